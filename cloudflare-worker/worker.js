@@ -231,6 +231,18 @@ export default {
     }
   },
 
+  // 计算请求签名：HMAC-SHA256(SIGNING_SECRET, "<Unix 时间戳>.<请求体>")
+  async signRequest(secret, body) {
+    const encoder = new TextEncoder();
+    const timestamp = Math.floor(Date.now() / 1000).toString();
+    const key = await crypto.subtle.importKey(
+      'raw', encoder.encode(secret), { name: 'HMAC', hash: 'SHA-256' }, false, ['sign']
+    );
+    const mac = await crypto.subtle.sign('HMAC', key, encoder.encode(timestamp + '.' + body));
+    const hex = Array.from(new Uint8Array(mac)).map(b => b.toString(16).padStart(2, '0')).join('');
+    return `t=${timestamp},v1=${hex}`;
+  },
+
   // 处理邮件
   async email(message, env, ctx) {
     console.log('=== Email Processing Started ===');
@@ -346,14 +358,19 @@ export default {
         headerCount: Object.keys(emailData.headers).length
       });
 
-      // 发送到Go API
+      // 发送到Go API，配置了 SIGNING_SECRET 时对请求体签名
+      const requestBody = JSON.stringify(emailData);
+      const headers = {
+        'Content-Type': 'application/json',
+        'Authorization': 'Bearer ' + env.API_TOKEN
+      };
+      if (env.SIGNING_SECRET) {
+        headers['X-MailCat-Signature'] = await this.signRequest(env.SIGNING_SECRET, requestBody);
+      }
       const response = await fetch(env.API_ENDPOINT + '/api/v1/emails', {
         method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-          'Authorization': 'Bearer ' + env.API_TOKEN
-        },
-        body: JSON.stringify(emailData)
+        headers: headers,
+        body: requestBody
       });
 
       if (!response.ok) {
@@ -376,4 +393,5 @@ export default {
 
 // 环境变量配置说明：
 // API_ENDPOINT: Go API服务器地址，例如 https://your-domain.com
-// API_TOKEN: API认证令牌，与config.yaml中的auth_token相同
\ No newline at end of file
+// API_TOKEN: API认证令牌，与config.yaml中的auth_token相同
+// SIGNING_SECRET: 可选，请求签名密钥，与config.yaml中的api.ingest_signing_secret相同
\ No newline at end of file
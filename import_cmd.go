@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"mailcat/internal/config"
+	"mailcat/internal/importer"
+	"mailcat/internal/ingest"
+	"mailcat/internal/spam"
+)
+
+// runImport 执行 import 子命令，返回进程退出码
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "import format: mbox, maildir or eml")
+	configPath := fs.String("config", "config/config.yaml", "path to config file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcat import --format mbox|maildir|eml [--config path] <path>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !importer.ValidFormat(*format) || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+
+	src, err := importer.PathSource(*format, path)
+	if err != nil {
+		log.Printf("Failed to open %s: %v", path, err)
+		return 1
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Printf("Failed to load config: %v", err)
+		return 1
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		log.Printf("%v", err)
+		return 1
+	}
+	defer db.Close()
+
+	spamFilter, err := spam.NewPipelineFromConfig(cfg.Spam)
+	if err != nil {
+		log.Printf("Failed to setup spam filter: %v", err)
+		return 1
+	}
+
+	imp := importer.New(db, ingest.New(db, spamFilter))
+	imp.Progress = func(report importer.Report) {
+		log.Printf("Processed %d messages: %d imported, %d duplicates, %d failed",
+			report.Total, report.Imported, report.Duplicates, report.Failed)
+	}
+
+	// Ctrl+C 时停止导入，已导入的邮件保留，重新运行会跳过重复邮件
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := imp.Run(ctx, src)
+	for _, itemErr := range report.Errors {
+		log.Printf("  %s: %s", itemErr.Source, itemErr.Error)
+	}
+	if report.ErrorsDropped > 0 {
+		log.Printf("  ... and %d more errors", report.ErrorsDropped)
+	}
+	if err != nil {
+		log.Printf("Import aborted: %v", err)
+		return 1
+	}
+
+	fmt.Printf("Imported %d of %d messages from %s (%d duplicates, %d failed)\n",
+		report.Imported, report.Total, path, report.Duplicates, report.Failed)
+	return 0
+}
@@ -0,0 +1,237 @@
+package analytics
+
+import (
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"mailcat/internal/models"
+)
+
+// 时间分桶粒度
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketMonth = "month"
+)
+
+// MaxBuckets 单次统计允许的最大分桶数
+const MaxBuckets = 2000
+
+// Options 统计参数，Since/Until 为左闭右开区间，分桶边界按 Location 计算
+type Options struct {
+	Since    time.Time
+	Until    time.Time
+	Bucket   string // 为空时按时间范围自动选择
+	Location *time.Location
+	Top      int // 排行榜的条目数
+}
+
+// Bucket 时间序列中的一个分桶
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Label string    `json:"label"` // 按配置时区格式化的分桶名称，如 2025-01-02
+	Count int       `json:"count"`
+	Spam  int       `json:"spam"`
+}
+
+// Entry 排行榜条目
+type Entry struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Report 统计结果
+type Report struct {
+	Timezone              string    `json:"timezone"`
+	Since                 time.Time `json:"since"`
+	Until                 time.Time `json:"until"`
+	Bucket                string    `json:"bucket"`
+	Series                []Bucket  `json:"series"`
+	Total                 int       `json:"total"`
+	Spam                  int       `json:"spam"`
+	SpamRatio             float64   `json:"spam_ratio"`
+	TotalSize             int64     `json:"total_size"`
+	AverageSize           int64     `json:"average_size"`
+	EmailsWithAttachments int       `json:"emails_with_attachments"`
+	AttachmentSize        int64     `json:"attachment_size"`
+	TopRecipients         []Entry   `json:"top_recipients"`
+	TopSenders            []Entry   `json:"top_senders"`
+	TopSenderDomains      []Entry   `json:"top_sender_domains"`
+}
+
+// Aggregator 逐条累计邮件统计，超出时间范围的邮件会被忽略
+type Aggregator struct {
+	opts       Options
+	report     *Report
+	recipients map[string]int
+	senders    map[string]int
+	domains    map[string]int
+}
+
+// New 校验参数并创建统计器，Bucket 为空时：两天以内按小时，约三个月以内按天，否则按月
+func New(opts Options) (*Aggregator, error) {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if !opts.Until.After(opts.Since) {
+		return nil, fmt.Errorf("until must be after since")
+	}
+	if opts.Top <= 0 {
+		opts.Top = 10
+	}
+	if opts.Bucket == "" {
+		switch span := opts.Until.Sub(opts.Since); {
+		case span <= 48*time.Hour:
+			opts.Bucket = BucketHour
+		case span <= 93*24*time.Hour:
+			opts.Bucket = BucketDay
+		default:
+			opts.Bucket = BucketMonth
+		}
+	}
+
+	series, err := buildSeries(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Aggregator{
+		opts: opts,
+		report: &Report{
+			Timezone: opts.Location.String(),
+			Since:    opts.Since.In(opts.Location),
+			Until:    opts.Until.In(opts.Location),
+			Bucket:   opts.Bucket,
+			Series:   series,
+		},
+		recipients: make(map[string]int),
+		senders:    make(map[string]int),
+		domains:    make(map[string]int),
+	}, nil
+}
+
+// buildSeries 按配置时区生成覆盖 [Since, Until) 的分桶，第一个分桶从 Since 所在的小时/日/月开始
+func buildSeries(opts Options) ([]Bucket, error) {
+	start := opts.Since.In(opts.Location)
+	var layout string
+	var next func(t time.Time) time.Time
+	switch opts.Bucket {
+	case BucketHour:
+		start = time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, opts.Location)
+		layout = "2006-01-02 15:00"
+		// 按绝对时间前进，夏令时切换时也不会重复或遗漏
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case BucketDay:
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, opts.Location)
+		layout = "2006-01-02"
+		next = func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, opts.Location)
+		}
+	case BucketMonth:
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, opts.Location)
+		layout = "2006-01"
+		next = func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, opts.Location)
+		}
+	default:
+		return nil, fmt.Errorf("bucket must be one of hour, day, month")
+	}
+
+	var series []Bucket
+	for t := start; t.Before(opts.Until); t = next(t) {
+		if len(series) >= MaxBuckets {
+			return nil, fmt.Errorf("time range too large for %s buckets (max %d)", opts.Bucket, MaxBuckets)
+		}
+		series = append(series, Bucket{Start: t, Label: t.Format(layout)})
+	}
+	return series, nil
+}
+
+// Add 累计一封邮件
+func (a *Aggregator) Add(stat models.EmailStat) {
+	if stat.ReceivedAt.Before(a.opts.Since) || !stat.ReceivedAt.Before(a.opts.Until) {
+		return
+	}
+	spam := stat.Folder == models.FolderSpam
+
+	// 分桶起点递增，取最后一个不晚于接收时间的分桶
+	series := a.report.Series
+	i := sort.Search(len(series), func(i int) bool { return series[i].Start.After(stat.ReceivedAt) }) - 1
+	if i >= 0 {
+		series[i].Count++
+		if spam {
+			series[i].Spam++
+		}
+	}
+
+	r := a.report
+	r.Total++
+	if spam {
+		r.Spam++
+	}
+	r.TotalSize += int64(stat.Size)
+	if stat.HasAttachments {
+		r.EmailsWithAttachments++
+		r.AttachmentSize += int64(stat.AttachmentSize)
+	}
+
+	for _, address := range parseAddresses(stat.To) {
+		a.recipients[address]++
+	}
+	for _, address := range parseAddresses(stat.From) {
+		a.senders[address]++
+		if at := strings.LastIndex(address, "@"); at >= 0 && at < len(address)-1 {
+			a.domains[address[at+1:]]++
+		}
+	}
+}
+
+// Report 返回统计结果
+func (a *Aggregator) Report() *Report {
+	r := a.report
+	if r.Total > 0 {
+		r.SpamRatio = float64(r.Spam) / float64(r.Total)
+		r.AverageSize = r.TotalSize / int64(r.Total)
+	}
+	r.TopRecipients = top(a.recipients, a.opts.Top)
+	r.TopSenders = top(a.senders, a.opts.Top)
+	r.TopSenderDomains = top(a.domains, a.opts.Top)
+	return r
+}
+
+// parseAddresses 解析地址列表并转为小写，无法解析时使用原始值
+func parseAddresses(value string) []string {
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+	result := make([]string, len(addresses))
+	for i, addr := range addresses {
+		result[i] = strings.ToLower(addr.Address)
+	}
+	return result
+}
+
+// top 按数量降序（相同时按名称）返回前 n 项
+func top(counts map[string]int, n int) []Entry {
+	entries := make([]Entry, 0, len(counts))
+	for name, count := range counts {
+		entries = append(entries, Entry{Name: name, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
@@ -0,0 +1,213 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // 测试不依赖系统时区数据库
+
+	"mailcat/internal/models"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// labels 返回分桶名称和各分桶的邮件数
+func labels(series []Bucket) (string, []int) {
+	names := make([]string, len(series))
+	counts := make([]int, len(series))
+	for i, b := range series {
+		names[i] = b.Label
+		counts[i] = b.Count
+	}
+	return strings.Join(names, ","), counts
+}
+
+func equalCounts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSeries(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	shanghai := loadLocation(t, "Asia/Shanghai")
+	at := func(loc *time.Location, year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		received []time.Time
+		labels   string
+		counts   []int
+	}{
+		{
+			// 2025-03-09 02:00 夏令时开始，当地时间跳过 02:00-03:00
+			name:     "hours across spring forward",
+			opts:     Options{Since: at(newYork, 2025, 3, 9, 0, 0), Until: at(newYork, 2025, 3, 9, 5, 0), Bucket: BucketHour, Location: newYork},
+			received: []time.Time{at(newYork, 2025, 3, 9, 1, 59), at(newYork, 2025, 3, 9, 3, 0)},
+			labels:   "2025-03-09 00:00,2025-03-09 01:00,2025-03-09 03:00,2025-03-09 04:00",
+			counts:   []int{0, 1, 1, 0},
+		},
+		{
+			// 2025-11-02 02:00 夏令时结束，当地时间 01:00-02:00 出现两次，分别计入两个分桶
+			name: "hours across fall back",
+			opts: Options{Since: at(newYork, 2025, 11, 2, 0, 0), Until: at(newYork, 2025, 11, 2, 3, 0), Bucket: BucketHour, Location: newYork},
+			received: []time.Time{
+				time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+				time.Date(2025, 11, 2, 6, 30, 0, 0, time.UTC), // 01:30 EST
+				time.Date(2025, 11, 2, 6, 45, 0, 0, time.UTC), // 01:45 EST
+			},
+			labels: "2025-11-02 00:00,2025-11-02 01:00,2025-11-02 01:00,2025-11-02 02:00",
+			counts: []int{0, 1, 2, 0},
+		},
+		{
+			// 夏令时开始的那天只有 23 小时，分桶仍然从当地午夜开始
+			name:     "days across spring forward",
+			opts:     Options{Since: at(newYork, 2025, 3, 8, 0, 0), Until: at(newYork, 2025, 3, 11, 0, 0), Bucket: BucketDay, Location: newYork},
+			received: []time.Time{at(newYork, 2025, 3, 9, 23, 30), at(newYork, 2025, 3, 10, 0, 0), time.Date(2025, 3, 10, 3, 59, 0, 0, time.UTC)},
+			labels:   "2025-03-08,2025-03-09,2025-03-10",
+			counts:   []int{0, 2, 1},
+		},
+		{
+			// 同一时刻在 UTC 是 1 月 31 日，在上海已是 2 月 1 日
+			name:     "months in the configured zone",
+			opts:     Options{Since: at(shanghai, 2024, 12, 1, 0, 0), Until: at(shanghai, 2025, 3, 1, 0, 0), Bucket: BucketMonth, Location: shanghai},
+			received: []time.Time{time.Date(2025, 1, 31, 15, 59, 0, 0, time.UTC), time.Date(2025, 1, 31, 16, 0, 0, 0, time.UTC)},
+			labels:   "2024-12,2025-01,2025-02",
+			counts:   []int{0, 1, 1},
+		},
+		{
+			// 从 1 月 31 日开始不会因为月份溢出跳过 2 月
+			name:     "months from the end of a month",
+			opts:     Options{Since: at(shanghai, 2025, 1, 31, 12, 0), Until: at(shanghai, 2025, 4, 1, 0, 0), Bucket: BucketMonth, Location: shanghai},
+			received: []time.Time{at(shanghai, 2025, 2, 28, 23, 59)},
+			labels:   "2025-01,2025-02,2025-03",
+			counts:   []int{0, 1, 0},
+		},
+		{
+			// 第一个分桶从 Since 所在的小时开始，但范围外的邮件不计入；Until 不包含在内
+			name: "range is half open",
+			opts: Options{Since: at(shanghai, 2025, 5, 1, 10, 30), Until: at(shanghai, 2025, 5, 1, 12, 30), Bucket: BucketHour, Location: shanghai},
+			received: []time.Time{
+				at(shanghai, 2025, 5, 1, 10, 15),
+				at(shanghai, 2025, 5, 1, 10, 30),
+				at(shanghai, 2025, 5, 1, 12, 29),
+				at(shanghai, 2025, 5, 1, 12, 30),
+			},
+			labels: "2025-05-01 10:00,2025-05-01 11:00,2025-05-01 12:00",
+			counts: []int{1, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		a, err := New(tt.opts)
+		if err != nil {
+			t.Errorf("%s: New error: %v", tt.name, err)
+			continue
+		}
+		for _, receivedAt := range tt.received {
+			a.Add(models.EmailStat{ReceivedAt: receivedAt})
+		}
+		report := a.Report()
+		gotLabels, gotCounts := labels(report.Series)
+		if gotLabels != tt.labels || !equalCounts(gotCounts, tt.counts) {
+			t.Errorf("%s: series = %s %v, want %s %v", tt.name, gotLabels, gotCounts, tt.labels, tt.counts)
+		}
+		total := 0
+		for _, c := range tt.counts {
+			total += c
+		}
+		if report.Total != total {
+			t.Errorf("%s: total = %d, want %d", tt.name, report.Total, total)
+		}
+	}
+}
+
+func TestNewBucketSelection(t *testing.T) {
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		span   time.Duration
+		bucket string
+	}{
+		{48 * time.Hour, BucketHour},
+		{49 * time.Hour, BucketDay},
+		{93 * 24 * time.Hour, BucketDay},
+		{94 * 24 * time.Hour, BucketMonth},
+	}
+	for _, tt := range tests {
+		a, err := New(Options{Since: since, Until: since.Add(tt.span), Location: time.UTC})
+		if err != nil {
+			t.Fatalf("New(%s) error: %v", tt.span, err)
+		}
+		if got := a.Report().Bucket; got != tt.bucket {
+			t.Errorf("span %s: bucket = %s, want %s", tt.span, got, tt.bucket)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"empty range", Options{Since: since, Until: since}},
+		{"reversed range", Options{Since: since, Until: since.Add(-time.Hour)}},
+		{"unknown bucket", Options{Since: since, Until: since.Add(time.Hour), Bucket: "week"}},
+		{"too many buckets", Options{Since: since, Until: since.Add(MaxBuckets * time.Hour).Add(time.Minute), Bucket: BucketHour, Location: time.UTC}},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.opts); err == nil {
+			t.Errorf("%s: New accepted invalid options", tt.name)
+		}
+	}
+	if _, err := New(Options{Since: since, Until: since.Add(MaxBuckets * time.Hour), Bucket: BucketHour, Location: time.UTC}); err != nil {
+		t.Errorf("New with exactly %d buckets: %v", MaxBuckets, err)
+	}
+}
+
+func TestReportTotals(t *testing.T) {
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, err := New(Options{Since: since, Until: since.AddDate(0, 0, 1), Location: time.UTC, Top: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stat := range []models.EmailStat{
+		{From: "Alice <ALICE@example.com>", To: "bob@example.com, carol@example.com", Size: 100},
+		{From: "alice@example.com", To: "bob@example.com", Size: 300, Folder: models.FolderSpam, HasAttachments: true, AttachmentSize: 250},
+		{From: "dave@other.org", To: "not an address", Size: 200},
+	} {
+		stat.ReceivedAt = since.Add(time.Hour)
+		a.Add(stat)
+	}
+	r := a.Report()
+	if r.Total != 3 || r.Spam != 1 || r.TotalSize != 600 || r.AverageSize != 200 || r.EmailsWithAttachments != 1 || r.AttachmentSize != 250 {
+		t.Errorf("totals = %+v", r)
+	}
+	if r.SpamRatio < 0.333 || r.SpamRatio > 0.334 {
+		t.Errorf("spam ratio = %v", r.SpamRatio)
+	}
+	if len(r.TopRecipients) != 2 || r.TopRecipients[0] != (Entry{"bob@example.com", 2}) || r.TopRecipients[1] != (Entry{"carol@example.com", 1}) {
+		t.Errorf("top recipients = %v", r.TopRecipients)
+	}
+	if len(r.TopSenders) != 2 || r.TopSenders[0] != (Entry{"alice@example.com", 2}) {
+		t.Errorf("top senders = %v", r.TopSenders)
+	}
+	if len(r.TopSenderDomains) != 2 || r.TopSenderDomains[0] != (Entry{"example.com", 2}) || r.TopSenderDomains[1] != (Entry{"other.org", 1}) {
+		t.Errorf("top sender domains = %v", r.TopSenderDomains)
+	}
+}
@@ -0,0 +1,254 @@
+package apikeys
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+	"mailcat/internal/settings"
+)
+
+const (
+	// keyPrefix 生成的密钥都以此开头，便于在日志和代码仓库中识别泄露的密钥
+	keyPrefix = "mc_"
+	// displayPrefixLength 列表中显示的密钥开头长度
+	displayPrefixLength = len(keyPrefix) + 8
+	// touchInterval 同一密钥从同一 IP 访问时，最近使用时间的最小写入间隔
+	touchInterval = time.Minute
+	// maxNameLength 密钥名称的最大长度（字符数）
+	maxNameLength = 100
+)
+
+// 认证失败的原因，ErrIPNotAllowed 和 ErrScope 对应 403，其余对应 401
+var (
+	ErrInvalidKey   = errors.New("invalid api key")
+	ErrExpired      = errors.New("api key has expired")
+	ErrRevoked      = errors.New("api key has been revoked")
+	ErrIPNotAllowed = errors.New("client ip is not allowed for this api key")
+	ErrScope        = errors.New("api key does not have the required scope")
+	ErrQueryToken   = errors.New("api key must be sent in the Authorization header")
+)
+
+// legacyScopes 配置文件中的 api_token 所具有的权限，与引入密钥之前的 /api/v1 权限一致
+var legacyScopes = []string{models.ScopeEmailsWrite, models.ScopeEmailsRead, models.ScopeEmailsDelete}
+
+// Manager 管理命名的 API 密钥，并兼容运行时设置中的 api_token
+type Manager struct {
+	db       *database.DB
+	settings *settings.Store
+
+	mu      sync.Mutex
+	touched map[int]touch // 最近一次写入数据库的使用记录
+}
+
+type touch struct {
+	at time.Time
+	ip string
+}
+
+// NewManager 创建 API 密钥管理器
+func NewManager(db *database.DB, store *settings.Store) *Manager {
+	return &Manager{db: db, settings: store, touched: make(map[int]touch)}
+}
+
+// Authenticate 校验令牌并返回对应的密钥，同时检查有效期、吊销状态、IP 白名单和权限范围。
+// 运行时设置中的 api_token 作为 ID 为 0 的密钥返回，不具有 admin 权限
+func (m *Manager) Authenticate(token, ip, scope string) (*models.APIKey, error) {
+	if token == "" {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := m.db.GetAPIKeyByHash(hashKey(token))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		legacy := m.settings.Get().APIToken
+		if legacy == "" || !hmac.Equal([]byte(token), []byte(legacy)) {
+			return nil, ErrInvalidKey
+		}
+		key = &models.APIKey{Name: settings.KeyAPIToken, Scopes: legacyScopes}
+	} else {
+		now := time.Now()
+		switch {
+		case key.RevokedAt != nil:
+			return nil, ErrRevoked
+		case key.ExpiresAt != nil && now.After(*key.ExpiresAt):
+			return nil, ErrExpired
+		case !ipAllowed(key.AllowedIPs, ip):
+			return nil, ErrIPNotAllowed
+		}
+		m.touch(key.ID, ip, now)
+	}
+
+	if scope != "" && !key.HasScope(scope) {
+		return nil, ErrScope
+	}
+	return key, nil
+}
+
+// AuthenticateQuery 校验通过 URL 参数 ?token= 传递的令牌，只接受创建时允许这样使用的只读密钥；
+// 运行时设置中的 api_token 具有写权限，不能通过 URL 传递
+func (m *Manager) AuthenticateQuery(token, ip, scope string) (*models.APIKey, error) {
+	key, err := m.Authenticate(token, ip, scope)
+	if err != nil {
+		return nil, err
+	}
+	if !key.AllowQueryToken {
+		return nil, ErrQueryToken
+	}
+	return key, nil
+}
+
+// touch 记录密钥的使用情况，同一 IP 在 touchInterval 内只写入一次
+func (m *Manager) touch(id int, ip string, now time.Time) {
+	m.mu.Lock()
+	last, ok := m.touched[id]
+	if ok && last.ip == ip && now.Sub(last.at) < touchInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.touched[id] = touch{at: now, ip: ip}
+	m.mu.Unlock()
+
+	if err := m.db.TouchAPIKey(id, ip, now); err != nil {
+		log.Printf("Failed to record api key usage: %v", err)
+	}
+}
+
+// Create 校验请求并创建密钥，返回的明文密钥只在此时可见
+func (m *Manager) Create(req models.CreateAPIKeyRequest) (*models.APIKey, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return nil, "", fmt.Errorf("name must be between 1 and %d characters", maxNameLength)
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	allowedIPs, err := normalizeIPs(req.AllowedIPs)
+	if err != nil {
+		return nil, "", err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("expires_at must be in the future")
+	}
+	// URL 会出现在访问日志和代理日志中，只有只读密钥可以放在 URL 里
+	if req.AllowQueryToken && (len(scopes) != 1 || scopes[0] != models.ScopeEmailsRead) {
+		return nil, "", fmt.Errorf("allow_query_token requires the %s scope only", models.ScopeEmailsRead)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	plaintext := keyPrefix + hex.EncodeToString(buf)
+
+	key := &models.APIKey{
+		Name:            name,
+		Prefix:          plaintext[:displayPrefixLength],
+		Scopes:          scopes,
+		AllowedIPs:      allowedIPs,
+		ExpiresAt:       req.ExpiresAt,
+		AllowQueryToken: req.AllowQueryToken,
+	}
+	if err := m.db.CreateAPIKey(key, hashKey(plaintext)); err != nil {
+		return nil, "", err
+	}
+	return key, plaintext, nil
+}
+
+// List 返回所有密钥，不包含明文
+func (m *Manager) List() ([]models.APIKey, error) {
+	return m.db.ListAPIKeys()
+}
+
+// Revoke 吊销密钥，立即生效
+func (m *Manager) Revoke(id int) (bool, error) {
+	return m.db.RevokeAPIKey(id)
+}
+
+// hashKey 计算密钥的哈希。密钥为 256 位随机数，无需慢哈希
+func hashKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		valid := false
+		for _, s := range models.Scopes {
+			if scope == s {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(models.Scopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return result, nil
+}
+
+// normalizeIPs 校验 IP 白名单，条目可以是 IP 或 CIDR
+func normalizeIPs(entries []string) ([]string, error) {
+	result := []string{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", entry)
+			}
+			result = append(result, network.String())
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", entry)
+		}
+		result = append(result, ip.String())
+	}
+	return result, nil
+}
+
+// ipAllowed 判断 IP 是否在白名单中，白名单为空时不限制
+func ipAllowed(allowed []string, ip string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	client := net.ParseIP(ip)
+	if client == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(client) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(client) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package apikeys
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"mailcat/internal/config"
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+	"mailcat/internal/settings"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{}
+	cfg.API.AuthToken = "api-token"
+	cfg.Admin.Password = "password"
+	store, err := settings.Load(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(db, store)
+}
+
+// insertKey 直接写入数据库，绕过 Create 的校验，用于构造已过期的密钥
+func insertKey(t *testing.T, m *Manager, token string, key *models.APIKey) *models.APIKey {
+	t.Helper()
+	key.Prefix = token[:displayPrefixLength]
+	if err := m.db.CreateAPIKey(key, hashKey(token)); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAuthenticate(t *testing.T) {
+	m := newTestManager(t)
+
+	_, readToken, err := m.Create(models.CreateAPIKeyRequest{Name: "reader", Scopes: []string{models.ScopeEmailsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, adminToken, err := m.Create(models.CreateAPIKeyRequest{Name: "admin", Scopes: []string{models.ScopeAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, v4Token, err := m.Create(models.CreateAPIKeyRequest{Name: "v4", Scopes: []string{models.ScopeEmailsRead}, AllowedIPs: []string{"192.0.2.0/24", "198.51.100.7"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, v6Token, err := m.Create(models.CreateAPIKeyRequest{Name: "v6", Scopes: []string{models.ScopeEmailsRead}, AllowedIPs: []string{"2001:db8::/32"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedToken, err := m.Create(models.CreateAPIKeyRequest{Name: "revoked", Scopes: []string{models.ScopeEmailsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := m.Revoke(revoked.ID); err != nil || !ok {
+		t.Fatalf("Revoke() = %v, %v", ok, err)
+	}
+	expiredToken := keyPrefix + "expired0000000000000000000000000000000000000000000000000000000000"
+	past := time.Now().Add(-time.Hour)
+	insertKey(t, m, expiredToken, &models.APIKey{Name: "expired", Scopes: []string{models.ScopeEmailsRead}, ExpiresAt: &past})
+
+	tests := []struct {
+		name    string
+		token   string
+		ip      string
+		scope   string
+		wantErr error
+	}{
+		{"valid", readToken, "203.0.113.1", models.ScopeEmailsRead, nil},
+		{"no scope required", readToken, "203.0.113.1", "", nil},
+		{"scope mismatch", readToken, "203.0.113.1", models.ScopeEmailsWrite, ErrScope},
+		{"admin has every scope", adminToken, "203.0.113.1", models.ScopeEmailsDelete, nil},
+		{"empty token", "", "203.0.113.1", models.ScopeEmailsRead, ErrInvalidKey},
+		{"unknown token", keyPrefix + "unknown", "203.0.113.1", models.ScopeEmailsRead, ErrInvalidKey},
+		{"revoked", revokedToken, "203.0.113.1", models.ScopeEmailsRead, ErrRevoked},
+		{"expired", expiredToken, "203.0.113.1", models.ScopeEmailsRead, ErrExpired},
+		{"ipv4 cidr match", v4Token, "192.0.2.200", models.ScopeEmailsRead, nil},
+		{"ipv4 exact match", v4Token, "198.51.100.7", models.ScopeEmailsRead, nil},
+		{"ipv4 outside", v4Token, "198.51.100.8", models.ScopeEmailsRead, ErrIPNotAllowed},
+		{"ipv4 key from ipv6", v4Token, "2001:db8::1", models.ScopeEmailsRead, ErrIPNotAllowed},
+		{"ipv6 cidr match", v6Token, "2001:db8:1::5", models.ScopeEmailsRead, nil},
+		{"ipv6 outside", v6Token, "2001:db9::1", models.ScopeEmailsRead, ErrIPNotAllowed},
+		{"unparseable client ip", v6Token, "unknown", models.ScopeEmailsRead, ErrIPNotAllowed},
+		{"legacy token read", "api-token", "203.0.113.1", models.ScopeEmailsRead, nil},
+		{"legacy token write", "api-token", "203.0.113.1", models.ScopeEmailsWrite, nil},
+		{"legacy token delete", "api-token", "203.0.113.1", models.ScopeEmailsDelete, nil},
+		{"legacy token admin", "api-token", "203.0.113.1", models.ScopeAdmin, ErrScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := m.Authenticate(tt.token, tt.ip, tt.scope)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && key == nil {
+				t.Fatal("Authenticate() returned no key")
+			}
+		})
+	}
+}
+
+func TestAuthenticateLegacyKey(t *testing.T) {
+	m := newTestManager(t)
+	key, err := m.Authenticate("api-token", "203.0.113.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != 0 || key.Name != settings.KeyAPIToken {
+		t.Errorf("legacy key = %d %q, want 0 %q", key.ID, key.Name, settings.KeyAPIToken)
+	}
+	if !reflect.DeepEqual(key.Scopes, legacyScopes) {
+		t.Errorf("legacy scopes = %v, want %v", key.Scopes, legacyScopes)
+	}
+	// 配置的令牌不能通过 URL 传递
+	if _, err := m.AuthenticateQuery("api-token", "203.0.113.1", models.ScopeEmailsRead); !errors.Is(err, ErrQueryToken) {
+		t.Errorf("AuthenticateQuery(legacy) error = %v, want %v", err, ErrQueryToken)
+	}
+}
+
+func TestAuthenticateRecordsUsage(t *testing.T) {
+	m := newTestManager(t)
+	created, token, err := m.Create(models.CreateAPIKeyRequest{Name: "reader", Scopes: []string{models.ScopeEmailsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(token, "192.0.2.9", models.ScopeEmailsRead); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != created.ID {
+		t.Fatalf("List() = %+v", keys)
+	}
+	if keys[0].LastUsedAt == nil || keys[0].LastUsedIP != "192.0.2.9" {
+		t.Errorf("usage = %v %q, want recorded for 192.0.2.9", keys[0].LastUsedAt, keys[0].LastUsedIP)
+	}
+}
+
+func TestNormalizeIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", nil, []string{}, false},
+		{"ipv4", []string{" 192.0.2.1 "}, []string{"192.0.2.1"}, false},
+		{"ipv4 cidr is masked", []string{"192.0.2.77/24"}, []string{"192.0.2.0/24"}, false},
+		{"ipv6 is canonical", []string{"2001:DB8:0:0::1"}, []string{"2001:db8::1"}, false},
+		{"ipv6 cidr", []string{"2001:db8::1/32"}, []string{"2001:db8::/32"}, false},
+		{"bad prefix length", []string{"192.0.2.0/33"}, nil, true},
+		{"bad cidr address", []string{"192.0.2/24"}, nil, true},
+		{"bad ipv6 cidr", []string{"2001:db8::/129"}, nil, true},
+		{"hostname", []string{"example.com"}, nil, true},
+		{"empty entry", []string{""}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeIPs(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeIPs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	m := newTestManager(t)
+	past := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name string
+		req  models.CreateAPIKeyRequest
+	}{
+		{"empty name", models.CreateAPIKeyRequest{Name: " ", Scopes: []string{models.ScopeEmailsRead}}},
+		{"no scopes", models.CreateAPIKeyRequest{Name: "k"}},
+		{"unknown scope", models.CreateAPIKeyRequest{Name: "k", Scopes: []string{"emails:everything"}}},
+		{"malformed cidr", models.CreateAPIKeyRequest{Name: "k", Scopes: []string{models.ScopeEmailsRead}, AllowedIPs: []string{"10.0.0.0/40"}}},
+		{"expired", models.CreateAPIKeyRequest{Name: "k", Scopes: []string{models.ScopeEmailsRead}, ExpiresAt: &past}},
+		{"query token with write scope", models.CreateAPIKeyRequest{Name: "k", Scopes: []string{models.ScopeEmailsRead, models.ScopeEmailsWrite}, AllowQueryToken: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := m.Create(tt.req); err == nil {
+				t.Error("Create() succeeded, want error")
+			}
+		})
+	}
+	keys, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("rejected requests created %d keys", len(keys))
+	}
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+)
+
+// pruneInterval 删除过期审计日志的间隔
+const pruneInterval = time.Hour
+
+// Logger 审计日志写入数据库，配置了文件时同时以 JSON Lines 格式追加写入文件，便于转发到日志系统
+type Logger struct {
+	db *database.DB
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// New 创建审计日志，path 非空时以追加方式打开（不存在时创建）该文件
+func New(db *database.DB, path string) (*Logger, error) {
+	l := &Logger{db: db}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log file: %w", err)
+		}
+		l.file = file
+	}
+	return l, nil
+}
+
+// Record 写入一条审计日志，CreatedAt 为零值时使用当前时间。
+// 写入失败只记录到服务日志，不影响请求本身
+func (l *Logger) Record(entry models.AuditEntry) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	if err := l.db.InsertAuditEntry(&entry); err != nil {
+		log.Printf("Failed to record audit entry %s: %v", entry.Action, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode audit entry %s: %v", entry.Action, err)
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit log file: %v", err)
+	}
+}
+
+// List 按条件筛选审计日志
+func (l *Logger) List(query models.AuditQuery) (*models.AuditList, error) {
+	entries, total, err := l.db.ListAuditEntries(query)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuditList{
+		Entries: entries,
+		Total:   total,
+		Page:    query.Page,
+		Limit:   query.Limit,
+	}, nil
+}
+
+// Prune 定期删除超过保留天数的审计日志（不影响已写入文件的记录），直到 ctx 被取消。
+// 保留天数每次清理时读取，运行时修改后下一次清理生效
+func (l *Logger) Prune(ctx context.Context, retentionDays func() int) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		cutoff := time.Now().AddDate(0, 0, -retentionDays())
+		if deleted, err := l.db.DeleteAuditEntriesBefore(cutoff); err != nil {
+			log.Printf("Failed to prune audit log: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Pruned %d audit entries older than %s", deleted, cutoff.Format(time.RFC3339))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close 关闭审计日志文件
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+)
+
+func newTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRecordWritesFile(t *testing.T) {
+	db := newTestDB(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, err := New(db, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Record(models.AuditEntry{Action: "login", Actor: "alice", Status: 200, Success: true})
+	logger.Record(models.AuditEntry{Action: "logout", Actor: "alice", Status: 200, Success: true})
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 关闭文件后仍写入数据库
+	logger.Record(models.AuditEntry{Action: "login", Actor: "bob", Status: 401})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("file has %d lines, want 2:\n%s", len(lines), data)
+	}
+	var entry models.AuditEntry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Action != "logout" || entry.CreatedAt.IsZero() {
+		t.Errorf("file entry = %+v", entry)
+	}
+
+	list, err := logger.List(models.AuditQuery{Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 3 || list.Entries[0].Actor != "bob" {
+		t.Errorf("List() = %d entries, first %+v", list.Total, list.Entries[0])
+	}
+}
+
+func TestPrune(t *testing.T) {
+	db := newTestDB(t)
+	logger, err := New(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	for _, age := range []time.Duration{0, 6 * 24 * time.Hour, 8 * 24 * time.Hour, 90 * 24 * time.Hour} {
+		logger.Record(models.AuditEntry{Action: "login", CreatedAt: now.Add(-age)})
+	}
+
+	// 已取消的 ctx 只执行一次清理
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	logger.Prune(ctx, func() int { return 7 })
+
+	list, err := logger.List(models.AuditQuery{Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 2 {
+		t.Fatalf("%d entries left after pruning, want 2", list.Total)
+	}
+	for _, entry := range list.Entries {
+		if now.Sub(entry.CreatedAt) > 7*24*time.Hour {
+			t.Errorf("entry from %v was not pruned", entry.CreatedAt)
+		}
+	}
+}
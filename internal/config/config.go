@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 )
@@ -12,11 +15,30 @@ type Config struct {
 	Database DatabaseConfig `yaml:"database"`
 	API      APIConfig      `yaml:"api"`
 	Admin    AdminConfig    `yaml:"admin"`
+	Spam      SpamConfig      `yaml:"spam"`
+	Sanitizer  SanitizerConfig  `yaml:"sanitizer"`
+	ImageProxy ImageProxyConfig `yaml:"image_proxy"`
+	Import     ImportConfig     `yaml:"import"`
+	IMAP       IMAPConfig       `yaml:"imap"`
+	POP3       POP3Config       `yaml:"pop3"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Health     HealthConfig     `yaml:"health"`
+	OIDC       OIDCConfig       `yaml:"oidc"`
+	Audit      AuditConfig      `yaml:"audit"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit"`
 }
 
 type ServerConfig struct {
-	Port string `yaml:"port"`
-	Host string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Host     string `yaml:"host"`
+	Timezone string `yaml:"timezone"` // 统计按该时区计算日期，IANA 名称（如 Asia/Shanghai），默认使用系统时区
+
+	// HTTP 超时（秒）：读取整个请求、写出响应、keep-alive 空闲连接
+	ReadTimeoutSeconds  int `yaml:"read_timeout_seconds"`
+	WriteTimeoutSeconds int `yaml:"write_timeout_seconds"`
+	IdleTimeoutSeconds  int `yaml:"idle_timeout_seconds"`
+	// ShutdownTimeoutSeconds 收到 SIGINT/SIGTERM 后等待进行中请求完成的最长时间
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`
 }
 
 type DatabaseConfig struct {
@@ -25,12 +47,155 @@ type DatabaseConfig struct {
 
 type APIConfig struct {
 	AuthToken string `yaml:"auth_token"`
+	// IngestSigningSecret 非空时 POST /api/v1/emails 除 API 密钥外还必须携带 X-MailCat-Signature 签名
+	IngestSigningSecret string `yaml:"ingest_signing_secret"`
+	// InlineURLSecret 内嵌图片签名地址的密钥，为空时自动生成并保存在数据库中；多个实例使用各自的数据库时需要配置为相同的值
+	InlineURLSecret string `yaml:"inline_url_secret"`
 }
 
 type AdminConfig struct {
+	Password    string `yaml:"password"`
+	RequireTOTP bool   `yaml:"require_totp"` // 所有管理后台用户都必须启用 TOTP，可在运行时设置中修改
+}
+
+// SpamConfig 垃圾邮件评分配置
+type SpamConfig struct {
+	Enabled              bool               `yaml:"enabled"`
+	Threshold            float64            `yaml:"threshold"`              // 超过该分数的邮件进入垃圾邮件文件夹
+	URLBlocklistFiles    []string           `yaml:"url_blocklist_files"`    // URL/域名黑名单文件，每行一条
+	SuspiciousExtensions []string           `yaml:"suspicious_extensions"`  // 为空时使用内置列表
+	TimeoutSeconds       int                `yaml:"timeout_seconds"`        // 外部扫描器超时时间
+	Rspamd               RspamdConfig       `yaml:"rspamd"`
+	SpamAssassin         SpamAssassinConfig `yaml:"spamassassin"`
+}
+
+// SanitizerConfig 服务端 HTML 清理配置
+type SanitizerConfig struct {
+	RemoteImages  string `yaml:"remote_images"`   // allow / block / proxy
+	ImageProxyURL string `yaml:"image_proxy_url"` // proxy 模式下的图片代理地址
+}
+
+// ImageProxyConfig 远程图片代理配置
+type ImageProxyConfig struct {
+	Enabled              bool  `yaml:"enabled"`
+	MaxBytes             int64 `yaml:"max_bytes"`
+	TimeoutSeconds       int   `yaml:"timeout_seconds"`
+	CacheEntries         int   `yaml:"cache_entries"`
+	CacheTTLSeconds      int   `yaml:"cache_ttl_seconds"`
+	AllowPrivateNetworks bool  `yaml:"allow_private_networks"`
+}
+
+// ImportConfig 历史邮件导入配置
+type ImportConfig struct {
+	MaxUploadMB int64 `yaml:"max_upload_mb"` // 管理后台上传文件的大小上限
+}
+
+// IMAPConfig 只读 IMAP 服务配置
+type IMAPConfig struct {
+	Enabled           bool                `yaml:"enabled"`
+	Address           string              `yaml:"address"`
+	TLSCertFile       string              `yaml:"tls_cert_file"`       // 配置证书后支持 STARTTLS
+	TLSKeyFile        string              `yaml:"tls_key_file"`
+	ImplicitTLS       bool                `yaml:"implicit_tls"`        // 连接建立即使用 TLS（993 端口），否则使用 STARTTLS
+	AllowInsecureAuth bool                `yaml:"allow_insecure_auth"` // 配置了 TLS 时仍允许未加密连接登录
+	Mailboxes         []IMAPMailboxConfig `yaml:"mailboxes"`           // 为空时按收件人地址自动生成邮箱
+}
+
+// IMAPMailboxConfig IMAP 邮箱：收件人中有地址与 Address 匹配的邮件属于该邮箱（规则同 models.MatchMailbox）
+type IMAPMailboxConfig struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"` // 例如 alice@example.com，或 @example.com 匹配整个域名
+	Token   string `yaml:"token"`   // 以邮箱名为用户名、该令牌为密码登录时只能访问此邮箱
+}
+
+// POP3Config POP3 服务配置，账户与 imap.mailboxes 共用
+type POP3Config struct {
+	Enabled           bool   `yaml:"enabled"`
+	Address           string `yaml:"address"`
+	TLSCertFile       string `yaml:"tls_cert_file"`       // 配置证书后支持 STLS
+	TLSKeyFile        string `yaml:"tls_key_file"`
+	ImplicitTLS       bool   `yaml:"implicit_tls"`        // 连接建立即使用 TLS（995 端口），否则使用 STLS
+	AllowInsecureAuth bool   `yaml:"allow_insecure_auth"` // 配置了 TLS 时仍允许未加密连接登录
+}
+
+// MetricsConfig Prometheus 指标端点配置
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Token   string `yaml:"token"` // 非空时抓取需要 Authorization: Bearer <token>，与 API 令牌相互独立
+}
+
+// HealthConfig 就绪检查配置
+type HealthConfig struct {
+	MinFreeDiskMB int64 `yaml:"min_free_disk_mb"` // 数据库所在磁盘的可用空间低于该值时 /health/ready 返回 503
+}
+
+// OIDCConfig 管理后台的 OIDC 单点登录（授权码模式 + PKCE）
+type OIDCConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	Issuer        string            `yaml:"issuer"` // 发现文档位于 issuer + /.well-known/openid-configuration
+	ClientID      string            `yaml:"client_id"`
+	ClientSecret  string            `yaml:"client_secret"`  // 为空时作为公开客户端
+	RedirectURL   string            `yaml:"redirect_url"`   // 例如 https://mail.example.com/admin/oidc/callback
+	Scopes        []string          `yaml:"scopes"`         // 默认 openid profile email
+	UsernameClaim string            `yaml:"username_claim"` // 默认 preferred_username，为空时依次使用 email 和 sub
+	RoleClaim     string            `yaml:"role_claim"`     // 用于映射角色的声明，支持 . 访问嵌套对象，默认 groups
+	RoleMappings  []OIDCRoleMapping `yaml:"role_mappings"`  // 按顺序匹配，第一个匹配的映射决定角色
+}
+
+// OIDCRoleMapping 声明值到角色的映射
+type OIDCRoleMapping struct {
+	Value     string   `yaml:"value"` // 声明中的值（字符串或数组中的一项），* 匹配所有用户
+	Role      string   `yaml:"role"`
+	Mailboxes []string `yaml:"mailboxes"` // viewer 可见的收件人地址
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	RetentionDays int    `yaml:"retention_days"` // 审计日志保留天数，默认 90，可在运行时设置中修改
+	File          string `yaml:"file"`           // 非空时同时以 JSON Lines 格式追加写入该文件
+}
+
+// RateLimitConfig 公开 API 的令牌桶限流配置
+type RateLimitConfig struct {
+	Enabled bool                 `yaml:"enabled"`
+	Backend string               `yaml:"backend"` // memory（默认）或 redis，多实例部署时使用 redis 共享状态
+	Redis   RateLimitRedisConfig `yaml:"redis"`
+	Ingest  RateLimitGroup       `yaml:"ingest"` // POST /api/v1/emails
+	Read    RateLimitGroup       `yaml:"read"`   // 查询、导出、内联资源
+	Write   RateLimitGroup       `yaml:"write"`  // 修改状态、删除
+}
+
+// RateLimitRedisConfig 限流使用的 Redis
+type RateLimitRedisConfig struct {
+	Address   string `yaml:"address"` // 默认 127.0.0.1:6379
+	Password  string `yaml:"password"`
+	DB        int    `yaml:"db"`
+	KeyPrefix string `yaml:"key_prefix"` // 默认 mailcat:ratelimit:
+}
+
+// RateLimitGroup 一组路由的限流规则，按 API 密钥和客户端 IP 分别计数
+type RateLimitGroup struct {
+	PerKey RateLimitRule `yaml:"per_key"`
+	PerIP  RateLimitRule `yaml:"per_ip"`
+}
+
+// RateLimitRule 令牌桶规则
+type RateLimitRule struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"` // 为 0 时使用默认值，小于 0 时不限制
+	Burst             int `yaml:"burst"`               // 桶容量，默认等于 requests_per_minute
+}
+
+// RspamdConfig rspamd 控制器配置（HTTP /checkv2 协议）
+type RspamdConfig struct {
+	URL      string `yaml:"url"`
 	Password string `yaml:"password"`
 }
 
+// SpamAssassinConfig spamd 配置（SPAMC 协议）
+type SpamAssassinConfig struct {
+	Address string `yaml:"address"`
+}
+
 func LoadConfig(configPath string) (*Config, error) {
 	data, err := ioutil.ReadFile(configPath)
 	if err != nil {
@@ -45,6 +210,8 @@ func LoadConfig(configPath string) (*Config, error) {
 	// 使用环境变量覆盖配置
 	overrideWithEnvVars(&config)
 
+	applyDefaults(&config)
+
 	// 验证必需的配置
 	if err := validateConfig(&config); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
@@ -62,6 +229,24 @@ func overrideWithEnvVars(config *Config) {
 	if host := os.Getenv("MAILCAT_SERVER_HOST"); host != "" {
 		config.Server.Host = host
 	}
+	if timezone := os.Getenv("MAILCAT_TIMEZONE"); timezone != "" {
+		config.Server.Timezone = timezone
+	}
+	for _, timeout := range []struct {
+		env  string
+		dest *int
+	}{
+		{"MAILCAT_SERVER_READ_TIMEOUT", &config.Server.ReadTimeoutSeconds},
+		{"MAILCAT_SERVER_WRITE_TIMEOUT", &config.Server.WriteTimeoutSeconds},
+		{"MAILCAT_SERVER_IDLE_TIMEOUT", &config.Server.IdleTimeoutSeconds},
+		{"MAILCAT_SHUTDOWN_TIMEOUT", &config.Server.ShutdownTimeoutSeconds},
+	} {
+		if value := os.Getenv(timeout.env); value != "" {
+			if n, err := strconv.Atoi(value); err == nil {
+				*timeout.dest = n
+			}
+		}
+	}
 
 	// 数据库配置
 	if dbPath := os.Getenv("MAILCAT_DATABASE_PATH"); dbPath != "" {
@@ -72,11 +257,217 @@ func overrideWithEnvVars(config *Config) {
 	if authToken := os.Getenv("MAILCAT_API_AUTH_TOKEN"); authToken != "" {
 		config.API.AuthToken = authToken
 	}
+	if secret := os.Getenv("MAILCAT_API_INLINE_URL_SECRET"); secret != "" {
+		config.API.InlineURLSecret = secret
+	}
+	if secret := os.Getenv("MAILCAT_API_INGEST_SIGNING_SECRET"); secret != "" {
+		config.API.IngestSigningSecret = secret
+	}
 
 	// 管理员配置 - 必须通过环境变量设置
 	if adminPassword := os.Getenv("MAILCAT_ADMIN_PASSWORD"); adminPassword != "" {
 		config.Admin.Password = adminPassword
 	}
+	if requireTOTP := os.Getenv("MAILCAT_ADMIN_REQUIRE_TOTP"); requireTOTP != "" {
+		config.Admin.RequireTOTP = requireTOTP == "true" || requireTOTP == "1"
+	}
+
+	// 垃圾邮件配置
+	if enabled := os.Getenv("MAILCAT_SPAM_ENABLED"); enabled != "" {
+		config.Spam.Enabled = enabled == "true" || enabled == "1"
+	}
+	if threshold := os.Getenv("MAILCAT_SPAM_THRESHOLD"); threshold != "" {
+		if v, err := strconv.ParseFloat(threshold, 64); err == nil {
+			config.Spam.Threshold = v
+		}
+	}
+	if rspamdURL := os.Getenv("MAILCAT_SPAM_RSPAMD_URL"); rspamdURL != "" {
+		config.Spam.Rspamd.URL = rspamdURL
+	}
+	if spamdAddr := os.Getenv("MAILCAT_SPAM_SPAMASSASSIN_ADDRESS"); spamdAddr != "" {
+		config.Spam.SpamAssassin.Address = spamdAddr
+	}
+
+	// HTML 清理配置
+	if remoteImages := os.Getenv("MAILCAT_SANITIZER_REMOTE_IMAGES"); remoteImages != "" {
+		config.Sanitizer.RemoteImages = remoteImages
+	}
+
+	// 图片代理配置
+	if enabled := os.Getenv("MAILCAT_IMAGE_PROXY_ENABLED"); enabled != "" {
+		config.ImageProxy.Enabled = enabled == "true" || enabled == "1"
+	}
+
+	// IMAP 配置
+	if enabled := os.Getenv("MAILCAT_IMAP_ENABLED"); enabled != "" {
+		config.IMAP.Enabled = enabled == "true" || enabled == "1"
+	}
+	if address := os.Getenv("MAILCAT_IMAP_ADDRESS"); address != "" {
+		config.IMAP.Address = address
+	}
+
+	// POP3 配置
+	if enabled := os.Getenv("MAILCAT_POP3_ENABLED"); enabled != "" {
+		config.POP3.Enabled = enabled == "true" || enabled == "1"
+	}
+	if address := os.Getenv("MAILCAT_POP3_ADDRESS"); address != "" {
+		config.POP3.Address = address
+	}
+
+	// 指标端点配置
+	if enabled := os.Getenv("MAILCAT_METRICS_ENABLED"); enabled != "" {
+		config.Metrics.Enabled = enabled == "true" || enabled == "1"
+	}
+	if token := os.Getenv("MAILCAT_METRICS_TOKEN"); token != "" {
+		config.Metrics.Token = token
+	}
+
+	// 导入配置
+	if maxUpload := os.Getenv("MAILCAT_IMPORT_MAX_UPLOAD_MB"); maxUpload != "" {
+		if n, err := strconv.ParseInt(maxUpload, 10, 64); err == nil {
+			config.Import.MaxUploadMB = n
+		}
+	}
+
+	// OIDC 单点登录配置
+	if enabled := os.Getenv("MAILCAT_OIDC_ENABLED"); enabled != "" {
+		config.OIDC.Enabled = enabled == "true" || enabled == "1"
+	}
+	if issuer := os.Getenv("MAILCAT_OIDC_ISSUER"); issuer != "" {
+		config.OIDC.Issuer = issuer
+	}
+	if clientID := os.Getenv("MAILCAT_OIDC_CLIENT_ID"); clientID != "" {
+		config.OIDC.ClientID = clientID
+	}
+	if clientSecret := os.Getenv("MAILCAT_OIDC_CLIENT_SECRET"); clientSecret != "" {
+		config.OIDC.ClientSecret = clientSecret
+	}
+	if redirectURL := os.Getenv("MAILCAT_OIDC_REDIRECT_URL"); redirectURL != "" {
+		config.OIDC.RedirectURL = redirectURL
+	}
+
+	// 审计日志配置
+	if retention := os.Getenv("MAILCAT_AUDIT_RETENTION_DAYS"); retention != "" {
+		if n, err := strconv.Atoi(retention); err == nil {
+			config.Audit.RetentionDays = n
+		}
+	}
+	if file := os.Getenv("MAILCAT_AUDIT_FILE"); file != "" {
+		config.Audit.File = file
+	}
+
+	// 限流配置
+	if enabled := os.Getenv("MAILCAT_RATE_LIMIT_ENABLED"); enabled != "" {
+		config.RateLimit.Enabled = enabled == "true" || enabled == "1"
+	}
+	if backend := os.Getenv("MAILCAT_RATE_LIMIT_BACKEND"); backend != "" {
+		config.RateLimit.Backend = backend
+	}
+	if address := os.Getenv("MAILCAT_RATE_LIMIT_REDIS_ADDRESS"); address != "" {
+		config.RateLimit.Redis.Address = address
+	}
+	if password := os.Getenv("MAILCAT_RATE_LIMIT_REDIS_PASSWORD"); password != "" {
+		config.RateLimit.Redis.Password = password
+	}
+
+	// 就绪检查配置
+	if minFree := os.Getenv("MAILCAT_HEALTH_MIN_FREE_DISK_MB"); minFree != "" {
+		if n, err := strconv.ParseInt(minFree, 10, 64); err == nil {
+			config.Health.MinFreeDiskMB = n
+		}
+	}
+}
+
+// applyDefaults 为未设置的可选配置填充默认值
+func applyDefaults(config *Config) {
+	if config.Server.Timezone == "" {
+		config.Server.Timezone = "Local"
+	}
+	// 导入上传和导出下载可能持续较久，读写超时默认较宽松
+	if config.Server.ReadTimeoutSeconds <= 0 {
+		config.Server.ReadTimeoutSeconds = 300
+	}
+	if config.Server.WriteTimeoutSeconds <= 0 {
+		config.Server.WriteTimeoutSeconds = 300
+	}
+	if config.Server.IdleTimeoutSeconds <= 0 {
+		config.Server.IdleTimeoutSeconds = 120
+	}
+	if config.Server.ShutdownTimeoutSeconds <= 0 {
+		config.Server.ShutdownTimeoutSeconds = 30
+	}
+	if config.Spam.Threshold <= 0 {
+		config.Spam.Threshold = 5.0
+	}
+	if config.Spam.TimeoutSeconds <= 0 {
+		config.Spam.TimeoutSeconds = 5
+	}
+	if config.Sanitizer.RemoteImages == "" {
+		config.Sanitizer.RemoteImages = "allow"
+	}
+
+	if config.ImageProxy.MaxBytes <= 0 {
+		config.ImageProxy.MaxBytes = 5 << 20
+	}
+	if config.ImageProxy.TimeoutSeconds <= 0 {
+		config.ImageProxy.TimeoutSeconds = 10
+	}
+	if config.ImageProxy.CacheEntries <= 0 {
+		config.ImageProxy.CacheEntries = 256
+	}
+	if config.ImageProxy.CacheTTLSeconds <= 0 {
+		config.ImageProxy.CacheTTLSeconds = 3600
+	}
+	if config.Import.MaxUploadMB <= 0 {
+		config.Import.MaxUploadMB = 200
+	}
+	if config.Health.MinFreeDiskMB <= 0 {
+		config.Health.MinFreeDiskMB = 100
+	}
+	if config.Audit.RetentionDays <= 0 {
+		config.Audit.RetentionDays = 90
+	}
+	if config.RateLimit.Backend == "" {
+		config.RateLimit.Backend = "memory"
+	}
+	if config.RateLimit.Redis.Address == "" {
+		config.RateLimit.Redis.Address = "127.0.0.1:6379"
+	}
+	if config.RateLimit.Redis.KeyPrefix == "" {
+		config.RateLimit.Redis.KeyPrefix = "mailcat:ratelimit:"
+	}
+	// 默认值足以应对 Worker 的正常推送和客户端轮询，只拦截令牌泄露后的滥用
+	applyRateLimitDefaults(&config.RateLimit.Ingest, 600)
+	applyRateLimitDefaults(&config.RateLimit.Read, 300)
+	applyRateLimitDefaults(&config.RateLimit.Write, 120)
+	if config.IMAP.Address == "" {
+		config.IMAP.Address = ":1143"
+	}
+	if config.POP3.Address == "" {
+		config.POP3.Address = ":1110"
+	}
+	if config.OIDC.UsernameClaim == "" {
+		config.OIDC.UsernameClaim = "preferred_username"
+	}
+	if config.OIDC.RoleClaim == "" {
+		config.OIDC.RoleClaim = "groups"
+	}
+	// 启用内置图片代理时，proxy 模式默认改写到该端点
+	if config.ImageProxy.Enabled && config.Sanitizer.ImageProxyURL == "" {
+		config.Sanitizer.ImageProxyURL = "/admin/api/proxy/image"
+	}
+}
+
+// applyRateLimitDefaults 为一组路由填充默认的每分钟请求数和桶容量
+func applyRateLimitDefaults(group *RateLimitGroup, requestsPerMinute int) {
+	for _, rule := range []*RateLimitRule{&group.PerKey, &group.PerIP} {
+		if rule.RequestsPerMinute == 0 {
+			rule.RequestsPerMinute = requestsPerMinute
+		}
+		if rule.Burst <= 0 {
+			rule.Burst = rule.RequestsPerMinute
+		}
+	}
 }
 
 // validateConfig 验证配置的必需字段
@@ -87,5 +478,65 @@ func validateConfig(config *Config) error {
 	if config.Admin.Password == "" {
 		return fmt.Errorf("Admin password is required. Please set MAILCAT_ADMIN_PASSWORD environment variable")
 	}
+	if secret := config.API.IngestSigningSecret; secret != "" && len(secret) < 32 {
+		return fmt.Errorf("api.ingest_signing_secret must be at least 32 characters")
+	}
+	if secret := config.API.InlineURLSecret; secret != "" && len(secret) < 32 {
+		return fmt.Errorf("api.inline_url_secret must be at least 32 characters")
+	}
+	if _, err := time.LoadLocation(config.Server.Timezone); err != nil {
+		return fmt.Errorf("invalid server.timezone %q: %v", config.Server.Timezone, err)
+	}
+	switch config.Sanitizer.RemoteImages {
+	case "allow", "block", "proxy":
+	default:
+		return fmt.Errorf("sanitizer.remote_images must be one of allow, block, proxy")
+	}
+	if (config.IMAP.TLSCertFile == "") != (config.IMAP.TLSKeyFile == "") {
+		return fmt.Errorf("imap.tls_cert_file and imap.tls_key_file must be set together")
+	}
+	if config.IMAP.ImplicitTLS && config.IMAP.TLSCertFile == "" {
+		return fmt.Errorf("imap.implicit_tls requires imap.tls_cert_file and imap.tls_key_file")
+	}
+	if (config.POP3.TLSCertFile == "") != (config.POP3.TLSKeyFile == "") {
+		return fmt.Errorf("pop3.tls_cert_file and pop3.tls_key_file must be set together")
+	}
+	if config.POP3.ImplicitTLS && config.POP3.TLSCertFile == "" {
+		return fmt.Errorf("pop3.implicit_tls requires pop3.tls_cert_file and pop3.tls_key_file")
+	}
+	names := make(map[string]bool)
+	for _, mailbox := range config.IMAP.Mailboxes {
+		name := strings.ToUpper(mailbox.Name)
+		switch {
+		case mailbox.Name == "" || mailbox.Address == "":
+			return fmt.Errorf("imap.mailboxes entries require name and address")
+		case strings.ContainsAny(mailbox.Name, "/*%\""):
+			return fmt.Errorf("imap mailbox name %q contains reserved characters", mailbox.Name)
+		case name == "INBOX" || name == "SPAM" || name == "TRASH" || names[name]:
+			return fmt.Errorf("imap mailbox name %q is reserved or duplicated", mailbox.Name)
+		}
+		names[name] = true
+	}
+	if config.RateLimit.Backend != "memory" && config.RateLimit.Backend != "redis" {
+		return fmt.Errorf("rate_limit.backend must be one of memory, redis")
+	}
+	if config.OIDC.Enabled {
+		if config.OIDC.Issuer == "" || config.OIDC.ClientID == "" || config.OIDC.RedirectURL == "" {
+			return fmt.Errorf("oidc.issuer, oidc.client_id and oidc.redirect_url are required when oidc is enabled")
+		}
+		if len(config.OIDC.RoleMappings) == 0 {
+			return fmt.Errorf("oidc.role_mappings must contain at least one mapping")
+		}
+		for _, mapping := range config.OIDC.RoleMappings {
+			switch {
+			case mapping.Value == "":
+				return fmt.Errorf("oidc.role_mappings entries require a value")
+			case mapping.Role != "owner" && mapping.Role != "admin" && mapping.Role != "viewer":
+				return fmt.Errorf("oidc role mapping %q: role must be one of owner, admin, viewer", mapping.Value)
+			case mapping.Role == "viewer" && len(mapping.Mailboxes) == 0:
+				return fmt.Errorf("oidc role mapping %q: viewer requires at least one mailbox", mapping.Value)
+			}
+		}
+	}
 	return nil
 }
\ No newline at end of file
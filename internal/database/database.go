@@ -1,13 +1,16 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
 	"time"
 
 	"mailcat/internal/models"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
@@ -15,7 +18,7 @@ type DB struct {
 }
 
 func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", dbPath)
+	conn, err := sql.Open(driverName, dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -46,6 +49,89 @@ func (db *DB) createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_emails_from ON emails(from_address);
 	CREATE INDEX IF NOT EXISTS idx_emails_to ON emails(to_address);
 	CREATE INDEX IF NOT EXISTS idx_emails_created_at ON emails(created_at);
+
+	CREATE TABLE IF NOT EXISTS labels (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS email_labels (
+		email_id INTEGER NOT NULL,
+		label_id INTEGER NOT NULL,
+		PRIMARY KEY (email_id, label_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_email_labels_label ON email_labels(label_id);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		allowed_ips TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		last_used_ip TEXT NOT NULL DEFAULT '',
+		revoked_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL,
+		mailboxes TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_login_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS admin_sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT NOT NULL UNIQUE,
+		user_id INTEGER NOT NULL,
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		last_seen_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_admin_sessions_user ON admin_sessions(user_id);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		actor_type TEXT NOT NULL,
+		action TEXT NOT NULL,
+		method TEXT NOT NULL DEFAULT '',
+		route TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0,
+		success INTEGER NOT NULL DEFAULT 0,
+		details TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_id);
+
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS secrets (
+		name TEXT PRIMARY KEY,
+		value BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 
 	_, err := db.conn.Exec(query)
@@ -53,25 +139,299 @@ func (db *DB) createTables() error {
 		return err
 	}
 
-	// 添加raw_email列（如果不存在）
-	alterQuery := `ALTER TABLE emails ADD COLUMN raw_email TEXT;`
-	db.conn.Exec(alterQuery) // 忽略错误，因为列可能已存在
+	// 为旧数据库补充新增的列（忽略错误，因为列可能已存在；缺失的列由 MigrationStatus 报告）
+	for _, added := range addedTableColumns {
+		for _, column := range added.columns {
+			db.conn.Exec(`ALTER TABLE ` + added.table + ` ADD COLUMN ` + column + `;`)
+		}
+	}
+
+	// 依赖新增列的索引需要在补列之后创建
+	indexQueries := []string{
+		`CREATE INDEX IF NOT EXISTS idx_emails_folder ON emails(folder, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_emails_message_id ON emails(message_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_emails_folder_id ON emails(folder, id);`,
+	}
+	for _, indexQuery := range indexQueries {
+		if _, err := db.conn.Exec(indexQuery); err != nil {
+			return err
+		}
+	}
+
+	// 记录结构版本；新版本程序创建的数据库保留其版本号，由 MigrationStatus 报告不一致
+	var version int
+	if err := db.conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version < SchemaVersion {
+		if version < messageIDBackfillVersion {
+			if err := db.backfillMessageIDs(); err != nil {
+				return err
+			}
+		}
+		_, err = db.conn.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion))
+	}
+	return err
+}
+
+// SchemaVersion 当前代码对应的数据库结构版本，保存在 PRAGMA user_version 中，新增表、列或需要迁移数据时递增
+const SchemaVersion = 11
+
+// messageIDBackfillVersion 从该版本开始，升级前入库的邮件已补充 message_id
+const messageIDBackfillVersion = 11
+
+// backfillMessageIDs 为补列之前入库的邮件（message_id 为 NULL）补充 Message-ID，
+// 否则重复导入时这些邮件不会被识别为已存在。先取保存的头部，没有时解析原始邮件的头部
+func (db *DB) backfillMessageIDs() error {
+	rows, err := db.conn.Query(`SELECT id, COALESCE(headers, ''), substr(COALESCE(raw_email, ''), 1, 65536)
+		FROM emails WHERE message_id IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to query emails without message id: %w", err)
+	}
+	// 先读出全部结果再更新，避免在读取游标打开时写入
+	messageIDs := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var headersJSON, raw string
+		if err := rows.Scan(&id, &headersJSON, &raw); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan email headers: %w", err)
+		}
+		messageIDs[id] = messageIDFromStored(headersJSON, raw)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query emails without message id: %w", err)
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, messageID := range messageIDs {
+		if _, err := tx.Exec(`UPDATE emails SET message_id = ? WHERE id = ?`, messageID, id); err != nil {
+			return fmt.Errorf("failed to backfill message id: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// messageIDFromStored 从保存的头部 JSON 或原始邮件中取出 Message-ID，都没有时返回空字符串
+func messageIDFromStored(headersJSON, raw string) string {
+	var headers map[string]string
+	if json.Unmarshal([]byte(headersJSON), &headers) == nil {
+		if messageID := MessageIDFromHeaders(headers); messageID != "" {
+			return messageID
+		}
+	}
+	if raw == "" {
+		return ""
+	}
+	// 只解析头部，原始邮件可能被截断
+	end := strings.Index(raw, "\r\n\r\n")
+	if end < 0 {
+		end = strings.Index(raw, "\n\n")
+	}
+	if end < 0 {
+		return ""
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(raw[:end] + "\r\n\r\n"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(msg.Header.Get("Message-Id"))
+}
+
+// addedColumns 建表之后新增的 emails 列，启动时为旧数据库补充
+var addedColumns = []string{
+	`raw_email TEXT`,
+	`folder TEXT NOT NULL DEFAULT 'inbox'`,
+	`spam_score REAL NOT NULL DEFAULT 0`,
+	`spam_reasons TEXT`,
+	`message_id TEXT`,
+	`is_read INTEGER NOT NULL DEFAULT 0`,
+	`is_starred INTEGER NOT NULL DEFAULT 0`,
+	`snippet TEXT`,
+	`size INTEGER`,
+	`has_attachments INTEGER NOT NULL DEFAULT 0`,
+	`attachment_size INTEGER`,
+}
+
+// addedUserColumns 建表之后新增的 users 列：TOTP 密钥、是否已启用、是否强制要求、
+// 最近一次使用的时间步（防止重放）、未使用的恢复码哈希，以及 OIDC 登录用户的 sub
+var addedUserColumns = []string{
+	`totp_secret TEXT NOT NULL DEFAULT ''`,
+	`totp_enabled INTEGER NOT NULL DEFAULT 0`,
+	`totp_required INTEGER NOT NULL DEFAULT 0`,
+	`totp_last_counter INTEGER NOT NULL DEFAULT 0`,
+	`recovery_codes TEXT NOT NULL DEFAULT ''`,
+	`oidc_subject TEXT NOT NULL DEFAULT ''`,
+}
+
+// addedAPIKeyColumns 建表之后新增的 api_keys 列：是否允许通过 URL 参数传递
+var addedAPIKeyColumns = []string{
+	`allow_query_token INTEGER NOT NULL DEFAULT 0`,
+}
+
+// addedTableColumns 各表建表之后新增的列
+var addedTableColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"emails", addedColumns},
+	{"users", addedUserColumns},
+	{"api_keys", addedAPIKeyColumns},
+}
+
+// MigrationStatus 数据库结构的迁移状态
+type MigrationStatus struct {
+	Version        int // 数据库中记录的版本
+	Expected       int // 当前代码要求的版本
+	MissingColumns []string // emails 的列只有列名，其他表为“表名.列名”
+}
+
+// Current 迁移是否已完成：版本一致且没有缺失的列
+func (s *MigrationStatus) Current() bool {
+	return s.Version == s.Expected && len(s.MissingColumns) == 0
+}
+
+// MigrationStatus 读取数据库结构版本并检查新增的列是否都已存在
+func (db *DB) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	status := &MigrationStatus{Expected: SchemaVersion}
+	if err := db.conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&status.Version); err != nil {
+		return nil, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	for _, added := range addedTableColumns {
+		existing, err := db.tableColumns(ctx, added.table)
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range added.columns {
+			name := strings.Fields(column)[0]
+			if existing[name] {
+				continue
+			}
+			if added.table != "emails" {
+				name = added.table + "." + name
+			}
+			status.MissingColumns = append(status.MissingColumns, name)
+		}
+	}
+	return status, nil
+}
+
+// tableColumns 返回表中已有的列名
+func (db *DB) tableColumns(ctx context.Context, table string) (map[string]bool, error) {
+	rows, err := db.conn.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s columns: %w", table, err)
+	}
+	defer rows.Close()
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan %s columns: %w", table, err)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get %s columns: %w", table, err)
+	}
+	return existing, nil
+}
 
+// ProbeWrite 检查数据库是否可以写入：在单独的连接上开启 IMMEDIATE 事务获取写锁后立即回滚，
+// 不修改任何数据。只读挂载、磁盘错误或写锁被长时间占用时返回错误
+func (db *DB) ProbeWrite(ctx context.Context) error {
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// 写锁被占用时最多等到 ctx 的截止时间，而不是连接默认的 busy_timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		var previous int64
+		if err := conn.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&previous); err != nil {
+			return err
+		}
+		wait := time.Until(deadline).Milliseconds()
+		if wait < 1 {
+			wait = 1
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d", wait)); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), fmt.Sprintf("PRAGMA busy_timeout = %d", previous))
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return fmt.Errorf("database is not writable: %w", err)
+	}
+	// 回滚不受 ctx 超时影响，避免连接带着未结束的事务回到连接池
+	if _, err := conn.ExecContext(context.Background(), "ROLLBACK"); err != nil {
+		return fmt.Errorf("failed to roll back write probe: %w", err)
+	}
 	return nil
 }
 
+// emailColumns 查询完整邮件记录时使用的列，与 scanEmail 的顺序保持一致
+const emailColumns = `id, from_address, to_address, subject, body, html_body, headers,
+	       COALESCE(raw_email, '') as raw_email, folder, spam_score,
+	       COALESCE(spam_reasons, '') as spam_reasons, is_read, is_starred, received_at, created_at`
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEmail 按 emailColumns 的顺序扫描一条邮件记录
+func scanEmail(row rowScanner, email *models.Email) error {
+	return row.Scan(
+		&email.ID,
+		&email.From,
+		&email.To,
+		&email.Subject,
+		&email.Body,
+		&email.HTMLBody,
+		&email.Headers,
+		&email.RawEmail,
+		&email.Folder,
+		&email.SpamScore,
+		&email.SpamReasons,
+		&email.IsRead,
+		&email.IsStarred,
+		&email.ReceivedAt,
+		&email.CreatedAt,
+	)
+}
+
 func (db *DB) SaveEmail(emailReq *models.EmailRequest) (*models.Email, error) {
 	headersJSON, err := json.Marshal(emailReq.Headers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal headers: %w", err)
 	}
 
+	folder := emailReq.Folder
+	if folder == "" {
+		folder = models.FolderInbox
+	}
+
 	query := `
-	INSERT INTO emails (from_address, to_address, subject, body, html_body, headers, raw_email, received_at, created_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO emails (from_address, to_address, subject, body, html_body, headers, raw_email,
+	                    folder, spam_score, spam_reasons, message_id, received_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now()
+	receivedAt := emailReq.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = now
+	}
 	result, err := db.conn.Exec(query,
 		emailReq.From,
 		emailReq.To,
@@ -80,7 +440,11 @@ func (db *DB) SaveEmail(emailReq *models.EmailRequest) (*models.Email, error) {
 		emailReq.HTMLBody,
 		string(headersJSON),
 		emailReq.RawEmail,
-		now,
+		folder,
+		emailReq.SpamScore,
+		emailReq.SpamReasons,
+		MessageIDFromHeaders(emailReq.Headers),
+		receivedAt,
 		now,
 	)
 
@@ -96,152 +460,1322 @@ func (db *DB) SaveEmail(emailReq *models.EmailRequest) (*models.Email, error) {
 	return db.GetEmailByID(int(id))
 }
 
+// MessageIDFromHeaders 从头部中取出 Message-ID（大小写不敏感），用于去重
+func MessageIDFromHeaders(headers map[string]string) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Message-Id") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// EmailExists 判断邮件是否已经存在：有 Message-ID 时按 Message-ID 判断，
+// 否则按原始邮件内容判断
+func (db *DB) EmailExists(messageID, rawEmail string) (bool, error) {
+	var row *sql.Row
+	switch {
+	case messageID != "":
+		row = db.conn.QueryRow(`SELECT 1 FROM emails WHERE message_id = ? LIMIT 1`, messageID)
+	case rawEmail != "":
+		row = db.conn.QueryRow(`SELECT 1 FROM emails WHERE raw_email = ? LIMIT 1`, rawEmail)
+	default:
+		return false, nil
+	}
+
+	var exists int
+	err := row.Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check existing email: %w", err)
+	}
+	return true, nil
+}
+
 func (db *DB) GetEmailByID(id int) (*models.Email, error) {
 	// 首先尝试查询包含raw_email的完整记录
-	query := `
-	SELECT id, from_address, to_address, subject, body, html_body, headers,
-	       COALESCE(raw_email, '') as raw_email, received_at, created_at
-	FROM emails WHERE id = ?
-	`
+	query := `SELECT ` + emailColumns + ` FROM emails WHERE id = ?`
 
 	row := db.conn.QueryRow(query, id)
 	email := &models.Email{}
 
-	err := row.Scan(
-		&email.ID,
-		&email.From,
-		&email.To,
-		&email.Subject,
-		&email.Body,
-		&email.HTMLBody,
-		&email.Headers,
-		&email.RawEmail,
-		&email.ReceivedAt,
-		&email.CreatedAt,
-	)
-
+	err := scanEmail(row, email)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan email: %w", err)
 	}
 
+	labels, err := db.labelsByEmail([]int{email.ID})
+	if err != nil {
+		return nil, err
+	}
+	email.Labels = labels[email.ID]
+
 	return email, nil
 }
 
-func (db *DB) GetEmails(page, limit int) (*models.EmailListResponse, error) {
-	offset := (page - 1) * limit
+// summaryColumns 列表查询使用的列，不读取正文和原始邮件，与 scanSummary 的顺序保持一致
+const summaryColumns = `id, from_address, to_address, COALESCE(subject, ''), COALESCE(snippet, ''),
+	       COALESCE(size, 0), has_attachments, folder, spam_score, is_read, is_starred, received_at, created_at`
 
-	// Get total count
-	countQuery := "SELECT COUNT(*) FROM emails"
-	var total int
-	err := db.conn.QueryRow(countQuery).Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get total count: %w", err)
+func scanSummary(row rowScanner, summary *models.EmailSummary) error {
+	return row.Scan(
+		&summary.ID,
+		&summary.From,
+		&summary.To,
+		&summary.Subject,
+		&summary.Snippet,
+		&summary.Size,
+		&summary.HasAttachments,
+		&summary.Folder,
+		&summary.SpamScore,
+		&summary.IsRead,
+		&summary.IsStarred,
+		&summary.ReceivedAt,
+		&summary.CreatedAt,
+	)
+}
+
+// ListEmailSummaries 按 ID 降序返回符合过滤条件的邮件摘要。
+// 游标分页（AfterID/BeforeID）使用 id 上的索引定位，不统计总数；按页码分页时仍返回 total。
+// filter.Folder 为空时默认只返回收件箱，为 models.FolderAll 时不按文件夹过滤
+func (db *DB) ListEmailSummaries(filter models.EmailFilter, query models.EmailListQuery) (*models.EmailSummaryList, error) {
+	baseWhere, args := buildEmailFilter(filter)
+	where := baseWhere
+	list := &models.EmailSummaryList{Limit: query.Limit}
+
+	cursorQuery := query.AfterID > 0 || query.BeforeID > 0
+	if !cursorQuery {
+		var total int
+		if err := db.conn.QueryRow(`SELECT COUNT(*) FROM emails `+where, args...).Scan(&total); err != nil {
+			return nil, fmt.Errorf("failed to get total count: %w", err)
+		}
+		list.Total = &total
+		list.Page = query.Page
 	}
 
-	// Get emails
-	query := `
-	SELECT id, from_address, to_address, subject, body, html_body, headers,
-	       COALESCE(raw_email, '') as raw_email, received_at, created_at
-	FROM emails
-	ORDER BY created_at DESC
-	LIMIT ? OFFSET ?
-	`
+	// 向前翻页时按升序取最接近游标的邮件，再反转为降序
+	order := "DESC"
+	pageArgs := append([]interface{}{}, args...)
+	switch {
+	case query.AfterID > 0:
+		where = appendCondition(where, "id < ?")
+		pageArgs = append(pageArgs, query.AfterID)
+	case query.BeforeID > 0:
+		where = appendCondition(where, "id > ?")
+		pageArgs = append(pageArgs, query.BeforeID)
+		order = "ASC"
+	}
+	sqlQuery := `SELECT ` + summaryColumns + ` FROM emails ` + where + ` ORDER BY id ` + order + ` LIMIT ?`
+	pageArgs = append(pageArgs, query.Limit)
+	if !cursorQuery {
+		sqlQuery += ` OFFSET ?`
+		pageArgs = append(pageArgs, (query.Page-1)*query.Limit)
+	}
 
-	rows, err := db.conn.Query(query, limit, offset)
+	rows, err := db.conn.Query(sqlQuery, pageArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query emails: %w", err)
 	}
 	defer rows.Close()
 
-	var emails []models.Email
+	list.Emails = []models.EmailSummary{}
 	for rows.Next() {
-		email := models.Email{}
-		err := rows.Scan(
-			&email.ID,
-			&email.From,
-			&email.To,
-			&email.Subject,
-			&email.Body,
-			&email.HTMLBody,
-			&email.Headers,
-			&email.RawEmail,
-			&email.ReceivedAt,
-			&email.CreatedAt,
-		)
-		if err != nil {
+		var summary models.EmailSummary
+		if err := scanSummary(rows, &summary); err != nil {
 			return nil, fmt.Errorf("failed to scan email: %w", err)
 		}
-		emails = append(emails, email)
+		list.Emails = append(list.Emails, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query emails: %w", err)
+	}
+	rows.Close()
+
+	if order == "ASC" {
+		for i, j := 0, len(list.Emails)-1; i < j; i, j = i+1, j-1 {
+			list.Emails[i], list.Emails[j] = list.Emails[j], list.Emails[i]
+		}
+	}
+	if len(list.Emails) == 0 {
+		return list, nil
+	}
+
+	ids := make([]int, len(list.Emails))
+	for i := range list.Emails {
+		ids[i] = list.Emails[i].ID
+	}
+	labels, err := db.labelsByEmail(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Emails {
+		list.Emails[i].Labels = labels[list.Emails[i].ID]
+	}
+
+	// 只有在游标两侧确实还有邮件时才返回游标
+	newest, oldest := ids[0], ids[len(ids)-1]
+	hasOlder, err := db.anyEmail(appendCondition(baseWhere, "id < ?"), append(append([]interface{}{}, args...), oldest))
+	if err != nil {
+		return nil, err
+	}
+	if hasOlder {
+		list.NextCursor = &oldest
+	}
+	hasNewer, err := db.anyEmail(appendCondition(baseWhere, "id > ?"), append(append([]interface{}{}, args...), newest))
+	if err != nil {
+		return nil, err
+	}
+	if hasNewer {
+		list.PrevCursor = &newest
 	}
 
-	return &models.EmailListResponse{
-		Emails: emails,
-		Total:  total,
-		Page:   page,
-		Limit:  limit,
-	}, nil
+	return list, nil
 }
 
-// GetEmailStats 获取邮件统计信息
-func (db *DB) GetEmailStats() (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
-	
-	// 获取总邮件数
-	var totalEmails int
-	err := db.conn.QueryRow("SELECT COUNT(*) FROM emails").Scan(&totalEmails)
+// anyEmail 判断是否存在满足 WHERE 子句的邮件
+func (db *DB) anyEmail(where string, args []interface{}) (bool, error) {
+	var exists bool
+	if err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM emails `+where+`)`, args...).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query emails: %w", err)
+	}
+	return exists, nil
+}
+
+// appendCondition 向 buildEmailFilter 生成的 WHERE 子句追加一个 AND 条件
+func appendCondition(where, condition string) string {
+	if where == "" {
+		return "WHERE " + condition
+	}
+	return where + " AND " + condition
+}
+
+// SetEmailSummary 保存列表视图和统计使用的摘要、大小和附件数据量
+func (db *DB) SetEmailSummary(id int, snippet string, size int, hasAttachments bool, attachmentSize int) error {
+	_, err := db.conn.Exec(`UPDATE emails SET snippet = ?, size = ?, has_attachments = ?, attachment_size = ? WHERE id = ?`,
+		snippet, size, hasAttachments, attachmentSize, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total emails: %w", err)
+		return fmt.Errorf("failed to update email summary: %w", err)
 	}
-	stats["total_emails"] = totalEmails
-	
-	// 获取今日邮件数
-	var todayEmails int
-	err = db.conn.QueryRow(`
-		SELECT COUNT(*) FROM emails
-		WHERE DATE(created_at) = DATE('now', 'localtime')
-	`).Scan(&todayEmails)
+	return nil
+}
+
+// EmailsWithoutSummary 按 ID 升序返回最多 limit 封尚未计算摘要的邮件（升级前入库的旧数据）
+func (db *DB) EmailsWithoutSummary(limit int) ([]*models.Email, error) {
+	query := `SELECT ` + emailColumns + ` FROM emails WHERE size IS NULL OR attachment_size IS NULL ORDER BY id ASC LIMIT ?`
+	rows, err := db.conn.Query(query, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get today emails: %w", err)
+		return nil, fmt.Errorf("failed to query emails: %w", err)
 	}
-	stats["today_emails"] = todayEmails
-	
-	// 获取最近7天的邮件统计（用于图表）
-	// 使用CTE生成最近7天的日期，确保所有日期都显示
-	rows, err := db.conn.Query(`
-		WITH RECURSIVE dates(date) AS (
-			SELECT date('now', '-6 days')
-			UNION ALL
-			SELECT date(date, '+1 day')
-			FROM dates
-			WHERE date < date('now')
-		)
-		SELECT dates.date, COALESCE(COUNT(emails.id), 0) as count
-		FROM dates
-		LEFT JOIN emails ON DATE(emails.created_at) = dates.date
-		GROUP BY dates.date
-		ORDER BY dates.date ASC
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get weekly stats: %w", err)
+	defer rows.Close()
+
+	var emails []*models.Email
+	for rows.Next() {
+		email := &models.Email{}
+		if err := scanEmail(rows, email); err != nil {
+			return nil, fmt.Errorf("failed to scan email: %w", err)
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// ForEachEmailStat 逐条读取接收时间在 [since, until) 内的邮件统计字段，不读取正文
+func (db *DB) ForEachEmailStat(since, until time.Time, fn func(stat models.EmailStat) error) error {
+	where, args := buildEmailFilter(models.EmailFilter{Folder: models.FolderAll, Since: &since, Until: &until})
+	query := `SELECT received_at, from_address, to_address, folder, COALESCE(size, 0), has_attachments,
+	       COALESCE(attachment_size, 0) FROM emails ` + where
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query email stats: %w", err)
 	}
 	defer rows.Close()
-	
-	var weeklyStats []map[string]interface{}
+
 	for rows.Next() {
-		var date string
-		var count int
-		err := rows.Scan(&date, &count)
+		var stat models.EmailStat
+		err := rows.Scan(&stat.ReceivedAt, &stat.From, &stat.To, &stat.Folder, &stat.Size,
+			&stat.HasAttachments, &stat.AttachmentSize)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan weekly stats: %w", err)
+			return fmt.Errorf("failed to scan email stat: %w", err)
+		}
+		if err := fn(stat); err != nil {
+			return err
 		}
-		weeklyStats = append(weeklyStats, map[string]interface{}{
-			"date":  date,
-			"count": count,
-		})
 	}
-	stats["weekly_stats"] = weeklyStats
-	
-	return stats, nil
+	return rows.Err()
+}
+
+// forEachEmailBatchSize ForEachEmail 每次查询读取的邮件数
+const forEachEmailBatchSize = 100
+
+// ForEachEmail 按 ID 升序逐条读取符合条件的邮件，适用于导出等不宜一次性载入内存的场景。
+// 按 ID 分批查询，每批读完即关闭结果集后再调用 fn，向慢速客户端写出时不会一直占用读事务
+// （长时间的读事务会阻止 WAL 检查点）。遍历期间新收到的邮件可能被包含在内。
+// fn 返回错误时停止遍历并返回该错误
+func (db *DB) ForEachEmail(filter models.EmailFilter, fn func(email *models.Email) error) error {
+	where, args := buildEmailFilter(filter)
+	where = appendCondition(where, "id > ?")
+	query := `SELECT ` + emailColumns + ` FROM emails ` + where + ` ORDER BY id ASC LIMIT ?`
+
+	lastID, remaining := 0, filter.Limit
+	for {
+		batchSize := forEachEmailBatchSize
+		if filter.Limit > 0 {
+			if remaining == 0 {
+				return nil
+			}
+			batchSize = min(batchSize, remaining)
+		}
+		batch, err := db.queryEmails(query, append(args[:len(args):len(args)], lastID, batchSize)...)
+		if err != nil {
+			return err
+		}
+		for _, email := range batch {
+			if err := fn(email); err != nil {
+				return err
+			}
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+		remaining -= len(batch)
+	}
+}
+
+// queryEmails 执行返回 emailColumns 的查询，读完全部结果后关闭结果集
+func (db *DB) queryEmails(query string, args ...interface{}) ([]*models.Email, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query emails: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []*models.Email
+	for rows.Next() {
+		email := &models.Email{}
+		if err := scanEmail(rows, email); err != nil {
+			return nil, fmt.Errorf("failed to scan email: %w", err)
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// ListEmailStates 按 ID 升序返回符合条件的邮件 ID 和已读状态
+func (db *DB) ListEmailStates(filter models.EmailFilter) ([]models.EmailState, error) {
+	where, args := buildEmailFilter(filter)
+	rows, err := db.conn.Query(`SELECT id, is_read FROM emails `+where+` ORDER BY id ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query email states: %w", err)
+	}
+	defer rows.Close()
+
+	var states []models.EmailState
+	for rows.Next() {
+		var state models.EmailState
+		if err := rows.Scan(&state.ID, &state.IsRead); err != nil {
+			return nil, fmt.Errorf("failed to scan email state: %w", err)
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+// SetEmailsRead 批量设置邮件的已读状态
+func (db *DB) SetEmailsRead(ids []int, read bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	in, args := idPlaceholders(ids)
+	query := `UPDATE emails SET is_read = ? WHERE id IN (` + in + `)`
+	if _, err := db.conn.Exec(query, append([]interface{}{read}, args...)...); err != nil {
+		return fmt.Errorf("failed to update read state: %w", err)
+	}
+	return nil
+}
+
+// MoveEmails 将邮件移动到指定文件夹（例如删除时移入回收站）
+func (db *DB) MoveEmails(ids []int, folder string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	in, args := idPlaceholders(ids)
+	query := `UPDATE emails SET folder = ? WHERE id IN (` + in + `)`
+	if _, err := db.conn.Exec(query, append([]interface{}{folder}, args...)...); err != nil {
+		return fmt.Errorf("failed to move emails: %w", err)
+	}
+	return nil
+}
+
+// UpdateEmailState 批量修改邮件的已读、星标和标签状态，不存在的 ID 会被忽略，返回实际修改的邮件数
+func (db *DB) UpdateEmailState(ids []int, update models.EmailStateUpdate) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 只处理存在的邮件，避免为不存在的邮件写入标签
+	in, args := idPlaceholders(ids)
+	rows, err := tx.Query(`SELECT id FROM emails WHERE id IN (`+in+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query emails: %w", err)
+	}
+	var existing []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan email id: %w", err)
+		}
+		existing = append(existing, id)
+	}
+	rows.Close()
+	if len(existing) == 0 {
+		return 0, nil
+	}
+	in, args = idPlaceholders(existing)
+
+	if update.IsRead != nil {
+		if _, err := tx.Exec(`UPDATE emails SET is_read = ? WHERE id IN (`+in+`)`, append([]interface{}{*update.IsRead}, args...)...); err != nil {
+			return 0, fmt.Errorf("failed to update read state: %w", err)
+		}
+	}
+	if update.IsStarred != nil {
+		if _, err := tx.Exec(`UPDATE emails SET is_starred = ? WHERE id IN (`+in+`)`, append([]interface{}{*update.IsStarred}, args...)...); err != nil {
+			return 0, fmt.Errorf("failed to update starred state: %w", err)
+		}
+	}
+
+	add := update.AddLabels
+	if update.Labels != nil {
+		if _, err := tx.Exec(`DELETE FROM email_labels WHERE email_id IN (`+in+`)`, args...); err != nil {
+			return 0, fmt.Errorf("failed to clear labels: %w", err)
+		}
+		add = append(append([]string{}, update.Labels...), add...)
+	}
+	for _, name := range add {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO labels (name) VALUES (?)`, name); err != nil {
+			return 0, fmt.Errorf("failed to create label: %w", err)
+		}
+		var labelID int
+		if err := tx.QueryRow(`SELECT id FROM labels WHERE name = ?`, name).Scan(&labelID); err != nil {
+			return 0, fmt.Errorf("failed to query label: %w", err)
+		}
+		for _, id := range existing {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO email_labels (email_id, label_id) VALUES (?, ?)`, id, labelID); err != nil {
+				return 0, fmt.Errorf("failed to add label: %w", err)
+			}
+		}
+	}
+	for _, name := range update.RemoveLabels {
+		query := `DELETE FROM email_labels WHERE email_id IN (` + in + `) AND label_id IN (SELECT id FROM labels WHERE name = ?)`
+		if _, err := tx.Exec(query, append(append([]interface{}{}, args...), name)...); err != nil {
+			return 0, fmt.Errorf("failed to remove label: %w", err)
+		}
+	}
+
+	// 标签是自由文本，不再被任何邮件使用时一并删除
+	if update.Labels != nil || len(update.RemoveLabels) > 0 {
+		if _, err := tx.Exec(`DELETE FROM labels WHERE id NOT IN (SELECT label_id FROM email_labels)`); err != nil {
+			return 0, fmt.Errorf("failed to clean up labels: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit state update: %w", err)
+	}
+	return len(existing), nil
+}
+
+// ListLabels 返回标签及使用该标签的邮件数，按名称排序。
+// mailboxes 为 nil 时返回所有标签；否则只统计收件人匹配 mailboxes 的邮件（与 EmailFilter.Mailboxes 相同），
+// 并省略这些邮件都没有使用的标签
+func (db *DB) ListLabels(mailboxes []string) ([]models.Label, error) {
+	query := `
+		SELECT labels.id, labels.name, COUNT(email_labels.email_id), labels.created_at
+		FROM labels
+		LEFT JOIN email_labels ON email_labels.label_id = labels.id
+		GROUP BY labels.id
+		ORDER BY labels.name COLLATE NOCASE ASC
+	`
+	var args []interface{}
+	if mailboxes != nil {
+		var where string
+		where, args = buildEmailFilter(models.EmailFilter{Folder: models.FolderAll, Mailboxes: mailboxes})
+		query = `
+		SELECT labels.id, labels.name, COUNT(email_labels.email_id), labels.created_at
+		FROM labels
+		JOIN email_labels ON email_labels.label_id = labels.id
+		WHERE email_labels.email_id IN (SELECT id FROM emails ` + where + `)
+		GROUP BY labels.id
+		ORDER BY labels.name COLLATE NOCASE ASC
+	`
+	}
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query labels: %w", err)
+	}
+	defer rows.Close()
+
+	labels := []models.Label{}
+	for rows.Next() {
+		var label models.Label
+		if err := rows.Scan(&label.ID, &label.Name, &label.Count, &label.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan label: %w", err)
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+// labelsByEmail 返回每封邮件的标签，没有标签的邮件对应空切片
+func (db *DB) labelsByEmail(ids []int) (map[int][]string, error) {
+	result := make(map[int][]string, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	for _, id := range ids {
+		result[id] = []string{}
+	}
+
+	in, args := idPlaceholders(ids)
+	rows, err := db.conn.Query(`
+		SELECT email_labels.email_id, labels.name
+		FROM email_labels
+		JOIN labels ON labels.id = email_labels.label_id
+		WHERE email_labels.email_id IN (`+in+`)
+		ORDER BY labels.name COLLATE NOCASE ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query email labels: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan email label: %w", err)
+		}
+		result[id] = append(result[id], name)
+	}
+	return result, rows.Err()
+}
+
+// idPlaceholders 生成 IN 子句的占位符和参数
+func idPlaceholders(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// ListRecipients 返回所有出现过的收件人字段（去重）
+func (db *DB) ListRecipients() ([]string, error) {
+	rows, err := db.conn.Query(`SELECT DISTINCT to_address FROM emails`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []string
+	for rows.Next() {
+		var to string
+		if err := rows.Scan(&to); err != nil {
+			return nil, fmt.Errorf("failed to scan recipient: %w", err)
+		}
+		recipients = append(recipients, to)
+	}
+	return recipients, rows.Err()
+}
+
+// MaxEmailID 返回当前最大的邮件 ID，没有邮件时返回 0
+func (db *DB) MaxEmailID() (int, error) {
+	var id int
+	if err := db.conn.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM emails`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to query max email id: %w", err)
+	}
+	return id, nil
+}
+
+// buildEmailFilter 根据过滤条件生成 WHERE 子句和参数
+func buildEmailFilter(filter models.EmailFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	folder := filter.Folder
+	if folder == "" {
+		folder = models.FolderInbox
+	}
+	if folder != models.FolderAll {
+		conditions = append(conditions, "folder = ?")
+		args = append(args, folder)
+	}
+	if filter.From != "" {
+		conditions = append(conditions, "from_address LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+escapeLike(filter.From)+"%")
+	}
+	if filter.To != "" {
+		conditions = append(conditions, "to_address LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+escapeLike(filter.To)+"%")
+	}
+	if filter.Mailboxes != nil {
+		if len(filter.Mailboxes) == 0 {
+			conditions = append(conditions, "0")
+		}
+		var mailboxConditions []string
+		for _, mailbox := range filter.Mailboxes {
+			mailboxConditions = append(mailboxConditions, "recipient_match(to_address, ?)")
+			args = append(args, mailbox)
+		}
+		if len(mailboxConditions) > 0 {
+			conditions = append(conditions, "("+strings.Join(mailboxConditions, " OR ")+")")
+		}
+	}
+	if filter.Subject != "" {
+		conditions = append(conditions, "subject LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+escapeLike(filter.Subject)+"%")
+	}
+	// 时间带有时区，使用 julianday 比较而不是直接比较字符串
+	if filter.Since != nil {
+		conditions = append(conditions, "julianday(received_at) >= julianday(?)")
+		args = append(args, filter.Since.UTC().Format(sqliteTimeLayout))
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "julianday(received_at) < julianday(?)")
+		args = append(args, filter.Until.UTC().Format(sqliteTimeLayout))
+	}
+	if len(filter.IDs) > 0 {
+		in, idArgs := idPlaceholders(filter.IDs)
+		conditions = append(conditions, "id IN ("+in+")")
+		args = append(args, idArgs...)
+	}
+	if filter.IsRead != nil {
+		conditions = append(conditions, "is_read = ?")
+		args = append(args, *filter.IsRead)
+	}
+	if filter.IsStarred != nil {
+		conditions = append(conditions, "is_starred = ?")
+		args = append(args, *filter.IsStarred)
+	}
+	if filter.Label != "" {
+		conditions = append(conditions, `id IN (SELECT email_labels.email_id FROM email_labels
+			JOIN labels ON labels.id = email_labels.label_id WHERE labels.name = ?)`)
+		args = append(args, filter.Label)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// sqliteTimeLayout SQLite 日期函数可识别的 UTC 时间格式
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// GetEmailStats 获取邮件统计信息
+func (db *DB) GetEmailStats() (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+	
+	// 获取总邮件数
+	var totalEmails int
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM emails").Scan(&totalEmails)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total emails: %w", err)
+	}
+	stats["total_emails"] = totalEmails
+	
+	// 按收件人统计收件箱中的未读邮件
+	unreadEmails, unreadByRecipient, err := db.unreadByRecipient()
+	if err != nil {
+		return nil, err
+	}
+	stats["unread_emails"] = unreadEmails
+	stats["unread_by_recipient"] = unreadByRecipient
+	
+	return stats, nil
+}
+
+// unreadByRecipient 统计收件箱中的未读邮件总数，以及按收件人地址（小写）分组的未读数，按数量降序排列。
+// 一封邮件有多个收件人时计入每个收件人
+func (db *DB) unreadByRecipient() (int, []map[string]interface{}, error) {
+	rows, err := db.conn.Query(`
+		SELECT to_address, COUNT(*) FROM emails
+		WHERE folder = ? AND is_read = 0
+		GROUP BY to_address
+	`, models.FolderInbox)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get unread stats: %w", err)
+	}
+	defer rows.Close()
+
+	total := 0
+	counts := make(map[string]int)
+	for rows.Next() {
+		var to string
+		var count int
+		if err := rows.Scan(&to, &count); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan unread stats: %w", err)
+		}
+		total += count
+		addresses, err := mail.ParseAddressList(to)
+		if err != nil {
+			counts[strings.ToLower(strings.TrimSpace(to))] += count
+			continue
+		}
+		for _, addr := range addresses {
+			counts[strings.ToLower(addr.Address)] += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("failed to get unread stats: %w", err)
+	}
+
+	recipients := make([]string, 0, len(counts))
+	for recipient := range counts {
+		recipients = append(recipients, recipient)
+	}
+	sort.Slice(recipients, func(i, j int) bool {
+		if counts[recipients[i]] != counts[recipients[j]] {
+			return counts[recipients[i]] > counts[recipients[j]]
+		}
+		return recipients[i] < recipients[j]
+	})
+
+	result := make([]map[string]interface{}, len(recipients))
+	for i, recipient := range recipients {
+		result[i] = map[string]interface{}{
+			"recipient": recipient,
+			"count":     counts[recipient],
+		}
+	}
+	return total, result, nil
+}
+
+// GetSettings 返回保存在数据库中的运行时设置
+func (db *DB) GetSettings() (map[string]string, error) {
+	rows, err := db.conn.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan setting: %w", err)
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+// InstanceSecret 返回名为 name 的随机密钥，第一次调用时用 generate 生成并保存，之后重启仍使用同一个值。
+// 多个进程同时首次调用时只有一个值会被保存，所有调用者都返回该值
+func (db *DB) InstanceSecret(name string, generate func() ([]byte, error)) ([]byte, error) {
+	var secret []byte
+	err := db.conn.QueryRow("SELECT value FROM secrets WHERE name = ?", name).Scan(&secret)
+	if err == nil {
+		return secret, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get secret %s: %w", name, err)
+	}
+
+	generated, err := generate()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.conn.Exec("INSERT OR IGNORE INTO secrets (name, value) VALUES (?, ?)", name, generated); err != nil {
+		return nil, fmt.Errorf("failed to save secret %s: %w", name, err)
+	}
+	if err := db.conn.QueryRow("SELECT value FROM secrets WHERE name = ?", name).Scan(&secret); err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// SaveSettings 在一个事务中写入 set 中的设置并删除 remove 中的设置
+func (db *DB) SaveSettings(set map[string]string, remove []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range set {
+		if _, err := tx.Exec(`
+			INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+		`, key, value, time.Now()); err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", key, err)
+		}
+	}
+	for _, key := range remove {
+		if _, err := tx.Exec("DELETE FROM settings WHERE key = ?", key); err != nil {
+			return fmt.Errorf("failed to delete setting %s: %w", key, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// apiKeyColumns 查询 API 密钥时使用的列，与 scanAPIKey 的顺序保持一致
+const apiKeyColumns = `id, name, prefix, scopes, allowed_ips, expires_at, created_at, last_used_at, last_used_ip, revoked_at, allow_query_token`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes, allowedIPs string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &allowedIPs,
+		&expiresAt, &key.CreatedAt, &lastUsedAt, &key.LastUsedIP, &revokedAt, &key.AllowQueryToken); err != nil {
+		return nil, err
+	}
+	key.Scopes = splitList(scopes)
+	key.AllowedIPs = splitList(allowedIPs)
+	key.ExpiresAt = nullTimePtr(expiresAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+	return &key, nil
+}
+
+// CreateAPIKey 保存新的 API 密钥，keyHash 为密钥的哈希；成功后填充 key 的 ID 和创建时间
+func (db *DB) CreateAPIKey(key *models.APIKey, keyHash string) error {
+	key.CreatedAt = time.Now()
+	var expiresAt interface{}
+	if key.ExpiresAt != nil {
+		expiresAt = *key.ExpiresAt
+	}
+	result, err := db.conn.Exec(`
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, allowed_ips, expires_at, created_at, allow_query_token)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, key.Name, key.Prefix, keyHash, strings.Join(key.Scopes, ","), strings.Join(key.AllowedIPs, ","),
+		expiresAt, key.CreatedAt, key.AllowQueryToken)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	key.ID = int(id)
+	return nil
+}
+
+// ListAPIKeys 返回所有 API 密钥（包括已吊销的），按创建顺序排列
+func (db *DB) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := db.conn.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash 按密钥哈希查找 API 密钥，不存在时返回 nil
+func (db *DB) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	row := db.conn.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, keyHash)
+	key, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, nil
+}
+
+// RevokeAPIKey 吊销 API 密钥，密钥不存在或已吊销时返回 false
+func (db *DB) RevokeAPIKey(id int) (bool, error) {
+	result, err := db.conn.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// TouchAPIKey 记录 API 密钥的最近使用时间和来源 IP
+func (db *DB) TouchAPIKey(id int, ip string, at time.Time) error {
+	if _, err := db.conn.Exec(`UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, at, ip, id); err != nil {
+		return fmt.Errorf("failed to update api key usage: %w", err)
+	}
+	return nil
+}
+
+// userColumns 查询用户时使用的列，与 scanUser 的顺序保持一致
+const userColumns = `id, username, role, mailboxes, totp_enabled, totp_required, oidc_subject, created_at, updated_at, last_login_at, password_hash`
+
+// scanUser 读取用户及其密码哈希
+func scanUser(row rowScanner) (*models.User, string, error) {
+	var user models.User
+	var mailboxes, passwordHash string
+	var lastLoginAt sql.NullTime
+	if err := row.Scan(&user.ID, &user.Username, &user.Role, &mailboxes, &user.TOTPEnabled, &user.TOTPRequired, &user.OIDCSubject,
+		&user.CreatedAt, &user.UpdatedAt, &lastLoginAt, &passwordHash); err != nil {
+		return nil, "", err
+	}
+	user.Mailboxes = splitList(mailboxes)
+	user.LastLoginAt = nullTimePtr(lastLoginAt)
+	return &user, passwordHash, nil
+}
+
+// CreateUser 保存新用户，passwordHash 为慢哈希后的密码（OIDC 用户为空，不能用密码登录）；成功后填充 user 的 ID 和创建时间
+func (db *DB) CreateUser(user *models.User, passwordHash string) error {
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	result, err := db.conn.Exec(`
+		INSERT INTO users (username, password_hash, role, mailboxes, oidc_subject, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, user.Username, passwordHash, user.Role, strings.Join(user.Mailboxes, ","), user.OIDCSubject, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	user.ID = int(id)
+	return nil
+}
+
+// ListUsers 返回所有用户，按创建顺序排列
+func (db *DB) ListUsers() ([]models.User, error) {
+	rows, err := db.conn.Query(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, _, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// GetUserByID 按 ID 查找用户，不存在时返回 nil
+func (db *DB) GetUserByID(id int) (*models.User, error) {
+	user, _, err := scanUser(db.conn.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByUsername 按用户名（不区分大小写）查找用户及其密码哈希，不存在时返回 nil
+func (db *DB) GetUserByUsername(username string) (*models.User, string, error) {
+	user, passwordHash, err := scanUser(db.conn.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, passwordHash, nil
+}
+
+// GetUserByOIDCSubject 按 OIDC sub 查找用户，不存在时返回 nil
+func (db *DB) GetUserByOIDCSubject(subject string) (*models.User, error) {
+	if subject == "" {
+		return nil, nil
+	}
+	user, _, err := scanUser(db.conn.QueryRow(`SELECT `+userColumns+` FROM users WHERE oidc_subject = ?`, subject))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// UpdateUser 保存用户的角色、邮箱和是否强制 TOTP，passwordHash 非空时同时修改密码
+func (db *DB) UpdateUser(user *models.User, passwordHash string) error {
+	user.UpdatedAt = time.Now()
+	query := `UPDATE users SET role = ?, mailboxes = ?, totp_required = ?, updated_at = ? WHERE id = ?`
+	args := []interface{}{user.Role, strings.Join(user.Mailboxes, ","), user.TOTPRequired, user.UpdatedAt, user.ID}
+	if passwordHash != "" {
+		query = `UPDATE users SET role = ?, mailboxes = ?, totp_required = ?, updated_at = ?, password_hash = ? WHERE id = ?`
+		args = []interface{}{user.Role, strings.Join(user.Mailboxes, ","), user.TOTPRequired, user.UpdatedAt, passwordHash, user.ID}
+	}
+	if _, err := db.conn.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser 删除用户，用户不存在时返回 false
+func (db *DB) DeleteUser(id int) (bool, error) {
+	result, err := db.conn.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// CountUsers 返回指定角色的用户数，role 为空时返回全部用户数
+func (db *DB) CountUsers(role string) (int, error) {
+	var count int
+	var err error
+	if role == "" {
+		err = db.conn.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count)
+	} else {
+		err = db.conn.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, role).Scan(&count)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// GetUserTOTP 读取用户的 TOTP 状态，用户不存在时返回 nil
+func (db *DB) GetUserTOTP(id int) (*models.UserTOTP, error) {
+	var totp models.UserTOTP
+	var recoveryCodes string
+	err := db.conn.QueryRow(`
+		SELECT totp_secret, totp_enabled, totp_last_counter, recovery_codes FROM users WHERE id = ?
+	`, id).Scan(&totp.Secret, &totp.Enabled, &totp.LastCounter, &recoveryCodes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user totp: %w", err)
+	}
+	totp.RecoveryCodes = splitList(recoveryCodes)
+	return &totp, nil
+}
+
+// SaveUserTOTP 保存用户的 TOTP 状态
+func (db *DB) SaveUserTOTP(id int, totp *models.UserTOTP) error {
+	_, err := db.conn.Exec(`
+		UPDATE users SET totp_secret = ?, totp_enabled = ?, totp_last_counter = ?, recovery_codes = ?, updated_at = ?
+		WHERE id = ?
+	`, totp.Secret, totp.Enabled, totp.LastCounter, strings.Join(totp.RecoveryCodes, ","), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to save user totp: %w", err)
+	}
+	return nil
+}
+
+// TouchUserLogin 记录用户的最近登录时间
+func (db *DB) TouchUserLogin(id int, at time.Time) error {
+	if _, err := db.conn.Exec(`UPDATE users SET last_login_at = ? WHERE id = ?`, at, id); err != nil {
+		return fmt.Errorf("failed to update user login: %w", err)
+	}
+	return nil
+}
+
+// sessionColumns 查询管理后台 session 时使用的列，与 scanSession 的顺序保持一致
+const sessionColumns = `s.id, s.user_id, COALESCE(u.username, ''), s.ip, s.user_agent, s.created_at, s.last_seen_at, s.expires_at`
+
+func scanSession(row rowScanner) (*models.AdminSession, error) {
+	var session models.AdminSession
+	if err := row.Scan(&session.ID, &session.UserID, &session.Username, &session.IP, &session.UserAgent,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CreateSession 保存管理后台 session，数据库只保存 token 的哈希；成功后填充 session 的 ID
+func (db *DB) CreateSession(session *models.AdminSession, tokenHash string) error {
+	result, err := db.conn.Exec(`
+		INSERT INTO admin_sessions (token_hash, user_id, ip, user_agent, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, tokenHash, session.UserID, session.IP, session.UserAgent, session.CreatedAt, session.LastSeenAt, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	session.ID = int(id)
+	return nil
+}
+
+// GetSessionByHash 按 token 哈希查找 session（包括已过期的），不存在时返回 nil
+func (db *DB) GetSessionByHash(tokenHash string) (*models.AdminSession, error) {
+	session, err := scanSession(db.conn.QueryRow(`
+		SELECT `+sessionColumns+` FROM admin_sessions s LEFT JOIN users u ON u.id = s.user_id WHERE s.token_hash = ?
+	`, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return session, nil
+}
+
+// ListSessions 返回未过期的 session，userID 为 0 时返回所有用户的 session，按最近活动时间倒序
+func (db *DB) ListSessions(userID int, now time.Time) ([]models.AdminSession, error) {
+	query := `SELECT ` + sessionColumns + ` FROM admin_sessions s LEFT JOIN users u ON u.id = s.user_id WHERE julianday(s.expires_at) > julianday(?)`
+	args := []interface{}{now.UTC().Format(sqliteTimeLayout)}
+	if userID != 0 {
+		query += ` AND s.user_id = ?`
+		args = append(args, userID)
+	}
+	rows, err := db.conn.Query(query+` ORDER BY s.last_seen_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.AdminSession{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession 记录 session 的最近活动时间和 IP，并延长有效期
+func (db *DB) TouchSession(id int, ip string, lastSeen, expires time.Time) error {
+	_, err := db.conn.Exec(`UPDATE admin_sessions SET ip = ?, last_seen_at = ?, expires_at = ? WHERE id = ?`, ip, lastSeen, expires, id)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession 删除 session，userID 非 0 时只删除该用户的 session；不存在时返回 false
+func (db *DB) DeleteSession(id, userID int) (bool, error) {
+	query := `DELETE FROM admin_sessions WHERE id = ?`
+	args := []interface{}{id}
+	if userID != 0 {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	result, err := db.conn.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete session: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete session: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// DeleteSessionByHash 按 token 哈希删除 session（登出）
+func (db *DB) DeleteSessionByHash(tokenHash string) error {
+	if _, err := db.conn.Exec(`DELETE FROM admin_sessions WHERE token_hash = ?`, tokenHash); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions 删除用户的所有 session，exceptID 非 0 时保留该 session，返回删除的数量
+func (db *DB) DeleteUserSessions(userID, exceptID int) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM admin_sessions WHERE user_id = ? AND id != ?`, userID, exceptID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// DeleteExpiredSessions 删除已过期的 session，返回删除的数量
+func (db *DB) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM admin_sessions WHERE julianday(expires_at) <= julianday(?)`, now.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// CountSessions 返回未过期的 session 数
+func (db *DB) CountSessions(now time.Time) (int, error) {
+	var count int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM admin_sessions WHERE julianday(expires_at) > julianday(?)`, now.UTC().Format(sqliteTimeLayout)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// InsertAuditEntry 写入一条审计日志，成功后填充 entry 的 ID
+func (db *DB) InsertAuditEntry(entry *models.AuditEntry) error {
+	result, err := db.conn.Exec(`
+		INSERT INTO audit_log (created_at, actor, actor_type, action, method, route, target_id, ip, status, success, details)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.CreatedAt, entry.Actor, entry.ActorType, entry.Action, entry.Method, entry.Route, entry.TargetID,
+		entry.IP, entry.Status, entry.Success, entry.Details)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	entry.ID = int(id)
+	return nil
+}
+
+// ListAuditEntries 按条件筛选审计日志，按时间倒序分页，同时返回符合条件的总数
+func (db *DB) ListAuditEntries(query models.AuditQuery) ([]models.AuditEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+	for _, filter := range []struct {
+		column string
+		value  string
+	}{{"actor", query.Actor}, {"action", query.Action}, {"target_id", query.TargetID}, {"ip", query.IP}} {
+		if filter.value != "" {
+			conditions = append(conditions, filter.column+" = ?")
+			args = append(args, filter.value)
+		}
+	}
+	if query.Success != nil {
+		conditions = append(conditions, "success = ?")
+		args = append(args, *query.Success)
+	}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "julianday(created_at) >= julianday(?)")
+		args = append(args, query.Since.UTC().Format(sqliteTimeLayout))
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "julianday(created_at) < julianday(?)")
+		args = append(args, query.Until.UTC().Format(sqliteTimeLayout))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT id, created_at, actor, actor_type, action, method, route, target_id, ip, status, success, details
+		FROM audit_log`+where+` ORDER BY id DESC LIMIT ? OFFSET ?
+	`, append(args, query.Limit, (query.Page-1)*query.Limit)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.CreatedAt, &entry.Actor, &entry.ActorType, &entry.Action, &entry.Method,
+			&entry.Route, &entry.TargetID, &entry.IP, &entry.Status, &entry.Success, &entry.Details); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// DeleteAuditEntriesBefore 删除早于 cutoff 的审计日志，返回删除的数量
+func (db *DB) DeleteAuditEntriesBefore(cutoff time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM audit_log WHERE julianday(created_at) < julianday(?)`, cutoff.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete audit entries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// splitList 拆分逗号分隔的列表，空字符串返回空切片
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// Size 返回数据库文件的大小（字节），按页数乘以页大小计算，不含 WAL 文件
+func (db *DB) Size() (int64, error) {
+	var pageCount, pageSize int64
+	if err := db.conn.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, fmt.Errorf("failed to get page count: %w", err)
+	}
+	if err := db.conn.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to get page size: %w", err)
+	}
+	return pageCount * pageSize, nil
+}
+
+// RowCounts 返回各数据表的行数
+func (db *DB) RowCounts() (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, table := range []string{"emails", "labels", "email_labels", "settings", "api_keys", "users", "admin_sessions", "audit_log"} {
+		var count int
+		if err := db.conn.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+// FolderCounts 返回每个文件夹的邮件数
+func (db *DB) FolderCounts() (map[string]int, error) {
+	rows, err := db.conn.Query("SELECT folder, COUNT(*) FROM emails GROUP BY folder")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count folders: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var folder string
+		var count int
+		if err := rows.Scan(&folder, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan folder counts: %w", err)
+		}
+		counts[folder] = count
+	}
+	return counts, rows.Err()
 }
 
 func (db *DB) Close() error {
@@ -0,0 +1,449 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"mailcat/internal/models"
+)
+
+func TestMailboxFilter(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, to := range []string{
+		"bob@example.com",
+		"Bob <BOB@Example.com>, carol@other.org",
+		"alice@example.com",
+		"jimbob@example.com",
+		"bob@example.com.evil",
+		"x@example.com.attacker",
+		"not an address",
+	} {
+		if _, err := db.SaveEmail(&models.EmailRequest{From: "sender@example.com", To: to, Subject: to}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		mailboxes []string
+		want      string
+	}{
+		{[]string{"bob@example.com"}, "Bob <BOB@Example.com>, carol@other.org|bob@example.com"},
+		{[]string{"@example.com"}, "Bob <BOB@Example.com>, carol@other.org|alice@example.com|bob@example.com|jimbob@example.com"},
+		{[]string{"carol@other.org", "x@example.com"}, "Bob <BOB@Example.com>, carol@other.org"},
+		{[]string{"@example.com.evil", "%", "_@example.com"}, "bob@example.com.evil"},
+		{[]string{}, ""},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := db.ForEachEmail(models.EmailFilter{Mailboxes: tt.mailboxes}, func(email *models.Email) error {
+			got = append(got, email.To)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ForEachEmail(%q) error: %v", tt.mailboxes, err)
+		}
+		sort.Strings(got)
+		if strings.Join(got, "|") != tt.want {
+			t.Errorf("mailboxes %q = %q, want %q", tt.mailboxes, got, tt.want)
+		}
+	}
+}
+
+func TestForEachEmailBatches(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	total := forEachEmailBatchSize*2 + 17
+	for i := 0; i < total; i++ {
+		email, err := db.SaveEmail(&models.EmailRequest{From: "a@example.com", To: "b@example.com", Subject: "s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%10 == 9 {
+			if err := db.MoveEmails([]int{email.ID}, models.FolderSpam); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	inbox := total - total/10
+
+	tests := []struct {
+		name   string
+		filter models.EmailFilter
+		want   int
+	}{
+		{"all", models.EmailFilter{Folder: models.FolderAll}, total},
+		{"filtered across batches", models.EmailFilter{}, inbox},
+		{"limit within a batch", models.EmailFilter{Folder: models.FolderAll, Limit: 30}, 30},
+		{"limit across batches", models.EmailFilter{Folder: models.FolderAll, Limit: forEachEmailBatchSize + 1}, forEachEmailBatchSize + 1},
+		{"limit equal to batch size", models.EmailFilter{Folder: models.FolderAll, Limit: forEachEmailBatchSize}, forEachEmailBatchSize},
+		{"limit above total", models.EmailFilter{Folder: models.FolderAll, Limit: total + 5}, total},
+	}
+	for _, tt := range tests {
+		var ids []int
+		err := db.ForEachEmail(tt.filter, func(email *models.Email) error {
+			ids = append(ids, email.ID)
+			// 回调中写入数据库不会被遍历阻塞
+			return db.SetEmailsRead([]int{email.ID}, true)
+		})
+		if err != nil {
+			t.Fatalf("%s: ForEachEmail error: %v", tt.name, err)
+		}
+		if len(ids) != tt.want {
+			t.Errorf("%s: visited %d emails, want %d", tt.name, len(ids), tt.want)
+		}
+		if !sort.IntsAreSorted(ids) {
+			t.Errorf("%s: emails are not in ID order", tt.name)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] == ids[i-1] {
+				t.Fatalf("%s: email %d visited twice", tt.name, ids[i])
+			}
+		}
+	}
+
+	// fn 返回错误时停止遍历
+	stop := errors.New("stop")
+	visited := 0
+	err = db.ForEachEmail(models.EmailFilter{Folder: models.FolderAll}, func(email *models.Email) error {
+		visited++
+		if visited == forEachEmailBatchSize+5 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visited != forEachEmailBatchSize+5 {
+		t.Errorf("ForEachEmail stopped after %d emails with %v, want %d and %v", visited, err, forEachEmailBatchSize+5, stop)
+	}
+}
+
+func TestMessageIDBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromHeaders, err := db.SaveEmail(&models.EmailRequest{
+		From: "a@example.com", To: "b@example.com",
+		Headers: map[string]string{"Message-ID": "<headers@example.com>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromRaw, err := db.SaveEmail(&models.EmailRequest{
+		From: "a@example.com", To: "b@example.com",
+		RawEmail: "From: a@example.com\nMessage-Id: <raw@example.com>\n\nbody\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟 message_id 列补上之前入库的邮件
+	if _, err := db.conn.Exec(`UPDATE emails SET message_id = NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.conn.Exec(`PRAGMA user_version = 10`); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := db.EmailExists("<headers@example.com>", ""); exists {
+		t.Fatal("message id found before the backfill")
+	}
+	db.Close()
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, messageID := range []string{"<headers@example.com>", "<raw@example.com>"} {
+		if exists, err := db.EmailExists(messageID, ""); err != nil || !exists {
+			t.Errorf("EmailExists(%q) = %v, %v after the backfill", messageID, exists, err)
+		}
+	}
+	var missing int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM emails WHERE message_id IS NULL AND id IN (?, ?)`, fromHeaders.ID, fromRaw.ID).Scan(&missing); err != nil || missing != 0 {
+		t.Errorf("%d emails still have no message id (%v)", missing, err)
+	}
+	status, err := db.MigrationStatus(context.Background())
+	if err != nil || !status.Current() {
+		t.Errorf("migration status = %+v, %v", status, err)
+	}
+}
+
+func TestUnreadCounts(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ids []int
+	for _, to := range []string{
+		"Bob <BOB@example.com>",
+		"bob@example.com, carol@example.com",
+		"carol@example.com",
+		"alice@example.com",
+		"not an address",
+		"bob@example.com",
+	} {
+		email, err := db.SaveEmail(&models.EmailRequest{From: "sender@example.com", To: to, Subject: to})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, email.ID)
+	}
+	// 已读的邮件和收件箱以外的邮件不计入未读数
+	if err := db.SetEmailsRead([]int{ids[3]}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MoveEmails([]int{ids[5]}, models.FolderSpam); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.GetEmailStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["total_emails"] != 6 || stats["unread_emails"] != 4 {
+		t.Errorf("total = %v, unread = %v, want 6 and 4", stats["total_emails"], stats["unread_emails"])
+	}
+	var got []string
+	for _, entry := range stats["unread_by_recipient"].([]map[string]interface{}) {
+		got = append(got, fmt.Sprintf("%v=%v", entry["recipient"], entry["count"]))
+	}
+	// 多个收件人的邮件计入每个收件人；按数量降序，数量相同时按地址排序
+	if want := "bob@example.com=2|carol@example.com=2|not an address=1"; strings.Join(got, "|") != want {
+		t.Errorf("unread by recipient = %s, want %s", strings.Join(got, "|"), want)
+	}
+
+	// 标记已读后未读数随之减少
+	if _, err := db.UpdateEmailState(ids[:2], models.EmailStateUpdate{IsRead: boolPtr(true)}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = db.GetEmailStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["unread_emails"] != 2 {
+		t.Errorf("unread after marking read = %v, want 2", stats["unread_emails"])
+	}
+}
+
+func TestListLabelsForMailboxes(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, email := range []struct {
+		to     string
+		labels []string
+	}{
+		{"alice@example.com", []string{"shared", "alice"}},
+		{"bob@example.com", []string{"shared", "bob"}},
+		{"Alice <alice@example.com>, bob@example.com", []string{"shared"}},
+	} {
+		saved, err := db.SaveEmail(&models.EmailRequest{From: "sender@example.com", To: email.to})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.UpdateEmailState([]int{saved.ID}, models.EmailStateUpdate{AddLabels: email.labels}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		mailboxes []string
+		want      string
+	}{
+		{nil, "alice=1|bob=1|shared=3"},
+		{[]string{"alice@example.com"}, "alice=1|shared=2"},
+		{[]string{"@example.com"}, "alice=1|bob=1|shared=3"},
+		{[]string{}, ""},
+	}
+	for _, tt := range tests {
+		labels, err := db.ListLabels(tt.mailboxes)
+		if err != nil {
+			t.Fatalf("ListLabels(%q) error: %v", tt.mailboxes, err)
+		}
+		var got []string
+		for _, label := range labels {
+			got = append(got, fmt.Sprintf("%s=%d", label.Name, label.Count))
+		}
+		if strings.Join(got, "|") != tt.want {
+			t.Errorf("ListLabels(%q) = %v, want %s", tt.mailboxes, got, tt.want)
+		}
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+// summaryPage 把一页结果格式化为 "ID 列表 next=游标 prev=游标"，没有游标时为 -
+func summaryPage(list *models.EmailSummaryList) string {
+	ids := make([]string, len(list.Emails))
+	for i, email := range list.Emails {
+		ids[i] = fmt.Sprint(email.ID)
+	}
+	cursor := func(c *int) string {
+		if c == nil {
+			return "-"
+		}
+		return fmt.Sprint(*c)
+	}
+	return fmt.Sprintf("[%s] next=%s prev=%s", strings.Join(ids, " "), cursor(list.NextCursor), cursor(list.PrevCursor))
+}
+
+func TestListEmailSummariesCursor(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// ID 1-10，偶数发给 even@example.com，奇数发给 odd@example.com；7 号移到垃圾邮件
+	for i := 1; i <= 10; i++ {
+		to := "odd@example.com"
+		if i%2 == 0 {
+			to = "even@example.com"
+		}
+		if _, err := db.SaveEmail(&models.EmailRequest{From: "sender@example.com", To: to, Subject: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.MoveEmails([]int{7}, models.FolderSpam); err != nil {
+		t.Fatal(err)
+	}
+
+	all := models.EmailFilter{Folder: models.FolderAll}
+	even := models.EmailFilter{Folder: models.FolderAll, To: "even@example.com"}
+	tests := []struct {
+		name   string
+		filter models.EmailFilter
+		query  models.EmailListQuery
+		want   string
+	}{
+		{"first page", all, models.EmailListQuery{Page: 1, Limit: 3}, "[10 9 8] next=8 prev=-"},
+		{"after", all, models.EmailListQuery{Limit: 3, AfterID: 8}, "[7 6 5] next=5 prev=7"},
+		{"after to last page", all, models.EmailListQuery{Limit: 3, AfterID: 3}, "[2 1] next=- prev=2"},
+		{"after exactly filling last page", all, models.EmailListQuery{Limit: 2, AfterID: 3}, "[2 1] next=- prev=2"},
+		{"after oldest", all, models.EmailListQuery{Limit: 3, AfterID: 1}, "[] next=- prev=-"},
+		// before_id 取游标之上最近的一页，结果仍按 ID 降序
+		{"before", all, models.EmailListQuery{Limit: 3, BeforeID: 2}, "[5 4 3] next=3 prev=5"},
+		{"before to first page", all, models.EmailListQuery{Limit: 3, BeforeID: 8}, "[10 9] next=9 prev=-"},
+		{"before newest", all, models.EmailListQuery{Limit: 3, BeforeID: 10}, "[] next=- prev=-"},
+		{"cursor not in result set", all, models.EmailListQuery{Limit: 3, AfterID: 100}, "[10 9 8] next=8 prev=-"},
+		// 游标与过滤条件组合时只在匹配的邮件之间翻页，游标也只考虑匹配的邮件
+		{"filtered first page", even, models.EmailListQuery{Page: 1, Limit: 2}, "[10 8] next=8 prev=-"},
+		{"filtered after", even, models.EmailListQuery{Limit: 2, AfterID: 8}, "[6 4] next=4 prev=6"},
+		{"filtered after odd cursor", even, models.EmailListQuery{Limit: 2, AfterID: 5}, "[4 2] next=- prev=4"},
+		{"filtered before", even, models.EmailListQuery{Limit: 2, BeforeID: 4}, "[8 6] next=6 prev=8"},
+		{"filtered before to first page", even, models.EmailListQuery{Limit: 2, BeforeID: 7}, "[10 8] next=8 prev=-"},
+		// 默认只看收件箱，垃圾邮件既不出现在结果中，也不影响游标
+		{"inbox skips spam", models.EmailFilter{}, models.EmailListQuery{Limit: 2, AfterID: 8}, "[6 5] next=5 prev=6"},
+		{"inbox before spam", models.EmailFilter{}, models.EmailListQuery{Limit: 1, BeforeID: 6}, "[8] next=8 prev=8"},
+		{"spam only", models.EmailFilter{Folder: models.FolderSpam}, models.EmailListQuery{Limit: 2, AfterID: 10}, "[7] next=- prev=-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := db.ListEmailSummaries(tt.filter, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summaryPage(list); got != tt.want {
+				t.Errorf("page = %s, want %s", got, tt.want)
+			}
+			// 只有按页码分页时统计总数
+			if cursor := tt.query.AfterID > 0 || tt.query.BeforeID > 0; cursor != (list.Total == nil) {
+				t.Errorf("total = %v for cursor query %v", list.Total, cursor)
+			}
+		})
+	}
+
+	// 沿 next_cursor 向后翻到底，再沿 prev_cursor 翻回来，两个方向经过相同的页
+	var forward, backward []string
+	list, err := db.ListEmailSummaries(all, models.EmailListQuery{Page: 1, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forward = append(forward, summaryPage(list))
+	for list.NextCursor != nil {
+		if list, err = db.ListEmailSummaries(all, models.EmailListQuery{Limit: 3, AfterID: *list.NextCursor}); err != nil {
+			t.Fatal(err)
+		}
+		forward = append(forward, summaryPage(list))
+	}
+	backward = append(backward, summaryPage(list))
+	for list.PrevCursor != nil {
+		if list, err = db.ListEmailSummaries(all, models.EmailListQuery{Limit: 3, BeforeID: *list.PrevCursor}); err != nil {
+			t.Fatal(err)
+		}
+		backward = append([]string{summaryPage(list)}, backward...)
+	}
+	if strings.Join(forward, "; ") != "[10 9 8] next=8 prev=-; [7 6 5] next=5 prev=7; [4 3 2] next=2 prev=4; [1] next=- prev=1" {
+		t.Errorf("forward pages = %v", forward)
+	}
+	if strings.Join(backward, "; ") != strings.Join(forward, "; ") {
+		t.Errorf("backward pages = %v, want %v", backward, forward)
+	}
+}
+
+func TestProbeWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.ProbeWrite(context.Background()); err != nil {
+		t.Fatalf("ProbeWrite() = %v", err)
+	}
+	// 探测回滚后连接可以继续正常写入
+	if _, err := db.SaveEmail(&models.EmailRequest{From: "a@example.com", To: "b@example.com", RawEmail: "Subject: x\r\n\r\nbody"}); err != nil {
+		t.Fatalf("SaveEmail() after probe = %v", err)
+	}
+
+	// 另一个连接持有写锁时探测失败
+	other, err := sql.Open(driverName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	tx, err := other.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO settings(key, value) VALUES ('probe', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := db.ProbeWrite(ctx); err == nil {
+		t.Error("ProbeWrite() succeeded while another connection holds the write lock")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ProbeWrite() waited %v, longer than the context deadline", elapsed)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ProbeWrite(context.Background()); err != nil {
+		t.Errorf("ProbeWrite() after the lock was released = %v", err)
+	}
+}
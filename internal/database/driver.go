@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"mailcat/internal/metrics"
+	"mailcat/internal/models"
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName 包装 sqlite3 驱动，记录每条语句的执行耗时
+const driverName = "sqlite3_metrics"
+
+func init() {
+	sql.Register(driverName, &timedDriver{&sqlite3.SQLiteDriver{ConnectHook: registerFuncs}})
+}
+
+// registerFuncs 为每个连接注册查询中使用的 Go 函数：
+// recipient_match(to_address, mailbox) 按 models.MatchMailbox 精确匹配收件人，用于 EmailFilter.Mailboxes
+func registerFuncs(conn *sqlite3.SQLiteConn) error {
+	return conn.RegisterFunc("recipient_match", models.MatchMailbox, true)
+}
+
+type timedDriver struct {
+	driver.Driver
+}
+
+func (d *timedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// timedConn 直接执行的 Exec/Query 计入 metrics.DBQueryDuration，
+// 事务中的语句同样经过这里
+type timedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer metrics.ObserveQuery("exec", query, time.Now())
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+// QueryContext 的耗时记录到结果集关闭时，包含逐行读取结果的时间：
+// SQLite 按需逐行执行查询，返回时通常只执行到第一行
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		metrics.ObserveQuery("query", query, start)
+		return nil, err
+	}
+	sqliteRows, ok := rows.(*sqlite3.SQLiteRows)
+	if !ok {
+		metrics.ObserveQuery("query", query, start)
+		return rows, nil
+	}
+	return &timedRows{SQLiteRows: sqliteRows, query: query, start: start}, nil
+}
+
+// timedRows 在 Close 时记录查询耗时，列类型等可选接口由内嵌的 SQLiteRows 提供
+type timedRows struct {
+	*sqlite3.SQLiteRows
+	query string
+	start time.Time
+}
+
+func (r *timedRows) Close() error {
+	defer metrics.ObserveQuery("query", r.query, r.start)
+	return r.SQLiteRows.Close()
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"bufio"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mailcat/internal/metrics"
+)
+
+// queryCount 从 /metrics 输出中读取 DBQueryDuration 的观测次数
+func queryCount(t *testing.T, operation, statement string) int {
+	t.Helper()
+	var b strings.Builder
+	if _, err := metrics.Default.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	prefix := `mailcat_db_query_duration_seconds_count{operation="` + operation + `",statement="` + statement + `"} `
+	scanner := bufio.NewScanner(strings.NewReader(b.String()))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), prefix); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+func TestQueryObservedOnClose(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	before := queryCount(t, "query", "with")
+	rows, err := db.conn.Query(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 100) SELECT i FROM n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	if count != 100 {
+		t.Fatalf("read %d rows, want 100", count)
+	}
+	// rows.Next 读完最后一行后 database/sql 会自动关闭结果集
+	if got := queryCount(t, "query", "with"); got != before+1 {
+		t.Errorf("observations after reading all rows = %d, want %d", got, before+1)
+	}
+	rows.Close()
+	if got := queryCount(t, "query", "with"); got != before+1 {
+		t.Errorf("observations after Close = %d, want %d (observed twice)", got, before+1)
+	}
+
+	// 提前关闭的结果集在 Close 时记录
+	before = queryCount(t, "query", "with")
+	rows, err = db.conn.Query(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 100) SELECT i FROM n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Next()
+	if got := queryCount(t, "query", "with"); got != before {
+		t.Errorf("observations before Close = %d, want %d", got, before)
+	}
+	rows.Close()
+	if got := queryCount(t, "query", "with"); got != before+1 {
+		t.Errorf("observations after Close = %d, want %d", got, before+1)
+	}
+
+	// 执行失败的查询立即记录
+	before = queryCount(t, "query", "select")
+	if _, err := db.conn.Query(`SELECT * FROM no_such_table`); err == nil {
+		t.Fatal("query on a missing table succeeded")
+	}
+	if got := queryCount(t, "query", "select"); got != before+1 {
+		t.Errorf("observations after a failed query = %d, want %d", got, before+1)
+	}
+}
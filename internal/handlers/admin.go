@@ -1,64 +1,64 @@
 package handlers
 
 import (
-	"crypto/hmac"
+	"context"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"mailcat/internal/analytics"
+	"mailcat/internal/apikeys"
 	"mailcat/internal/database"
+	"mailcat/internal/lockout"
+	"mailcat/internal/metrics"
+	"mailcat/internal/models"
+	"mailcat/internal/sessions"
+	"mailcat/internal/settings"
+	"mailcat/internal/users"
 	"github.com/gin-gonic/gin"
 )
 
 type AdminHandler struct {
 	db               *database.DB
-	authToken        string
-	adminPasswordHash string
-
-	// 随机 session 管理
-	sessions   map[string]time.Time // token -> 过期时间
-	sessionMu  sync.RWMutex
-
-	// 登录速率限制
-	loginAttempts map[string]*loginAttemptInfo
-	loginMu       sync.Mutex
-}
-
-type loginAttemptInfo struct {
-	count    int
-	firstAt  time.Time
-	lockedAt time.Time
+	settings         *settings.Store // 运行时设置，修改后立即生效
+	keys             *apikeys.Manager // 具有 admin 权限的 API 密钥也可以访问管理接口
+	users            *users.Manager // 管理后台用户
+	sessions         *sessions.Manager // 保存在数据库中的登录 session
+	location         *time.Location // 统计使用的时区
+
+	// 登录失败锁定，与 IMAP/POP3 登录共用
+	lockout *lockout.Lockout
+
+	// 密码验证通过、等待 TOTP 验证码的登录
+	challenges  map[string]*loginChallenge
+	challengeMu sync.Mutex
 }
 
-const (
-	maxLoginAttempts  = 5               // 最大尝试次数
-	loginWindow       = 5 * time.Minute // 计数窗口
-	lockDuration      = 15 * time.Minute // 锁定时长
-	sessionMaxAge     = 24 * time.Hour  // Session 有效期
-)
-
-func NewAdminHandler(db *database.DB, authToken, adminPassword string) *AdminHandler {
-	h := &AdminHandler{
+func NewAdminHandler(db *database.DB, store *settings.Store, keys *apikeys.Manager, userManager *users.Manager, sessionManager *sessions.Manager, loginLockout *lockout.Lockout, location *time.Location) *AdminHandler {
+	return &AdminHandler{
 		db:                db,
-		authToken:         authToken,
-		adminPasswordHash: sha256Hex(adminPassword),
-		sessions:          make(map[string]time.Time),
-		loginAttempts:     make(map[string]*loginAttemptInfo),
-	}
-	// 启动后台清理过期 session
-	go h.cleanExpiredSessions()
-	return h
+		settings:          store,
+		keys:              keys,
+		users:             userManager,
+		sessions:          sessionManager,
+		location:          location,
+		lockout:           loginLockout,
+		challenges:        make(map[string]*loginChallenge),
+	}
 }
 
-// sha256Hex 计算字符串的 SHA-256 哈希值并返回十六进制字符串
-func sha256Hex(s string) string {
-	h := sha256.Sum256([]byte(s))
-	return hex.EncodeToString(h[:])
+// clearUserSessions 使用户的所有 session 失效，用于修改密码和删除用户之后
+func (h *AdminHandler) clearUserSessions(userID int) {
+	if _, err := h.sessions.RevokeUser(userID, 0); err != nil {
+		log.Printf("Failed to revoke sessions of user %d: %v", userID, err)
+	}
 }
 
 // generateSessionToken 生成加密安全的随机 session token
@@ -70,85 +70,53 @@ func generateSessionToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-// cleanExpiredSessions 定期清理过期 session
-func (h *AdminHandler) cleanExpiredSessions() {
+// CleanExpiredSessions 定期清理过期 session，直到 ctx 被取消
+func (h *AdminHandler) CleanExpiredSessions(ctx context.Context) {
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
-	for range ticker.C {
-		h.sessionMu.Lock()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := h.sessions.DeleteExpired(); err != nil {
+			log.Printf("Failed to delete expired sessions: %v", err)
+		}
+
 		now := time.Now()
-		for token, expiry := range h.sessions {
-			if now.After(expiry) {
-				delete(h.sessions, token)
+		h.challengeMu.Lock()
+		for token, challenge := range h.challenges {
+			if now.After(challenge.expires) {
+				delete(h.challenges, token)
 			}
 		}
-		h.sessionMu.Unlock()
+		h.challengeMu.Unlock()
 	}
 }
 
-// validateSession 验证 session token 是否有效
-func (h *AdminHandler) validateSession(token string) bool {
-	h.sessionMu.RLock()
-	defer h.sessionMu.RUnlock()
-	expiry, exists := h.sessions[token]
-	if !exists {
-		return false
+// ActiveSessions 返回未过期的管理员 session 数
+func (h *AdminHandler) ActiveSessions() int {
+	count, err := h.sessions.Count()
+	if err != nil {
+		log.Printf("Failed to count sessions: %v", err)
 	}
-	return time.Now().Before(expiry)
+	return count
 }
 
 // checkRateLimit 检查登录速率限制，返回是否允许登录
 func (h *AdminHandler) checkRateLimit(ip string) (bool, int) {
-	h.loginMu.Lock()
-	defer h.loginMu.Unlock()
-
-	info, exists := h.loginAttempts[ip]
-	if !exists {
-		h.loginAttempts[ip] = &loginAttemptInfo{count: 0, firstAt: time.Now()}
-		return true, maxLoginAttempts
-	}
-
-	now := time.Now()
-
-	// 检查是否在锁定期间
-	if !info.lockedAt.IsZero() && now.Before(info.lockedAt.Add(lockDuration)) {
-		remaining := int(info.lockedAt.Add(lockDuration).Sub(now).Seconds())
-		return false, remaining
-	}
-
-	// 超出计数窗口则重置
-	if now.After(info.firstAt.Add(loginWindow)) {
-		info.count = 0
-		info.firstAt = now
-		info.lockedAt = time.Time{}
-	}
-
-	if info.count >= maxLoginAttempts {
-		info.lockedAt = now
-		return false, int(lockDuration.Seconds())
-	}
-
-	return true, maxLoginAttempts - info.count
+	return h.lockout.Check(ip)
 }
 
 // recordLoginAttempt 记录一次失败的登录尝试
 func (h *AdminHandler) recordLoginAttempt(ip string) {
-	h.loginMu.Lock()
-	defer h.loginMu.Unlock()
-
-	info, exists := h.loginAttempts[ip]
-	if !exists {
-		h.loginAttempts[ip] = &loginAttemptInfo{count: 1, firstAt: time.Now()}
-		return
-	}
-	info.count++
+	h.lockout.Fail(ip)
 }
 
 // resetLoginAttempts 登录成功后重置计数
 func (h *AdminHandler) resetLoginAttempts(ip string) {
-	h.loginMu.Lock()
-	defer h.loginMu.Unlock()
-	delete(h.loginAttempts, ip)
+	h.lockout.Reset(ip)
 }
 
 // AdminAuthMiddleware 管理员认证中间件
@@ -157,20 +125,73 @@ func (h *AdminHandler) AdminAuthMiddleware() gin.HandlerFunc {
 		// 检查session
 		session := c.GetHeader("X-Admin-Session")
 		if session == "" {
-			// 检查cookie
+			// 检查cookie，通过 cookie 认证的非 GET 请求需要 CSRF token
 			if cookie, err := c.Cookie("admin_session"); err == nil {
 				session = cookie
+				if !checkCSRF(c, session) {
+					return
+				}
 			}
 		}
 		
-		// 使用随机 session token 验证
-		if !h.validateSession(session) {
+		// 没有 session 时可以使用具有 admin 权限的 API 密钥
+		if session == "" && strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			key, err := h.keys.Authenticate(token, c.ClientIP(), models.ScopeAdmin)
+			if err != nil {
+				abortAPIKeyError(c, err)
+				return
+			}
+			c.Set("api_key", key)
+			c.Set(adminUserKey, &models.User{Username: "api_key:" + key.Name, Role: models.RoleAdmin})
+			c.Next()
+			return
+		}
+
+		// 使用随机 session token 验证，每次请求重新读取用户，角色修改立即生效
+		adminSession, err := h.sessions.Validate(session, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load session",
+				"details": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if adminSession == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized",
+			})
+			c.Abort()
+			return
+		}
+		user, err := h.users.Get(adminSession.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load user",
+				"details": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if user == nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Unauthorized",
 			})
 			c.Abort()
 			return
 		}
+		c.Set(adminUserKey, user)
+		c.Set(adminSessionKey, adminSession)
+
+		// 要求 TOTP 但尚未绑定的用户只能访问当前用户和 TOTP 绑定接口
+		if !user.TOTPEnabled && h.totpRequired(user) && !totpEnrollmentRoute(c.FullPath()) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "TOTP enrollment required",
+			})
+			c.Abort()
+			return
+		}
 		
 		c.Next()
 	}
@@ -191,7 +212,8 @@ func (h *AdminHandler) Login(c *gin.Context) {
 	}
 
 	var loginReq struct {
-		Password string `json:"password"`
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
 	}
 	
 	if err := c.ShouldBindJSON(&loginReq); err != nil {
@@ -201,38 +223,82 @@ func (h *AdminHandler) Login(c *gin.Context) {
 		return
 	}
 	
-	// 前端发送的是 SHA-256 哈希后的密码，使用 HMAC 安全比较防止时序攻击
-	if !hmac.Equal([]byte(loginReq.Password), []byte(h.adminPasswordHash)) {
+	setAuditActor(c, loginReq.Username)
+
+	// 前端发送的是 SHA-256 哈希后的密码，服务端与保存的 bcrypt 哈希比较
+	user, err := h.users.Authenticate(loginReq.Username, loginReq.Password)
+	if err == users.ErrInvalidCredentials {
 		h.recordLoginAttempt(clientIP)
+		metrics.LoginFailures.Inc("admin")
 		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid password",
+			"error": "Invalid username or password",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Internal server error",
 		})
 		return
 	}
 	
+	// 已启用 TOTP 的用户需要通过 /admin/login/totp 提交验证码后才能获得 session
+	if user.TOTPEnabled {
+		challenge, err := h.newLoginChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Internal server error",
+			})
+			return
+		}
+		setAuditDetails(c, "verification code required")
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "Verification code required",
+			"totp_required": true,
+			"challenge":     challenge,
+		})
+		return
+	}
+
 	// 登录成功，重置速率限制
 	h.resetLoginAttempts(clientIP)
+	h.startSession(c, user, gin.H{
+		"totp_enrollment_required": h.totpRequired(user),
+	})
+}
 
-	// 生成加密安全的随机 session token
-	sessionToken, err := generateSessionToken()
+// startSession 登录成功后创建 session，extra 中的字段附加到响应中
+func (h *AdminHandler) startSession(c *gin.Context, user *models.User, extra gin.H) {
+	sessionToken, err := h.createSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal server error",
 		})
 		return
 	}
+	
+	response := gin.H{
+		"message":    "Login successful",
+		"session":    sessionToken,
+		"csrf_token": csrfToken(sessionToken),
+		"user":       user,
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
+}
 
-	// 存储 session
-	h.sessionMu.Lock()
-	h.sessions[sessionToken] = time.Now().Add(sessionMaxAge)
-	h.sessionMu.Unlock()
+// createSession 为用户创建 session 并写入 cookie，返回 session token
+func (h *AdminHandler) createSession(c *gin.Context, user *models.User) (string, error) {
+	sessionToken, _, err := h.sessions.Create(user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return "", err
+	}
 
-	c.SetCookie("admin_session", sessionToken, int(sessionMaxAge.Seconds()), "/", "", false, true)
-	
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"session": sessionToken,
-	})
+	setCookie(c, "admin_session", sessionToken, int(sessions.MaxAge.Seconds()), "/", http.SameSiteStrictMode)
+	setCSRFCookie(c, sessionToken, int(sessions.MaxAge.Seconds()))
+	return sessionToken, nil
 }
 
 // Logout 处理登出请求
@@ -242,22 +308,32 @@ func (h *AdminHandler) Logout(c *gin.Context) {
 	if session == "" {
 		if cookie, err := c.Cookie("admin_session"); err == nil {
 			session = cookie
+			if !checkCSRF(c, session) {
+				return
+			}
 		}
 	}
-	if session != "" {
-		h.sessionMu.Lock()
-		delete(h.sessions, session)
-		h.sessionMu.Unlock()
+	if current, err := h.sessions.Validate(session, c.ClientIP()); err == nil && current != nil {
+		setAuditActor(c, current.Username)
+	}
+	if err := h.sessions.RevokeToken(session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to log out",
+			"details": err.Error(),
+		})
+		return
 	}
 
-	c.SetCookie("admin_session", "", -1, "/", "", false, true)
+	setCookie(c, "admin_session", "", -1, "/", http.SameSiteStrictMode)
+	setCSRFCookie(c, "", -1)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Logout successful",
 	})
 }
 
 
-// GetStats 获取统计信息
+// GetStats 获取统计信息。analytics 部分支持 ?since=&until=（RFC 3339 或按配置时区解析的 YYYY-MM-DD，
+// until 不包含在内）、?bucket=hour|day|month 和 ?top=，默认统计最近 7 天
 func (h *AdminHandler) GetStats(c *gin.Context) {
 	stats, err := h.db.GetEmailStats()
 	if err != nil {
@@ -267,6 +343,67 @@ func (h *AdminHandler) GetStats(c *gin.Context) {
 		})
 		return
 	}
+
+	// “今天”和最近 7 天按配置的时区计算
+	now := time.Now().In(h.location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, h.location)
+	tomorrow := today.AddDate(0, 0, 1)
+	weekStart := today.AddDate(0, 0, -6)
+
+	opts, err := h.parseAnalyticsOptions(c, weekStart, tomorrow)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	report, err := analytics.New(opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	weekly, err := analytics.New(analytics.Options{Since: weekStart, Until: tomorrow, Bucket: analytics.BucketDay, Location: h.location})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 一次扫描同时累计两个时间范围
+	since, until := opts.Since, opts.Until
+	if weekStart.Before(since) {
+		since = weekStart
+	}
+	if tomorrow.After(until) {
+		until = tomorrow
+	}
+	err = h.db.ForEachEmailStat(since, until, func(stat models.EmailStat) error {
+		report.Add(stat)
+		weekly.Add(stat)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get stats",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	weeklyReport := weekly.Report()
+	weeklyStats := make([]gin.H, len(weeklyReport.Series))
+	for i, bucket := range weeklyReport.Series {
+		weeklyStats[i] = gin.H{
+			"date":  bucket.Label,
+			"count": bucket.Count,
+		}
+	}
+	stats["today_emails"] = weeklyReport.Series[len(weeklyReport.Series)-1].Count
+	stats["weekly_stats"] = weeklyStats
+	stats["analytics"] = report.Report()
 	
 	// 添加系统状态
 	stats["system_status"] = "running"
@@ -274,22 +411,56 @@ func (h *AdminHandler) GetStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
-// GetAdminEmails 获取邮件列表（管理员接口）
-func (h *AdminHandler) GetAdminEmails(c *gin.Context) {
-	pageStr := c.DefaultQuery("page", "1")
-	limitStr := c.DefaultQuery("limit", "20")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+// parseAnalyticsOptions 解析统计参数，未指定时间范围时使用 [defaultSince, defaultUntil)
+func (h *AdminHandler) parseAnalyticsOptions(c *gin.Context, defaultSince, defaultUntil time.Time) (analytics.Options, error) {
+	opts := analytics.Options{
+		Since:    defaultSince,
+		Until:    defaultUntil,
+		Bucket:   c.Query("bucket"),
+		Location: h.location,
+	}
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &opts.Since}, {"until", &opts.Until}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeIn(value, h.location)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s: %q", param.name, value)
+		}
+		*param.dest = t
+	}
+	if top := c.Query("top"); top != "" {
+		n, err := strconv.Atoi(top)
+		if err != nil || n < 1 || n > 100 {
+			return opts, fmt.Errorf("top must be between 1 and 100")
+		}
+		opts.Top = n
 	}
+	return opts, nil
+}
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 || limit > 100 {
-		limit = 20
+// GetAdminEmails 获取邮件列表（管理员接口），只返回摘要字段
+func (h *AdminHandler) GetAdminEmails(c *gin.Context) {
+	query, err := parseListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	response, err := h.db.GetEmails(page, limit)
+	list, err := h.db.ListEmailSummaries(filter, query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get emails",
@@ -297,27 +468,26 @@ func (h *AdminHandler) GetAdminEmails(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, list)
 }
 
-// GetConfig 获取配置信息（仅显示脱敏后的令牌）
+// GetConfig 获取运行时设置，API 令牌只返回掩码；overrides 列出保存在数据库中、覆盖了配置文件的设置项
 func (h *AdminHandler) GetConfig(c *gin.Context) {
-	masked := h.authToken
-	if len(masked) > 8 {
-		masked = masked[:4] + "****" + masked[len(masked)-4:]
-	} else {
-		masked = "****"
-	}
-	c.JSON(http.StatusOK, gin.H{
-		"api_token": masked,
-	})
+	c.JSON(http.StatusOK, h.configResponse())
 }
 
-// SaveConfig 保存配置信息
+// SaveConfig 保存运行时设置并立即生效。留空或省略的字段保持不变，reset 中的设置项恢复为配置文件中的值；
+// 管理员密码改为按用户管理，提交 admin_password 会返回错误
 func (h *AdminHandler) SaveConfig(c *gin.Context) {
 	var configReq struct {
-		APIToken      string `json:"api_token"`
-		AdminPassword string `json:"admin_password"`
+		APIToken           string   `json:"api_token"`
+		AdminPassword      string   `json:"admin_password"`
+		SpamThreshold      *float64 `json:"spam_threshold"`
+		RemoteImages       string   `json:"remote_images"`
+		ImportMaxUploadMB  *int64   `json:"import_max_upload_mb"`
+		RequireTOTP        *bool    `json:"require_totp"`
+		AuditRetentionDays *int     `json:"audit_retention_days"`
+		Reset              []string `json:"reset"`
 	}
 
 	if err := c.ShouldBindJSON(&configReq); err != nil {
@@ -327,11 +497,84 @@ func (h *AdminHandler) SaveConfig(c *gin.Context) {
 		return
 	}
 
-	// 这里应该保存到配置文件
-	// 简化实现，只返回成功
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Configuration saved successfully",
-	})
+	set := make(map[string]string)
+	if configReq.APIToken != "" {
+		set[settings.KeyAPIToken] = configReq.APIToken
+	}
+	if configReq.AdminPassword != "" {
+		set[settings.KeyAdminPassword] = configReq.AdminPassword
+	}
+	if configReq.SpamThreshold != nil {
+		set[settings.KeySpamThreshold] = strconv.FormatFloat(*configReq.SpamThreshold, 'f', -1, 64)
+	}
+	if configReq.RemoteImages != "" {
+		set[settings.KeyRemoteImages] = configReq.RemoteImages
+	}
+	if configReq.ImportMaxUploadMB != nil {
+		set[settings.KeyImportMaxUploadMB] = strconv.FormatInt(*configReq.ImportMaxUploadMB, 10)
+	}
+	if configReq.RequireTOTP != nil {
+		set[settings.KeyRequireTOTP] = strconv.FormatBool(*configReq.RequireTOTP)
+	}
+	if configReq.AuditRetentionDays != nil {
+		set[settings.KeyAuditRetentionDays] = strconv.Itoa(*configReq.AuditRetentionDays)
+	}
+	if len(set) == 0 && len(configReq.Reset) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No settings to change",
+		})
+		return
+	}
+	setAuditDetails(c, settingsChangeSummary(set, configReq.Reset))
+
+	if _, err := h.settings.Update(set, configReq.Reset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to save configuration",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	response := h.configResponse()
+	response["message"] = "Configuration saved successfully"
+	c.JSON(http.StatusOK, response)
+}
+
+// settingsChangeSummary 审计日志中记录修改和重置的设置项名称，不记录值（可能是令牌）
+func settingsChangeSummary(set map[string]string, reset []string) string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	if len(keys) > 0 {
+		parts = append(parts, "set="+strings.Join(keys, ","))
+	}
+	if len(reset) > 0 {
+		parts = append(parts, "reset="+strings.Join(reset, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// configResponse 当前设置的响应内容
+func (h *AdminHandler) configResponse() gin.H {
+	current := h.settings.Get()
+	masked := current.APIToken
+	if len(masked) > 8 {
+		masked = masked[:4] + "****" + masked[len(masked)-4:]
+	} else {
+		masked = "****"
+	}
+	return gin.H{
+		"api_token":            masked,
+		"spam_threshold":       current.SpamThreshold,
+		"remote_images":        current.RemoteImages,
+		"import_max_upload_mb": current.ImportMaxUploadMB,
+		"require_totp":         current.RequireTOTP,
+		"audit_retention_days": current.AuditRetentionDays,
+		"overrides":            h.settings.Overrides(),
+	}
 }
 
 // escapeHtml HTML转义函数
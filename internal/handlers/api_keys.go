@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"mailcat/internal/apikeys"
+	"mailcat/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler 管理接口中的 API 密钥管理
+type APIKeyHandler struct {
+	keys *apikeys.Manager
+}
+
+func NewAPIKeyHandler(keys *apikeys.Manager) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// ListAPIKeys 列出所有 API 密钥（包括已吊销的），不返回密钥本身
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.keys.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list api keys",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+	})
+}
+
+// CreateAPIKey 创建 API 密钥，明文密钥只在本次响应中返回
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	key, plaintext, err := h.keys.Create(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to create api key",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	setAuditTarget(c, key.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key":     plaintext,
+		"message": "Store this key now, it will not be shown again",
+	})
+}
+
+// RevokeAPIKey 吊销 API 密钥，立即生效
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid api key ID",
+		})
+		return
+	}
+
+	revoked, err := h.keys.Revoke(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to revoke api key",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "API key not found or already revoked",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked",
+	})
+}
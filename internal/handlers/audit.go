@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcat/internal/audit"
+	"mailcat/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// auditActorKey 尚未认证的请求（登录、登出）由处理器在 gin.Context 中保存操作者用户名的键
+	auditActorKey = "audit_actor"
+	// auditTargetKey 处理器保存操作对象 ID 的键，未设置时使用路由参数 :id
+	auditTargetKey = "audit_target"
+	// auditDetailsKey 处理器保存补充说明的键
+	auditDetailsKey = "audit_details"
+	// auditFailedKey 处理器标记操作失败的键，用于失败时仍返回 2xx/3xx 的请求（如 OIDC 回调）
+	auditFailedKey = "audit_failed"
+)
+
+// auditedRoutes 需要记录审计日志的路由（方法 + 路由模板）及其操作名称
+var auditedRoutes = map[string]string{
+	"POST /admin/login":        "login",
+	"POST /admin/login/totp":   "login.totp",
+	"GET /admin/oidc/callback": "login.oidc",
+	"POST /admin/logout":       "logout",
+
+	"GET /admin/api/emails/:id":              "email.view",
+	"GET /admin/api/emails/:id/structure":    "email.structure",
+	"GET /admin/api/emails/:id/raw":          "email.raw",
+	"PATCH /admin/api/emails":                "email.update",
+	"PATCH /admin/api/emails/:id":            "email.update",
+	"GET /admin/api/export":                  "email.export",
+	"POST /admin/api/import":                 "email.import",
+	"POST /admin/api/config":                 "config.update",
+	"POST /admin/api/keys":                   "api_key.create",
+	"DELETE /admin/api/keys/:id":             "api_key.revoke",
+	"POST /admin/api/users":                  "user.create",
+	"PATCH /admin/api/users/:id":             "user.update",
+	"DELETE /admin/api/users/:id":            "user.delete",
+	"DELETE /admin/api/users/:id/totp":       "user.totp_reset",
+	"DELETE /admin/api/sessions/:id":         "session.revoke",
+	"POST /admin/api/sessions/revoke-others": "session.revoke_others",
+	"POST /admin/api/totp/enable":            "totp.enable",
+	"POST /admin/api/totp/disable":           "totp.disable",
+	"POST /admin/api/totp/recovery-codes":    "totp.recovery_codes",
+
+	"POST /api/v1/emails":              "email.receive",
+	"GET /api/v1/emails":               "email.list",
+	"GET /api/v1/emails/:id":           "email.view",
+	"GET /api/v1/emails/:id/structure": "email.structure",
+	"GET /api/v1/emails/:id/raw":       "email.raw",
+	"GET /api/v1/emails/:id/inline":    "email.inline",
+	"PATCH /api/v1/emails":             "email.update",
+	"PATCH /api/v1/emails/:id":         "email.update",
+	"DELETE /api/v1/emails/:id":        "email.delete",
+	"GET /api/v1/labels":               "labels.list",
+	"GET /api/v1/export":               "email.export",
+}
+
+// AuditMiddleware 为 auditedRoutes 中的路由记录审计日志：操作者、IP、路由、操作对象和响应状态。
+// 注册在认证中间件之前，认证失败的请求也会被记录
+func AuditMiddleware(logger *audit.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action, ok := auditedRoutes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		c.Next()
+
+		entry := models.AuditEntry{
+			Action:   action,
+			Method:   c.Request.Method,
+			Route:    c.FullPath(),
+			TargetID: c.Param("id"),
+			IP:       c.ClientIP(),
+			Status:   c.Writer.Status(),
+			Details:  c.GetString(auditDetailsKey),
+		}
+		entry.Actor, entry.ActorType = auditActor(c)
+		if target := c.GetString(auditTargetKey); target != "" {
+			entry.TargetID = target
+		}
+		entry.Success = entry.Status < http.StatusBadRequest && !c.GetBool(auditFailedKey)
+		logger.Record(entry)
+	}
+}
+
+// auditActor 返回请求的操作者：已认证的用户、API 密钥，或处理器记录的尝试登录的用户名
+func auditActor(c *gin.Context) (string, string) {
+	if value, ok := c.Get("api_key"); ok {
+		if key, ok := value.(*models.APIKey); ok {
+			return "api_key:" + key.Name, models.ActorAPIKey
+		}
+	}
+	if user := currentUser(c); user != nil {
+		return user.Username, models.ActorUser
+	}
+	if actor := c.GetString(auditActorKey); actor != "" {
+		return actor, models.ActorUser
+	}
+	return "", models.ActorAnonymous
+}
+
+// setAuditActor 记录尚未认证的请求的操作者（例如登录时提交的用户名）
+func setAuditActor(c *gin.Context, username string) {
+	c.Set(auditActorKey, username)
+}
+
+// setAuditTarget 记录操作对象的 ID，用于 ID 不在路由参数中的请求（创建、批量操作）
+func setAuditTarget(c *gin.Context, ids ...int) {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	c.Set(auditTargetKey, strings.Join(parts, ","))
+}
+
+// setAuditDetails 记录补充说明，不得包含密码、令牌等敏感信息
+func setAuditDetails(c *gin.Context, details string) {
+	c.Set(auditDetailsKey, details)
+}
+
+// auditFailure 标记操作失败并记录原因
+func auditFailure(c *gin.Context, reason string) {
+	c.Set(auditFailedKey, true)
+	setAuditDetails(c, reason)
+}
+
+// AuditHandler 审计日志查询
+type AuditHandler struct {
+	logger   *audit.Logger
+	location *time.Location
+}
+
+// NewAuditHandler 创建审计日志处理器，日期参数按 location 解析
+func NewAuditHandler(logger *audit.Logger, location *time.Location) *AuditHandler {
+	return &AuditHandler{logger: logger, location: location}
+}
+
+// ListAuditLog 分页查询审计日志，支持按 actor、action、target_id、ip、success 和时间范围（since、until）筛选
+func (h *AuditHandler) ListAuditLog(c *gin.Context) {
+	query, err := h.parseAuditQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	list, err := h.logger.List(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get audit log",
+			"details": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// parseAuditQuery 解析筛选和分页参数，每页默认 50 条，最多 500 条
+func (h *AuditHandler) parseAuditQuery(c *gin.Context) (models.AuditQuery, error) {
+	query := models.AuditQuery{
+		Actor:    c.Query("actor"),
+		Action:   c.Query("action"),
+		TargetID: c.Query("target_id"),
+		IP:       c.Query("ip"),
+		Page:     1,
+		Limit:    50,
+	}
+	if page, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && page >= 1 {
+		query.Page = page
+	}
+	if limit, err := strconv.Atoi(c.DefaultQuery("limit", "50")); err == nil && limit >= 1 && limit <= 500 {
+		query.Limit = limit
+	}
+	if value := c.Query("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid success: %q", value)
+		}
+		query.Success = &success
+	}
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeIn(value, h.location)
+		if err != nil {
+			return query, fmt.Errorf("invalid %s: %q", param.name, value)
+		}
+		*param.dest = t
+	}
+	return query, nil
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"mailcat/internal/audit"
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// auditEntries 返回按时间倒序的全部审计日志
+func auditEntries(t *testing.T, logger *audit.Logger) []models.AuditEntry {
+	t.Helper()
+	list, err := logger.List(models.AuditQuery{Page: 1, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list.Entries
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	a := newTestAdmin(t)
+	logger, err := audit.New(a.db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewEmailHandler(a.db, a.store, a.keys, nil, utils.SanitizeOptions{}, []byte("0123456789abcdef0123456789abcdef"))
+	_, session := a.login(t, "alice", models.RoleAdmin)
+
+	var ids []int
+	for _, raw := range []string{inlineTestMessage, "From: c@example.com\r\nTo: d@example.com\r\nSubject: hi\r\n\r\nhello\r\n"} {
+		email, err := a.db.SaveEmail(&models.EmailRequest{From: "a@example.com", To: "b@example.com", RawEmail: raw})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, email.ID)
+	}
+
+	r := gin.New()
+	r.Use(AuditMiddleware(logger))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/healthz", ok)
+	r.GET("/api/v1/emails", h.AuthMiddleware(models.ScopeEmailsRead), h.GetEmails)
+	r.GET("/api/v1/emails/:id/inline", h.InlineAuthMiddleware(), h.GetInlinePart)
+	r.GET("/admin/api/emails/:id", a.handler.AdminAuthMiddleware(), ok)
+
+	tests := []struct {
+		name       string
+		target     string
+		header     http.Header
+		wantStatus int
+		want       models.AuditEntry
+	}{
+		{
+			name:       "list records the returned ids",
+			target:     "/api/v1/emails",
+			header:     http.Header{"Authorization": {"Bearer api-token"}},
+			wantStatus: http.StatusOK,
+			want: models.AuditEntry{Action: "email.list", Actor: "api_key:api_token", ActorType: models.ActorAPIKey,
+				Route: "/api/v1/emails", TargetID: strconv.Itoa(ids[1]) + "," + strconv.Itoa(ids[0]), Success: true},
+		},
+		{
+			name:       "unauthenticated request is recorded",
+			target:     "/api/v1/emails",
+			wantStatus: http.StatusUnauthorized,
+			want:       models.AuditEntry{Action: "email.list", ActorType: models.ActorAnonymous, Route: "/api/v1/emails"},
+		},
+		{
+			name:       "inline part with api key",
+			target:     "/api/v1/emails/" + strconv.Itoa(ids[0]) + "/inline?cid=logo@example.com",
+			header:     http.Header{"Authorization": {"Bearer api-token"}},
+			wantStatus: http.StatusOK,
+			want: models.AuditEntry{Action: "email.inline", Actor: "api_key:api_token", ActorType: models.ActorAPIKey,
+				Route: "/api/v1/emails/:id/inline", TargetID: strconv.Itoa(ids[0]), Success: true},
+		},
+		{
+			name:       "inline part with signed url",
+			target:     h.inlinePartURL(ids[0], "logo@example.com"),
+			wantStatus: http.StatusOK,
+			want: models.AuditEntry{Action: "email.inline", ActorType: models.ActorAnonymous,
+				Route: "/api/v1/emails/:id/inline", TargetID: strconv.Itoa(ids[0]), Success: true, Details: "signed url"},
+		},
+		{
+			name:       "admin session",
+			target:     "/admin/api/emails/" + strconv.Itoa(ids[1]),
+			header:     http.Header{"X-Admin-Session": {session}},
+			wantStatus: http.StatusOK,
+			want: models.AuditEntry{Action: "email.view", Actor: "alice", ActorType: models.ActorUser,
+				Route: "/admin/api/emails/:id", TargetID: strconv.Itoa(ids[1]), Success: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(auditEntries(t, logger))
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			entries := auditEntries(t, logger)
+			if len(entries) != before+1 {
+				t.Fatalf("recorded %d entries, want 1", len(entries)-before)
+			}
+			got := entries[0]
+			want := tt.want
+			want.ID, want.CreatedAt = got.ID, got.CreatedAt
+			want.Method, want.IP, want.Status = http.MethodGet, "192.0.2.1", tt.wantStatus
+			if got != want {
+				t.Errorf("entry = %+v\nwant    %+v", got, want)
+			}
+		})
+	}
+
+	// 不在 auditedRoutes 中的路由不记录
+	before := len(auditEntries(t, logger))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if got := len(auditEntries(t, logger)); got != before {
+		t.Errorf("unaudited route recorded %d entries", got-before)
+	}
+}
+
+func TestListAuditLog(t *testing.T) {
+	a := newTestAdmin(t)
+	logger, err := audit.New(a.db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, entry := range []models.AuditEntry{
+		{Action: "login", Actor: "alice", IP: "192.0.2.1", Status: 200, Success: true},
+		{Action: "login", Actor: "bob", IP: "192.0.2.2", Status: 401},
+		{Action: "email.view", Actor: "alice", IP: "192.0.2.1", TargetID: "7", Status: 200, Success: true},
+		{Action: "email.delete", Actor: "api_key:ci", ActorType: models.ActorAPIKey, IP: "198.51.100.1", TargetID: "7", Status: 200, Success: true},
+	} {
+		entry.CreatedAt = base.AddDate(0, 0, i)
+		logger.Record(entry)
+	}
+
+	r := gin.New()
+	r.GET("/admin/api/audit", NewAuditHandler(logger, time.UTC).ListAuditLog)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantTotal  int
+		wantFirst  string // 第一条（最新）的 action
+	}{
+		{"", http.StatusOK, 4, "email.delete"},
+		{"?actor=alice", http.StatusOK, 2, "email.view"},
+		{"?action=login", http.StatusOK, 2, "login"},
+		{"?target_id=7", http.StatusOK, 2, "email.delete"},
+		{"?ip=192.0.2.2", http.StatusOK, 1, "login"},
+		{"?success=false", http.StatusOK, 1, "login"},
+		{"?success=true&actor=alice", http.StatusOK, 2, "email.view"},
+		{"?since=2024-03-02&until=2024-03-04", http.StatusOK, 2, "email.view"},
+		{"?since=2024-03-03T12:00:00Z", http.StatusOK, 2, "email.delete"},
+		{"?limit=1&page=2", http.StatusOK, 4, "email.view"},
+		{"?success=maybe", http.StatusBadRequest, 0, ""},
+		{"?since=yesterday", http.StatusBadRequest, 0, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/api/audit"+tt.query, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.query, w.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+		var list models.AuditList
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		if list.Total != tt.wantTotal {
+			t.Errorf("%s: total = %d, want %d", tt.query, list.Total, tt.wantTotal)
+		}
+		if len(list.Entries) == 0 || list.Entries[0].Action != tt.wantFirst {
+			t.Errorf("%s: entries = %+v, want first %s", tt.query, list.Entries, tt.wantFirst)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// csrfCookie 登录时写入的 CSRF token，前端脚本可以读取（不是 HttpOnly）
+	csrfCookie = "mailcat_csrf"
+	// csrfHeader 使用 cookie 认证的非 GET 请求需要在该请求头中提交 CSRF token
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfToken 由 session token 派生 CSRF token。跨站页面无法读取 HttpOnly 的 session cookie，
+// 因此无法算出该值；无需额外保存，重启和多实例部署时依然有效
+func csrfToken(session string) string {
+	mac := hmac.New(sha256.New, []byte(session))
+	mac.Write([]byte("mailcat-csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// setCSRFCookie 写入与 session 对应的 CSRF token cookie，session 为空时删除
+func setCSRFCookie(c *gin.Context, session string, maxAge int) {
+	value := ""
+	if session != "" {
+		value = csrfToken(session)
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(csrfCookie, value, maxAge, "/", "", isHTTPS(c), false)
+}
+
+// safeMethod GET、HEAD 和 OPTIONS 请求不修改状态，不需要 CSRF token
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// checkCSRF 校验通过 cookie 认证的非 GET 请求是否携带了正确的 CSRF token，失败时写入 403 响应并返回 false。
+// 使用 X-Admin-Session 请求头或 API 密钥认证的请求不会被跨站页面自动附带凭据，不需要校验
+func checkCSRF(c *gin.Context, session string) bool {
+	if safeMethod(c.Request.Method) {
+		return true
+	}
+	token := c.GetHeader(csrfHeader)
+	if token != "" && hmac.Equal([]byte(token), []byte(csrfToken(session))) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": "CSRF token missing or invalid",
+	})
+	c.Abort()
+	return false
+}
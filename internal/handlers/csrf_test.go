@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mailcat/internal/apikeys"
+	"mailcat/internal/config"
+	"mailcat/internal/database"
+	"mailcat/internal/lockout"
+	"mailcat/internal/models"
+	"mailcat/internal/sessions"
+	"mailcat/internal/settings"
+	"mailcat/internal/users"
+	"github.com/gin-gonic/gin"
+)
+
+// testAdmin 管理后台处理器的测试环境，数据库为临时文件
+type testAdmin struct {
+	db       *database.DB
+	store    *settings.Store
+	keys     *apikeys.Manager
+	users    *users.Manager
+	sessions *sessions.Manager
+	handler  *AdminHandler
+}
+
+func newTestAdmin(t *testing.T) *testAdmin {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{}
+	cfg.API.AuthToken = "api-token"
+	cfg.Admin.Password = "password"
+	store, err := settings.Load(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userManager, err := users.NewManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &testAdmin{db: db, store: store, keys: apikeys.NewManager(db, store), users: userManager, sessions: sessions.NewManager(db)}
+	a.handler = NewAdminHandler(db, store, a.keys, userManager, a.sessions, lockout.New(), time.UTC)
+	return a
+}
+
+// login 创建用户并为其创建 session，返回用户和 session token
+func (a *testAdmin) login(t *testing.T, username, role string, mailboxes ...string) (*models.User, string) {
+	t.Helper()
+	user, err := a.users.Create(models.CreateUserRequest{Username: username, Password: "password-" + username, Role: role, Mailboxes: mailboxes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := a.sessions.Create(user.ID, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, token
+}
+
+func TestCSRF(t *testing.T) {
+	a := newTestAdmin(t)
+	_, session := a.login(t, "alice", models.RoleAdmin)
+	_, other := a.login(t, "bob", models.RoleAdmin)
+
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api := r.Group("/admin/api", a.handler.AdminAuthMiddleware())
+	api.GET("/emails", ok)
+	api.HEAD("/emails", ok)
+	api.POST("/emails", ok)
+	api.DELETE("/emails/:id", ok)
+	r.POST("/admin/logout", a.handler.Logout)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		cookie string // admin_session cookie
+		header string // X-Admin-Session
+		token  string // X-CSRF-Token
+		want   int
+	}{
+		{"cookie without token", http.MethodPost, "/admin/api/emails", session, "", "", http.StatusForbidden},
+		{"cookie with wrong token", http.MethodPost, "/admin/api/emails", session, "", "wrong", http.StatusForbidden},
+		{"cookie with another session's token", http.MethodDelete, "/admin/api/emails/1", session, "", csrfToken(other), http.StatusForbidden},
+		{"cookie with correct token", http.MethodPost, "/admin/api/emails", session, "", csrfToken(session), http.StatusOK},
+		{"session header without token", http.MethodPost, "/admin/api/emails", "", session, "", http.StatusOK},
+		{"session header ignores the cookie", http.MethodPost, "/admin/api/emails", other, session, "", http.StatusOK},
+		{"GET with cookie", http.MethodGet, "/admin/api/emails", session, "", "", http.StatusOK},
+		{"HEAD with cookie", http.MethodHead, "/admin/api/emails", session, "", "", http.StatusOK},
+		{"invalid session is still checked for CSRF first", http.MethodPost, "/admin/api/emails", "expired", "", "", http.StatusForbidden},
+		{"logout with cookie without token", http.MethodPost, "/admin/logout", other, "", "", http.StatusForbidden},
+		{"logout with cookie and token", http.MethodPost, "/admin/logout", other, "", csrfToken(other), http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "admin_session", Value: tt.cookie})
+		}
+		if tt.header != "" {
+			req.Header.Set("X-Admin-Session", tt.header)
+		}
+		if tt.token != "" {
+			req.Header.Set(csrfHeader, tt.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	// 被拒绝的登出请求不会吊销 session
+	if s, err := a.sessions.Validate(session, "192.0.2.1"); err != nil || s == nil {
+		t.Errorf("session was revoked: %v", err)
+	}
+	if s, _ := a.sessions.Validate(other, "192.0.2.1"); s != nil {
+		t.Error("logout with a valid CSRF token did not revoke the session")
+	}
+}
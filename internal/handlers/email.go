@@ -1,63 +1,99 @@
 package handlers
 
 import (
-	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
 
+	"mailcat/internal/apikeys"
 	"mailcat/internal/database"
+	"mailcat/internal/ingest"
+	"mailcat/internal/message"
+	"mailcat/internal/metrics"
 	"mailcat/internal/models"
+	"mailcat/internal/settings"
 	"mailcat/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 type EmailHandler struct {
-	db        *database.DB
-	authToken string
+	db              *database.DB
+	settings        *settings.Store // 远程图片策略随设置修改立即生效
+	keys            *apikeys.Manager
+	ingest          *ingest.Pipeline
+	sanitizeOpts    utils.SanitizeOptions
+	inlineURLSecret []byte // 内嵌图片地址的签名密钥，见 LoadInlineURLSecret
 }
 
-func NewEmailHandler(db *database.DB, authToken string) *EmailHandler {
+func NewEmailHandler(db *database.DB, store *settings.Store, keys *apikeys.Manager, ingestPipeline *ingest.Pipeline, sanitizeOpts utils.SanitizeOptions, inlineURLSecret []byte) *EmailHandler {
 	return &EmailHandler{
-		db:        db,
-		authToken: authToken,
+		db:              db,
+		settings:        store,
+		keys:            keys,
+		ingest:          ingestPipeline,
+		sanitizeOpts:    sanitizeOpts,
+		inlineURLSecret: inlineURLSecret,
 	}
 }
 
-// AuthMiddleware 验证API令牌（支持 Authorization 请求头和 URL query 参数）
-func (h *EmailHandler) AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware 验证 API 密钥并检查权限范围。密钥通过 Authorization: Bearer <token> 请求头传递；
+// URL 参数 ?token=<token> 会出现在访问日志中，只接受创建时设置了 allow_query_token 的只读密钥。
+// 认证通过的密钥保存在上下文的 "api_key" 中
+func (h *EmailHandler) AuthMiddleware(scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authorized := false
-
-		// 方式1：Authorization: Bearer <token> 请求头
-		if header := c.GetHeader("Authorization"); header == "Bearer "+h.authToken {
-			authorized = true
-		}
-
-		// 方式2：URL query 参数 ?token=<token>
-		if !authorized {
-			if queryToken := c.Query("token"); queryToken == h.authToken {
-				authorized = true
-			}
+		var key *models.APIKey
+		var err error
+		if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			key, err = h.keys.Authenticate(strings.TrimPrefix(header, "Bearer "), c.ClientIP(), scope)
+		} else {
+			key, err = h.keys.AuthenticateQuery(c.Query("token"), c.ClientIP(), scope)
 		}
-
-		if !authorized {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Unauthorized",
-			})
-			c.Abort()
+		if err != nil {
+			abortAPIKeyError(c, err)
 			return
 		}
 
+		c.Set("api_key", key)
 		c.Next()
 	}
 }
 
+// abortAPIKeyError 根据认证失败的原因返回 401、403 或 500
+func abortAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, apikeys.ErrIPNotAllowed), errors.Is(err, apikeys.ErrScope):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"details": err.Error(),
+		})
+	case errors.Is(err, apikeys.ErrInvalidKey), errors.Is(err, apikeys.ErrExpired), errors.Is(err, apikeys.ErrRevoked):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Unauthorized",
+		})
+	case errors.Is(err, apikeys.ErrQueryToken):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"details": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to verify api key",
+			"details": err.Error(),
+		})
+	}
+	c.Abort()
+}
+
 // ReceiveEmail 接收来自Cloudflare Worker的邮件
 func (h *EmailHandler) ReceiveEmail(c *gin.Context) {
 	var emailReq models.EmailRequest
 	if err := c.ShouldBindJSON(&emailReq); err != nil {
+		metrics.IngestTotal.Inc(metrics.SourceAPI, metrics.IngestRejected)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid request body",
 			"details": err.Error(),
@@ -65,8 +101,10 @@ func (h *EmailHandler) ReceiveEmail(c *gin.Context) {
 		return
 	}
 
-	email, err := h.db.SaveEmail(&emailReq)
+	// 垃圾邮件评分后入库，超过阈值的邮件放入垃圾邮件文件夹
+	email, err := h.ingest.Ingest(c.Request.Context(), &emailReq)
 	if err != nil {
+		metrics.IngestTotal.Inc(metrics.SourceAPI, metrics.IngestRejected)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to save email",
 			"details": err.Error(),
@@ -74,28 +112,36 @@ func (h *EmailHandler) ReceiveEmail(c *gin.Context) {
 		return
 	}
 
+	metrics.IngestTotal.Inc(metrics.SourceAPI, metrics.IngestAccepted)
+	setAuditTarget(c, email.ID)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Email received successfully",
 		"email":   email,
 	})
 }
 
-// GetEmails 获取邮件列表
+// GetEmails 获取邮件列表，只返回摘要字段，正文通过详情接口获取
 func (h *EmailHandler) GetEmails(c *gin.Context) {
-	pageStr := c.DefaultQuery("page", "1")
-	limitStr := c.DefaultQuery("limit", "20")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+	query, err := parseListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 || limit > 100 {
-		limit = 20
+	// 默认排除垃圾邮件和已删除邮件，可通过 ?folder=spam、?folder=trash 或 ?folder=all 查看；
+	// 支持 is_read、is_starred、label 等过滤条件
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	response, err := h.db.GetEmails(page, limit)
+	list, err := h.db.ListEmailSummaries(filter, query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get emails",
@@ -104,98 +150,65 @@ func (h *EmailHandler) GetEmails(c *gin.Context) {
 		return
 	}
 
-	// 清理返回字段：只返回核心字段（发件人，收件人，收件时间，主题，内容）
-	optimizedEmails := make([]gin.H, len(response.Emails))
-	for i, email := range response.Emails {
-		// 解析和清理邮件内容
-		body := email.Body
-		htmlBody := email.HTMLBody
-		
-		// 首先检查是否是纯Base64编码的内容
-		if body != "" && isBase64Content(body) {
-			if decoded, err := base64.StdEncoding.DecodeString(body); err == nil {
-				body = string(decoded)
-			}
-		}
-		
-		// 优先尝试解析MIME格式内容（包含base64解码）
-		if body != "" && isMIMEContent(body) {
-			if parsedContent, parseErr := utils.ParseMIMEContent(body); parseErr == nil {
-				if parsedContent.TextBody != "" {
-					body = parsedContent.TextBody
-				}
-				if parsedContent.HTMLBody != "" {
-					htmlBody = parsedContent.HTMLBody
-				}
-			}
-		} else if body != "" && (strings.Contains(body, "Content-Type:") || strings.Contains(body, "boundary=")) {
-			// 如果body包含multipart数据，尝试标准解析
-			if parsedContent, parseErr := utils.ParseEmailFromRaw(body); parseErr == nil {
-				if parsedContent.TextBody != "" {
-					body = parsedContent.TextBody
-				}
-				if parsedContent.HTMLBody != "" {
-					htmlBody = parsedContent.HTMLBody
-				}
-			}
-		}
-		
-		// 如果还是空的，尝试从raw_email解析
-		if (body == "" || htmlBody == "") && email.RawEmail != "" {
-			rawEmail := email.RawEmail
-			
-			// 检查raw_email是否是Base64编码
-			if isBase64Content(rawEmail) {
-				if decoded, err := base64.StdEncoding.DecodeString(rawEmail); err == nil {
-					rawEmail = string(decoded)
-				}
-			}
-			
-			if isMIMEContent(rawEmail) {
-				if parsedContent, parseErr := utils.ParseMIMEContent(rawEmail); parseErr == nil {
-					if body == "" && parsedContent.TextBody != "" {
-						body = parsedContent.TextBody
-					}
-					if htmlBody == "" && parsedContent.HTMLBody != "" {
-						htmlBody = parsedContent.HTMLBody
-					}
-				}
-			} else if parsedContent, parseErr := utils.ParseEmailFromRaw(rawEmail); parseErr == nil {
-				if body == "" && parsedContent.TextBody != "" {
-					body = parsedContent.TextBody
-				}
-				if htmlBody == "" && parsedContent.HTMLBody != "" {
-					htmlBody = parsedContent.HTMLBody
-				}
-			}
-		}
-
-		// 清理发件人和收件人字段，移除多余的格式
-		from := cleanEmailAddress(email.From)
-		to := cleanEmailAddress(email.To)
-
-		optimizedEmails[i] = gin.H{
-			"id":          email.ID,
-			"from":        from,              // 发件人（已清理）
-			"to":          to,                // 收件人（已清理）
-			"received_at": email.ReceivedAt,  // 收件时间
-			"subject":     email.Subject,     // 主题
-			"content":     body,              // 纯文本内容（已解析和清理）
-		}
+	// 清理发件人和收件人字段，移除多余的格式
+	ids := make([]int, len(list.Emails))
+	for i := range list.Emails {
+		list.Emails[i].From = cleanEmailAddress(list.Emails[i].From)
+		list.Emails[i].To = cleanEmailAddress(list.Emails[i].To)
+		ids[i] = list.Emails[i].ID
 	}
+	setAuditTarget(c, ids...)
+
+	c.JSON(http.StatusOK, list)
+}
 
-	optimizedResponse := gin.H{
-		"emails": optimizedEmails,
-		"total":  response.Total,
-		"page":   response.Page,
-		"limit":  response.Limit,
+// parseListQuery 解析分页参数：page、limit（1-100，默认 20）以及游标 after_id / before_id
+func parseListQuery(c *gin.Context) (models.EmailListQuery, error) {
+	query := models.EmailListQuery{Page: 1, Limit: 20}
+
+	if page, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && page >= 1 {
+		query.Page = page
+	}
+	if limit, err := strconv.Atoi(c.DefaultQuery("limit", "20")); err == nil && limit >= 1 && limit <= 100 {
+		query.Limit = limit
 	}
 
-	c.JSON(http.StatusOK, optimizedResponse)
+	for _, param := range []struct {
+		name string
+		dest *int
+	}{{"after_id", &query.AfterID}, {"before_id", &query.BeforeID}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			return query, fmt.Errorf("invalid %s: %q", param.name, value)
+		}
+		*param.dest = id
+	}
+	if query.AfterID > 0 && query.BeforeID > 0 {
+		return query, fmt.Errorf("after_id and before_id cannot be used together")
+	}
+	return query, nil
 }
 
 // GetEmailByID 根据ID获取单个邮件
 func (h *EmailHandler) GetEmailByID(c *gin.Context) {
+	h.getEmailByID(c, false)
+}
+
+// GetAdminEmailByID 管理后台打开邮件，默认将邮件标记为已读，?mark_read=false 时保持原状态；
+// 只读的 viewer 用户打开邮件不修改已读状态
+func (h *EmailHandler) GetAdminEmailByID(c *gin.Context) {
+	markRead := c.Query("mark_read") != "false"
+	if user := currentUser(c); user != nil && user.Role == models.RoleViewer {
+		markRead = false
+	}
+	h.getEmailByID(c, markRead)
+}
+
+func (h *EmailHandler) getEmailByID(c *gin.Context, markRead bool) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -206,76 +219,24 @@ func (h *EmailHandler) GetEmailByID(c *gin.Context) {
 	}
 
 	email, err := h.db.GetEmailByID(id)
-	if err != nil {
+	if err != nil || !canAccessEmail(c, email) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Email not found",
 		})
 		return
 	}
 
-	// 解析和清理邮件内容
-	body := email.Body
-	htmlBody := email.HTMLBody
-	
-	// 首先检查是否是纯Base64编码的内容
-	if body != "" && isBase64Content(body) {
-		if decoded, err := base64.StdEncoding.DecodeString(body); err == nil {
-			body = string(decoded)
-		}
-	}
-	
-	// 优先尝试解析MIME格式内容（包含base64解码）
-	if body != "" && isMIMEContent(body) {
-		if parsedContent, parseErr := utils.ParseMIMEContent(body); parseErr == nil {
-			if parsedContent.TextBody != "" {
-				body = parsedContent.TextBody
-			}
-			if parsedContent.HTMLBody != "" {
-				htmlBody = parsedContent.HTMLBody
-			}
-		}
-	} else if body != "" && (strings.Contains(body, "Content-Type:") || strings.Contains(body, "boundary=")) {
-		// 如果body包含multipart数据，尝试标准解析
-		if parsedContent, parseErr := utils.ParseEmailFromRaw(body); parseErr == nil {
-			if parsedContent.TextBody != "" {
-				body = parsedContent.TextBody
-			}
-			if parsedContent.HTMLBody != "" {
-				htmlBody = parsedContent.HTMLBody
-			}
-		}
-	}
-	
-	// 如果还是空的，尝试从raw_email解析
-	if (body == "" || htmlBody == "") && email.RawEmail != "" {
-		rawEmail := email.RawEmail
-		
-		// 检查raw_email是否是Base64编码
-		if isBase64Content(rawEmail) {
-			if decoded, err := base64.StdEncoding.DecodeString(rawEmail); err == nil {
-				rawEmail = string(decoded)
-			}
-		}
-		
-		if isMIMEContent(rawEmail) {
-			if parsedContent, parseErr := utils.ParseMIMEContent(rawEmail); parseErr == nil {
-				if body == "" && parsedContent.TextBody != "" {
-					body = parsedContent.TextBody
-				}
-				if htmlBody == "" && parsedContent.HTMLBody != "" {
-					htmlBody = parsedContent.HTMLBody
-				}
-			}
-		} else if parsedContent, parseErr := utils.ParseEmailFromRaw(rawEmail); parseErr == nil {
-			if body == "" && parsedContent.TextBody != "" {
-				body = parsedContent.TextBody
-			}
-			if htmlBody == "" && parsedContent.HTMLBody != "" {
-				htmlBody = parsedContent.HTMLBody
-			}
+	if markRead && !email.IsRead {
+		if err := h.db.SetEmailsRead([]int{email.ID}, true); err != nil {
+			log.Printf("Failed to mark email %d as read: %v", email.ID, err)
+		} else {
+			email.IsRead = true
 		}
 	}
 
+	// 解析和清理邮件内容
+	body, htmlBody := message.DecodeContent(email)
+
 	// 如果没有HTML内容但有纯文本内容，将纯文本转换为HTML
 	if htmlBody == "" && body != "" {
 		htmlBody = textToHTML(body)
@@ -293,6 +254,18 @@ func (h *EmailHandler) GetEmailByID(c *gin.Context) {
 		}
 	}
 
+	// 将 cid: 内嵌图片引用改写为带签名的地址
+	htmlBody = h.rewriteInlineReferences(email, htmlBody)
+
+	// 服务端 HTML 清理，供自行渲染的 API 调用方使用；可通过 ?remote_images= 覆盖远程图片策略
+	sanitizeOpts := h.sanitizeOpts
+	sanitizeOpts.RemoteImages = h.settings.Get().RemoteImages
+	switch mode := c.Query("remote_images"); mode {
+	case utils.RemoteImagesAllow, utils.RemoteImagesBlock, utils.RemoteImagesProxy:
+		sanitizeOpts.RemoteImages = mode
+	}
+	sanitizedHTML, sanitizeReport := utils.SanitizeHTML(htmlBody, sanitizeOpts)
+
 	// 清理发件人和收件人字段
 	from := cleanEmailAddress(email.From)
 	to := cleanEmailAddress(email.To)
@@ -307,29 +280,26 @@ func (h *EmailHandler) GetEmailByID(c *gin.Context) {
 		"subject":     email.Subject,     // 主题
 		"body":        body,              // 纯文本内容（已解析和清理）
 		"html_body":   htmlBody,          // HTML内容（仅用于详情查看）
+		"html_body_sanitized": sanitizedHTML,  // 服务端清理后的HTML
+		"html_sanitizer":      sanitizeReport, // 清理时移除的内容统计
 		"headers":     email.Headers,     // 邮件头部信息
+		"folder":      email.Folder,      // 所在文件夹（inbox/spam/trash）
+		"spam_score":  email.SpamScore,   // 垃圾邮件评分
+		"spam_reasons": json.RawMessage(spamReasonsJSON(email.SpamReasons)), // 评分原因
+		"is_read":     email.IsRead,      // 是否已读
+		"is_starred":  email.IsStarred,   // 是否星标
+		"labels":      email.Labels,      // 标签
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-// isMIMEContent 检查内容是否为MIME格式
-func isMIMEContent(content string) bool {
-	// 检查是否包含MIME边界标识符，同时支持 \n 和 \r\n 换行
-	lines := strings.FieldsFunc(content, func(r rune) bool {
-		return r == '\n'
-	})
-	for _, line := range lines {
-		line = strings.TrimRight(line, "\r")
-		// 查找以 -- 开头的边界线，且长度合理
-		if strings.HasPrefix(line, "--") && len(line) > 10 {
-			// 进一步验证是否包含Content-Type
-			if strings.Contains(content, "Content-Type:") {
-				return true
-			}
-		}
+// spamReasonsJSON 返回可直接嵌入响应的评分原因 JSON，旧数据为空时返回空数组
+func spamReasonsJSON(reasons string) string {
+	if reasons == "" || !json.Valid([]byte(reasons)) {
+		return "[]"
 	}
-	return false
+	return reasons
 }
 
 // cleanEmailAddress 清理邮件地址，移除多余的格式
@@ -361,38 +331,6 @@ func (h *EmailHandler) HealthCheck(c *gin.Context) {
 	})
 }
 
-// isBase64Content 检查内容是否是Base64编码
-func isBase64Content(content string) bool {
-	// 移除换行符和空格
-	cleanContent := strings.ReplaceAll(content, "\r\n", "")
-	cleanContent = strings.ReplaceAll(cleanContent, "\n", "")
-	cleanContent = strings.ReplaceAll(cleanContent, " ", "")
-	
-	// Base64内容应该只包含Base64字符集
-	if len(cleanContent) == 0 {
-		return false
-	}
-	
-	// 检查长度是否是4的倍数（Base64特征）
-	if len(cleanContent)%4 != 0 {
-		return false
-	}
-	
-	// 检查是否只包含Base64字符
-	for _, char := range cleanContent {
-		if !((char >= 'A' && char <= 'Z') ||
-			 (char >= 'a' && char <= 'z') ||
-			 (char >= '0' && char <= '9') ||
-			 char == '+' || char == '/' || char == '=') {
-			return false
-		}
-	}
-	
-	// 尝试解码以验证是否是有效的Base64
-	_, err := base64.StdEncoding.DecodeString(cleanContent)
-	return err == nil
-}
-
 // textToHTML 将纯文本转换为HTML格式
 func textToHTML(text string) string {
 	if text == "" {
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mailcat/internal/models"
+	"mailcat/internal/settings"
+	"mailcat/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	a := newTestAdmin(t)
+	h := NewEmailHandler(a.db, a.store, a.keys, nil, utils.SanitizeOptions{}, nil)
+
+	_, readToken, err := a.keys.Create(models.CreateAPIKeyRequest{Name: "reader", Scopes: []string{models.ScopeEmailsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, queryToken, err := a.keys.Create(models.CreateAPIKeyRequest{Name: "feed", Scopes: []string{models.ScopeEmailsRead}, AllowQueryToken: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, lanToken, err := a.keys.Create(models.CreateAPIKeyRequest{Name: "lan", Scopes: []string{models.ScopeEmailsRead}, AllowedIPs: []string{"192.0.2.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedToken, err := a.keys.Create(models.CreateAPIKeyRequest{Name: "revoked", Scopes: []string{models.ScopeEmailsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.keys.Revoke(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/read", h.AuthMiddleware(models.ScopeEmailsRead), ok)
+	r.POST("/write", h.AuthMiddleware(models.ScopeEmailsWrite), ok)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		remoteAddr string
+		want       int
+	}{
+		{"valid key", http.MethodGet, "/read", readToken, "203.0.113.1:1234", http.StatusOK},
+		{"no token", http.MethodGet, "/read", "", "203.0.113.1:1234", http.StatusUnauthorized},
+		{"unknown token", http.MethodGet, "/read", "mc_unknown", "203.0.113.1:1234", http.StatusUnauthorized},
+		{"scope mismatch", http.MethodPost, "/write", readToken, "203.0.113.1:1234", http.StatusForbidden},
+		{"revoked", http.MethodGet, "/read", revokedToken, "203.0.113.1:1234", http.StatusUnauthorized},
+		{"allowed ip", http.MethodGet, "/read", lanToken, "192.0.2.10:1234", http.StatusOK},
+		{"ip not allowed", http.MethodGet, "/read", lanToken, "203.0.113.1:1234", http.StatusForbidden},
+		{"legacy token write", http.MethodPost, "/write", "api-token", "203.0.113.1:1234", http.StatusOK},
+		{"query token allowed", http.MethodGet, "/read?token=" + queryToken, "", "203.0.113.1:1234", http.StatusOK},
+		{"query token not allowed", http.MethodGet, "/read?token=" + readToken, "", "203.0.113.1:1234", http.StatusUnauthorized},
+		{"legacy token in query", http.MethodGet, "/read?token=api-token", "", "203.0.113.1:1234", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRemoteImagesFollowSettings(t *testing.T) {
+	a := newTestAdmin(t)
+	h := NewEmailHandler(a.db, a.store, a.keys, nil, utils.SanitizeOptions{}, nil)
+	raw := "From: a@example.com\r\nTo: b@example.com\r\nSubject: pixel\r\nContent-Type: text/html\r\n\r\n" +
+		"<p>hi</p><img src=\"https://tracker.example/p.png\">\r\n"
+	email, err := a.db.SaveEmail(&models.EmailRequest{From: "a@example.com", To: "b@example.com", RawEmail: raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/api/v1/emails/:id", h.AuthMiddleware(models.ScopeEmailsRead), h.GetEmailByID)
+	sanitized := func() string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/emails/"+strconv.Itoa(email.ID), nil)
+		req.Header.Set("Authorization", "Bearer api-token")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			HTML string `json:"html_body_sanitized"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.HTML
+	}
+
+	// 修改设置后下一个请求立即使用新的策略
+	if _, err := a.store.Update(map[string]string{settings.KeyRemoteImages: utils.RemoteImagesAllow}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if html := sanitized(); !strings.Contains(html, "https://tracker.example/p.png") {
+		t.Errorf("allow: remote image was removed: %s", html)
+	}
+	if _, err := a.store.Update(map[string]string{settings.KeyRemoteImages: utils.RemoteImagesBlock}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if html := sanitized(); strings.Contains(html, "https://tracker.example/p.png") {
+		t.Errorf("block: remote image was kept: %s", html)
+	}
+}
+
+func TestGetEmailsCursor(t *testing.T) {
+	a := newTestAdmin(t)
+	h := NewEmailHandler(a.db, a.store, a.keys, nil, utils.SanitizeOptions{}, nil)
+	for i := 1; i <= 6; i++ {
+		email, err := a.db.SaveEmail(&models.EmailRequest{From: "sender@example.com", To: "b@example.com", Subject: strconv.Itoa(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 0 {
+			a.db.SetEmailsRead([]int{email.ID}, true)
+		}
+	}
+	r := gin.New()
+	r.GET("/api/v1/emails", h.AuthMiddleware(models.ScopeEmailsRead), h.GetEmails)
+
+	get := func(target string) (int, map[string]json.RawMessage) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer api-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]json.RawMessage
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	tests := []struct {
+		query string
+		ids   string
+		next  string
+		prev  string
+	}{
+		{"limit=2", "[6 5]", "5", "null"},
+		{"limit=2&after_id=5", "[4 3]", "3", "4"},
+		{"limit=2&before_id=2", "[4 3]", "3", "4"},
+		{"limit=2&before_id=4", "[6 5]", "5", "null"},
+		{"limit=2&after_id=2", "[1]", "null", "1"},
+		// 游标与 is_read 过滤组合：未读邮件为 5 4 2 1
+		{"limit=2&is_read=false&after_id=5", "[4 2]", "2", "4"},
+		{"limit=2&is_read=false&before_id=2", "[5 4]", "4", "null"},
+		{"limit=2&is_read=true&after_id=6", "[3]", "null", "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			code, body := get("/api/v1/emails?" + tt.query)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			var emails []models.EmailSummary
+			json.Unmarshal(body["emails"], &emails)
+			ids := make([]string, len(emails))
+			for i, email := range emails {
+				ids[i] = strconv.Itoa(email.ID)
+			}
+			if got := "[" + strings.Join(ids, " ") + "]"; got != tt.ids {
+				t.Errorf("emails = %s, want %s", got, tt.ids)
+			}
+			if string(body["next_cursor"]) != tt.next || string(body["prev_cursor"]) != tt.prev {
+				t.Errorf("next_cursor = %s, prev_cursor = %s, want %s and %s", body["next_cursor"], body["prev_cursor"], tt.next, tt.prev)
+			}
+			// total 只在按页码分页时返回
+			if _, ok := body["total"]; ok == strings.Contains(tt.query, "_id=") {
+				t.Errorf("total present = %v", ok)
+			}
+		})
+	}
+
+	for _, query := range []string{"after_id=0", "before_id=abc", "after_id=-1", "after_id=3&before_id=1"} {
+		if code, _ := get("/api/v1/emails?" + query); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, code)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"archive/zip"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"mailcat/internal/message"
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// 导出格式
+const (
+	exportFormatMbox = "mbox"
+	exportFormatZip  = "zip"
+)
+
+// GetRawEmail 以 message/rfc822 格式下载原始邮件
+func (h *EmailHandler) GetRawEmail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid email ID",
+		})
+		return
+	}
+
+	email, err := h.db.GetEmailByID(id)
+	if err != nil || !canAccessEmail(c, email) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Email not found",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": emlFilename(email)}))
+	c.Data(http.StatusOK, "message/rfc822", message.Raw(email))
+}
+
+// ExportEmails 将符合条件的邮件导出为 mbox 文件或 .eml 文件的 zip 压缩包，
+// 分批读取并直接写入响应，不会把全部邮件载入内存
+func (h *EmailHandler) ExportEmails(c *gin.Context) {
+	// 审计日志记录导出条件，不包含 URL 中的令牌
+	params := c.Request.URL.Query()
+	params.Del("token")
+	setAuditDetails(c, params.Encode())
+
+	format := c.DefaultQuery("format", exportFormatMbox)
+	if format != exportFormatMbox && format != exportFormatZip {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid format, expected mbox or zip",
+		})
+		return
+	}
+
+	filter, err := parseEmailFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid filter",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// 大量邮件的导出可能超过 server.write_timeout_seconds，取消本请求的写超时以免下载被截断
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline for export: %v", err)
+	}
+
+	filename := "mailcat-export-" + time.Now().Format("20060102-150405") + "." + format
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	count := 0
+	switch format {
+	case exportFormatMbox:
+		c.Header("Content-Type", "application/mbox")
+		c.Status(http.StatusOK)
+		mbox := utils.NewMboxWriter(c.Writer)
+		err = h.db.ForEachEmail(filter, func(email *models.Email) error {
+			count++
+			return mbox.WriteMessage(email.From, email.ReceivedAt, message.Raw(email))
+		})
+		if flushErr := mbox.Flush(); err == nil {
+			err = flushErr
+		}
+
+	case exportFormatZip:
+		c.Header("Content-Type", "application/zip")
+		c.Status(http.StatusOK)
+		archive := zip.NewWriter(c.Writer)
+		err = h.db.ForEachEmail(filter, func(email *models.Email) error {
+			count++
+			w, err := archive.CreateHeader(&zip.FileHeader{
+				Name:     emlFilename(email),
+				Method:   zip.Deflate,
+				Modified: email.ReceivedAt,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(message.Raw(email))
+			return err
+		})
+		if closeErr := archive.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	// 响应已经开始写出，出错时只能记录日志并中断连接
+	if err != nil {
+		log.Printf("Export failed after %d emails: %v", count, err)
+		c.Abort()
+	}
+}
+
+// parseEmailFilter 从查询参数解析过滤条件：folder、from、to、subject、
+// since/until（RFC 3339 或 YYYY-MM-DD）、ids（逗号分隔）、limit 以及 is_read、is_starred、label
+func parseEmailFilter(c *gin.Context) (models.EmailFilter, error) {
+	filter := models.EmailFilter{
+		Folder:  c.Query("folder"),
+		From:    c.Query("from"),
+		To:      c.Query("to"),
+		Subject: c.Query("subject"),
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseFilterTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %q", param.name, value)
+		}
+		*param.dest = &t
+	}
+
+	if ids := c.Query("ids"); ids != "" {
+		for _, s := range strings.Split(ids, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return filter, fmt.Errorf("invalid id: %q", s)
+			}
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+
+	if err := parseStateFilter(c, &filter); err != nil {
+		return filter, err
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("invalid limit: %q", limit)
+		}
+		filter.Limit = n
+	}
+	filter.Mailboxes = userMailboxes(c)
+
+	return filter, nil
+}
+
+// parseFilterTime 解析 RFC 3339 时间或按服务器时区解析的日期
+func parseFilterTime(value string) (time.Time, error) {
+	return parseTimeIn(value, time.Local)
+}
+
+// parseTimeIn 解析 RFC 3339 时间或按指定时区解析的日期
+func parseTimeIn(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+// emlFilename 生成导出文件名：ID 加上清理后的主题
+func emlFilename(email *models.Email) string {
+	var b strings.Builder
+	for _, r := range email.Subject {
+		if b.Len() >= 60 {
+			break
+		}
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.':
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '_':
+			b.WriteRune('_')
+		}
+	}
+	name := strings.Trim(b.String(), "._")
+	if name == "" {
+		return fmt.Sprintf("%06d.eml", email.ID)
+	}
+	return fmt.Sprintf("%06d_%s.eml", email.ID, name)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func newExportTestRouter(t *testing.T) (*gin.Engine, *testAdmin) {
+	t.Helper()
+	a := newTestAdmin(t)
+	h := NewEmailHandler(a.db, a.store, a.keys, nil, utils.SanitizeOptions{}, nil)
+	for _, req := range []models.EmailRequest{
+		{From: "Alice <alice@example.com>", To: "b@example.com", RawEmail: "From: alice@example.com\r\nSubject: one\r\n\r\nFrom the start\r\n"},
+		// 没有原始邮件时按保存的字段重建
+		{From: "carol@example.com", To: "b@example.com", Subject: "two\r\nBcc: x@example.com", Body: "rebuilt"},
+		{From: "dave@example.com", To: "other@example.com", RawEmail: "Subject: three\r\n\r\nthree\r\n"},
+	} {
+		if _, err := a.db.SaveEmail(&req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := gin.New()
+	r.GET("/api/v1/export", h.AuthMiddleware(models.ScopeEmailsRead), h.ExportEmails)
+	return r, a
+}
+
+func exportRequest(target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer api-token")
+	return req
+}
+
+func TestExportMbox(t *testing.T) {
+	r, _ := newExportTestRouter(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, exportRequest("/api/v1/export?format=mbox&to=b@example.com"))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/mbox" {
+		t.Fatalf("export = %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;") {
+		t.Errorf("Content-Disposition = %q", w.Header().Get("Content-Disposition"))
+	}
+
+	body := w.Body.String()
+	if n := strings.Count(body, "\nFrom ") + 1; !strings.HasPrefix(body, "From alice@example.com ") || n != 2 {
+		t.Errorf("mbox has %d messages, want 2:\n%s", n, body)
+	}
+	if !strings.Contains(body, "\n>From the start\n") {
+		t.Errorf("body line starting with From is not escaped:\n%s", body)
+	}
+	if !strings.Contains(body, "\nSubject: two Bcc: x@example.com\n") || strings.Contains(body, "\nBcc:") {
+		t.Errorf("rebuilt message headers are not sanitized:\n%s", body)
+	}
+	if strings.Contains(body, "three") {
+		t.Errorf("filtered email was exported:\n%s", body)
+	}
+}
+
+func TestExportZip(t *testing.T) {
+	r, _ := newExportTestRouter(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, exportRequest("/api/v1/export?format=zip&folder=all"))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("export = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	if want := "000001.eml,000002_two__Bcc_xexample.com.eml,000003.eml"; strings.Join(names, ",") != want {
+		t.Errorf("zip entries = %v, want %s", names, want)
+	}
+	rc, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); string(data) != "From: alice@example.com\r\nSubject: one\r\n\r\nFrom the start\r\n" {
+		t.Errorf("raw email = %q, want it unchanged", data)
+	}
+}
+
+func TestExportInvalidFormat(t *testing.T) {
+	r, _ := newExportTestRouter(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, exportRequest("/api/v1/export?format=tar"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestExportOutlivesWriteTimeout(t *testing.T) {
+	r, a := newExportTestRouter(t)
+	for i := 0; i < 20; i++ {
+		if _, err := a.db.SaveEmail(&models.EmailRequest{From: "a@example.com", To: "b@example.com", RawEmail: "Subject: bulk\r\n\r\n" + strings.Repeat("x", 1000) + "\r\n"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 模拟耗时超过 WriteTimeout 的导出：开始写出之前已经过了写超时
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		r.ServeHTTP(w, req)
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/export?format=mbox&folder=all", nil)
+	req.Header.Set("Authorization", "Bearer api-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("export request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("export was truncated: %v", err)
+	}
+	if n := strings.Count(string(body), "\nFrom ") + 1; n != 23 {
+		t.Errorf("export contains %d messages, want 23", n)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mailcat/internal/health"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler 存活和就绪检查
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler 创建健康检查处理器
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Live 存活检查：进程能够处理请求即返回 200，不检查依赖
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": health.StatusOK,
+	})
+}
+
+// Ready 就绪检查：执行所有检查并返回各项结果，任意一项失败时返回 503
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.checker.Run(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mailcat/internal/health"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	checker := health.New(50 * time.Millisecond)
+	var dbErr error
+	checker.Register("database", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, dbErr
+	})
+
+	r := gin.New()
+	h := NewHealthHandler(checker)
+	r.GET("/health/live", h.Live)
+	r.GET("/health/ready", h.Ready)
+	ready := func() (int, health.Report) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+		var report health.Report
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, report
+	}
+
+	if code, report := ready(); code != http.StatusOK || report.Checks["database"].Status != health.StatusOK {
+		t.Errorf("ready = %d %+v, want 200", code, report)
+	}
+
+	dbErr = errors.New("database is not writable: attempt to write a readonly database")
+	code, report := ready()
+	if code != http.StatusServiceUnavailable || report.Status != health.StatusFail {
+		t.Errorf("ready with a failing check = %d %+v, want 503", code, report)
+	}
+	if got := report.Checks["database"]; got.Status != health.StatusFail || got.Error != dbErr.Error() {
+		t.Errorf("database check = %+v", got)
+	}
+
+	// 开始关闭后就绪检查返回 503，存活检查不受影响
+	dbErr = nil
+	checker.SetDraining()
+	if code, report := ready(); code != http.StatusServiceUnavailable || report.Checks[health.CheckShutdown].Status != health.StatusFail {
+		t.Errorf("ready while draining = %d %+v, want 503", code, report)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("live while draining = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"mailcat/internal/imageproxy"
+	"github.com/gin-gonic/gin"
+)
+
+type ImageProxyHandler struct {
+	proxy *imageproxy.Proxy
+}
+
+func NewImageProxyHandler(proxy *imageproxy.Proxy) *ImageProxyHandler {
+	return &ImageProxyHandler{proxy: proxy}
+}
+
+// ProxyImage 代替浏览器获取邮件中的远程图片，避免泄露查看者的 IP
+func (h *ImageProxyHandler) ProxyImage(c *gin.Context) {
+	img, err := h.proxy.Fetch(c.Request.Context(), c.Query("url"))
+	if err != nil {
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, imageproxy.ErrInvalidURL):
+			status = http.StatusBadRequest
+		case errors.Is(err, imageproxy.ErrForbiddenTarget):
+			status = http.StatusForbidden
+		case errors.Is(err, imageproxy.ErrNotImage):
+			status = http.StatusUnsupportedMediaType
+		case errors.Is(err, imageproxy.ErrTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		default:
+			log.Printf("Image proxy fetch failed: %v", err)
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, img.ContentType, img.Data)
+}
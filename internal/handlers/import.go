@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"mailcat/internal/importer"
+	"mailcat/internal/settings"
+	"github.com/gin-gonic/gin"
+)
+
+// zipMagic zip 文件的起始字节
+var zipMagic = []byte("PK\x03\x04")
+
+type ImportHandler struct {
+	importer *importer.Importer
+	settings *settings.Store // 上传大小上限随设置修改立即生效
+}
+
+func NewImportHandler(imp *importer.Importer, store *settings.Store) *ImportHandler {
+	return &ImportHandler{
+		importer: imp,
+		settings: store,
+	}
+}
+
+// ImportEmails 导入上传的历史邮件：format 为 mbox、maildir 或 eml，
+// file 可以是 mbox 文件、单个 .eml 文件，或包含 Maildir / .eml 文件的 zip 压缩包
+func (h *ImportHandler) ImportEmails(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.settings.Get().ImportMaxUploadMB<<20)
+
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "Upload too large",
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid multipart form",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer c.Request.MultipartForm.RemoveAll()
+
+	format := c.Request.FormValue("format")
+	if !importer.ValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid format, expected mbox, maildir or eml",
+		})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Missing upload file",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(zipMagic))
+	n, _ := io.ReadFull(file, magic)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to read upload",
+		})
+		return
+	}
+
+	var src importer.Source
+	switch {
+	case bytes.Equal(magic[:n], zipMagic):
+		zr, err := zip.NewReader(file, header.Size)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid zip archive",
+				"details": err.Error(),
+			})
+			return
+		}
+		src = importer.ZipSource(zr, format)
+	case format == importer.FormatMbox:
+		src = importer.MboxSource(file)
+	case format == importer.FormatEML:
+		src = importer.SingleSource(header.Filename, file)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Maildir uploads must be a zip archive",
+		})
+		return
+	}
+
+	report, err := h.importer.Run(c.Request.Context(), src)
+	if err != nil {
+		log.Printf("Import of %s failed after %d messages: %v", header.Filename, report.Total, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Import aborted",
+			"details": err.Error(),
+			"report":  report,
+		})
+		return
+	}
+
+	log.Printf("Imported %s: %d imported, %d duplicates, %d failed", header.Filename, report.Imported, report.Duplicates, report.Failed)
+	c.JSON(http.StatusOK, report)
+}
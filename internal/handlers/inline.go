@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcat/internal/database"
+	"mailcat/internal/message"
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// inlineURLTTL 内嵌图片签名地址的有效期
+const inlineURLTTL = time.Hour
+
+// LoadInlineURLSecret 返回内嵌图片地址的签名密钥：优先使用配置的值，否则使用数据库中保存的随机密钥
+// （首次启动时生成），重启后已经生成的地址在有效期内仍然可用
+func LoadInlineURLSecret(db *database.DB, configured string) ([]byte, error) {
+	if configured != "" {
+		return []byte(configured), nil
+	}
+	return db.InstanceSecret("inline_url", func() ([]byte, error) {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate inline url secret: %w", err)
+		}
+		return secret, nil
+	})
+}
+
+// inlinePartURL 生成带签名的内嵌部分地址，<img> 无法携带 Authorization 请求头，
+// 因此通过有时效的签名授权访问
+func (h *EmailHandler) inlinePartURL(emailID int, cid string) string {
+	expires := time.Now().Add(inlineURLTTL).Unix()
+	return fmt.Sprintf("/api/v1/emails/%d/inline?cid=%s&expires=%d&sig=%s",
+		emailID, url.QueryEscape(cid), expires, h.signInlinePart(emailID, cid, expires))
+}
+
+// signInlinePart 计算内嵌部分地址的签名
+func (h *EmailHandler) signInlinePart(emailID int, cid string, expires int64) string {
+	mac := hmac.New(sha256.New, h.inlineURLSecret)
+	fmt.Fprintf(mac, "%d\n%s\n%d", emailID, cid, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyInlineSignature 校验请求中的签名和有效期
+func (h *EmailHandler) verifyInlineSignature(c *gin.Context) bool {
+	sig := c.Query("sig")
+	if sig == "" {
+		return false
+	}
+	emailID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return false
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	expected := h.signInlinePart(emailID, c.Query("cid"), expires)
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
+
+// InlineAuthMiddleware 内嵌部分的认证：有效签名或 API 令牌二选一
+func (h *EmailHandler) InlineAuthMiddleware() gin.HandlerFunc {
+	tokenAuth := h.AuthMiddleware(models.ScopeEmailsRead)
+	return func(c *gin.Context) {
+		if h.verifyInlineSignature(c) {
+			setAuditDetails(c, "signed url")
+			c.Next()
+			return
+		}
+		tokenAuth(c)
+	}
+}
+
+// GetInlinePart 返回邮件中通过 Content-ID 引用的内嵌部分
+func (h *EmailHandler) GetInlinePart(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid email ID",
+		})
+		return
+	}
+	cid := c.Query("cid")
+	if cid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing cid",
+		})
+		return
+	}
+
+	email, err := h.db.GetEmailByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Email not found",
+		})
+		return
+	}
+
+	raw := storedMessage(email)
+	if raw == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Inline part not found",
+		})
+		return
+	}
+
+	part, err := utils.FindInlinePart(raw, cid)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, utils.ErrPartNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error": "Inline part not found",
+		})
+		return
+	}
+
+	// 只有图片以内联方式返回，其他类型一律作为附件下载，避免在本站源下渲染邮件内容
+	disposition := "attachment"
+	contentType := part.ContentType
+	if strings.HasPrefix(contentType, "image/") && contentType != "image/svg+xml" {
+		disposition = "inline"
+	} else {
+		contentType = "application/octet-stream"
+	}
+	if part.Filename != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": part.Filename})
+	}
+
+	c.Header("Content-Disposition", disposition)
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, contentType, part.Data)
+}
+
+// rewriteInlineReferences 把 HTML 中的 cid: 引用改写为带签名的内嵌部分地址
+func (h *EmailHandler) rewriteInlineReferences(email *models.Email, htmlBody string) string {
+	if !strings.Contains(strings.ToLower(htmlBody), "cid:") || storedMessage(email) == "" {
+		return htmlBody
+	}
+	return utils.RewriteCIDReferences(htmlBody, func(cid string) string {
+		return h.inlinePartURL(email.ID, cid)
+	})
+}
+
+// storedMessage 从存储的字段中取出完整的 MIME 邮件：优先使用 raw_email，
+// 其次是包含头部的 body，最后用 headers 中的 Content-Type 与 body 拼装。
+// 无法得到 MIME 结构时返回空字符串
+func storedMessage(email *models.Email) string {
+	if raw := email.RawEmail; raw != "" {
+		if message.IsBase64(raw) {
+			if decoded, err := base64.StdEncoding.DecodeString(raw); err == nil {
+				raw = string(decoded)
+			}
+		}
+		return raw
+	}
+
+	if email.Body == "" {
+		return ""
+	}
+	if msg, err := mail.ReadMessage(strings.NewReader(email.Body)); err == nil && msg.Header.Get("Content-Type") != "" {
+		return email.Body
+	}
+
+	// Worker 可能只提交了去掉头部的正文，Content-Type 保存在 headers 中
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(email.Headers), &headers); err != nil {
+		return ""
+	}
+	for name, value := range headers {
+		if strings.EqualFold(name, "Content-Type") && strings.Contains(strings.ToLower(value), "multipart/") {
+			return "Content-Type: " + value + "\r\n\r\n" + email.Body
+		}
+	}
+	return ""
+}
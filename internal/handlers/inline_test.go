@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mailcat/internal/apikeys"
+	"mailcat/internal/config"
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+	"mailcat/internal/settings"
+	"mailcat/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const inlineTestMessage = "From: a@example.com\r\n" +
+	"To: b@example.com\r\n" +
+	"Subject: logo\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/related; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<img src=\"cid:logo@example.com\">\r\n" +
+	"--b1\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-ID: <logo@example.com>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"--b1--\r\n"
+
+// newInlineTestServer 创建只包含内嵌图片端点的路由和一封带内嵌图片的邮件
+func newInlineTestServer(t *testing.T, secret []byte) (*gin.Engine, *EmailHandler, int) {
+	gin.SetMode(gin.TestMode)
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{}
+	cfg.API.AuthToken = "api-token"
+	cfg.Admin.Password = "password"
+	store, err := settings.Load(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, err := db.SaveEmail(&models.EmailRequest{From: "a@example.com", To: "b@example.com", RawEmail: inlineTestMessage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewEmailHandler(db, store, apikeys.NewManager(db, store), nil, utils.SanitizeOptions{}, secret)
+	r := gin.New()
+	r.GET("/api/v1/emails/:id/inline", h.InlineAuthMiddleware(), h.GetInlinePart)
+	return r, h, email.ID
+}
+
+func getInline(r *gin.Engine, target string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestInlinePartSignedURL(t *testing.T) {
+	r, h, id := newInlineTestServer(t, []byte("0123456789abcdef0123456789abcdef"))
+
+	signed := h.inlinePartURL(id, "logo@example.com")
+	w := getInline(r, signed, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || !strings.HasPrefix(w.Body.String(), "\x89PNG") {
+		t.Fatalf("GET %s = %d %q", signed, w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Header().Get("Content-Security-Policy"), "sandbox") {
+		t.Error("inline part is served without a sandbox CSP")
+	}
+
+	u, _ := url.Parse(signed)
+	query := u.Query()
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+	otherID := strconv.Itoa(id + 1)
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{"no signature", "/api/v1/emails/" + strconv.Itoa(id) + "/inline?cid=logo@example.com"},
+		{"other email", strings.Replace(signed, "/emails/"+strconv.Itoa(id)+"/", "/emails/"+otherID+"/", 1)},
+		{"other cid", strings.Replace(signed, "cid=logo%40example.com", "cid=other%40example.com", 1)},
+		{"extended expiry", strings.Replace(signed, "expires="+query.Get("expires"), "expires="+strconv.FormatInt(expires+3600, 10), 1)},
+		{"tampered signature", strings.Replace(signed, "sig="+query.Get("sig"), "sig="+strings.Repeat("0", 64), 1)},
+		{"expired", "/api/v1/emails/" + strconv.Itoa(id) + "/inline?cid=logo%40example.com&expires=" +
+			strconv.FormatInt(expired, 10) + "&sig=" + h.signInlinePart(id, "logo@example.com", expired)},
+	}
+	for _, tt := range tests {
+		if w := getInline(r, tt.target, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: GET %s = %d, want 401", tt.name, tt.target, w.Code)
+		}
+	}
+
+	// 没有签名时可以使用 API 令牌
+	header := http.Header{"Authorization": {"Bearer api-token"}}
+	if w := getInline(r, tests[0].target, header); w.Code != http.StatusOK {
+		t.Errorf("GET with API token = %d, want 200", w.Code)
+	}
+}
+
+func TestInlineURLSecretPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	load := func(configured string) []byte {
+		db, err := database.NewDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		secret, err := LoadInlineURLSecret(db, configured)
+		if err != nil {
+			t.Fatalf("LoadInlineURLSecret error: %v", err)
+		}
+		return secret
+	}
+
+	first := load("")
+	if len(first) != 32 {
+		t.Fatalf("generated secret has %d bytes, want 32", len(first))
+	}
+	if second := load(""); string(second) != string(first) {
+		t.Error("secret changed after reopening the database")
+	}
+	if configured := load("configured-secret-configured-secret"); string(configured) != "configured-secret-configured-secret" {
+		t.Errorf("configured secret was not used: %q", configured)
+	}
+
+	// 重启后之前签发的地址仍然有效
+	_, h, id := newInlineTestServer(t, first)
+	signed := h.inlinePartURL(id, "logo@example.com")
+	restarted, _, _ := newInlineTestServer(t, load(""))
+	if w := getInline(restarted, signed, nil); w.Code != http.StatusOK {
+		t.Errorf("URL signed before a restart = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"mailcat/internal/database"
+	"mailcat/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler 以 Prometheus 文本格式输出指标
+type MetricsHandler struct {
+	token string // 为空时不需要认证
+
+	// scrape 抓取时计算的指标（数据库大小、行数、管理员 session 数）
+	scrape *metrics.Registry
+}
+
+// NewMetricsHandler 创建指标处理器，activeSessions 返回当前的管理员 session 数
+func NewMetricsHandler(db *database.DB, token string, activeSessions func() int) *MetricsHandler {
+	scrape := metrics.NewRegistry()
+	scrape.NewGaugeFunc("mailcat_db_size_bytes", "Size of the SQLite database file.", nil,
+		func(set func(float64, ...string)) {
+			size, err := db.Size()
+			if err != nil {
+				log.Printf("Failed to collect database size: %v", err)
+				return
+			}
+			set(float64(size))
+		})
+	scrape.NewGaugeFunc("mailcat_db_rows", "Number of rows per table.", []string{"table"},
+		func(set func(float64, ...string)) {
+			counts, err := db.RowCounts()
+			if err != nil {
+				log.Printf("Failed to collect row counts: %v", err)
+				return
+			}
+			for _, table := range sortedNames(counts) {
+				set(float64(counts[table]), table)
+			}
+		})
+	scrape.NewGaugeFunc("mailcat_emails", "Number of stored emails per folder.", []string{"folder"},
+		func(set func(float64, ...string)) {
+			counts, err := db.FolderCounts()
+			if err != nil {
+				log.Printf("Failed to collect folder counts: %v", err)
+				return
+			}
+			for _, folder := range sortedNames(counts) {
+				set(float64(counts[folder]), folder)
+			}
+		})
+	scrape.NewGaugeFunc("mailcat_admin_sessions_active", "Active admin sessions.", nil,
+		func(set func(float64, ...string)) {
+			set(float64(activeSessions()))
+		})
+
+	return &MetricsHandler{token: token, scrape: scrape}
+}
+
+// Metrics 输出全部指标，配置了令牌时要求 Authorization: Bearer <token>
+func (h *MetricsHandler) Metrics(c *gin.Context) {
+	if h.token != "" {
+		header := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(header), []byte("Bearer "+h.token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized",
+			})
+			return
+		}
+	}
+
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+	if _, err := metrics.Default.WriteTo(c.Writer); err != nil {
+		return
+	}
+	h.scrape.WriteTo(c.Writer)
+}
+
+// MetricsMiddleware 记录每个请求的耗时，按 gin 路由模板（如 /api/v1/emails/:id）分组以限制标签基数
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(),
+			c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
+
+func sortedNames(counts map[string]int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
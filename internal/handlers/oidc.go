@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"mailcat/internal/config"
+	"mailcat/internal/metrics"
+	"mailcat/internal/oidc"
+	"mailcat/internal/users"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// oidcLoginMaxAge 跳转到身份提供方后完成登录的时限
+	oidcLoginMaxAge = 10 * time.Minute
+	// oidcStateCookie 绑定 state 与发起登录的浏览器，防止登录 CSRF
+	oidcStateCookie = "mailcat_oidc_state"
+	// loginPage 前端登录页，回调完成后带着 session 或错误信息跳转回该页面
+	loginPage = "/admin/login"
+)
+
+// pendingOIDCLogin 已跳转到身份提供方、等待回调的登录
+type pendingOIDCLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// OIDCHandler 管理后台的 OIDC 单点登录
+type OIDCHandler struct {
+	provider *oidc.Provider
+	users    *users.Manager
+	admin    *AdminHandler // 登录成功后创建与密码登录相同的 session
+	cfg      config.OIDCConfig
+
+	mu      sync.Mutex
+	pending map[string]pendingOIDCLogin // state -> 登录
+}
+
+// NewOIDCHandler 创建 OIDC 登录处理器
+func NewOIDCHandler(provider *oidc.Provider, userManager *users.Manager, admin *AdminHandler, cfg config.OIDCConfig) *OIDCHandler {
+	return &OIDCHandler{
+		provider: provider,
+		users:    userManager,
+		admin:    admin,
+		cfg:      cfg,
+		pending:  make(map[string]pendingOIDCLogin),
+	}
+}
+
+// CleanExpiredLogins 定期清理超时未回调的登录，直到 ctx 被取消
+func (h *OIDCHandler) CleanExpiredLogins(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		h.mu.Lock()
+		now := time.Now()
+		for state, login := range h.pending {
+			if now.After(login.expires) {
+				delete(h.pending, state)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Login 生成 state、nonce 和 PKCE code_verifier，跳转到身份提供方的授权地址
+func (h *OIDCHandler) Login(c *gin.Context) {
+	state, err := oidc.NewState()
+	if err != nil {
+		h.fail(c, "Internal server error", err)
+		return
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		h.fail(c, "Internal server error", err)
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		h.fail(c, "Internal server error", err)
+		return
+	}
+	authURL, err := h.provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		h.fail(c, "Identity provider is unavailable", err)
+		return
+	}
+
+	h.mu.Lock()
+	h.pending[state] = pendingOIDCLogin{nonce: nonce, verifier: verifier, expires: time.Now().Add(oidcLoginMaxAge)}
+	h.mu.Unlock()
+
+	// 身份提供方跳转回来是顶层导航，SameSite=Lax 的 cookie 会被带上
+	setCookie(c, oidcStateCookie, state, int(oidcLoginMaxAge.Seconds()), "/admin/oidc", http.SameSiteLaxMode)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 校验 state，用授权码和 code_verifier 换取并校验 ID Token，按声明映射角色后创建 session。
+// 结果通过跳转到登录页的 URL 片段传给前端（#session= 或 #error=），片段不会发送到服务器或写入访问日志
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	setCookie(c, oidcStateCookie, "", -1, "/admin/oidc", http.SameSiteLaxMode)
+
+	h.mu.Lock()
+	login, exists := h.pending[state]
+	delete(h.pending, state)
+	h.mu.Unlock()
+	if state == "" || cookie != state || !exists || time.Now().After(login.expires) {
+		h.fail(c, "Login expired or was started in another browser, please try again", nil)
+		return
+	}
+	if errCode := c.Query("error"); errCode != "" {
+		h.fail(c, "Identity provider returned an error: "+errCode, nil)
+		return
+	}
+
+	claims, err := h.provider.Exchange(c.Request.Context(), c.Query("code"), login.verifier, login.nonce)
+	if err != nil {
+		h.fail(c, "Failed to verify identity provider response", err)
+		return
+	}
+
+	mapping, ok := h.mapRole(claims)
+	if !ok {
+		h.fail(c, "Your account is not allowed to access MailCat", nil)
+		return
+	}
+	setAuditActor(c, h.username(claims))
+	user, err := h.users.ProvisionOIDC(claims.String("sub"), h.username(claims), mapping.Role, mapping.Mailboxes)
+	switch err {
+	case nil:
+	case users.ErrLocalAccount:
+		h.fail(c, "Username is already used by a local account", nil)
+		return
+	case users.ErrLastOwner:
+		h.fail(c, "Role mapping would remove the last owner", nil)
+		return
+	default:
+		h.fail(c, "Failed to provision user", err)
+		return
+	}
+
+	// 在本地启用了 TOTP 的用户仍需提交验证码
+	setAuditActor(c, user.Username)
+	fragment := url.Values{}
+	if user.TOTPEnabled {
+		challenge, err := h.admin.newLoginChallenge(user)
+		if err != nil {
+			h.fail(c, "Internal server error", err)
+			return
+		}
+		fragment.Set("challenge", challenge)
+		setAuditDetails(c, "verification code required")
+	} else {
+		session, err := h.admin.createSession(c, user)
+		if err != nil {
+			h.fail(c, "Internal server error", err)
+			return
+		}
+		fragment.Set("session", session)
+	}
+	c.Redirect(http.StatusFound, loginPage+"#"+fragment.Encode())
+}
+
+// mapRole 按顺序匹配角色映射，返回第一个匹配的映射
+func (h *OIDCHandler) mapRole(claims oidc.Claims) (config.OIDCRoleMapping, bool) {
+	values := claims.Strings(h.cfg.RoleClaim)
+	for _, mapping := range h.cfg.RoleMappings {
+		if mapping.Value == "*" {
+			return mapping, true
+		}
+		for _, value := range values {
+			if value == mapping.Value {
+				return mapping, true
+			}
+		}
+	}
+	return config.OIDCRoleMapping{}, false
+}
+
+// username 新建用户时使用的用户名：配置的声明，依次回退到 email 和 sub
+func (h *OIDCHandler) username(claims oidc.Claims) string {
+	for _, claim := range []string{h.cfg.UsernameClaim, "email", "sub"} {
+		if value := strings.TrimSpace(claims.String(claim)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// fail 记录失败并带着错误信息跳转回登录页
+func (h *OIDCHandler) fail(c *gin.Context, message string, err error) {
+	metrics.LoginFailures.Inc("admin_oidc")
+	auditFailure(c, message)
+	if err != nil {
+		log.Printf("OIDC login failed: %s: %v", message, err)
+	}
+	c.Redirect(http.StatusFound, loginPage+"#"+url.Values{"error": {message}}.Encode())
+}
+
+// LoginMethods 返回登录页可用的登录方式
+func LoginMethods(oidcEnabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"password": true,
+			"oidc":     oidcEnabled,
+		})
+	}
+}
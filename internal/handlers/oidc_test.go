@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"mailcat/internal/config"
+	"mailcat/internal/models"
+	"mailcat/internal/oidc"
+	"mailcat/internal/oidc/oidctest"
+	"github.com/gin-gonic/gin"
+)
+
+var testRoleMappings = []config.OIDCRoleMapping{
+	{Value: "mailcat-owners", Role: models.RoleOwner},
+	{Value: "mailcat-admins", Role: models.RoleAdmin},
+	{Value: "support", Role: models.RoleViewer, Mailboxes: []string{"support@example.com"}},
+}
+
+func TestMapRole(t *testing.T) {
+	withDefault := append(append([]config.OIDCRoleMapping{}, testRoleMappings...), config.OIDCRoleMapping{Value: "*", Role: models.RoleViewer, Mailboxes: []string{"@example.com"}})
+	tests := []struct {
+		name      string
+		roleClaim string
+		mappings  []config.OIDCRoleMapping
+		claims    oidc.Claims
+		wantRole  string
+		wantOK    bool
+	}{
+		{"array claim", "groups", testRoleMappings, oidc.Claims{"groups": []interface{}{"staff", "mailcat-admins"}}, models.RoleAdmin, true},
+		{"string claim", "groups", testRoleMappings, oidc.Claims{"groups": "support"}, models.RoleViewer, true},
+		// 按映射的顺序匹配，而不是声明中值的顺序
+		{"first mapping wins", "groups", testRoleMappings, oidc.Claims{"groups": []interface{}{"support", "mailcat-owners"}}, models.RoleOwner, true},
+		{"no match", "groups", testRoleMappings, oidc.Claims{"groups": []interface{}{"staff"}}, "", false},
+		{"missing claim", "groups", testRoleMappings, oidc.Claims{"sub": "x"}, "", false},
+		{"case sensitive", "groups", testRoleMappings, oidc.Claims{"groups": "Mailcat-Admins"}, "", false},
+		{"nested claim", "realm_access.roles", testRoleMappings, oidc.Claims{"realm_access": map[string]interface{}{"roles": []interface{}{"mailcat-admins"}}}, models.RoleAdmin, true},
+		{"wildcard", "groups", withDefault, oidc.Claims{"groups": []interface{}{"staff"}}, models.RoleViewer, true},
+		{"wildcard after match", "groups", withDefault, oidc.Claims{"groups": []interface{}{"mailcat-admins"}}, models.RoleAdmin, true},
+		{"wildcard without claim", "groups", withDefault, oidc.Claims{}, models.RoleViewer, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &OIDCHandler{cfg: config.OIDCConfig{RoleClaim: tt.roleClaim, RoleMappings: tt.mappings}}
+			mapping, ok := h.mapRole(tt.claims)
+			if ok != tt.wantOK || mapping.Role != tt.wantRole {
+				t.Errorf("mapRole() = %q, %v, want %q, %v", mapping.Role, ok, tt.wantRole, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestOIDCUsername(t *testing.T) {
+	tests := []struct {
+		name   string
+		claim  string
+		claims oidc.Claims
+		want   string
+	}{
+		{"configured claim", "preferred_username", oidc.Claims{"preferred_username": " alice ", "email": "a@example.com", "sub": "1"}, "alice"},
+		{"custom claim", "upn", oidc.Claims{"upn": "alice@corp", "preferred_username": "other"}, "alice@corp"},
+		{"falls back to email", "preferred_username", oidc.Claims{"preferred_username": "  ", "email": "a@example.com", "sub": "1"}, "a@example.com"},
+		{"falls back to sub", "preferred_username", oidc.Claims{"sub": "1"}, "1"},
+		{"non-string claim", "preferred_username", oidc.Claims{"preferred_username": 42, "sub": "1"}, "1"},
+		{"nothing", "preferred_username", oidc.Claims{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &OIDCHandler{cfg: config.OIDCConfig{UsernameClaim: tt.claim}}
+			if got := h.username(tt.claims); got != tt.want {
+				t.Errorf("username() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// oidcLogin 走完一次登录：跳转到身份提供方、授权、回调，返回回调跳转到登录页时的 URL 片段
+func oidcLogin(t *testing.T, r *gin.Engine, p *oidctest.Provider) url.Values {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login = %d", w.Code)
+	}
+	authURL := w.Header().Get("Location")
+	u, _ := url.Parse(authURL)
+	state := u.Query().Get("state")
+	code := p.Authorize(t, authURL)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/oidc/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusFound || !strings.HasPrefix(location, loginPage+"#") {
+		t.Fatalf("callback = %d %q", w.Code, location)
+	}
+	fragment, err := url.ParseQuery(strings.TrimPrefix(location, loginPage+"#"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fragment
+}
+
+func newOIDCTestRouter(t *testing.T) (*gin.Engine, *testAdmin, *oidctest.Provider) {
+	t.Helper()
+	a := newTestAdmin(t)
+	p := oidctest.NewProvider(t)
+	provider := oidc.New(oidc.Config{Issuer: p.URL, ClientID: oidctest.ClientID, ClientSecret: oidctest.ClientSecret, RedirectURL: "http://localhost/admin/oidc/callback"})
+	h := NewOIDCHandler(provider, a.users, a.handler, config.OIDCConfig{
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		RoleMappings:  testRoleMappings,
+	})
+	r := gin.New()
+	r.GET("/admin/oidc/login", h.Login)
+	r.GET("/admin/oidc/callback", h.Callback)
+	return r, a, p
+}
+
+func TestOIDCCallback(t *testing.T) {
+	r, a, p := newOIDCTestRouter(t)
+	p.Claims = map[string]interface{}{"sub": "sub-alice", "preferred_username": "alice", "groups": []string{"support"}}
+
+	fragment := oidcLogin(t, r, p)
+	session, err := a.sessions.Validate(fragment.Get("session"), "192.0.2.1")
+	if err != nil || session == nil {
+		t.Fatalf("no valid session in %v (%v)", fragment, err)
+	}
+	user, err := a.users.Get(session.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || user.Role != models.RoleViewer || user.OIDCSubject != "sub-alice" || strings.Join(user.Mailboxes, ",") != "support@example.com" {
+		t.Errorf("provisioned user = %+v", user)
+	}
+
+	// 角色随身份提供方中的分组变化
+	p.Claims["groups"] = []string{"mailcat-admins"}
+	if fragment := oidcLogin(t, r, p); fragment.Get("session") == "" {
+		t.Fatalf("second login failed: %v", fragment)
+	}
+	if user, _ := a.users.Get(user.ID); user.Role != models.RoleAdmin {
+		t.Errorf("role after group change = %q, want admin", user.Role)
+	}
+
+	// 没有匹配的映射时拒绝登录
+	p.Claims["groups"] = []string{"staff"}
+	if fragment := oidcLogin(t, r, p); fragment.Get("session") != "" || !strings.Contains(fragment.Get("error"), "not allowed") {
+		t.Errorf("unmapped user: %v", fragment)
+	}
+}
+
+func TestOIDCCallbackRefusesLocalAccount(t *testing.T) {
+	r, a, p := newOIDCTestRouter(t)
+	local, _ := a.login(t, "alice", models.RoleViewer, "alice@example.com")
+	p.Claims = map[string]interface{}{"sub": "sub-alice", "preferred_username": "alice", "groups": []string{"mailcat-owners"}}
+
+	fragment := oidcLogin(t, r, p)
+	if fragment.Get("session") != "" || fragment.Get("error") != "Username is already used by a local account" {
+		t.Fatalf("login with a local username: %v", fragment)
+	}
+	if user, _ := a.users.Get(local.ID); user.Role != models.RoleViewer || user.OIDCSubject != "" {
+		t.Errorf("local account was taken over: %+v", user)
+	}
+
+	// 没有 preferred_username 时回退到 email，不会与本地账户冲突
+	delete(p.Claims, "preferred_username")
+	p.Claims["email"] = "alice@example.com"
+	if fragment := oidcLogin(t, r, p); fragment.Get("session") == "" {
+		t.Errorf("login with email username: %v", fragment)
+	}
+	if users, _ := a.users.List(); len(users) != 2 || users[1].Username != "alice@example.com" {
+		t.Errorf("users = %+v", users)
+	}
+}
+
+func TestOIDCCallbackKeepsLastOwner(t *testing.T) {
+	r, a, p := newOIDCTestRouter(t)
+	p.Claims = map[string]interface{}{"sub": "sub-owner", "preferred_username": "owner", "groups": []string{"mailcat-owners"}}
+	if fragment := oidcLogin(t, r, p); fragment.Get("session") == "" {
+		t.Fatalf("owner login failed: %v", fragment)
+	}
+
+	p.Claims["groups"] = []string{"mailcat-admins"}
+	if fragment := oidcLogin(t, r, p); fragment.Get("session") != "" || fragment.Get("error") != "Role mapping would remove the last owner" {
+		t.Errorf("demoting the last owner: %v", fragment)
+	}
+	users, _ := a.users.List()
+	if len(users) != 1 || users[0].Role != models.RoleOwner {
+		t.Errorf("users after refused demotion = %+v", users)
+	}
+}
+
+func TestOIDCCallbackRejectsForeignState(t *testing.T) {
+	r, _, p := newOIDCTestRouter(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/oidc/login", nil))
+	authURL := w.Header().Get("Location")
+	u, _ := url.Parse(authURL)
+	state := u.Query().Get("state")
+
+	// 没有发起登录时的 state cookie（例如登录 CSRF）
+	req := httptest.NewRequest(http.MethodGet, "/admin/oidc/callback?"+url.Values{"state": {state}, "code": {p.Authorize(t, authURL)}}.Encode(), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if location := w.Header().Get("Location"); !strings.Contains(location, "#error=") || strings.Contains(location, "session=") {
+		t.Errorf("callback without state cookie redirected to %q", location)
+	}
+}
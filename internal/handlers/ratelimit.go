@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mailcat/internal/metrics"
+	"mailcat/internal/models"
+	"mailcat/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter 公开 API 的限流中间件，limiter 为 nil 时（未启用限流）不做任何限制
+type RateLimiter struct {
+	limiter *ratelimit.Limiter
+}
+
+// NewRateLimiter 创建限流中间件
+func NewRateLimiter(limiter *ratelimit.Limiter) *RateLimiter {
+	return &RateLimiter{limiter: limiter}
+}
+
+// ByIP 按客户端 IP 限流。注册在认证之前，使用无效令牌的请求同样被计数
+func (r *RateLimiter) ByIP(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r.take(c, group, ratelimit.ByIP, c.ClientIP())
+	}
+}
+
+// ByKey 按 API 密钥限流。注册在认证之后；配置文件中的 api_token 的 ID 为 0，
+// 通过签名 URL 访问（没有密钥）的请求不按密钥计数
+func (r *RateLimiter) ByKey(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("api_key")
+		key, ok := value.(*models.APIKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		r.take(c, group, ratelimit.ByKey, strconv.Itoa(key.ID))
+	}
+}
+
+// take 取一个令牌并设置 X-RateLimit-* 响应头，令牌不足时返回 429。
+// 同一请求经过多个限流维度时，响应头反映剩余令牌最少的一个
+func (r *RateLimiter) take(c *gin.Context, group, by, id string) {
+	if r.limiter == nil {
+		c.Next()
+		return
+	}
+	result, ok := r.limiter.Take(c.Request.Context(), group, by, id)
+	if !ok {
+		c.Next()
+		return
+	}
+
+	header := c.Writer.Header()
+	if current, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err != nil || result.Remaining <= current {
+		header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	}
+	if !result.Allowed {
+		retryAfter := ceilSeconds(result.RetryAfter)
+		metrics.RateLimited.Inc(group, by)
+		auditFailure(c, "rate limited by "+by)
+		header.Set("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many requests, please try again later",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+	c.Next()
+}
+
+// ceilSeconds 将时长向上取整为秒，用于响应头
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"mailcat/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// adminSessionKey AdminAuthMiddleware 在 gin.Context 中保存当前 session 的键，API 密钥访问时不存在
+const adminSessionKey = "admin_session"
+
+// currentSession 返回发起请求的 session，API 密钥访问时返回 nil
+func currentSession(c *gin.Context) *models.AdminSession {
+	if value, ok := c.Get(adminSessionKey); ok {
+		if session, ok := value.(*models.AdminSession); ok {
+			return session
+		}
+	}
+	return nil
+}
+
+// isHTTPS 判断请求是否通过 HTTPS 到达，包括 TLS 由反向代理终止的情况
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// setCookie 写入 HttpOnly cookie，通过 HTTPS 访问时带 Secure 标记
+func setCookie(c *gin.Context, name, value string, maxAge int, path string, sameSite http.SameSite) {
+	c.SetSameSite(sameSite)
+	c.SetCookie(name, value, maxAge, path, "", isHTTPS(c), true)
+}
+
+// ListSessions 返回当前用户未过期的 session；owner 可以用 ?all=true 查看所有用户的 session
+func (h *AdminHandler) ListSessions(c *gin.Context) {
+	current := currentSession(c)
+	user := currentUser(c)
+	all := c.Query("all") == "true"
+	if all && !user.HasRole(models.RoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only owners can list sessions of all users",
+		})
+		return
+	}
+	if !all && current == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Sessions are only available for user accounts",
+		})
+		return
+	}
+
+	userID := 0
+	if !all {
+		userID = current.UserID
+	}
+	list, err := h.sessions.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list sessions",
+			"details": err.Error(),
+		})
+		return
+	}
+	for i := range list {
+		list[i].Current = current != nil && list[i].ID == current.ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": list,
+	})
+}
+
+// RevokeSession 吊销 session。用户可以吊销自己的 session，owner 可以吊销任何用户的 session
+func (h *AdminHandler) RevokeSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid session ID",
+		})
+		return
+	}
+
+	userID := 0
+	if user := currentUser(c); !user.HasRole(models.RoleOwner) {
+		current := currentSession(c)
+		if current == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Sessions are only available for user accounts",
+			})
+			return
+		}
+		userID = current.UserID
+	}
+	revoked, err := h.sessions.Revoke(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to revoke session",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Session not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessions 吊销当前用户除当前 session 以外的所有 session（“退出其他设备”）
+func (h *AdminHandler) RevokeOtherSessions(c *gin.Context) {
+	current := currentSession(c)
+	if current == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Sessions are only available for user accounts",
+		})
+		return
+	}
+	revoked, err := h.sessions.RevokeUser(current.UserID, current.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to revoke sessions",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Other sessions revoked",
+		"revoked": revoked,
+	})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"mailcat/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionsScopedToUser(t *testing.T) {
+	a := newTestAdmin(t)
+	_, alice := a.login(t, "alice", models.RoleAdmin)
+	bob, bobToken := a.login(t, "bob", models.RoleAdmin)
+	_, owner := a.login(t, "olivia", models.RoleOwner)
+
+	r := gin.New()
+	api := r.Group("/admin/api", a.handler.AdminAuthMiddleware())
+	api.GET("/sessions", a.handler.ListSessions)
+	api.DELETE("/sessions/:id", a.handler.RevokeSession)
+
+	do := func(method, path, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Admin-Session", session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	list := func(path, session string) []models.AdminSession {
+		t.Helper()
+		w := do(http.MethodGet, path, session)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Sessions []models.AdminSession `json:"sessions"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Sessions
+	}
+
+	bobSessions, err := a.sessions.List(bob.ID)
+	if err != nil || len(bobSessions) != 1 {
+		t.Fatalf("List(bob) = %v, %v", bobSessions, err)
+	}
+	bobSessionPath := "/admin/api/sessions/" + strconv.Itoa(bobSessions[0].ID)
+
+	// alice 只能看到自己的 session
+	for _, s := range list("/admin/api/sessions", alice) {
+		if s.UserID == bob.ID {
+			t.Error("ListSessions returned another user's session")
+		}
+	}
+	if w := do(http.MethodGet, "/admin/api/sessions?all=true", alice); w.Code != http.StatusForbidden {
+		t.Errorf("all=true as admin status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// alice 不能吊销 bob 的 session
+	if w := do(http.MethodDelete, bobSessionPath, alice); w.Code != http.StatusNotFound {
+		t.Errorf("revoking another user's session status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if s, _ := a.sessions.Validate(bobToken, "192.0.2.1"); s == nil {
+		t.Fatal("another user's session was revoked")
+	}
+
+	// owner 可以查看和吊销所有用户的 session
+	if got := list("/admin/api/sessions?all=true", owner); len(got) != 3 {
+		t.Errorf("all=true as owner returned %d sessions, want 3", len(got))
+	}
+	if w := do(http.MethodDelete, bobSessionPath, owner); w.Code != http.StatusOK {
+		t.Errorf("owner revoking session status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if s, _ := a.sessions.Validate(bobToken, "192.0.2.1"); s != nil {
+		t.Error("session revoked by the owner still validates")
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"mailcat/internal/metrics"
+	"mailcat/internal/signature"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// signatureWindow 签名时间戳与服务器时间的最大偏差，也是防重放缓存的保留时间
+	signatureWindow = 5 * time.Minute
+	// maxSignedBodySize 校验签名时读取的请求体上限，与全局请求体限制一致
+	maxSignedBodySize = 10 << 20
+)
+
+// RequireSignature 校验推送邮件请求的 X-MailCat-Signature 签名（HMAC-SHA256，覆盖时间戳和请求体）。
+// 在 API 密钥认证之后执行：即使 API 令牌泄露，没有签名密钥也无法伪造或重放推送请求
+func RequireSignature(secret string) gin.HandlerFunc {
+	verifier := signature.NewVerifier(secret, signatureWindow)
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodySize))
+		if err != nil {
+			metrics.IngestTotal.Inc(metrics.SourceAPI, metrics.IngestRejected)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error": "Request body too large",
+				})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Failed to read request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if err := verifier.Verify(c.GetHeader(signature.Header), body, time.Now()); err != nil {
+			metrics.IngestTotal.Inc(metrics.SourceAPI, metrics.IngestRejected)
+			auditFailure(c, err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Invalid signature",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		// 处理器重新读取请求体
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
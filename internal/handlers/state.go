@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"mailcat/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxLabelLength 标签名的最大长度（字符数）
+	maxLabelLength = 64
+	// maxBulkStateIDs 单次批量修改状态的邮件数上限
+	maxBulkStateIDs = 1000
+)
+
+// UpdateEmailState 修改单封邮件的已读、星标和标签状态
+func (h *EmailHandler) UpdateEmailState(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid email ID",
+		})
+		return
+	}
+
+	var update models.EmailStateUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := normalizeStateUpdate(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	updated, err := h.db.UpdateEmailState([]int{id}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update email state",
+			"details": err.Error(),
+		})
+		return
+	}
+	if updated == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Email not found",
+		})
+		return
+	}
+
+	email, err := h.db.GetEmailByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Email not found",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":         email.ID,
+		"is_read":    email.IsRead,
+		"is_starred": email.IsStarred,
+		"labels":     email.Labels,
+	})
+}
+
+// BulkUpdateEmailState 批量修改邮件状态，不存在的 ID 会被忽略
+func (h *EmailHandler) BulkUpdateEmailState(c *gin.Context) {
+	var req models.BulkEmailStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxBulkStateIDs {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("ids must contain between 1 and %d email IDs", maxBulkStateIDs),
+		})
+		return
+	}
+	if err := normalizeStateUpdate(&req.EmailStateUpdate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	setAuditTarget(c, req.IDs...)
+	updated, err := h.db.UpdateEmailState(req.IDs, req.EmailStateUpdate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update email state",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"updated": updated,
+	})
+}
+
+// DeleteEmail 删除邮件：移入回收站（folder=trash），已在回收站中的邮件保持不变
+func (h *EmailHandler) DeleteEmail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid email ID",
+		})
+		return
+	}
+
+	if _, err := h.db.GetEmailByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Email not found",
+		})
+		return
+	}
+	if err := h.db.MoveEmails([]int{id}, models.FolderTrash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete email",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":     id,
+		"folder": models.FolderTrash,
+	})
+}
+
+// GetLabels 获取标签及其邮件数，只能查看部分邮箱的用户只统计这些邮箱中的邮件
+func (h *EmailHandler) GetLabels(c *gin.Context) {
+	labels, err := h.db.ListLabels(userMailboxes(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get labels",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"labels": labels,
+	})
+}
+
+// normalizeStateUpdate 校验状态修改请求并清理标签名（去除首尾空白、去重）
+func normalizeStateUpdate(update *models.EmailStateUpdate) error {
+	if update.IsRead == nil && update.IsStarred == nil && update.Labels == nil &&
+		len(update.AddLabels) == 0 && len(update.RemoveLabels) == 0 {
+		return fmt.Errorf("no state changes requested")
+	}
+
+	var err error
+	if update.Labels != nil {
+		if update.Labels, err = normalizeLabels(update.Labels); err != nil {
+			return err
+		}
+	}
+	if update.AddLabels, err = normalizeLabels(update.AddLabels); err != nil {
+		return err
+	}
+	if update.RemoveLabels, err = normalizeLabels(update.RemoveLabels); err != nil {
+		return err
+	}
+	return nil
+}
+
+func normalizeLabels(labels []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			return nil, fmt.Errorf("label must not be empty")
+		}
+		if utf8.RuneCountInString(label) > maxLabelLength {
+			return nil, fmt.Errorf("label %q is longer than %d characters", label, maxLabelLength)
+		}
+		if strings.IndexFunc(label, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("label %q contains control characters", label)
+		}
+		// 标签名不区分大小写
+		key := strings.ToLower(label)
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, label)
+		}
+	}
+	return result, nil
+}
+
+// parseListFilter 解析列表接口的过滤条件：folder、from、to、subject 以及 is_read、is_starred、label
+func parseListFilter(c *gin.Context) (models.EmailFilter, error) {
+	filter := models.EmailFilter{
+		Folder:  c.Query("folder"),
+		From:    c.Query("from"),
+		To:      c.Query("to"),
+		Subject: c.Query("subject"),
+	}
+	err := parseStateFilter(c, &filter)
+	filter.Mailboxes = userMailboxes(c)
+	return filter, err
+}
+
+// parseStateFilter 解析状态过滤条件：is_read、is_starred（true/false）和 label
+func parseStateFilter(c *gin.Context, filter *models.EmailFilter) error {
+	for _, param := range []struct {
+		name string
+		dest **bool
+	}{{"is_read", &filter.IsRead}, {"is_starred", &filter.IsStarred}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q", param.name, value)
+		}
+		*param.dest = &b
+	}
+	filter.Label = strings.TrimSpace(c.Query("label"))
+	return nil
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// newStateTestRouter 创建修改状态和标签的 API 路由，以及三封邮件：两封发给 alice，一封发给 bob
+func newStateTestRouter(t *testing.T) (*gin.Engine, *testAdmin, []int) {
+	t.Helper()
+	a := newTestAdmin(t)
+	h := NewEmailHandler(a.db, a.store, a.keys, nil, utils.SanitizeOptions{}, nil)
+	var ids []int
+	for _, to := range []string{"alice@example.com", "Alice <alice@example.com>", "bob@example.com"} {
+		email, err := a.db.SaveEmail(&models.EmailRequest{From: "sender@example.com", To: to, Subject: "s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, email.ID)
+	}
+
+	r := gin.New()
+	api := r.Group("/api/v1")
+	api.PATCH("/emails", h.AuthMiddleware(models.ScopeEmailsWrite), h.BulkUpdateEmailState)
+	api.PATCH("/emails/:id", h.AuthMiddleware(models.ScopeEmailsWrite), h.UpdateEmailState)
+	api.GET("/labels", h.AuthMiddleware(models.ScopeEmailsRead), h.GetLabels)
+	r.GET("/admin/api/labels", a.handler.AdminAuthMiddleware(), h.GetLabels)
+	return r, a, ids
+}
+
+func doJSON(r *gin.Engine, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+var apiTokenHeader = http.Header{"Authorization": {"Bearer api-token"}}
+
+func TestBulkUpdateEmailState(t *testing.T) {
+	r, a, ids := newStateTestRouter(t)
+
+	body := `{"ids": [` + strconv.Itoa(ids[0]) + `, ` + strconv.Itoa(ids[2]) + `, 9999], "is_read": true, "is_starred": true, "add_labels": [" QA ", "qa", "Release"]}`
+	w := doJSON(r, http.MethodPatch, "/api/v1/emails", body, apiTokenHeader)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk update = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Updated int `json:"updated"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Updated != 2 {
+		t.Errorf("updated = %d, want 2 (unknown IDs are ignored)", resp.Updated)
+	}
+
+	for i, id := range ids {
+		email, err := a.db.GetEmailByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		changed := i != 1
+		if email.IsRead != changed || email.IsStarred != changed {
+			t.Errorf("email %d: read=%v starred=%v, want %v", id, email.IsRead, email.IsStarred, changed)
+		}
+		want := []string{}
+		if changed {
+			want = []string{"QA", "Release"}
+		}
+		if !reflect.DeepEqual(email.Labels, want) {
+			t.Errorf("email %d labels = %v, want %v", id, email.Labels, want)
+		}
+	}
+
+	// 移除标签，不再使用的标签被删除
+	body = `{"ids": [` + strconv.Itoa(ids[0]) + `, ` + strconv.Itoa(ids[2]) + `], "remove_labels": ["release"], "is_read": false}`
+	if w := doJSON(r, http.MethodPatch, "/api/v1/emails", body, apiTokenHeader); w.Code != http.StatusOK {
+		t.Fatalf("bulk remove = %d: %s", w.Code, w.Body.String())
+	}
+	labels, err := a.db.ListLabels(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 1 || labels[0].Name != "QA" || labels[0].Count != 2 {
+		t.Errorf("labels after removal = %+v, want only QA on 2 emails", labels)
+	}
+	if email, _ := a.db.GetEmailByID(ids[0]); email.IsRead {
+		t.Error("email is still read after is_read=false")
+	}
+
+	tooMany := make([]string, maxBulkStateIDs+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i + 1)
+	}
+	for name, body := range map[string]string{
+		"no ids":         `{"ids": [], "is_read": true}`,
+		"too many ids":   `{"ids": [` + strings.Join(tooMany, ",") + `], "is_read": true}`,
+		"no changes":     `{"ids": [1]}`,
+		"empty label":    `{"ids": [1], "add_labels": ["  "]}`,
+		"long label":     `{"ids": [1], "add_labels": ["` + strings.Repeat("x", maxLabelLength+1) + `"]}`,
+		"control char":   `{"ids": [1], "add_labels": ["a\u0007b"]}`,
+		"invalid json":   `{"ids": [1], "is_read": "yes"}`,
+		"missing ids":    `{"is_read": true}`,
+		"non-array body": `[]`,
+	} {
+		if w := doJSON(r, http.MethodPatch, "/api/v1/emails", body, apiTokenHeader); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestUpdateEmailState(t *testing.T) {
+	r, _, ids := newStateTestRouter(t)
+	target := "/api/v1/emails/" + strconv.Itoa(ids[0])
+
+	if w := doJSON(r, http.MethodPatch, target, `{"add_labels": ["a", "b"]}`, apiTokenHeader); w.Code != http.StatusOK {
+		t.Fatalf("add labels = %d: %s", w.Code, w.Body.String())
+	}
+	// labels 替换全部标签
+	w := doJSON(r, http.MethodPatch, target, `{"labels": ["C", "c", "b"], "is_starred": true}`, apiTokenHeader)
+	if w.Code != http.StatusOK {
+		t.Fatalf("replace labels = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		IsRead    bool     `json:"is_read"`
+		IsStarred bool     `json:"is_starred"`
+		Labels    []string `json:"labels"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.IsRead || !resp.IsStarred || !reflect.DeepEqual(resp.Labels, []string{"b", "C"}) {
+		t.Errorf("response = %+v, want starred with labels [b C]", resp)
+	}
+
+	// 空数组清空标签
+	w = doJSON(r, http.MethodPatch, target, `{"labels": []}`, apiTokenHeader)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Labels) != 0 {
+		t.Errorf("labels after clearing = %v (%v)", resp.Labels, err)
+	}
+
+	if w := doJSON(r, http.MethodPatch, "/api/v1/emails/9999", `{"is_read": true}`, apiTokenHeader); w.Code != http.StatusNotFound {
+		t.Errorf("unknown email status = %d, want 404", w.Code)
+	}
+	if w := doJSON(r, http.MethodPatch, "/api/v1/emails/abc", `{"is_read": true}`, apiTokenHeader); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid id status = %d, want 400", w.Code)
+	}
+}
+
+func TestGetLabelsScopedToMailboxes(t *testing.T) {
+	r, a, ids := newStateTestRouter(t)
+	for _, update := range []struct {
+		id     int
+		labels []string
+	}{
+		{ids[0], []string{"shared", "alice-only"}},
+		{ids[1], []string{"shared"}},
+		{ids[2], []string{"shared", "bob-secret"}},
+	} {
+		if _, err := a.db.UpdateEmailState([]int{update.id}, models.EmailStateUpdate{AddLabels: update.labels}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, viewer := a.login(t, "viewer", models.RoleViewer, "alice@example.com")
+	_, admin := a.login(t, "admin2", models.RoleAdmin)
+	_, nobody := a.login(t, "viewer2", models.RoleViewer, "carol@example.com")
+
+	labels := func(target string, header http.Header) map[string]int {
+		t.Helper()
+		w := doJSON(r, http.MethodGet, target, "", header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", target, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Labels []models.Label `json:"labels"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[string]int)
+		for _, label := range resp.Labels {
+			counts[label.Name] = label.Count
+		}
+		return counts
+	}
+
+	all := map[string]int{"alice-only": 1, "bob-secret": 1, "shared": 3}
+	if got := labels("/api/v1/labels", apiTokenHeader); !reflect.DeepEqual(got, all) {
+		t.Errorf("api labels = %v, want %v", got, all)
+	}
+	if got := labels("/admin/api/labels", http.Header{"X-Admin-Session": {admin}}); !reflect.DeepEqual(got, all) {
+		t.Errorf("admin labels = %v, want %v", got, all)
+	}
+	if got, want := labels("/admin/api/labels", http.Header{"X-Admin-Session": {viewer}}), map[string]int{"alice-only": 1, "shared": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("viewer labels = %v, want %v", got, want)
+	}
+	if got := labels("/admin/api/labels", http.Header{"X-Admin-Session": {nobody}}); len(got) != 0 {
+		t.Errorf("viewer without matching mail sees labels %v", got)
+	}
+}
+
+func TestNormalizeLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  []string
+		want    []string
+		wantErr bool
+	}{
+		{"nil", nil, []string{}, false},
+		{"trimmed", []string{"  urgent\t"}, []string{"urgent"}, false},
+		{"case-insensitive dedup keeps first", []string{"QA", "qa", "Qa "}, []string{"QA"}, false},
+		{"order preserved", []string{"b", "a", "B"}, []string{"b", "a"}, false},
+		{"unicode", []string{"重要", "重要"}, []string{"重要"}, false},
+		{"max length", []string{strings.Repeat("字", maxLabelLength)}, []string{strings.Repeat("字", maxLabelLength)}, false},
+		{"too long", []string{strings.Repeat("字", maxLabelLength+1)}, nil, true},
+		{"empty", []string{"ok", " "}, nil, true},
+		{"newline", []string{"a\nb"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeLabels(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"mailcat/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// GetEmailStructure 返回邮件的 MIME 结构树（类型、头部、disposition、大小）
+func (h *EmailHandler) GetEmailStructure(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid email ID",
+		})
+		return
+	}
+
+	email, err := h.db.GetEmailByID(id)
+	if err != nil || !canAccessEmail(c, email) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Email not found",
+		})
+		return
+	}
+
+	raw := storedMessage(email)
+	if raw == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "MIME structure not available",
+		})
+		return
+	}
+
+	tree, err := utils.ParseMIMETree(raw)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Failed to parse MIME structure",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":        email.ID,
+		"structure": tree,
+	})
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcat/internal/metrics"
+	"mailcat/internal/models"
+	"mailcat/internal/users"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	challengeMaxAge      = 5 * time.Minute // 密码验证通过后提交 TOTP 验证码的时限
+	maxChallengeAttempts = 5               // 单次登录允许的验证码错误次数
+)
+
+// loginChallenge 密码验证通过、等待 TOTP 验证码的登录
+type loginChallenge struct {
+	userID   int
+	username string // 记录审计日志
+	expires  time.Time
+	attempts int
+}
+
+// newLoginChallenge 创建等待第二步验证的登录，返回随机的 challenge token
+func (h *AdminHandler) newLoginChallenge(user *models.User) (string, error) {
+	token, err := generateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	h.challengeMu.Lock()
+	h.challenges[token] = &loginChallenge{userID: user.ID, username: user.Username, expires: time.Now().Add(challengeMaxAge)}
+	h.challengeMu.Unlock()
+	return token, nil
+}
+
+// totpRequired 用户是否必须启用 TOTP：用户单独设置或运行时设置 require_totp。
+// OIDC 用户的多因素认证由身份提供方负责，不受 require_totp 约束
+func (h *AdminHandler) totpRequired(user *models.User) bool {
+	return user.TOTPRequired || (h.settings.Get().RequireTOTP && user.OIDCSubject == "")
+}
+
+// totpEnrollmentRoute 尚未绑定 TOTP 的用户在被要求绑定时仍可访问的接口
+func totpEnrollmentRoute(route string) bool {
+	return route == "/admin/api/me" || strings.HasPrefix(route, "/admin/api/totp")
+}
+
+// verifyCode 校验用户的 TOTP 验证码或恢复码，失败计入登录速率限制。
+// 验证码错误时返回 failStatus：登录时为 401，已登录时为 403，避免前端将其当作 session 失效。
+// 失败时已写入响应，返回 false
+func (h *AdminHandler) verifyCode(c *gin.Context, userID int, code string, failStatus int) (usedRecovery bool, ok bool) {
+	clientIP := c.ClientIP()
+	if allowed, remaining := h.checkRateLimit(clientIP); !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed attempts, please try again later",
+			"retry_after": remaining,
+		})
+		return false, false
+	}
+
+	usedRecovery, err := h.users.VerifySecondFactor(userID, code)
+	if err == users.ErrInvalidCode {
+		h.recordLoginAttempt(clientIP)
+		metrics.LoginFailures.Inc("admin_totp")
+		c.JSON(failStatus, gin.H{
+			"error": "Invalid verification code",
+		})
+		return false, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to verify code",
+			"details": err.Error(),
+		})
+		return false, false
+	}
+	return usedRecovery, true
+}
+
+// LoginTOTP 登录的第二步：提交 challenge 和 TOTP 验证码（或恢复码），验证通过后创建 session
+func (h *AdminHandler) LoginTOTP(c *gin.Context) {
+	var req struct {
+		Challenge string `json:"challenge" binding:"required"`
+		Code      string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request",
+		})
+		return
+	}
+
+	h.challengeMu.Lock()
+	challenge, exists := h.challenges[req.Challenge]
+	if exists && time.Now().After(challenge.expires) {
+		delete(h.challenges, req.Challenge)
+		exists = false
+	}
+	h.challengeMu.Unlock()
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Login challenge expired, please log in again",
+		})
+		return
+	}
+	setAuditActor(c, challenge.username)
+
+	usedRecovery, ok := h.verifyCode(c, challenge.userID, req.Code, http.StatusUnauthorized)
+	if !ok {
+		// 错误次数过多时作废本次登录，需要重新输入密码
+		h.challengeMu.Lock()
+		challenge.attempts++
+		if challenge.attempts >= maxChallengeAttempts {
+			delete(h.challenges, req.Challenge)
+		}
+		h.challengeMu.Unlock()
+		return
+	}
+
+	h.challengeMu.Lock()
+	delete(h.challenges, req.Challenge)
+	h.challengeMu.Unlock()
+
+	user, err := h.users.Get(challenge.userID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Unauthorized",
+		})
+		return
+	}
+	h.resetLoginAttempts(c.ClientIP())
+
+	extra := gin.H{"recovery_code_used": usedRecovery}
+	if usedRecovery {
+		setAuditDetails(c, "recovery code used")
+		remaining, err := h.users.RecoveryCodesRemaining(user.ID)
+		if err == nil {
+			extra["recovery_codes_remaining"] = remaining
+		}
+	}
+	h.startSession(c, user, extra)
+}
+
+// sessionUser 返回 TOTP 接口的当前用户，API 密钥没有对应的用户，返回 nil 并写入响应
+func sessionUser(c *gin.Context) *models.User {
+	user := currentUser(c)
+	if user == nil || user.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "TOTP is only available for user accounts",
+		})
+		return nil
+	}
+	return user
+}
+
+// GetTOTPStatus 返回当前用户的 TOTP 状态
+func (h *AdminHandler) GetTOTPStatus(c *gin.Context) {
+	user := sessionUser(c)
+	if user == nil {
+		return
+	}
+	remaining, err := h.users.RecoveryCodesRemaining(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get TOTP status",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"required":                 h.totpRequired(user),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTOTP 生成新的 TOTP 密钥，返回密钥和用于生成二维码的 otpauth:// 地址；提交验证码（EnableTOTP）后才会启用
+func (h *AdminHandler) SetupTOTP(c *gin.Context) {
+	user := sessionUser(c)
+	if user == nil {
+		return
+	}
+	secret, uri, err := h.users.BeginTOTP(user)
+	if err == users.ErrTOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "TOTP is already enabled",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to set up TOTP",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": uri,
+	})
+}
+
+// EnableTOTP 提交认证器应用生成的验证码完成绑定，返回恢复码（只显示一次）
+func (h *AdminHandler) EnableTOTP(c *gin.Context) {
+	user := sessionUser(c)
+	if user == nil {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request",
+		})
+		return
+	}
+
+	clientIP := c.ClientIP()
+	if allowed, remaining := h.checkRateLimit(clientIP); !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed attempts, please try again later",
+			"retry_after": remaining,
+		})
+		return
+	}
+	codes, err := h.users.EnableTOTP(user.ID, req.Code)
+	switch err {
+	case nil:
+	case users.ErrInvalidCode:
+		h.recordLoginAttempt(clientIP)
+		metrics.LoginFailures.Inc("admin_totp")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Invalid verification code",
+		})
+		return
+	case users.ErrTOTPEnabled:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "TOTP is already enabled",
+		})
+		return
+	case users.ErrTOTPNotStarted:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Call /admin/api/totp/setup first",
+		})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to enable TOTP",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "TOTP enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP 提交验证码或恢复码后关闭 TOTP；被要求启用 TOTP 的用户不能关闭
+func (h *AdminHandler) DisableTOTP(c *gin.Context) {
+	user := sessionUser(c)
+	if user == nil {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request",
+		})
+		return
+	}
+	if h.totpRequired(user) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "TOTP is required and cannot be disabled",
+		})
+		return
+	}
+	if _, ok := h.verifyCode(c, user.ID, req.Code, http.StatusForbidden); !ok {
+		return
+	}
+	if err := h.users.DisableTOTP(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to disable TOTP",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "TOTP disabled",
+	})
+}
+
+// RegenerateRecoveryCodes 提交验证码后生成新的恢复码，旧的恢复码全部失效
+func (h *AdminHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user := sessionUser(c)
+	if user == nil {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request",
+		})
+		return
+	}
+	if _, ok := h.verifyCode(c, user.ID, req.Code, http.StatusForbidden); !ok {
+		return
+	}
+	codes, err := h.users.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to generate recovery codes",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// ResetUserTOTP 清除用户的 TOTP（例如丢失设备且没有恢复码），并使其所有 session 失效
+func (h *AdminHandler) ResetUserTOTP(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+	user, err := h.users.Get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get user",
+			"details": err.Error(),
+		})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+	if err := h.users.DisableTOTP(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to reset TOTP",
+			"details": err.Error(),
+		})
+		return
+	}
+	h.clearUserSessions(id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "TOTP reset",
+	})
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mailcat/internal/models"
+	"mailcat/internal/users"
+	"github.com/gin-gonic/gin"
+)
+
+// adminUserKey AdminAuthMiddleware 在上下文中保存当前用户的键
+const adminUserKey = "admin_user"
+
+// currentUser 返回管理接口的当前用户，/api/v1 等不经过 AdminAuthMiddleware 的请求返回 nil
+func currentUser(c *gin.Context) *models.User {
+	if value, ok := c.Get(adminUserKey); ok {
+		if user, ok := value.(*models.User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// userMailboxes 返回当前用户可见的收件人地址，nil 表示不限制
+func userMailboxes(c *gin.Context) []string {
+	if user := currentUser(c); user != nil {
+		return user.MailboxFilter()
+	}
+	return nil
+}
+
+// canAccessEmail 判断当前用户能否查看邮件，不能查看时按邮件不存在处理
+func canAccessEmail(c *gin.Context, email *models.Email) bool {
+	user := currentUser(c)
+	return user == nil || user.CanAccess(email.To)
+}
+
+// RequireRole 只允许指定角色的用户访问，需在 AdminAuthMiddleware 之后使用
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil || !user.HasRole(roles...) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"details": "requires role " + strings.Join(roles, " or "),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser 返回当前登录的用户
+func (h *AdminHandler) CurrentUser(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"user": currentUser(c),
+	})
+}
+
+// ListUsers 列出所有用户
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	list, err := h.users.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list users",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": list,
+	})
+}
+
+// CreateUser 创建用户，密码为明文，服务端保存其 bcrypt 哈希
+func (h *AdminHandler) CreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.users.Create(req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == users.ErrUsernameTaken {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error":   "Failed to create user",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	setAuditTarget(c, user.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"user": user,
+	})
+}
+
+// UpdateUser 修改用户的密码、角色或邮箱；修改密码后该用户的所有 session 失效
+func (h *AdminHandler) UpdateUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, passwordChanged, err := h.users.Update(id, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to update user",
+			"details": err.Error(),
+		})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+	if passwordChanged {
+		h.clearUserSessions(user.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":                 user,
+		"sessions_invalidated": passwordChanged,
+	})
+}
+
+// DeleteUser 删除用户并使其所有 session 失效，不能删除最后一个 owner
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	deleted, err := h.users.Delete(id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == users.ErrLastOwner {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error":   "Failed to delete user",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+	h.clearUserSessions(id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User deleted",
+	})
+}
@@ -0,0 +1,189 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 检查结果状态
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckShutdown 开始关闭后报告中唯一的检查项
+const CheckShutdown = "shutdown"
+
+// errUnsupported 当前平台无法获取磁盘可用空间
+var errUnsupported = errors.New("free disk space is not supported on this platform")
+
+// CheckFunc 一项就绪检查，返回的 details 会原样输出，error 非 nil 表示未就绪
+type CheckFunc func(ctx context.Context) (details map[string]interface{}, err error)
+
+// Result 单项检查的结果
+type Result struct {
+	Status     string                 `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report 就绪检查报告，任意一项失败时 Status 为 fail
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker 就绪检查集合，各项检查并发执行
+type Checker struct {
+	timeout  time.Duration
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	checks []check
+}
+
+// New 创建检查集合，timeout 为每项检查的超时时间
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register 添加一项检查，同名检查会被替换
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.checks {
+		if c.checks[i].name == name {
+			c.checks[i].fn = fn
+			return
+		}
+	}
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// SetDraining 标记服务开始关闭，此后 Run 不再执行检查，直接报告未就绪，
+// 负载均衡器据此停止转发新的请求
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Run 执行所有检查，超时的检查记为失败
+func (c *Checker) Run(ctx context.Context) *Report {
+	if c.draining.Load() {
+		return &Report{Status: StatusFail, Checks: map[string]Result{
+			CheckShutdown: {Status: StatusFail, Error: "server is shutting down"},
+		}}
+	}
+
+	c.mu.Lock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, ck := range checks {
+		wg.Add(1)
+		go func(i int, ck check) {
+			defer wg.Done()
+			results[i] = c.runOne(ctx, ck.fn)
+		}(i, ck)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	for i, ck := range checks {
+		report.Checks[ck.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checker) runOne(ctx context.Context, fn CheckFunc) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		details map[string]interface{}
+		err     error
+	}
+	start := time.Now()
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := fn(ctx)
+		done <- outcome{details, err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = fmt.Errorf("check timed out after %s", c.timeout)
+	}
+
+	result := Result{Status: StatusOK, DurationMS: time.Since(start).Milliseconds(), Details: out.details}
+	if out.err != nil {
+		result.Status = StatusFail
+		result.Error = out.err.Error()
+	}
+	return result
+}
+
+// DiskSpace 检查 path 所在文件系统的可用空间不少于 minFree 字节。
+// 当前平台无法获取可用空间时只报告而不判定失败
+func DiskSpace(path string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		free, err := freeSpace(path)
+		if err == errUnsupported {
+			return map[string]interface{}{"supported": false}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get free disk space: %w", err)
+		}
+		details := map[string]interface{}{
+			"free_bytes":     free,
+			"min_free_bytes": minFree,
+		}
+		if free < minFree {
+			return details, fmt.Errorf("only %d bytes free on %s", free, path)
+		}
+		return details, nil
+	}
+}
+
+// FileExists 检查文件存在且不是目录，例如前端构建产物
+func FileExists(path string) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", path)
+		}
+		return nil, nil
+	}
+}
+
+// Listening 检查服务是否正在监听，addr 在未监听时返回 nil
+func Listening(addr func() net.Addr) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		a := addr()
+		if a == nil {
+			return nil, errors.New("not listening")
+		}
+		return map[string]interface{}{"address": a.String()}, nil
+	}
+}
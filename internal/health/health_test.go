@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	c := New(50 * time.Millisecond)
+	c.Register("ok", func(ctx context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"version": 11}, nil
+	})
+	c.Register("failing", func(ctx context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"free_bytes": 1}, errors.New("disk full")
+	})
+	release := make(chan struct{})
+	defer close(release)
+	c.Register("slow", func(ctx context.Context) (map[string]interface{}, error) {
+		// 忽略 ctx 的检查也不能拖住 Run
+		<-release
+		return nil, nil
+	})
+
+	start := time.Now()
+	report := c.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run() took %v with a hanging check", elapsed)
+	}
+	if report.Status != StatusFail {
+		t.Errorf("Status = %q, want %q", report.Status, StatusFail)
+	}
+	if len(report.Checks) != 3 {
+		t.Fatalf("Checks = %+v, want 3 results", report.Checks)
+	}
+	if got := report.Checks["ok"]; got.Status != StatusOK || got.Error != "" || got.Details["version"] != 11 {
+		t.Errorf("ok = %+v", got)
+	}
+	if got := report.Checks["failing"]; got.Status != StatusFail || got.Error != "disk full" || got.Details["free_bytes"] != 1 {
+		t.Errorf("failing = %+v", got)
+	}
+	if got := report.Checks["slow"]; got.Status != StatusFail || !strings.Contains(got.Error, "timed out") {
+		t.Errorf("slow = %+v", got)
+	}
+}
+
+func TestRunAllOK(t *testing.T) {
+	c := New(time.Second)
+	c.Register("a", func(ctx context.Context) (map[string]interface{}, error) { return nil, errors.New("replaced") })
+	// 同名检查被替换
+	c.Register("a", func(ctx context.Context) (map[string]interface{}, error) { return nil, nil })
+	c.Register("b", func(ctx context.Context) (map[string]interface{}, error) { return nil, nil })
+
+	report := c.Run(context.Background())
+	if report.Status != StatusOK || len(report.Checks) != 2 {
+		t.Errorf("Run() = %+v, want 2 passing checks", report)
+	}
+}
+
+func TestRunDraining(t *testing.T) {
+	c := New(time.Second)
+	called := false
+	c.Register("database", func(ctx context.Context) (map[string]interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	if report := c.Run(context.Background()); report.Status != StatusOK {
+		t.Fatalf("Run() before draining = %+v", report)
+	}
+
+	called = false
+	c.SetDraining()
+	report := c.Run(context.Background())
+	if report.Status != StatusFail {
+		t.Errorf("Status while draining = %q, want %q", report.Status, StatusFail)
+	}
+	if got, ok := report.Checks[CheckShutdown]; !ok || got.Status != StatusFail || len(report.Checks) != 1 {
+		t.Errorf("Checks while draining = %+v, want only %s", report.Checks, CheckShutdown)
+	}
+	if called {
+		t.Error("checks ran while draining")
+	}
+}
+
+func TestListening(t *testing.T) {
+	var addr net.Addr
+	check := Listening(func() net.Addr { return addr })
+	if _, err := check(context.Background()); err == nil {
+		t.Error("Listening() succeeded without an address")
+	}
+	addr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1143}
+	details, err := check(context.Background())
+	if err != nil || details["address"] != "127.0.0.1:1143" {
+		t.Errorf("Listening() = %v, %v", details, err)
+	}
+}
+
+func TestFileExists(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.html")
+	if _, err := FileExists(path)(context.Background()); err == nil {
+		t.Error("FileExists() succeeded for a missing file")
+	}
+	if err := os.WriteFile(path, []byte("<html>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FileExists(path)(context.Background()); err != nil {
+		t.Errorf("FileExists() = %v", err)
+	}
+	if _, err := FileExists(dir)(context.Background()); err == nil {
+		t.Error("FileExists() succeeded for a directory")
+	}
+}
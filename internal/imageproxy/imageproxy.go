@@ -0,0 +1,230 @@
+package imageproxy
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL      = errors.New("invalid image url")
+	ErrForbiddenTarget = errors.New("image host is not allowed")
+	ErrNotImage        = errors.New("remote resource is not an image")
+	ErrTooLarge        = errors.New("remote image exceeds size limit")
+	ErrUpstream        = errors.New("failed to fetch remote image")
+)
+
+// Options 图片代理配置
+type Options struct {
+	MaxBytes             int64         // 单张图片最大字节数
+	Timeout              time.Duration // 请求远程图片的超时时间
+	CacheEntries         int           // 缓存的最大图片数量
+	CacheTTL             time.Duration // 缓存有效期
+	AllowPrivateNetworks bool          // 是否允许访问内网地址（仅用于测试或可信网络）
+}
+
+// Image 已获取的远程图片
+type Image struct {
+	ContentType string
+	Data        []byte
+	FetchedAt   time.Time
+}
+
+// Proxy 按需获取远程图片，查看邮件时不会把查看者的 IP 暴露给追踪服务
+type Proxy struct {
+	opts   Options
+	client *http.Client
+	cache  *imageCache
+}
+
+// New 创建图片代理
+func New(opts Options) *Proxy {
+	if opts.AllowPrivateNetworks {
+		return newProxy(opts, nil)
+	}
+	return newProxy(opts, isPrivateIP)
+}
+
+// newProxy 创建图片代理，forbidden 非 nil 时拒绝连接到它返回 true 的地址
+func newProxy(opts Options, forbidden func(net.IP) bool) *Proxy {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if forbidden != nil {
+		// 在建立连接前检查解析后的地址，防止 DNS 重绑定绕过；重定向后的连接同样经过检查
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || forbidden(ip) {
+				return ErrForbiddenTarget
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &Proxy{
+		opts: opts,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return errors.New("too many redirects")
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return ErrInvalidURL
+				}
+				return nil
+			},
+		},
+		cache: newImageCache(opts.CacheEntries, opts.CacheTTL),
+	}
+}
+
+// Fetch 获取远程图片，优先使用缓存
+func (p *Proxy) Fetch(ctx context.Context, rawURL string) (*Image, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+	key := u.String()
+
+	if img := p.cache.get(key); img != nil {
+		return img, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", "MailCat-ImageProxy/1.0")
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenTarget) {
+			return nil, ErrForbiddenTarget
+		}
+		if errors.Is(err, ErrInvalidURL) {
+			return nil, ErrInvalidURL
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrUpstream, resp.StatusCode)
+	}
+
+	// SVG 可以携带脚本，不通过代理提供
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") || contentType == "image/svg+xml" {
+		return nil, ErrNotImage
+	}
+	if resp.ContentLength > p.opts.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, p.opts.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+	if int64(len(data)) > p.opts.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	img := &Image{ContentType: contentType, Data: data, FetchedAt: time.Now()}
+	p.cache.put(key, img)
+	return img, nil
+}
+
+// sharedAddressSpace 运营商级 NAT 地址（RFC 6598），部分云平台的元数据服务位于其中
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPrivateIP 判断是否为回环、内网、链路本地等不应从公网代理访问的地址
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip) || (ip.To4() != nil && ip.To4()[0] == 0)
+}
+
+// imageCache 带过期时间的 LRU 缓存
+type imageCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key   string
+	image *Image
+}
+
+func newImageCache(capacity int, ttl time.Duration) *imageCache {
+	return &imageCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *imageCache) get(key string) *Image {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Since(entry.image.FetchedAt) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.image
+}
+
+func (c *imageCache) put(key string, img *Image) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).image = img
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, image: img})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
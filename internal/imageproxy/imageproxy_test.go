@@ -0,0 +1,223 @@
+package imageproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var png = []byte("\x89PNG\r\n\x1a\n fake image data")
+
+func testOptions() Options {
+	return Options{
+		MaxBytes:             1024,
+		Timeout:              2 * time.Second,
+		CacheEntries:         8,
+		CacheTTL:             time.Minute,
+		AllowPrivateNetworks: true,
+	}
+}
+
+// imageServer 提供测试用的图片和各种异常响应，返回服务器和请求计数
+func imageServer(t *testing.T) (*httptest.Server, *int32) {
+	var hits int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/image.svg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+		w.Write([]byte("<svg onload=alert(1)></svg>"))
+	})
+	mux.HandleFunc("/large.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, 2048))
+	})
+	mux.HandleFunc("/large-chunked.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		for i := 0; i < 4; i++ {
+			w.Write(make([]byte, 512))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/missing.png", http.NotFound)
+	mux.HandleFunc("/to-file", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestFetch(t *testing.T) {
+	server, _ := imageServer(t)
+	proxy := New(testOptions())
+	ctx := context.Background()
+
+	img, err := proxy.Fetch(ctx, server.URL+"/image.png")
+	if err != nil {
+		t.Fatalf("Fetch error: %v", err)
+	}
+	if img.ContentType != "image/png" || string(img.Data) != string(png) {
+		t.Errorf("Fetch = %q %q", img.ContentType, img.Data)
+	}
+
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"/page.html", ErrNotImage},
+		{"/image.svg", ErrNotImage},
+		{"/large.png", ErrTooLarge},
+		{"/large-chunked.png", ErrTooLarge},
+		{"/missing.png", ErrUpstream},
+		{"/to-file", ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		if _, err := proxy.Fetch(ctx, server.URL+tt.path); !errors.Is(err, tt.want) {
+			t.Errorf("Fetch(%s) error = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+	for _, raw := range []string{"file:///etc/passwd", "javascript:alert(1)", "//example.com/a.png", "http://", "::"} {
+		if _, err := proxy.Fetch(ctx, raw); err != ErrInvalidURL {
+			t.Errorf("Fetch(%q) error = %v, want ErrInvalidURL", raw, err)
+		}
+	}
+}
+
+func TestFetchRejectsPrivateNetworks(t *testing.T) {
+	server, hits := imageServer(t)
+	opts := testOptions()
+	opts.AllowPrivateNetworks = false
+	opts.Timeout = 500 * time.Millisecond
+	proxy := New(opts)
+
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	for _, raw := range []string{
+		server.URL + "/image.png",
+		"http://localhost" + port + "/image.png",
+		"http://[::1]" + port + "/image.png",
+		"http://10.0.0.1/image.png",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://100.100.100.200/latest/meta-data/",
+		"http://0.0.0.0" + port + "/image.png",
+	} {
+		if _, err := proxy.Fetch(context.Background(), raw); err != ErrForbiddenTarget {
+			t.Errorf("Fetch(%s) error = %v, want ErrForbiddenTarget", raw, err)
+		}
+	}
+	if *hits != 0 {
+		t.Errorf("image server received %d requests, want none", *hits)
+	}
+}
+
+func TestFetchRejectsRedirectToForbiddenAddress(t *testing.T) {
+	// 127.0.0.2 上的服务器代表内网地址，127.0.0.1 上的服务器代表公网上的跳转页
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.2: %v", err)
+	}
+	var internalHits int32
+	internal := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&internalHits, 1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	internal.Listener.Close()
+	internal.Listener = listener
+	internal.Start()
+	defer internal.Close()
+
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/secret.png", http.StatusFound)
+	}))
+	defer public.Close()
+
+	proxy := newProxy(testOptions(), func(ip net.IP) bool { return ip.Equal(net.IPv4(127, 0, 0, 2)) })
+	if _, err := proxy.Fetch(context.Background(), public.URL+"/redirect"); err != ErrForbiddenTarget {
+		t.Errorf("Fetch error = %v, want ErrForbiddenTarget", err)
+	}
+	if internalHits != 0 {
+		t.Errorf("forbidden server received %d requests, want none", internalHits)
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"::", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"93.184.216.34", false},
+		{"100.128.0.1", false},
+		{"2606:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := isPrivateIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPrivateIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestFetchCache(t *testing.T) {
+	server, hits := imageServer(t)
+	opts := testOptions()
+	opts.CacheEntries = 1
+	proxy := New(opts)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := proxy.Fetch(ctx, server.URL+"/image.png"); err != nil {
+			t.Fatalf("Fetch error: %v", err)
+		}
+	}
+	if *hits != 1 {
+		t.Errorf("image server received %d requests, want 1 (later fetches served from cache)", *hits)
+	}
+
+	// 容量为 1 时，缓存另一张图片会淘汰第一张
+	proxy.cache.put("other", &Image{FetchedAt: time.Now()})
+	proxy.Fetch(ctx, server.URL+"/image.png")
+	if *hits != 2 {
+		t.Errorf("image server received %d requests, want 2 after eviction", *hits)
+	}
+
+	// 过期的缓存不再使用
+	proxy.cache.get(server.URL + "/image.png").FetchedAt = time.Now().Add(-2 * time.Minute)
+	proxy.Fetch(ctx, server.URL+"/image.png")
+	if *hits != 3 {
+		t.Errorf("image server received %d requests, want 3 after expiry", *hits)
+	}
+
+	// 失败的请求不会被缓存
+	proxy.Fetch(ctx, server.URL+"/missing.png")
+	if proxy.cache.get(server.URL+"/missing.png") != nil {
+		t.Error("a failed fetch was cached")
+	}
+}
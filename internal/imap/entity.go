@@ -0,0 +1,388 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxEntityDepth multipart 和 message/rfc822 的最大嵌套层数
+const maxEntityDepth = 16
+
+// entity 保留原始字节的 MIME 实体，BODY[section] 需要返回未解码的原始内容
+type entity struct {
+	header []byte // 原始头部，包含结尾的空行
+	body   []byte
+	fields textproto.MIMEHeader
+
+	mediaType string // 小写，例如 text
+	subtype   string // 小写，例如 plain
+	params    map[string]string
+
+	parts    []*entity // multipart 的子部分
+	embedded *entity   // message/rfc822 内嵌的邮件
+}
+
+// parseEntity 解析原始邮件或 MIME 部分，defaultType 为缺少 Content-Type 时的类型
+func parseEntity(raw []byte, defaultType string, depth int) *entity {
+	e := &entity{}
+	e.header, e.body = splitHeader(raw)
+	e.fields = parseHeaderFields(e.header)
+
+	contentType := e.fields.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultType
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = defaultType, nil
+		if mt, _, err := mime.ParseMediaType(defaultType); err == nil {
+			mediaType = mt
+		}
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	if mediaType == "text/plain" {
+		if _, ok := params["charset"]; !ok {
+			params["charset"] = "us-ascii"
+		}
+	}
+	e.params = params
+	e.mediaType, e.subtype, _ = strings.Cut(mediaType, "/")
+
+	if depth >= maxEntityDepth {
+		return e
+	}
+	switch {
+	case e.mediaType == "multipart" && params["boundary"] != "":
+		childType := "text/plain"
+		if e.subtype == "digest" {
+			childType = "message/rfc822"
+		}
+		for _, part := range splitMultipart(e.body, params["boundary"]) {
+			e.parts = append(e.parts, parseEntity(part, childType, depth+1))
+		}
+	case e.isMessage():
+		e.embedded = parseEntity(e.body, "text/plain", depth+1)
+	}
+	return e
+}
+
+func (e *entity) isMultipart() bool {
+	return e.mediaType == "multipart" && len(e.parts) > 0
+}
+
+func (e *entity) isMessage() bool {
+	return e.mediaType == "message" && (e.subtype == "rfc822" || e.subtype == "global")
+}
+
+// splitHeader 在第一个空行处分隔头部和正文，头部包含该空行
+func splitHeader(raw []byte) ([]byte, []byte) {
+	if bytes.HasPrefix(raw, []byte("\r\n")) {
+		return raw[:2], raw[2:]
+	}
+	if bytes.HasPrefix(raw, []byte("\n")) {
+		return raw[:1], raw[1:]
+	}
+	crlf := bytes.Index(raw, []byte("\r\n\r\n"))
+	lf := bytes.Index(raw, []byte("\n\n"))
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return raw[:crlf+4], raw[crlf+4:]
+	case lf >= 0:
+		return raw[:lf+2], raw[lf+2:]
+	default:
+		return raw, nil
+	}
+}
+
+func parseHeaderFields(header []byte) textproto.MIMEHeader {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(header)))
+	fields, _ := r.ReadMIMEHeader()
+	if fields == nil {
+		fields = textproto.MIMEHeader{}
+	}
+	return fields
+}
+
+// splitMultipart 按分隔符切分 multipart 正文，分隔符前的换行属于分隔符
+func splitMultipart(body []byte, boundary string) [][]byte {
+	delimiter := []byte("--" + boundary)
+	var parts [][]byte
+	start := -1
+	pos := 0
+	for pos <= len(body) {
+		lineEnd := bytes.IndexByte(body[pos:], '\n')
+		next := len(body) + 1
+		if lineEnd >= 0 {
+			next = pos + lineEnd + 1
+		}
+		line := body[pos:min(next, len(body))]
+		trimmed := bytes.TrimRight(line, " \t\r\n")
+		if bytes.HasPrefix(trimmed, delimiter) {
+			rest := trimmed[len(delimiter):]
+			closing := bytes.Equal(rest, []byte("--"))
+			if closing || len(rest) == 0 {
+				if start >= 0 {
+					parts = append(parts, trimLineBreak(body[start:pos]))
+				}
+				if closing {
+					return parts
+				}
+				start = next
+			}
+		}
+		if lineEnd < 0 {
+			break
+		}
+		pos = next
+	}
+	// 缺少结束分隔符时保留最后一部分
+	if start >= 0 && start <= len(body) {
+		parts = append(parts, body[start:])
+	}
+	return parts
+}
+
+func trimLineBreak(b []byte) []byte {
+	if bytes.HasSuffix(b, []byte("\r\n")) {
+		return b[:len(b)-2]
+	}
+	return bytes.TrimSuffix(b, []byte("\n"))
+}
+
+// countLines 统计正文行数（BODYSTRUCTURE 中文本部分需要）
+func countLines(b []byte) int {
+	n := bytes.Count(b, []byte("\n"))
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// part 按 IMAP 部分编号查找实体：multipart 的第 n 个子部分；
+// message/rfc822 先进入内嵌邮件；非 multipart 实体的第 1 部分是其本身
+func (e *entity) part(path []int) *entity {
+	current := e
+	for _, n := range path {
+		if current.isMessage() && current.embedded != nil {
+			current = current.embedded
+		}
+		switch {
+		case current.isMultipart():
+			if n < 1 || n > len(current.parts) {
+				return nil
+			}
+			current = current.parts[n-1]
+		case n == 1:
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// filterHeader 返回只包含（或排除）指定字段的头部，包括折行，并以空行结尾
+func filterHeader(header []byte, names []string, exclude bool) []byte {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[strings.ToLower(name)] = true
+	}
+
+	var out bytes.Buffer
+	include := false
+	for _, line := range bytes.SplitAfter(header, []byte("\n")) {
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := strings.Cut(string(line), ":")
+			include = wanted[strings.ToLower(strings.TrimSpace(name))] != exclude
+		}
+		if include {
+			out.Write(line)
+		}
+	}
+	out.WriteString("\r\n")
+	return out.Bytes()
+}
+
+// writeEnvelope 写出 ENVELOPE 结构
+func writeEnvelope(w *responseWriter, fields textproto.MIMEHeader) {
+	header := mail.Header(fields)
+	from := header.Get("From")
+	sender := header.Get("Sender")
+	if sender == "" {
+		sender = from
+	}
+	replyTo := header.Get("Reply-To")
+	if replyTo == "" {
+		replyTo = from
+	}
+
+	w.WriteString("(")
+	w.nstring(header.Get("Date"))
+	w.WriteString(" ")
+	w.nstring(header.Get("Subject"))
+	for _, value := range []string{from, sender, replyTo, header.Get("To"), header.Get("Cc"), header.Get("Bcc")} {
+		w.WriteString(" ")
+		writeAddressList(w, value)
+	}
+	w.WriteString(" ")
+	w.nstring(header.Get("In-Reply-To"))
+	w.WriteString(" ")
+	w.nstring(header.Get("Message-Id"))
+	w.WriteString(")")
+}
+
+// writeAddressList 写出地址列表，每个地址为 (name adl mailbox host)
+func writeAddressList(w *responseWriter, value string) {
+	if strings.TrimSpace(value) == "" {
+		w.WriteString("NIL")
+		return
+	}
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil || len(addresses) == 0 {
+		w.WriteString("NIL")
+		return
+	}
+
+	w.WriteString("(")
+	for _, addr := range addresses {
+		mailbox, host, _ := strings.Cut(addr.Address, "@")
+		name := addr.Name
+		if name != "" && !isASCII(name) {
+			name = mime.QEncoding.Encode("utf-8", name)
+		}
+		w.WriteString("(")
+		w.nstring(name)
+		w.WriteString(" NIL ")
+		w.nstring(mailbox)
+		w.WriteString(" ")
+		w.nstring(host)
+		w.WriteString(")")
+	}
+	w.WriteString(")")
+}
+
+// writeBodyStructure 写出 BODY 或 BODYSTRUCTURE（extended 为 true 时包含扩展数据）
+func writeBodyStructure(w *responseWriter, e *entity, extended bool) {
+	w.WriteString("(")
+	if e.isMultipart() {
+		for _, part := range e.parts {
+			writeBodyStructure(w, part, extended)
+		}
+		w.WriteString(" ")
+		w.quoted(strings.ToUpper(e.subtype))
+		if extended {
+			w.WriteString(" ")
+			writeParams(w, e.params)
+			w.WriteString(" ")
+			writeDisposition(w, e.fields)
+			w.WriteString(" ")
+			w.nstring(e.fields.Get("Content-Language"))
+		}
+		w.WriteString(")")
+		return
+	}
+
+	mediaType, subtype := e.mediaType, e.subtype
+	if mediaType == "multipart" {
+		// 缺少分隔符的 multipart 无法拆分，作为普通文本处理
+		mediaType, subtype = "text", "plain"
+	}
+	encoding := strings.ToUpper(strings.TrimSpace(e.fields.Get("Content-Transfer-Encoding")))
+	if encoding == "" {
+		encoding = "7BIT"
+	}
+
+	w.quoted(strings.ToUpper(mediaType))
+	w.WriteString(" ")
+	w.quoted(strings.ToUpper(subtype))
+	w.WriteString(" ")
+	writeParams(w, e.params)
+	w.WriteString(" ")
+	w.nstring(e.fields.Get("Content-Id"))
+	w.WriteString(" ")
+	w.nstring(e.fields.Get("Content-Description"))
+	w.WriteString(" ")
+	w.quoted(encoding)
+	w.WriteString(" " + strconv.Itoa(len(e.body)))
+
+	switch {
+	case e.isMessage() && e.embedded != nil:
+		w.WriteString(" ")
+		writeEnvelope(w, e.embedded.fields)
+		w.WriteString(" ")
+		writeBodyStructure(w, e.embedded, extended)
+		w.WriteString(" " + strconv.Itoa(countLines(e.body)))
+	case mediaType == "text":
+		w.WriteString(" " + strconv.Itoa(countLines(e.body)))
+	}
+
+	if extended {
+		w.WriteString(" ")
+		w.nstring(e.fields.Get("Content-Md5"))
+		w.WriteString(" ")
+		writeDisposition(w, e.fields)
+		w.WriteString(" ")
+		w.nstring(e.fields.Get("Content-Language"))
+	}
+	w.WriteString(")")
+}
+
+func writeParams(w *responseWriter, params map[string]string) {
+	if len(params) == 0 {
+		w.WriteString("NIL")
+		return
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w.WriteString("(")
+	for i, key := range keys {
+		if i > 0 {
+			w.WriteString(" ")
+		}
+		w.quoted(strings.ToUpper(key))
+		w.WriteString(" ")
+		w.string(params[key])
+	}
+	w.WriteString(")")
+}
+
+func writeDisposition(w *responseWriter, fields textproto.MIMEHeader) {
+	value := fields.Get("Content-Disposition")
+	if value == "" {
+		w.WriteString("NIL")
+		return
+	}
+	disposition, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		w.WriteString("NIL")
+		return
+	}
+	w.WriteString("(")
+	w.quoted(strings.ToUpper(disposition))
+	w.WriteString(" ")
+	writeParams(w, params)
+	w.WriteString(")")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,483 @@
+package imap
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcat/internal/message"
+	"mailcat/internal/models"
+)
+
+// internalDateLayout INTERNALDATE 的格式
+const internalDateLayout = "02-Jan-2006 15:04:05 -0700"
+
+// maxCachedMessages 每个会话缓存的已生成邮件数量，客户端通常会对同一封邮件连续发起多次 FETCH
+const maxCachedMessages = 16
+
+// renderedMessage 生成好的原始邮件及其 MIME 结构
+type renderedMessage struct {
+	raw        []byte
+	receivedAt time.Time
+	root       *entity
+}
+
+func (m *renderedMessage) entity() *entity {
+	if m.root == nil {
+		m.root = parseEntity(m.raw, "text/plain", 0)
+	}
+	return m.root
+}
+
+// fetchItem FETCH 请求的一个数据项
+type fetchItem struct {
+	name    string // UID、FLAGS、ENVELOPE、BODYSTRUCTURE、BODY、BODY[] 等
+	section *bodySection
+}
+
+// bodySection BODY[section]<partial> 中的 section 和 partial
+type bodySection struct {
+	peek      bool
+	path      []int
+	specifier string // 空、HEADER、HEADER.FIELDS、HEADER.FIELDS.NOT、TEXT 或 MIME
+	fields    []string
+
+	partial bool
+	offset  int
+	count   int
+}
+
+// setsSeen 读取正文（非 PEEK）时会把邮件标记为已读
+func (it fetchItem) setsSeen() bool {
+	switch it.name {
+	case "RFC822", "RFC822.TEXT":
+		return true
+	}
+	return it.section != nil && !it.section.peek
+}
+
+func (it fetchItem) needsContent() bool {
+	return it.name != "UID" && it.name != "FLAGS"
+}
+
+// parseFetchItems 解析 FETCH 数据项，支持 ALL、FAST、FULL 宏
+func parseFetchItems(arg item) ([]fetchItem, error) {
+	var names []string
+	switch arg.kind {
+	case listItem:
+		for _, it := range arg.list {
+			if it.kind != atomItem {
+				return nil, syntaxError("invalid fetch item")
+			}
+			names = append(names, it.s)
+		}
+	case atomItem:
+		switch strings.ToUpper(arg.s) {
+		case "ALL":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE"}
+		case "FAST":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE"}
+		case "FULL":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY"}
+		default:
+			names = []string{arg.s}
+		}
+	default:
+		return nil, syntaxError("invalid fetch item")
+	}
+
+	items := make([]fetchItem, 0, len(names))
+	for _, name := range names {
+		it, err := parseFetchItem(name)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+func parseFetchItem(name string) (fetchItem, error) {
+	upper := strings.ToUpper(name)
+	switch upper {
+	case "UID", "FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODYSTRUCTURE", "BODY",
+		"RFC822", "RFC822.HEADER", "RFC822.TEXT":
+		return fetchItem{name: upper}, nil
+	}
+
+	var section bodySection
+	var rest string
+	switch {
+	case strings.HasPrefix(upper, "BODY.PEEK["):
+		section.peek = true
+		rest = name[len("BODY.PEEK["):]
+	case strings.HasPrefix(upper, "BODY["):
+		rest = name[len("BODY["):]
+	default:
+		return fetchItem{}, syntaxErrorf("unknown fetch item %q", name)
+	}
+
+	end := strings.IndexByte(rest, ']')
+	if end < 0 {
+		return fetchItem{}, syntaxError("missing ] in section")
+	}
+	if err := section.parse(rest[:end]); err != nil {
+		return fetchItem{}, err
+	}
+
+	if partial := rest[end+1:]; partial != "" {
+		if !strings.HasPrefix(partial, "<") || !strings.HasSuffix(partial, ">") {
+			return fetchItem{}, syntaxError("invalid partial")
+		}
+		offset, count, found := strings.Cut(partial[1:len(partial)-1], ".")
+		var err1, err2 error
+		section.offset, err1 = strconv.Atoi(offset)
+		section.count, err2 = strconv.Atoi(count)
+		if !found || err1 != nil || err2 != nil || section.offset < 0 || section.count <= 0 {
+			return fetchItem{}, syntaxError("invalid partial")
+		}
+		section.partial = true
+	}
+	return fetchItem{name: "BODY[]", section: &section}, nil
+}
+
+// parse 解析方括号内的 section，例如 1.2.HEADER.FIELDS (FROM TO)
+func (s *bodySection) parse(spec string) error {
+	spec = strings.TrimSpace(spec)
+	for spec != "" {
+		part, rest, _ := strings.Cut(spec, ".")
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		if n <= 0 {
+			return syntaxError("invalid section part")
+		}
+		s.path = append(s.path, n)
+		spec = rest
+	}
+	if spec == "" {
+		return nil
+	}
+
+	specifier, fields, hasFields := strings.Cut(spec, " ")
+	s.specifier = strings.ToUpper(specifier)
+	switch s.specifier {
+	case "HEADER", "TEXT":
+	case "MIME":
+		if len(s.path) == 0 {
+			return syntaxError("MIME requires a part number")
+		}
+	case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
+		fields = strings.TrimSpace(fields)
+		if !hasFields || !strings.HasPrefix(fields, "(") || !strings.HasSuffix(fields, ")") {
+			return syntaxError("missing header field list")
+		}
+		for _, field := range strings.Fields(fields[1 : len(fields)-1]) {
+			s.fields = append(s.fields, strings.ToUpper(strings.Trim(field, `"`)))
+		}
+		if len(s.fields) == 0 {
+			return syntaxError("empty header field list")
+		}
+		return nil
+	default:
+		return syntaxErrorf("unknown section %q", spec)
+	}
+	if hasFields {
+		return syntaxError("unexpected field list")
+	}
+	return nil
+}
+
+// responseName 响应中的数据项名称，例如 BODY[1.HEADER]<0>
+func (s *bodySection) responseName() string {
+	var b strings.Builder
+	b.WriteString("BODY[")
+	for i, n := range s.path {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(strconv.Itoa(n))
+	}
+	if s.specifier != "" {
+		if len(s.path) > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(s.specifier)
+	}
+	if len(s.fields) > 0 {
+		b.WriteString(" (" + strings.Join(s.fields, " ") + ")")
+	}
+	b.WriteByte(']')
+	if s.partial {
+		b.WriteString("<" + strconv.Itoa(s.offset) + ">")
+	}
+	return b.String()
+}
+
+// extract 取出 section 对应的原始内容，部分不存在时返回空
+func (s *bodySection) extract(root *entity, raw []byte) []byte {
+	var data []byte
+	if len(s.path) == 0 {
+		switch s.specifier {
+		case "":
+			data = raw
+		case "HEADER":
+			data = root.header
+		case "HEADER.FIELDS":
+			data = filterHeader(root.header, s.fields, false)
+		case "HEADER.FIELDS.NOT":
+			data = filterHeader(root.header, s.fields, true)
+		case "TEXT":
+			data = root.body
+		}
+	} else if e := root.part(s.path); e != nil {
+		// HEADER、TEXT 等作用于 message/rfc822 部分内嵌的邮件
+		target := e
+		if s.specifier != "" && s.specifier != "MIME" && e.isMessage() && e.embedded != nil {
+			target = e.embedded
+		}
+		switch s.specifier {
+		case "":
+			data = e.body
+		case "MIME":
+			data = e.header
+		case "HEADER":
+			data = target.header
+		case "HEADER.FIELDS":
+			data = filterHeader(target.header, s.fields, false)
+		case "HEADER.FIELDS.NOT":
+			data = filterHeader(target.header, s.fields, true)
+		case "TEXT":
+			data = target.body
+		}
+	}
+
+	if s.partial {
+		if s.offset >= len(data) {
+			return nil
+		}
+		data = data[s.offset:]
+		if s.count < len(data) {
+			data = data[:s.count]
+		}
+	}
+	return data
+}
+
+func (s *session) handleFetch(cmd *command, args []item, uid bool) error {
+	if len(args) != 2 || args[0].kind != atomItem {
+		s.tagged(cmd.tag, "BAD", "FETCH expects sequence set and items")
+		return nil
+	}
+	indexes, err := s.resolve(args[0].s, uid)
+	if err != nil {
+		s.tagged(cmd.tag, "BAD", err.Error())
+		return nil
+	}
+	items, err := parseFetchItems(args[1])
+	if err != nil {
+		s.tagged(cmd.tag, "BAD", err.Error())
+		return nil
+	}
+
+	hasUID, hasFlags, needContent, setsSeen := false, false, false, false
+	for _, it := range items {
+		hasUID = hasUID || it.name == "UID"
+		hasFlags = hasFlags || it.name == "FLAGS"
+		needContent = needContent || it.needsContent()
+		setsSeen = setsSeen || it.setsSeen()
+	}
+	if uid && !hasUID {
+		items = append([]fetchItem{{name: "UID"}}, items...)
+	}
+
+	// 先把需要标记已读的邮件写入数据库，响应中的 FLAGS 即为最新状态
+	markedSeen := make(map[int]bool)
+	if setsSeen && !s.readOnly {
+		var ids []int
+		for _, i := range indexes {
+			if !s.seen[i] {
+				ids = append(ids, s.uids[i])
+				markedSeen[i] = true
+			}
+		}
+		if err := s.server.db.SetEmailsRead(ids, true); err != nil {
+			return err
+		}
+		for i := range markedSeen {
+			s.seen[i] = true
+		}
+	}
+
+	messages := make(map[int]*renderedMessage)
+	if needContent {
+		if err := s.renderMessages(indexes, messages); err != nil {
+			return err
+		}
+	}
+
+	for _, i := range indexes {
+		msg := messages[s.uids[i]]
+		if needContent && msg == nil {
+			// 邮件已被删除，等待下一次 NOOP 时发送 EXPUNGE
+			continue
+		}
+		s.w.WriteString("* " + strconv.Itoa(i+1) + " FETCH (")
+		for j, it := range items {
+			if j > 0 {
+				s.w.WriteString(" ")
+			}
+			s.writeFetchItem(i, it, msg)
+		}
+		if markedSeen[i] && !hasFlags {
+			s.w.WriteString(" FLAGS (" + flagList(true) + ")")
+		}
+		s.w.WriteString(")\r\n")
+	}
+
+	s.ok(cmd, commandName(cmd, uid)+" completed")
+	return nil
+}
+
+func (s *session) writeFetchItem(i int, it fetchItem, msg *renderedMessage) {
+	w := s.w
+	switch it.name {
+	case "UID":
+		w.WriteString("UID " + strconv.Itoa(s.uids[i]))
+	case "FLAGS":
+		w.WriteString("FLAGS (" + flagList(s.seen[i]) + ")")
+	case "INTERNALDATE":
+		w.WriteString("INTERNALDATE ")
+		w.quoted(msg.receivedAt.Format(internalDateLayout))
+	case "RFC822.SIZE":
+		w.WriteString("RFC822.SIZE " + strconv.Itoa(len(msg.raw)))
+	case "ENVELOPE":
+		w.WriteString("ENVELOPE ")
+		writeEnvelope(w, msg.entity().fields)
+	case "BODYSTRUCTURE":
+		w.WriteString("BODYSTRUCTURE ")
+		writeBodyStructure(w, msg.entity(), true)
+	case "BODY":
+		w.WriteString("BODY ")
+		writeBodyStructure(w, msg.entity(), false)
+	case "RFC822":
+		w.WriteString("RFC822 ")
+		w.literal(msg.raw)
+	case "RFC822.HEADER":
+		w.WriteString("RFC822.HEADER ")
+		w.literal(msg.entity().header)
+	case "RFC822.TEXT":
+		w.WriteString("RFC822.TEXT ")
+		w.literal(msg.entity().body)
+	case "BODY[]":
+		w.WriteString(it.section.responseName() + " ")
+		w.literal(it.section.extract(msg.entity(), msg.raw))
+	}
+}
+
+// renderMessages 生成指定邮件的原始内容，优先使用会话缓存
+func (s *session) renderMessages(indexes []int, messages map[int]*renderedMessage) error {
+	var missing []int
+	for _, i := range indexes {
+		uid := s.uids[i]
+		if cached := s.cache[uid]; cached != nil {
+			messages[uid] = cached
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return s.loadEmails(missing, func(email *models.Email) error {
+		msg := &renderedMessage{raw: message.RawCRLF(email), receivedAt: email.ReceivedAt}
+		messages[email.ID] = msg
+		if len(missing) <= maxCachedMessages {
+			if s.cache == nil || len(s.cache) >= maxCachedMessages {
+				s.cache = make(map[int]*renderedMessage)
+			}
+			s.cache[email.ID] = msg
+		}
+		return nil
+	})
+}
+
+// handleStore 修改标志，只有 \Seen 会被保存，其余标志被忽略
+func (s *session) handleStore(cmd *command, args []item, uid bool) error {
+	if len(args) < 3 || args[0].kind != atomItem || args[1].kind != atomItem {
+		s.tagged(cmd.tag, "BAD", "STORE expects sequence set, item and flags")
+		return nil
+	}
+	if s.readOnly {
+		s.tagged(cmd.tag, "NO", "Mailbox is read-only")
+		return nil
+	}
+	indexes, err := s.resolve(args[0].s, uid)
+	if err != nil {
+		s.tagged(cmd.tag, "BAD", err.Error())
+		return nil
+	}
+
+	operation := strings.ToUpper(args[1].s)
+	silent := strings.HasSuffix(operation, ".SILENT")
+	operation = strings.TrimSuffix(operation, ".SILENT")
+	if operation != "FLAGS" && operation != "+FLAGS" && operation != "-FLAGS" {
+		s.tagged(cmd.tag, "BAD", "Unknown STORE item")
+		return nil
+	}
+
+	flags := args[2:]
+	if len(flags) == 1 && flags[0].kind == listItem {
+		flags = flags[0].list
+	}
+	hasSeen := false
+	for _, flag := range flags {
+		hasSeen = hasSeen || flag.isAtom(`\Seen`)
+	}
+
+	var markRead, markUnread []int
+	for _, i := range indexes {
+		seen := s.seen[i]
+		switch {
+		case operation == "FLAGS":
+			seen = hasSeen
+		case hasSeen:
+			seen = operation == "+FLAGS"
+		}
+		if seen != s.seen[i] {
+			if seen {
+				markRead = append(markRead, s.uids[i])
+			} else {
+				markUnread = append(markUnread, s.uids[i])
+			}
+			s.seen[i] = seen
+		}
+	}
+	if err := s.server.db.SetEmailsRead(markRead, true); err != nil {
+		return err
+	}
+	if err := s.server.db.SetEmailsRead(markUnread, false); err != nil {
+		return err
+	}
+
+	if !silent {
+		for _, i := range indexes {
+			s.w.WriteString("* " + strconv.Itoa(i+1) + " FETCH (")
+			if uid {
+				s.w.WriteString("UID " + strconv.Itoa(s.uids[i]) + " ")
+			}
+			s.w.WriteString("FLAGS (" + flagList(s.seen[i]) + "))\r\n")
+		}
+	}
+	s.ok(cmd, commandName(cmd, uid)+" completed")
+	return nil
+}
+
+func commandName(cmd *command, uid bool) string {
+	if uid {
+		return "UID " + strings.ToUpper(cmd.args[0].s)
+	}
+	return cmd.name
+}
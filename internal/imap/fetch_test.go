@@ -0,0 +1,172 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// nestedMessage multipart/mixed：文本部分、multipart/alternative 和内嵌的 message/rfc822
+const nestedMessage = "From: a@example.com\r\n" +
+	"To: b@example.com\r\n" +
+	"Subject: nested\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"preamble\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"first part\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"plain\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>html</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"Subject: forwarded\r\n" +
+	"\r\n" +
+	"forwarded body\r\n" +
+	"--outer--\r\n"
+
+func TestParseFetchItem(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string // BODY[...] 数据项在响应中的名称，其他数据项为其名称
+		peek     bool
+	}{
+		{"uid", "UID", false},
+		{"rfc822.size", "RFC822.SIZE", false},
+		{"BODY[]", "BODY[]", false},
+		{"body.peek[]", "BODY[]", true},
+		{"BODY[1.2.MIME]", "BODY[1.2.MIME]", false},
+		{"BODY[text]<10.20>", "BODY[TEXT]<10>", false},
+		{"BODY.PEEK[HEADER.FIELDS (from \"Subject\")]", "BODY[HEADER.FIELDS (FROM SUBJECT)]", true},
+		{"BODY[3.HEADER.FIELDS.NOT (X-A)]", "BODY[3.HEADER.FIELDS.NOT (X-A)]", false},
+	}
+	for _, tt := range tests {
+		it, err := parseFetchItem(tt.name)
+		if err != nil {
+			t.Errorf("parseFetchItem(%q) error: %v", tt.name, err)
+			continue
+		}
+		got := it.name
+		if it.section != nil {
+			got = it.section.responseName()
+			if it.section.peek != tt.peek {
+				t.Errorf("parseFetchItem(%q) peek = %v", tt.name, it.section.peek)
+			}
+		}
+		if got != tt.response {
+			t.Errorf("parseFetchItem(%q) = %q, want %q", tt.name, got, tt.response)
+		}
+	}
+
+	for _, invalid := range []string{
+		"BODYX", "BODY[", "BODY[0]", "BODY[MIME]", "BODY[HEADER.FIELDS]", "BODY[HEADER.FIELDS ()]",
+		"BODY[TEXT (A)]", "BODY[FOO]", "BODY[]<1>", "BODY[]<1.0>", "BODY[]<-1.5>", "BODY[]x",
+	} {
+		if _, err := parseFetchItem(invalid); err == nil {
+			t.Errorf("parseFetchItem(%q) accepted an invalid item", invalid)
+		}
+	}
+}
+
+func TestParseFetchItemsMacros(t *testing.T) {
+	items, err := parseFetchItems(atom("full"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, it := range items {
+		names = append(names, it.name)
+	}
+	if got := strings.Join(names, " "); got != "FLAGS INTERNALDATE RFC822.SIZE ENVELOPE BODY" {
+		t.Errorf("FULL = %s", got)
+	}
+	if _, err := parseFetchItems(list(atom("UID"), str("FLAGS"))); err == nil {
+		t.Error("a string fetch item was accepted")
+	}
+}
+
+func TestBodySectionExtract(t *testing.T) {
+	raw := []byte(nestedMessage)
+	root := parseEntity(raw, "text/plain", 0)
+
+	tests := []struct {
+		section string
+		want    string
+	}{
+		{"", nestedMessage},
+		{"HEADER", nestedMessage[:strings.Index(nestedMessage, "\r\n\r\n")+4]},
+		{"HEADER.FIELDS (SUBJECT TO)", "To: b@example.com\r\nSubject: nested\r\n\r\n"},
+		{"HEADER.FIELDS.NOT (FROM TO CONTENT-TYPE)", "Subject: nested\r\n\r\n"},
+		{"1", "first part"},
+		{"1.MIME", "Content-Type: text/plain\r\n\r\n"},
+		{"2.1", "plain"},
+		{"2.2", "<p>html</p>"},
+		{"2.2.MIME", "Content-Type: text/html\r\n\r\n"},
+		{"3", "Subject: forwarded\r\n\r\nforwarded body"},
+		{"3.HEADER", "Subject: forwarded\r\n\r\n"},
+		{"3.TEXT", "forwarded body"},
+		{"3.1", "forwarded body"},
+		{"1.1", "first part"}, // 非 multipart 部分的第 1 部分是其本身
+		{"4", ""},
+		{"1.2", ""},
+		{"2.3.1", ""},
+	}
+	for _, tt := range tests {
+		var s bodySection
+		if err := s.parse(tt.section); err != nil {
+			t.Errorf("parse(%q) error: %v", tt.section, err)
+			continue
+		}
+		if got := string(s.extract(root, raw)); got != tt.want {
+			t.Errorf("BODY[%s] = %q, want %q", tt.section, got, tt.want)
+		}
+	}
+
+	partial := &bodySection{specifier: "TEXT", partial: true}
+	for _, tt := range []struct {
+		offset, count int
+		want          string
+	}{
+		{0, 8, "preamble"},
+		{2, 3, "eam"},
+		{len(root.body) - 3, 100, "-\r\n"},
+		{len(root.body), 5, ""},
+	} {
+		partial.offset, partial.count = tt.offset, tt.count
+		if got := string(partial.extract(root, raw)); got != tt.want {
+			t.Errorf("BODY[TEXT]<%d.%d> = %q, want %q", tt.offset, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestWriteBodyStructure(t *testing.T) {
+	var buf bytes.Buffer
+	w := &responseWriter{Writer: bufio.NewWriter(&buf)}
+	writeBodyStructure(w, parseEntity([]byte(nestedMessage), "text/plain", 0), false)
+	w.Flush()
+
+	got := buf.String()
+	for _, want := range []string{
+		`("TEXT" "PLAIN" ("CHARSET" "us-ascii") NIL NIL "7BIT" 10 1)`,
+		`("TEXT" "HTML" NIL NIL NIL "7BIT" 11 1) "ALTERNATIVE")`,
+		`("MESSAGE" "RFC822"`,
+		`"MIXED")`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("BODY = %s\nmissing %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package imap
+
+import (
+	"net/mail"
+	"sort"
+	"strings"
+
+	"mailcat/internal/models"
+)
+
+const (
+	inboxName = "INBOX"
+	spamName  = "Spam"
+	trashName = "Trash"
+	// hierarchyDelimiter 邮箱层级分隔符，邮箱名中不允许出现
+	hierarchyDelimiter = "/"
+)
+
+// MailboxConfig 按收件人划分的邮箱，收件人中有地址与 Address 匹配的邮件属于该邮箱（规则同 models.MatchMailbox）
+type MailboxConfig struct {
+	Name    string
+	Address string
+	Token   string // 以 Name 为用户名、Token 为密码登录时只能访问此邮箱，为空时只能由管理员访问
+}
+
+// user 已登录的用户：管理员或单个邮箱的用户
+type user struct {
+	name    string
+	mailbox *MailboxConfig // 为 nil 时为管理员
+}
+
+// mailbox 用户可见的邮箱，对应一组邮件过滤条件
+type mailbox struct {
+	name       string // UTF-8 名称，发送给客户端前需编码
+	filter     models.EmailFilter
+	attributes string
+}
+
+// mailboxes 返回用户可见的邮箱：
+// 管理员看到全部邮件的 INBOX、Spam 和 Trash，以及每个收件人邮箱；邮箱用户的这三个邮箱只包含该邮箱的邮件
+func (s *Server) mailboxes(u *user) ([]mailbox, error) {
+	if u.mailbox != nil {
+		return []mailbox{
+			{name: inboxName, filter: models.EmailFilter{Folder: models.FolderInbox, Mailboxes: []string{u.mailbox.Address}}},
+			{name: spamName, filter: models.EmailFilter{Folder: models.FolderSpam, Mailboxes: []string{u.mailbox.Address}}, attributes: `\Junk`},
+			{name: trashName, filter: models.EmailFilter{Folder: models.FolderTrash, Mailboxes: []string{u.mailbox.Address}}, attributes: `\Trash`},
+		}, nil
+	}
+
+	list := []mailbox{
+		{name: inboxName, filter: models.EmailFilter{Folder: models.FolderInbox}},
+		{name: spamName, filter: models.EmailFilter{Folder: models.FolderSpam}, attributes: `\Junk`},
+		{name: trashName, filter: models.EmailFilter{Folder: models.FolderTrash}, attributes: `\Trash`},
+	}
+
+	configs := s.opts.Mailboxes
+	if len(configs) == 0 {
+		addresses, err := s.recipientAddresses()
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			configs = append(configs, MailboxConfig{Name: address, Address: address})
+		}
+	}
+	for _, config := range configs {
+		list = append(list, mailbox{
+			name:   config.Name,
+			filter: models.EmailFilter{Folder: models.FolderInbox, Mailboxes: []string{config.Address}},
+		})
+	}
+	return list, nil
+}
+
+// findMailbox 按客户端提交的（已编码的）名称查找邮箱，INBOX 不区分大小写
+func (s *Server) findMailbox(u *user, encodedName string) (*mailbox, error) {
+	list, err := s.mailboxes(u)
+	if err != nil {
+		return nil, err
+	}
+	name := decodeMailboxName(encodedName)
+	for i := range list {
+		if list[i].name == name || (list[i].name == inboxName && strings.EqualFold(name, inboxName)) {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// recipientAddresses 从已有邮件的收件人中提取去重后的地址，用于自动生成邮箱
+func (s *Server) recipientAddresses() ([]string, error) {
+	recipients, err := s.db.ListRecipients()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var addresses []string
+	add := func(address string) {
+		address = strings.ToLower(strings.TrimSpace(address))
+		if address == "" || !strings.Contains(address, "@") || strings.ContainsAny(address, hierarchyDelimiter+`*%"\`) {
+			return
+		}
+		if strings.EqualFold(address, inboxName) || seen[address] {
+			return
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+	for _, to := range recipients {
+		parsed, err := mail.ParseAddressList(to)
+		if err != nil {
+			add(to)
+			continue
+		}
+		for _, addr := range parsed {
+			add(addr.Address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// matchMailbox 按 LIST 通配符匹配邮箱名：* 匹配任意字符，% 不跨越层级分隔符
+func matchMailbox(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*', '%':
+			wildcard := pattern[0]
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchMailbox(rest, name[i:]) {
+					return true
+				}
+				if i < len(name) && wildcard == '%' && name[i] == hierarchyDelimiter[0] {
+					return false
+				}
+			}
+			return false
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return len(name) == 0
+}
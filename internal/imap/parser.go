@@ -0,0 +1,333 @@
+package imap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxLineLength 单行命令的最大长度
+	maxLineLength = 64 << 10
+	// maxLiteralSize 命令中字面量的最大长度（只读服务不支持 APPEND，无需更大）
+	maxLiteralSize = 64 << 10
+)
+
+var errLineTooLong = errors.New("command line too long")
+
+// syntaxError 命令格式错误，回复 BAD 后可以继续处理下一条命令
+type syntaxError string
+
+func (e syntaxError) Error() string { return string(e) }
+
+// itemKind 命令参数的类型
+type itemKind int
+
+const (
+	atomItem   itemKind = iota // 原子，包括 NIL、序列集和 BODY[...] 这类带方括号的数据项
+	stringItem                 // 引号字符串或字面量
+	listItem                   // 括号列表
+)
+
+// item 命令参数
+type item struct {
+	kind itemKind
+	s    string
+	list []item
+}
+
+func (it item) isAtom(name string) bool {
+	return it.kind == atomItem && strings.EqualFold(it.s, name)
+}
+
+// asString 将原子或字符串参数作为字符串使用（IMAP 的 astring）
+func (it item) asString() (string, bool) {
+	if it.kind == listItem {
+		return "", false
+	}
+	return it.s, true
+}
+
+// command 解析后的客户端命令
+type command struct {
+	tag  string
+	name string
+	args []item
+}
+
+// parser 从连接中读取命令，遇到同步字面量 {n} 时发送继续请求
+type parser struct {
+	r         *bufio.Reader
+	onLiteral func() error // 读取同步字面量前调用，用于发送 "+" 继续请求
+
+	line []byte
+	pos  int
+}
+
+// readLine 读取一行（不含 CRLF）
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxLineLength {
+			return nil, errLineTooLong
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// readCommand 读取并解析一条命令
+func (p *parser) readCommand() (*command, error) {
+	line, err := readLine(p.r)
+	if err != nil {
+		return nil, err
+	}
+	p.line, p.pos = line, 0
+
+	cmd := &command{}
+	if cmd.tag, err = p.readTag(); err != nil {
+		return cmd, err
+	}
+	if err := p.expectSpace(); err != nil {
+		return cmd, err
+	}
+	name, err := p.readAtom()
+	if err != nil {
+		return cmd, err
+	}
+	cmd.name = strings.ToUpper(name)
+	cmd.args, err = p.readItems(false)
+	return cmd, err
+}
+
+func (p *parser) readTag() (string, error) {
+	start := p.pos
+	for p.pos < len(p.line) && isTagChar(p.line[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", syntaxError("missing tag")
+	}
+	return string(p.line[start:p.pos]), nil
+}
+
+func (p *parser) expectSpace() error {
+	if p.pos >= len(p.line) || p.line[p.pos] != ' ' {
+		return syntaxError("expected space")
+	}
+	p.pos++
+	return nil
+}
+
+// readItems 读取空格分隔的参数，直到行尾或（inList 时）右括号
+func (p *parser) readItems(inList bool) ([]item, error) {
+	var items []item
+	for {
+		if p.pos >= len(p.line) {
+			if inList {
+				return nil, syntaxError("unterminated list")
+			}
+			return items, nil
+		}
+		if inList && p.line[p.pos] == ')' {
+			p.pos++
+			return items, nil
+		}
+		// 顶层参数前有空格；列表中除第一项外，各项之间以空格分隔
+		if !inList || len(items) > 0 {
+			if err := p.expectSpace(); err != nil {
+				return nil, err
+			}
+		}
+
+		it, err := p.readItem()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+}
+
+func (p *parser) readItem() (item, error) {
+	if p.pos >= len(p.line) {
+		return item{}, syntaxError("missing argument")
+	}
+	switch p.line[p.pos] {
+	case '(':
+		p.pos++
+		list, err := p.readItems(true)
+		return item{kind: listItem, list: list}, err
+	case '"':
+		s, err := p.readQuoted()
+		return item{kind: stringItem, s: s}, err
+	case '{':
+		s, err := p.readLiteral()
+		return item{kind: stringItem, s: s}, err
+	default:
+		s, err := p.readAtom()
+		return item{kind: atomItem, s: s}, err
+	}
+}
+
+// readAtom 读取原子。方括号内允许空格和括号，以支持 BODY[HEADER.FIELDS (FROM)]<0.100>
+func (p *parser) readAtom() (string, error) {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.line) {
+		c := p.line[p.pos]
+		if depth == 0 && (c == ' ' || c == '(' || c == ')') {
+			break
+		}
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case '"', '{', '\r', '\n':
+			if depth == 0 {
+				return "", syntaxErrorf("unexpected %q in atom", c)
+			}
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", syntaxError("empty atom")
+	}
+	return string(p.line[start:p.pos]), nil
+}
+
+func (p *parser) readQuoted() (string, error) {
+	p.pos++ // 开头的引号
+	var b strings.Builder
+	for p.pos < len(p.line) {
+		c := p.line[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.pos >= len(p.line) {
+				return "", syntaxError("unterminated quoted string")
+			}
+			b.WriteByte(p.line[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", syntaxError("unterminated quoted string")
+}
+
+// readLiteral 读取 {n} 或 {n+} 字面量，字面量之后的命令内容在下一行
+func (p *parser) readLiteral() (string, error) {
+	end := strings.IndexByte(string(p.line[p.pos:]), '}')
+	if end < 0 || p.pos+end != len(p.line)-1 {
+		return "", syntaxError("invalid literal")
+	}
+	spec := string(p.line[p.pos+1 : p.pos+end])
+	nonSync := strings.HasSuffix(spec, "+")
+	size, err := strconv.Atoi(strings.TrimSuffix(spec, "+"))
+	if err != nil || size < 0 {
+		return "", syntaxError("invalid literal size")
+	}
+	if size > maxLiteralSize {
+		// 同步字面量尚未发送，可以直接拒绝；非同步字面量已在传输中，只能断开连接
+		if nonSync {
+			return "", errLineTooLong
+		}
+		return "", syntaxError("literal too large")
+	}
+	if !nonSync && p.onLiteral != nil {
+		if err := p.onLiteral(); err != nil {
+			return "", err
+		}
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return "", err
+	}
+	rest, err := readLine(p.r)
+	if err != nil {
+		return "", err
+	}
+	p.line, p.pos = rest, 0
+	return string(buf), nil
+}
+
+func syntaxErrorf(format string, args ...interface{}) error {
+	return syntaxError(fmt.Sprintf(format, args...))
+}
+
+func isTagChar(c byte) bool {
+	return c > ' ' && c < 0x7f && !strings.ContainsRune(`(){%*"\+`, rune(c))
+}
+
+// seqRange 序列号或 UID 范围，0 表示 *
+type seqRange struct {
+	start, stop uint32
+}
+
+// seqSet 序列集，例如 1:3,5,7:*
+type seqSet []seqRange
+
+func parseSeqSet(s string) (seqSet, error) {
+	var set seqSet
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, ":", 2)
+		start, err := parseSeqNumber(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		stop := start
+		if len(bounds) == 2 {
+			if stop, err = parseSeqNumber(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		set = append(set, seqRange{start: start, stop: stop})
+	}
+	return set, nil
+}
+
+func parseSeqNumber(s string) (uint32, error) {
+	if s == "*" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, syntaxErrorf("invalid sequence number %q", s)
+	}
+	return uint32(n), nil
+}
+
+// contains 判断 n 是否在集合中，max 为 * 代表的值（最大序列号或最大 UID）
+func (set seqSet) contains(n, max uint32) bool {
+	for _, r := range set {
+		start, stop := r.start, r.stop
+		if start == 0 {
+			start = max
+		}
+		if stop == 0 {
+			stop = max
+		}
+		if start > stop {
+			start, stop = stop, start
+		}
+		if n >= start && n <= stop {
+			return true
+		}
+	}
+	return false
+}
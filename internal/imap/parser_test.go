@@ -0,0 +1,194 @@
+package imap
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestParser 从字符串读取命令，返回解析器和发送继续请求的次数
+func newTestParser(input string) (*parser, *int) {
+	continuations := 0
+	p := &parser{
+		r:         bufio.NewReader(strings.NewReader(input)),
+		onLiteral: func() error { continuations++; return nil },
+	}
+	return p, &continuations
+}
+
+func atom(s string) item        { return item{kind: atomItem, s: s} }
+func str(s string) item         { return item{kind: stringItem, s: s} }
+func list(items ...item) item   { return item{kind: listItem, list: items} }
+func args(items ...item) []item { return items }
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		input string
+		tag   string
+		name  string
+		args  []item
+	}{
+		{"a1 noop\r\n", "a1", "NOOP", nil},
+		{"a2 LOGIN user \"p\\\"a\\\\ss\"\r\n", "a2", "LOGIN", args(atom("user"), str(`p"a\ss`))},
+		{"a3 LOGIN \"\" \"\"\r\n", "a3", "LOGIN", args(str(""), str(""))},
+		{"a4 FETCH 1:*,3 (UID FLAGS BODY.PEEK[HEADER.FIELDS (FROM SUBJECT)]<0.100>)\n", "a4", "FETCH",
+			args(atom("1:*,3"), list(atom("UID"), atom("FLAGS"), atom("BODY.PEEK[HEADER.FIELDS (FROM SUBJECT)]<0.100>")))},
+		{"a5 SEARCH OR (FROM a) NOT SEEN\r\n", "a5", "SEARCH",
+			args(atom("OR"), list(atom("FROM"), atom("a")), atom("NOT"), atom("SEEN"))},
+		{"a6 STATUS INBOX ()\r\n", "a6", "STATUS", args(atom("INBOX"), list())},
+		{"a7 LIST \"\" %\r\n", "a7", "LIST", args(str(""), atom("%"))},
+	}
+	for _, tt := range tests {
+		p, _ := newTestParser(tt.input)
+		cmd, err := p.readCommand()
+		if err != nil {
+			t.Errorf("readCommand(%q) error: %v", tt.input, err)
+			continue
+		}
+		if cmd.tag != tt.tag || cmd.name != tt.name || !reflect.DeepEqual(cmd.args, tt.args) {
+			t.Errorf("readCommand(%q) = %+v", tt.input, cmd)
+		}
+	}
+}
+
+func TestReadCommandSyntaxErrors(t *testing.T) {
+	for _, input := range []string{
+		"\r\n",
+		"noop\r\n",
+		"a1  NOOP\r\n",
+		"a1 LOGIN (user\r\n",
+		"a1 LOGIN \"user\r\n",
+		"a1 LOGIN user\"x\r\n",
+		"a1 LOGIN user  pass\r\n",
+		"a1 LOGIN {abc}\r\n",
+		"a1 LOGIN {-1}\r\n",
+		"a1 LOGIN {3} x\r\n",
+		"a1 FETCH 1 (FLAGS))\r\n",
+	} {
+		p, _ := newTestParser(input)
+		cmd, err := p.readCommand()
+		var syntaxErr syntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("readCommand(%q) = %+v, %v, want a syntax error", input, cmd, err)
+		}
+	}
+}
+
+func TestReadCommandLiterals(t *testing.T) {
+	// 同步字面量发送一次继续请求，LITERAL+ 不发送；字面量可以包含 CRLF 和引号
+	p, continuations := newTestParser("a1 LOGIN {4}\r\nuser {7+}\r\npa\"\r\nss\r\na2 NOOP\r\n")
+	cmd, err := p.readCommand()
+	if err != nil {
+		t.Fatalf("readCommand error: %v", err)
+	}
+	if want := args(str("user"), str("pa\"\r\nss")); !reflect.DeepEqual(cmd.args, want) {
+		t.Errorf("args = %+v, want %+v", cmd.args, want)
+	}
+	if *continuations != 1 {
+		t.Errorf("sent %d continuation requests, want 1", *continuations)
+	}
+	if cmd, err := p.readCommand(); err != nil || cmd.tag != "a2" {
+		t.Errorf("next command = %+v, %v", cmd, err)
+	}
+
+	// 过大的同步字面量在发送继续请求前拒绝，客户端不会发送内容，可以继续读取下一条命令
+	p, continuations = newTestParser("a1 LOGIN {99999999}\r\na2 NOOP\r\n")
+	var syntaxErr syntaxError
+	if _, err := p.readCommand(); !errors.As(err, &syntaxErr) || *continuations != 0 {
+		t.Errorf("oversized literal: error = %v, continuations = %d", err, *continuations)
+	}
+	if cmd, err := p.readCommand(); err != nil || cmd.tag != "a2" {
+		t.Errorf("command after oversized literal = %+v, %v", cmd, err)
+	}
+
+	// 过大的非同步字面量已经在传输中，只能断开连接
+	p, _ = newTestParser("a1 LOGIN {99999999+}\r\n")
+	if _, err := p.readCommand(); !errors.Is(err, errLineTooLong) {
+		t.Errorf("oversized non-synchronizing literal error = %v, want errLineTooLong", err)
+	}
+
+	// 连接在字面量中途断开
+	p, _ = newTestParser("a1 LOGIN {10}\r\nshort")
+	if _, err := p.readCommand(); err == nil {
+		t.Error("truncated literal was accepted")
+	}
+}
+
+func TestReadLineTooLong(t *testing.T) {
+	p, _ := newTestParser("a1 LOGIN " + strings.Repeat("x", maxLineLength) + "\r\n")
+	if _, err := p.readCommand(); !errors.Is(err, errLineTooLong) {
+		t.Errorf("error = %v, want errLineTooLong", err)
+	}
+}
+
+func TestSeqSet(t *testing.T) {
+	set, err := parseSeqSet("2:4,7,9:*,*:12")
+	if err != nil {
+		t.Fatalf("parseSeqSet error: %v", err)
+	}
+	const max = 20
+	var got []uint32
+	for n := uint32(1); n <= max; n++ {
+		if set.contains(n, max) {
+			got = append(got, n)
+		}
+	}
+	if want := []uint32{2, 3, 4, 7, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}; !reflect.DeepEqual(got, want) {
+		t.Errorf("members = %v, want %v", got, want)
+	}
+
+	// 范围可以倒序书写；* 代表最大值，空邮箱中 * 为 0
+	if set, _ := parseSeqSet("5:3"); !set.contains(4, 10) {
+		t.Error("5:3 does not contain 4")
+	}
+	if set, _ := parseSeqSet("*"); !set.contains(7, 7) || set.contains(6, 7) {
+		t.Error("* does not match only the maximum")
+	}
+
+	for _, invalid := range []string{"", "0", "1:0", "a", "1,,2", "1:", ":3", "-1", "4294967296", "1:2:3"} {
+		if _, err := parseSeqSet(invalid); err == nil {
+			t.Errorf("parseSeqSet(%q) accepted an invalid set", invalid)
+		}
+	}
+}
+
+// FuzzReadCommand 解析任意输入时不能 panic，也不能在字面量上无限读取。运行方式：
+//
+//	go test ./internal/imap -run '^$' -fuzz FuzzReadCommand -fuzztime 30s
+func FuzzReadCommand(f *testing.F) {
+	for _, seed := range []string{
+		"a1 NOOP\r\n",
+		"a1 LOGIN {4}\r\nuser {4+}\r\npass\r\n",
+		"a1 LOGIN {4}\r\nus",
+		"a1 FETCH 1:* (BODY.PEEK[1.2.HEADER.FIELDS (FROM)]<0.10>)\r\n",
+		"a1 SEARCH CHARSET UTF-8 OR (SUBJECT \"x\\\"y\") NOT UID 1:*\r\n",
+		"a1 STATUS INBOX (MESSAGES UNSEEN\r\n",
+		"a1 X {99999999+}\r\n",
+		"a1 X [[[(]\r\n",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		p, _ := newTestParser(input)
+		for i := 0; i <= len(input); i++ {
+			cmd, err := p.readCommand()
+			var syntaxErr syntaxError
+			if err != nil && !errors.As(err, &syntaxErr) {
+				return
+			}
+			if err == nil && (cmd.tag == "" || cmd.name != strings.ToUpper(cmd.name)) {
+				t.Fatalf("readCommand(%q) = %+v", input, cmd)
+			}
+			if err == nil {
+				for _, it := range cmd.args {
+					if it.kind == atomItem && it.s == "" {
+						t.Fatalf("empty atom in %q", input)
+					}
+				}
+			}
+		}
+		t.Fatalf("parser did not reach the end of %q", input)
+	})
+}
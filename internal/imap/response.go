@@ -0,0 +1,136 @@
+package imap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// responseWriter 写出服务端响应，字符串按需使用引号或字面量
+type responseWriter struct {
+	*bufio.Writer
+}
+
+// quoted 写出字符串：可安全加引号时使用引号字符串，否则使用字面量
+func (w *responseWriter) quoted(s string) {
+	if !quotable(s) {
+		w.literal([]byte(s))
+		return
+	}
+	w.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			w.WriteByte('\\')
+		}
+		w.WriteByte(s[i])
+	}
+	w.WriteByte('"')
+}
+
+// string 与 quoted 相同，用于强调参数是 IMAP string
+func (w *responseWriter) string(s string) {
+	w.quoted(s)
+}
+
+// nstring 空字符串写为 NIL
+func (w *responseWriter) nstring(s string) {
+	if s == "" {
+		w.WriteString("NIL")
+		return
+	}
+	w.quoted(s)
+}
+
+// literal 写出 {n} 字面量
+func (w *responseWriter) literal(b []byte) {
+	w.WriteString("{" + strconv.Itoa(len(b)) + "}\r\n")
+	w.Write(b)
+}
+
+func quotable(s string) bool {
+	if len(s) > 1024 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '\r' || c == '\n' || c == 0 || c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// mutf7Encoding 修改版 UTF-7 使用的 base64 字母表（以 , 代替 /，不补齐）
+var mutf7Encoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// encodeMailboxName 按 RFC 3501 5.1.3 将邮箱名编码为修改版 UTF-7
+func encodeMailboxName(name string) string {
+	var b strings.Builder
+	var pending []rune
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		units := utf16.Encode(pending)
+		raw := make([]byte, 0, len(units)*2)
+		for _, u := range units {
+			raw = append(raw, byte(u>>8), byte(u))
+		}
+		b.WriteByte('&')
+		b.WriteString(mutf7Encoding.EncodeToString(raw))
+		b.WriteByte('-')
+		pending = pending[:0]
+	}
+	for _, r := range name {
+		switch {
+		case r == '&':
+			flush()
+			b.WriteString("&-")
+		case r >= 0x20 && r <= 0x7e:
+			flush()
+			b.WriteRune(r)
+		default:
+			pending = append(pending, r)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// decodeMailboxName 解码修改版 UTF-7 邮箱名，格式错误时原样返回
+func decodeMailboxName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '&' {
+			b.WriteByte(name[i])
+			continue
+		}
+		end := strings.IndexByte(name[i:], '-')
+		if end < 0 {
+			return name
+		}
+		encoded := name[i+1 : i+end]
+		i += end
+		if encoded == "" {
+			b.WriteByte('&')
+			continue
+		}
+		raw, err := mutf7Encoding.DecodeString(encoded)
+		if err != nil || len(raw)%2 != 0 {
+			return name
+		}
+		units := make([]uint16, len(raw)/2)
+		for j := range units {
+			units[j] = uint16(raw[2*j])<<8 | uint16(raw[2*j+1])
+		}
+		for _, r := range utf16.Decode(units) {
+			if r == utf8.RuneError {
+				return name
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
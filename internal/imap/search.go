@@ -0,0 +1,346 @@
+package imap
+
+import (
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcat/internal/message"
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+)
+
+// searchDateLayout SEARCH 中日期参数的格式
+const searchDateLayout = "2-Jan-2006"
+
+// searchKey 一个搜索条件
+type searchKey struct {
+	name  string
+	arg   string
+	date  time.Time
+	size  int
+	set   seqSet
+	field string // HEADER 的字段名
+	sub   []*searchKey
+}
+
+// searchTarget 被搜索的邮件，只在条件需要时加载内容
+type searchTarget struct {
+	seq     uint32
+	uid     uint32
+	seen    bool
+	email   *models.Email
+	matched bool
+
+	raw    []byte
+	header mail.Header
+	text   string
+}
+
+func (t *searchTarget) rawMessage() []byte {
+	if t.raw == nil {
+		t.raw = message.RawCRLF(t.email)
+	}
+	return t.raw
+}
+
+func (t *searchTarget) headers() mail.Header {
+	if t.header == nil {
+		t.header = mail.Header(parseEntity(t.rawMessage(), "text/plain", 0).fields)
+	}
+	return t.header
+}
+
+func (t *searchTarget) bodyText() string {
+	if t.text == "" {
+		text, html := message.DecodeContent(t.email)
+		t.text = strings.ToLower(text + "\n" + html)
+	}
+	return t.text
+}
+
+// parseSearchKeys 解析搜索条件，多个条件之间为 AND 关系
+func parseSearchKeys(args []item) ([]*searchKey, error) {
+	var keys []*searchKey
+	for len(args) > 0 {
+		key, rest, err := parseSearchKey(args)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		args = rest
+	}
+	if len(keys) == 0 {
+		return nil, syntaxError("missing search criteria")
+	}
+	return keys, nil
+}
+
+func parseSearchKey(args []item) (*searchKey, []item, error) {
+	first := args[0]
+	args = args[1:]
+
+	if first.kind == listItem {
+		sub, err := parseSearchKeys(first.list)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &searchKey{name: "AND", sub: sub}, args, nil
+	}
+	if first.kind != atomItem {
+		return nil, nil, syntaxError("invalid search key")
+	}
+
+	key := &searchKey{name: strings.ToUpper(first.s)}
+	needArg := func() (string, error) {
+		if len(args) == 0 || args[0].kind == listItem {
+			return "", syntaxErrorf("%s expects an argument", key.name)
+		}
+		value := args[0].s
+		args = args[1:]
+		return value, nil
+	}
+
+	var err error
+	switch key.name {
+	case "ALL", "ANSWERED", "DELETED", "DRAFT", "FLAGGED", "NEW", "OLD", "RECENT", "SEEN",
+		"UNANSWERED", "UNDELETED", "UNDRAFT", "UNFLAGGED", "UNSEEN":
+	case "BCC", "BODY", "CC", "FROM", "SUBJECT", "TEXT", "TO", "KEYWORD", "UNKEYWORD":
+		key.arg, err = needArg()
+		key.arg = strings.ToLower(key.arg)
+	case "HEADER":
+		if key.field, err = needArg(); err == nil {
+			key.arg, err = needArg()
+			key.arg = strings.ToLower(key.arg)
+		}
+	case "BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE":
+		var value string
+		if value, err = needArg(); err == nil {
+			if key.date, err = time.Parse(searchDateLayout, value); err != nil {
+				err = syntaxErrorf("invalid date %q", value)
+			}
+		}
+	case "LARGER", "SMALLER":
+		var value string
+		if value, err = needArg(); err == nil {
+			if key.size, err = strconv.Atoi(value); err != nil {
+				err = syntaxErrorf("invalid size %q", value)
+			}
+		}
+	case "UID":
+		var value string
+		if value, err = needArg(); err == nil {
+			key.set, err = parseSeqSet(value)
+		}
+	case "NOT":
+		if len(args) == 0 {
+			return nil, nil, syntaxError("NOT expects a search key")
+		}
+		var sub *searchKey
+		sub, args, err = parseSearchKey(args)
+		key.sub = []*searchKey{sub}
+	case "OR":
+		var left, right *searchKey
+		if len(args) == 0 {
+			return nil, nil, syntaxError("OR expects two search keys")
+		}
+		if left, args, err = parseSearchKey(args); err == nil {
+			if len(args) == 0 {
+				return nil, nil, syntaxError("OR expects two search keys")
+			}
+			right, args, err = parseSearchKey(args)
+		}
+		key.sub = []*searchKey{left, right}
+	default:
+		// 序列集
+		key.name = "SEQ"
+		key.set, err = parseSeqSet(first.s)
+		if err != nil {
+			err = syntaxErrorf("unknown search key %q", first.s)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, args, nil
+}
+
+// needsContent 判断条件是否需要读取邮件内容
+func (k *searchKey) needsContent() bool {
+	switch k.name {
+	case "AND", "NOT", "OR":
+		for _, sub := range k.sub {
+			if sub.needsContent() {
+				return true
+			}
+		}
+		return false
+	case "ALL", "ANSWERED", "DELETED", "DRAFT", "FLAGGED", "NEW", "OLD", "RECENT", "SEEN",
+		"UNANSWERED", "UNDELETED", "UNDRAFT", "UNFLAGGED", "UNSEEN", "KEYWORD", "UNKEYWORD", "UID", "SEQ":
+		return false
+	}
+	return true
+}
+
+func (k *searchKey) match(t *searchTarget, maxSeq, maxUID uint32) bool {
+	switch k.name {
+	case "AND":
+		for _, sub := range k.sub {
+			if !sub.match(t, maxSeq, maxUID) {
+				return false
+			}
+		}
+		return true
+	case "NOT":
+		return !k.sub[0].match(t, maxSeq, maxUID)
+	case "OR":
+		return k.sub[0].match(t, maxSeq, maxUID) || k.sub[1].match(t, maxSeq, maxUID)
+	case "ALL", "OLD", "UNANSWERED", "UNDELETED", "UNDRAFT", "UNFLAGGED", "UNKEYWORD":
+		return true
+	case "ANSWERED", "DELETED", "DRAFT", "FLAGGED", "RECENT", "NEW", "KEYWORD":
+		// 这些标志不会被保存，RECENT 始终为空
+		return false
+	case "SEEN":
+		return t.seen
+	case "UNSEEN":
+		return !t.seen
+	case "UID":
+		return k.set.contains(t.uid, maxUID)
+	case "SEQ":
+		return k.set.contains(t.seq, maxSeq)
+	case "FROM", "TO", "CC", "BCC", "SUBJECT":
+		return headerContains(t.headers(), k.name, k.arg)
+	case "HEADER":
+		if k.arg == "" {
+			_, ok := t.headers()[textproto.CanonicalMIMEHeaderKey(k.field)]
+			return ok
+		}
+		return headerContains(t.headers(), k.field, k.arg)
+	case "BODY":
+		return strings.Contains(t.bodyText(), k.arg)
+	case "TEXT":
+		if strings.Contains(t.bodyText(), k.arg) {
+			return true
+		}
+		for name := range t.headers() {
+			if headerContains(t.headers(), name, k.arg) {
+				return true
+			}
+		}
+		return false
+	case "LARGER":
+		return len(t.rawMessage()) > k.size
+	case "SMALLER":
+		return len(t.rawMessage()) < k.size
+	case "BEFORE", "ON", "SINCE":
+		return compareDate(t.email.ReceivedAt, k.date, k.name)
+	case "SENTBEFORE", "SENTON", "SENTSINCE":
+		sent, err := t.headers().Date()
+		if err != nil {
+			return false
+		}
+		return compareDate(sent, k.date, strings.TrimPrefix(k.name, "SENT"))
+	}
+	return false
+}
+
+// headerContains 对解码后的头部值进行不区分大小写的包含匹配
+func headerContains(header mail.Header, name, value string) bool {
+	for key, values := range header {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		for _, v := range values {
+			if strings.Contains(strings.ToLower(utils.DecodeHeader(v)), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareDate 按日期比较（忽略时间），RFC 3501 规定不考虑时区
+func compareDate(t, date time.Time, op string) bool {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	switch op {
+	case "BEFORE":
+		return day.Before(date)
+	case "ON":
+		return day.Equal(date)
+	default:
+		return !day.Before(date)
+	}
+}
+
+func (s *session) handleSearch(cmd *command, args []item, uid bool) error {
+	// 只支持 UTF-8 和 US-ASCII 字符集
+	if len(args) >= 2 && args[0].isAtom("CHARSET") {
+		charset, _ := args[1].asString()
+		if !strings.EqualFold(charset, "UTF-8") && !strings.EqualFold(charset, "US-ASCII") {
+			s.tagged(cmd.tag, "NO", "[BADCHARSET (UTF-8 US-ASCII)] Unsupported charset")
+			return nil
+		}
+		args = args[2:]
+	}
+	keys, err := parseSearchKeys(args)
+	if err != nil {
+		s.tagged(cmd.tag, "BAD", err.Error())
+		return nil
+	}
+	root := &searchKey{name: "AND", sub: keys}
+
+	maxSeq := uint32(len(s.uids))
+	maxUID := uint32(0)
+	if len(s.uids) > 0 {
+		maxUID = uint32(s.uids[len(s.uids)-1])
+	}
+
+	var targets []*searchTarget
+	for i, id := range s.uids {
+		targets = append(targets, &searchTarget{seq: uint32(i + 1), uid: uint32(id), seen: s.seen[i]})
+	}
+
+	if root.needsContent() {
+		byID := make(map[int]*searchTarget, len(targets))
+		ids := make([]int, len(targets))
+		for i, t := range targets {
+			byID[int(t.uid)] = t
+			ids[i] = int(t.uid)
+		}
+		err := s.loadEmails(ids, func(email *models.Email) error {
+			t := byID[email.ID]
+			t.email = email
+			t.matched = root.match(t, maxSeq, maxUID)
+			// 匹配后释放内容，避免大邮箱占用过多内存
+			t.email, t.raw, t.header, t.text = nil, nil, nil, ""
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, t := range targets {
+			t.matched = root.match(t, maxSeq, maxUID)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("SEARCH")
+	for _, t := range targets {
+		if !t.matched {
+			continue
+		}
+		b.WriteByte(' ')
+		if uid {
+			b.WriteString(strconv.FormatUint(uint64(t.uid), 10))
+		} else {
+			b.WriteString(strconv.FormatUint(uint64(t.seq), 10))
+		}
+	}
+	s.untagged(b.String())
+	s.ok(cmd, commandName(cmd, uid)+" completed")
+	return nil
+}
@@ -0,0 +1,238 @@
+package imap
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"mailcat/internal/audit"
+	"mailcat/internal/database"
+	"mailcat/internal/ingest"
+	"mailcat/internal/lockout"
+	"mailcat/internal/metrics"
+	"mailcat/internal/models"
+)
+
+const (
+	// autologoutTimeout 未认证或空闲连接的超时时间（RFC 3501 要求不少于 30 分钟）
+	autologoutTimeout = 30 * time.Minute
+	// loginTimeout 登录前的空闲超时
+	loginTimeout = time.Minute
+	// maxLoginFailures 单个连接允许的登录失败次数
+	maxLoginFailures = 3
+	// idlePollInterval IDLE 时兜底的轮询间隔，用于发现其他进程（如 import 命令）写入的邮件
+	idlePollInterval = 30 * time.Second
+)
+
+// Options IMAP 服务配置
+type Options struct {
+	Address           string
+	TLSConfig         *tls.Config                          // 为 nil 时不支持 STARTTLS
+	ImplicitTLS       bool                                 // 连接建立即进行 TLS 握手
+	AllowInsecureAuth bool                                 // 配置了 TLS 时仍允许在未加密连接上登录
+	CheckAdmin        func(username, password string) bool // 校验管理员的用户名和密码，登录后可访问全部邮箱；为 nil 时只能以邮箱令牌登录
+	Lockout           *lockout.Lockout                     // 按来源 IP 的登录失败锁定，与管理后台共用；为 nil 时只限制单个连接的失败次数
+	Audit             *audit.Logger                        // 记录登录成功和失败，为 nil 时不记录
+	Mailboxes         []MailboxConfig
+}
+
+// Server 只读 IMAP4rev1 服务，将存储的邮件以邮箱形式提供给邮件客户端
+type Server struct {
+	db     *database.DB
+	ingest *ingest.Pipeline
+	opts   Options
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer 创建 IMAP 服务，ingestPipeline 用于在新邮件入库时通知 IDLE 中的客户端
+func NewServer(db *database.DB, ingestPipeline *ingest.Pipeline, opts Options) *Server {
+	return &Server{
+		db:     db,
+		ingest: ingestPipeline,
+		opts:   opts,
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 监听 Options.Address 并处理连接，直到 Close 被调用
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.opts.Address)
+	if err != nil {
+		return err
+	}
+	if s.opts.ImplicitTLS {
+		l = tls.NewListener(l, s.opts.TLSConfig)
+	}
+	return s.Serve(l)
+}
+
+// Serve 在指定的 listener 上处理连接，Close 之后返回 nil
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			newSession(s, conn).serve()
+		}()
+	}
+}
+
+// Close 停止监听并断开所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// Addr 返回正在监听的地址，尚未开始监听或已关闭时返回 nil
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil || s.closed {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// authenticate 校验用户名和密码：管理员使用自己的密码，邮箱名使用该邮箱的令牌。
+// ip 为客户端地址，被锁定时不校验密码；失败计入锁定，结果写入审计日志
+func (s *Server) authenticate(username, password, ip string) *user {
+	if s.opts.Lockout != nil {
+		if allowed, _ := s.opts.Lockout.Check(ip); !allowed {
+			log.Printf("IMAP login for user %q from %s rejected: too many failed attempts", username, ip)
+			s.recordLogin(username, ip, http.StatusTooManyRequests, "too many failed login attempts")
+			return nil
+		}
+	}
+
+	u := s.checkCredentials(username, password)
+	if u == nil {
+		log.Printf("IMAP login failed for user %q", username)
+		metrics.LoginFailures.Inc("imap")
+		if s.opts.Lockout != nil {
+			s.opts.Lockout.Fail(ip)
+		}
+		s.recordLogin(username, ip, http.StatusUnauthorized, "invalid credentials")
+		return nil
+	}
+	if s.opts.Lockout != nil {
+		s.opts.Lockout.Reset(ip)
+	}
+	s.recordLogin(username, ip, http.StatusOK, "")
+	return u
+}
+
+// checkCredentials 按管理员密码或邮箱令牌校验，失败时返回 nil
+func (s *Server) checkCredentials(username, password string) *user {
+	if s.opts.CheckAdmin != nil && s.opts.CheckAdmin(username, password) {
+		return &user{name: username}
+	}
+	for i := range s.opts.Mailboxes {
+		mailbox := &s.opts.Mailboxes[i]
+		if mailbox.Token != "" && username == mailbox.Name && secureCompare(password, mailbox.Token) {
+			return &user{name: username, mailbox: mailbox}
+		}
+	}
+	return nil
+}
+
+// recordLogin 将登录结果写入审计日志，状态码与管理后台登录的 HTTP 状态一致
+func (s *Server) recordLogin(username, ip string, status int, details string) {
+	if s.opts.Audit == nil {
+		return
+	}
+	s.opts.Audit.Record(models.AuditEntry{
+		Actor:     username,
+		ActorType: models.ActorUser,
+		Action:    "imap.login",
+		Method:    "IMAP",
+		IP:        ip,
+		Status:    status,
+		Success:   status == http.StatusOK,
+		Details:   details,
+	})
+}
+
+// remoteIP 返回连接的客户端 IP，用于登录失败锁定
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// secureCompare 以固定时间比较两个字符串，先取哈希以免泄露长度
+func secureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,694 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcat/internal/models"
+)
+
+// uidValidity 邮件 ID 使用 AUTOINCREMENT 生成且不会复用，UID 始终有效
+const uidValidity = 1
+
+// errLogout 客户端已登出或连接需要关闭
+var errLogout = errors.New("logout")
+
+// session 单个客户端连接的状态
+type session struct {
+	server *Server
+	conn   net.Conn
+	tls    bool
+	r      *bufio.Reader
+	w      *responseWriter
+	p      *parser
+
+	user     *user
+	failures int
+
+	// 已选中的邮箱，序列号 i+1 对应 uids[i]
+	selected *mailbox
+	readOnly bool
+	uids     []int
+	seen     []bool
+	uidNext  int
+
+	cache map[int]*renderedMessage
+}
+
+func newSession(server *Server, conn net.Conn) *session {
+	s := &session{server: server}
+	_, s.tls = conn.(*tls.Conn)
+	s.setConn(conn)
+	return s
+}
+
+func (s *session) setConn(conn net.Conn) {
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+	s.w = &responseWriter{Writer: bufio.NewWriter(conn)}
+	s.p = &parser{r: s.r, onLiteral: func() error {
+		s.w.WriteString("+ Ready for literal data\r\n")
+		return s.w.Flush()
+	}}
+}
+
+func (s *session) serve() {
+	s.untagged("OK [CAPABILITY " + s.capabilities() + "] MailCat IMAP4rev1 service ready")
+	if s.w.Flush() != nil {
+		return
+	}
+
+	for {
+		timeout := autologoutTimeout
+		if s.user == nil {
+			timeout = loginTimeout
+		}
+		s.conn.SetDeadline(time.Now().Add(timeout))
+
+		cmd, err := s.p.readCommand()
+		if err != nil {
+			var syntaxErr syntaxError
+			var netErr net.Error
+			switch {
+			case errors.As(err, &syntaxErr):
+				tag := "*"
+				if cmd != nil && cmd.tag != "" {
+					tag = cmd.tag
+				}
+				s.tagged(tag, "BAD", "Syntax error: "+err.Error())
+				if s.w.Flush() != nil {
+					return
+				}
+				continue
+			case errors.Is(err, errLineTooLong):
+				s.untagged("BYE Command line too long")
+			case errors.As(err, &netErr) && netErr.Timeout():
+				s.untagged("BYE Autologout; idle for too long")
+			}
+			s.w.Flush()
+			return
+		}
+
+		err = s.handle(cmd)
+		if flushErr := s.w.Flush(); flushErr != nil {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, errLogout) {
+				log.Printf("IMAP session error: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// handle 执行一条命令，返回错误时关闭连接
+func (s *session) handle(cmd *command) error {
+	switch cmd.name {
+	case "CAPABILITY":
+		s.untagged("CAPABILITY " + s.capabilities())
+		s.ok(cmd, "CAPABILITY completed")
+		return nil
+	case "NOOP", "CHECK":
+		if s.selected != nil {
+			if err := s.update(); err != nil {
+				return err
+			}
+		}
+		s.ok(cmd, cmd.name+" completed")
+		return nil
+	case "LOGOUT":
+		s.untagged("BYE MailCat IMAP server logging out")
+		s.ok(cmd, "LOGOUT completed")
+		return errLogout
+	case "STARTTLS":
+		return s.handleStartTLS(cmd)
+	case "LOGIN":
+		return s.handleLogin(cmd)
+	case "AUTHENTICATE":
+		return s.handleAuthenticate(cmd)
+	}
+
+	if s.user == nil {
+		s.tagged(cmd.tag, "BAD", "Command requires authentication")
+		return nil
+	}
+
+	switch cmd.name {
+	case "SELECT", "EXAMINE":
+		return s.handleSelect(cmd)
+	case "LIST", "LSUB":
+		return s.handleList(cmd)
+	case "STATUS":
+		return s.handleStatus(cmd)
+	case "NAMESPACE":
+		s.untagged(`NAMESPACE (("" "` + hierarchyDelimiter + `")) NIL NIL`)
+		s.ok(cmd, "NAMESPACE completed")
+		return nil
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		// 所有邮箱始终视为已订阅
+		s.ok(cmd, cmd.name+" completed")
+		return nil
+	case "IDLE":
+		return s.handleIdle(cmd)
+	case "CREATE", "DELETE", "RENAME", "APPEND":
+		s.readOnlyError(cmd)
+		return nil
+	}
+
+	if s.selected == nil {
+		s.tagged(cmd.tag, "BAD", "No mailbox selected")
+		return nil
+	}
+
+	switch cmd.name {
+	case "CLOSE", "UNSELECT":
+		s.deselect()
+		s.ok(cmd, cmd.name+" completed")
+		return nil
+	case "EXPUNGE", "COPY", "MOVE":
+		s.readOnlyError(cmd)
+		return nil
+	case "FETCH":
+		return s.handleFetch(cmd, cmd.args, false)
+	case "STORE":
+		return s.handleStore(cmd, cmd.args, false)
+	case "SEARCH":
+		return s.handleSearch(cmd, cmd.args, false)
+	case "UID":
+		if len(cmd.args) == 0 || cmd.args[0].kind != atomItem {
+			s.tagged(cmd.tag, "BAD", "Missing UID command")
+			return nil
+		}
+		args := cmd.args[1:]
+		switch strings.ToUpper(cmd.args[0].s) {
+		case "FETCH":
+			return s.handleFetch(cmd, args, true)
+		case "STORE":
+			return s.handleStore(cmd, args, true)
+		case "SEARCH":
+			return s.handleSearch(cmd, args, true)
+		case "COPY", "MOVE", "EXPUNGE":
+			s.readOnlyError(cmd)
+			return nil
+		}
+	}
+
+	s.tagged(cmd.tag, "BAD", "Unknown command")
+	return nil
+}
+
+func (s *session) capabilities() string {
+	caps := []string{"IMAP4rev1", "LITERAL+", "IDLE", "UNSELECT", "NAMESPACE"}
+	if s.server.opts.TLSConfig != nil && !s.tls {
+		caps = append(caps, "STARTTLS")
+	}
+	if s.user == nil {
+		if s.canLogin() {
+			caps = append(caps, "AUTH=PLAIN")
+		} else {
+			caps = append(caps, "LOGINDISABLED")
+		}
+	}
+	return strings.Join(caps, " ")
+}
+
+// canLogin 配置了 TLS 时只允许在加密连接上登录，除非显式允许明文登录
+func (s *session) canLogin() bool {
+	return s.tls || s.server.opts.TLSConfig == nil || s.server.opts.AllowInsecureAuth
+}
+
+func (s *session) untagged(text string) {
+	s.w.WriteString("* " + text + "\r\n")
+}
+
+func (s *session) tagged(tag, status, text string) {
+	s.w.WriteString(tag + " " + status + " " + text + "\r\n")
+}
+
+func (s *session) ok(cmd *command, text string) {
+	s.tagged(cmd.tag, "OK", text)
+}
+
+func (s *session) readOnlyError(cmd *command) {
+	s.tagged(cmd.tag, "NO", "[CANNOT] MailCat IMAP is read-only")
+}
+
+func (s *session) handleStartTLS(cmd *command) error {
+	if s.server.opts.TLSConfig == nil || s.tls {
+		s.tagged(cmd.tag, "BAD", "STARTTLS not available")
+		return nil
+	}
+	if s.user != nil {
+		s.tagged(cmd.tag, "BAD", "Already authenticated")
+		return nil
+	}
+	// STARTTLS 之后不能处理握手前已缓冲的明文数据，防止命令注入
+	if s.r.Buffered() > 0 {
+		s.tagged(cmd.tag, "BAD", "Unexpected data after STARTTLS")
+		return errLogout
+	}
+
+	s.ok(cmd, "Begin TLS negotiation now")
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	tlsConn := tls.Server(s.conn, s.server.opts.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	s.tls = true
+	s.setConn(tlsConn)
+	return nil
+}
+
+func (s *session) handleLogin(cmd *command) error {
+	if s.user != nil {
+		s.tagged(cmd.tag, "BAD", "Already authenticated")
+		return nil
+	}
+	if !s.canLogin() {
+		s.tagged(cmd.tag, "NO", "[PRIVACYREQUIRED] LOGIN is disabled, use STARTTLS first")
+		return nil
+	}
+	if len(cmd.args) != 2 {
+		s.tagged(cmd.tag, "BAD", "LOGIN expects username and password")
+		return nil
+	}
+	username, ok1 := cmd.args[0].asString()
+	password, ok2 := cmd.args[1].asString()
+	if !ok1 || !ok2 {
+		s.tagged(cmd.tag, "BAD", "Invalid LOGIN arguments")
+		return nil
+	}
+	return s.login(cmd, username, password)
+}
+
+// handleAuthenticate 支持 AUTHENTICATE PLAIN，初始响应可以在命令中给出或在继续请求后发送
+func (s *session) handleAuthenticate(cmd *command) error {
+	if s.user != nil {
+		s.tagged(cmd.tag, "BAD", "Already authenticated")
+		return nil
+	}
+	if len(cmd.args) == 0 || !cmd.args[0].isAtom("PLAIN") {
+		s.tagged(cmd.tag, "NO", "Unsupported authentication mechanism")
+		return nil
+	}
+	if !s.canLogin() {
+		s.tagged(cmd.tag, "NO", "[PRIVACYREQUIRED] Authentication is disabled, use STARTTLS first")
+		return nil
+	}
+
+	var response string
+	if len(cmd.args) > 1 {
+		response, _ = cmd.args[1].asString()
+	} else {
+		s.w.WriteString("+ \r\n")
+		if err := s.w.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(s.r)
+		if err != nil {
+			return err
+		}
+		response = string(line)
+	}
+	if response == "*" {
+		s.tagged(cmd.tag, "BAD", "Authentication cancelled")
+		return nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		s.tagged(cmd.tag, "BAD", "Invalid base64 response")
+		return nil
+	}
+	parts := bytes.Split(decoded, []byte{0})
+	if len(parts) != 3 || (len(parts[0]) > 0 && !bytes.Equal(parts[0], parts[1])) {
+		s.tagged(cmd.tag, "NO", "[AUTHENTICATIONFAILED] Invalid PLAIN response")
+		return nil
+	}
+	return s.login(cmd, string(parts[1]), string(parts[2]))
+}
+
+func (s *session) login(cmd *command, username, password string) error {
+	u := s.server.authenticate(username, password, remoteIP(s.conn))
+	if u == nil {
+		s.failures++
+		// 延迟响应以减缓暴力破解
+		time.Sleep(time.Second)
+		s.tagged(cmd.tag, "NO", "[AUTHENTICATIONFAILED] Invalid credentials")
+		if s.failures >= maxLoginFailures {
+			s.untagged("BYE Too many authentication failures")
+			return errLogout
+		}
+		return nil
+	}
+
+	s.user = u
+	s.ok(cmd, "[CAPABILITY "+s.capabilities()+"] Logged in")
+	return nil
+}
+
+func (s *session) handleSelect(cmd *command) error {
+	s.deselect()
+	if len(cmd.args) != 1 {
+		s.tagged(cmd.tag, "BAD", cmd.name+" expects a mailbox name")
+		return nil
+	}
+	name, _ := cmd.args[0].asString()
+	mb, err := s.server.findMailbox(s.user, name)
+	if err != nil {
+		return err
+	}
+	if mb == nil {
+		s.tagged(cmd.tag, "NO", "[NONEXISTENT] No such mailbox")
+		return nil
+	}
+
+	states, err := s.server.db.ListEmailStates(mb.filter)
+	if err != nil {
+		return err
+	}
+	uidNext, err := s.nextUID()
+	if err != nil {
+		return err
+	}
+
+	s.selected = mb
+	s.readOnly = cmd.name == "EXAMINE"
+	s.uidNext = uidNext
+	firstUnseen := 0
+	for i, state := range states {
+		s.uids = append(s.uids, state.ID)
+		s.seen = append(s.seen, state.IsRead)
+		if !state.IsRead && firstUnseen == 0 {
+			firstUnseen = i + 1
+		}
+	}
+
+	s.untagged(`FLAGS (\Seen \Answered \Flagged \Deleted \Draft)`)
+	if s.readOnly {
+		s.untagged("OK [PERMANENTFLAGS ()] Read-only mailbox")
+	} else {
+		s.untagged(`OK [PERMANENTFLAGS (\Seen)] Only \Seen is stored`)
+	}
+	s.untagged(strconv.Itoa(len(s.uids)) + " EXISTS")
+	s.untagged("0 RECENT")
+	if firstUnseen > 0 {
+		s.untagged("OK [UNSEEN " + strconv.Itoa(firstUnseen) + "] First unseen message")
+	}
+	s.untagged("OK [UIDVALIDITY " + strconv.Itoa(uidValidity) + "] UIDs valid")
+	s.untagged("OK [UIDNEXT " + strconv.Itoa(uidNext) + "] Predicted next UID")
+	if s.readOnly {
+		s.ok(cmd, "[READ-ONLY] EXAMINE completed")
+	} else {
+		s.ok(cmd, "[READ-WRITE] SELECT completed")
+	}
+	return nil
+}
+
+func (s *session) deselect() {
+	s.selected = nil
+	s.readOnly = false
+	s.uids = nil
+	s.seen = nil
+	s.cache = nil
+}
+
+func (s *session) nextUID() (int, error) {
+	maxID, err := s.server.db.MaxEmailID()
+	if err != nil {
+		return 0, err
+	}
+	return maxID + 1, nil
+}
+
+func (s *session) handleList(cmd *command) error {
+	if len(cmd.args) != 2 {
+		s.tagged(cmd.tag, "BAD", cmd.name+" expects reference and pattern")
+		return nil
+	}
+	reference, _ := cmd.args[0].asString()
+	pattern, _ := cmd.args[1].asString()
+
+	if pattern == "" {
+		s.untagged(cmd.name + ` (\Noselect) "` + hierarchyDelimiter + `" ""`)
+		s.ok(cmd, cmd.name+" completed")
+		return nil
+	}
+
+	list, err := s.server.mailboxes(s.user)
+	if err != nil {
+		return err
+	}
+	for _, mb := range list {
+		name := encodeMailboxName(mb.name)
+		matchName := name
+		if mb.name == inboxName {
+			// INBOX 不区分大小写
+			matchName = strings.ToUpper(name)
+			if strings.EqualFold(reference+pattern, name) {
+				pattern, reference = inboxName, ""
+			}
+		}
+		if !matchMailbox(reference+pattern, matchName) {
+			continue
+		}
+		attributes := `\HasNoChildren`
+		if mb.attributes != "" {
+			attributes += " " + mb.attributes
+		}
+		s.w.WriteString("* " + cmd.name + " (" + attributes + `) "` + hierarchyDelimiter + `" `)
+		s.w.quoted(name)
+		s.w.WriteString("\r\n")
+	}
+	s.ok(cmd, cmd.name+" completed")
+	return nil
+}
+
+func (s *session) handleStatus(cmd *command) error {
+	if len(cmd.args) != 2 || cmd.args[1].kind != listItem {
+		s.tagged(cmd.tag, "BAD", "STATUS expects mailbox and item list")
+		return nil
+	}
+	name, _ := cmd.args[0].asString()
+	mb, err := s.server.findMailbox(s.user, name)
+	if err != nil {
+		return err
+	}
+	if mb == nil {
+		s.tagged(cmd.tag, "NO", "[NONEXISTENT] No such mailbox")
+		return nil
+	}
+
+	states, err := s.server.db.ListEmailStates(mb.filter)
+	if err != nil {
+		return err
+	}
+	unseen := 0
+	for _, state := range states {
+		if !state.IsRead {
+			unseen++
+		}
+	}
+
+	var items []string
+	for _, it := range cmd.args[1].list {
+		switch strings.ToUpper(it.s) {
+		case "MESSAGES":
+			items = append(items, "MESSAGES "+strconv.Itoa(len(states)))
+		case "RECENT":
+			items = append(items, "RECENT 0")
+		case "UIDNEXT":
+			uidNext, err := s.nextUID()
+			if err != nil {
+				return err
+			}
+			items = append(items, "UIDNEXT "+strconv.Itoa(uidNext))
+		case "UIDVALIDITY":
+			items = append(items, "UIDVALIDITY "+strconv.Itoa(uidValidity))
+		case "UNSEEN":
+			items = append(items, "UNSEEN "+strconv.Itoa(unseen))
+		default:
+			s.tagged(cmd.tag, "BAD", "Unknown STATUS item "+it.s)
+			return nil
+		}
+	}
+
+	s.w.WriteString("* STATUS ")
+	s.w.quoted(encodeMailboxName(mb.name))
+	s.w.WriteString(" (" + strings.Join(items, " ") + ")\r\n")
+	s.ok(cmd, "STATUS completed")
+	return nil
+}
+
+// handleIdle 进入 IDLE：新邮件入库或定时轮询时推送变化，直到客户端发送 DONE
+func (s *session) handleIdle(cmd *command) error {
+	notify, unsubscribe := s.server.ingest.Subscribe()
+	defer unsubscribe()
+
+	s.w.WriteString("+ idling\r\n")
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+
+	s.conn.SetDeadline(time.Now().Add(autologoutTimeout))
+	done := make(chan error, 1)
+	go func() {
+		line, err := readLine(s.r)
+		if err == nil && !strings.EqualFold(string(line), "DONE") {
+			err = fmt.Errorf("unexpected %q during IDLE", line)
+		}
+		done <- err
+	}()
+
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					s.untagged("BYE Autologout; idle for too long")
+					return errLogout
+				}
+				if errors.Is(err, io.EOF) {
+					return errLogout
+				}
+				s.tagged(cmd.tag, "BAD", err.Error())
+				return errLogout
+			}
+			s.ok(cmd, "IDLE terminated")
+			return nil
+		case <-notify:
+		case <-ticker.C:
+		}
+
+		if s.selected != nil {
+			if err := s.update(); err != nil {
+				return err
+			}
+			if err := s.w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// update 将选中邮箱的变化（删除、已读状态变化、新邮件）通知客户端。
+// 只在 NOOP、CHECK 和 IDLE 中调用，此时允许发送 EXPUNGE
+func (s *session) update() error {
+	states, err := s.server.db.ListEmailStates(s.selected.filter)
+	if err != nil {
+		return err
+	}
+	current := make(map[int]bool, len(states))
+	for _, state := range states {
+		current[state.ID] = state.IsRead
+	}
+
+	// 从后往前发送 EXPUNGE，已发送的序列号不会影响之前的序列号
+	for i := len(s.uids) - 1; i >= 0; i-- {
+		if _, ok := current[s.uids[i]]; !ok {
+			s.untagged(strconv.Itoa(i+1) + " EXPUNGE")
+			s.uids = append(s.uids[:i], s.uids[i+1:]...)
+			s.seen = append(s.seen[:i], s.seen[i+1:]...)
+		}
+	}
+
+	for i, uid := range s.uids {
+		if read := current[uid]; read != s.seen[i] {
+			s.seen[i] = read
+			s.untagged(strconv.Itoa(i+1) + " FETCH (FLAGS (" + flagList(read) + "))")
+		}
+	}
+
+	// 新邮件的 UID 必须不小于已通告的 UIDNEXT，ID 更小的邮件（例如从垃圾邮件移回收件箱）
+	// 需要重新选择邮箱后才会出现
+	lastUID := 0
+	if len(s.uids) > 0 {
+		lastUID = s.uids[len(s.uids)-1]
+	}
+	added := false
+	for _, state := range states {
+		if state.ID > lastUID && state.ID >= s.uidNext {
+			s.uids = append(s.uids, state.ID)
+			s.seen = append(s.seen, state.IsRead)
+			added = true
+		}
+	}
+	if added {
+		s.untagged(strconv.Itoa(len(s.uids)) + " EXISTS")
+		if last := s.uids[len(s.uids)-1]; last >= s.uidNext {
+			s.uidNext = last + 1
+		}
+	}
+	return nil
+}
+
+func flagList(seen bool) string {
+	if seen {
+		return `\Seen`
+	}
+	return ""
+}
+
+// resolve 返回序列集（uid 为 true 时为 UID 集）中邮件的下标
+func (s *session) resolve(setArg string, uid bool) ([]int, error) {
+	set, err := parseSeqSet(setArg)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []int
+	if uid {
+		maxUID := uint32(0)
+		if len(s.uids) > 0 {
+			maxUID = uint32(s.uids[len(s.uids)-1])
+		}
+		for i, id := range s.uids {
+			if set.contains(uint32(id), maxUID) {
+				indexes = append(indexes, i)
+			}
+		}
+		return indexes, nil
+	}
+
+	count := uint32(len(s.uids))
+	for _, r := range set {
+		if r.start > count || r.stop > count {
+			return nil, errors.New("invalid sequence number")
+		}
+	}
+	for i := range s.uids {
+		if set.contains(uint32(i+1), count) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
+
+// loadEmails 按 ID 分批读取邮件，避免 SQL 参数过多
+func (s *session) loadEmails(ids []int, fn func(email *models.Email) error) error {
+	const batchSize = 200
+	for start := 0; start < len(ids); start += batchSize {
+		end := min(start+batchSize, len(ids))
+		filter := models.EmailFilter{Folder: models.FolderAll, IDs: ids[start:end]}
+		if err := s.server.db.ForEachEmail(filter, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
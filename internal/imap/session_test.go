@@ -0,0 +1,324 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mailcat/internal/audit"
+	"mailcat/internal/database"
+	"mailcat/internal/ingest"
+	"mailcat/internal/lockout"
+	"mailcat/internal/models"
+)
+
+// testEmail 生成一封完整的原始邮件
+func testEmail(to, subject, body string) *models.EmailRequest {
+	return &models.EmailRequest{
+		From:    "sender@example.com",
+		To:      to,
+		Subject: subject,
+		RawEmail: "From: sender@example.com\r\nTo: " + to + "\r\nSubject: " + subject +
+			"\r\nDate: Mon, 02 Jan 2006 15:04:05 +0000\r\nMessage-ID: <" + subject + "@example.com>\r\n\r\n" + body + "\r\n",
+	}
+}
+
+// newTestServer 在本地端口上启动 IMAP 服务，bob 以邮箱令牌登录，admin 以管理员密码登录；
+// 登录结果写入审计日志，loginLockout 为 nil 时不跨连接锁定
+func newTestServer(t *testing.T, loginLockout *lockout.Lockout) (string, *database.DB, *ingest.Pipeline) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	auditLogger, err := audit.New(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := ingest.New(db, nil)
+	server := NewServer(db, pipeline, Options{
+		CheckAdmin: func(username, password string) bool { return username == "admin" && password == "admin-pw" },
+		Lockout:    loginLockout,
+		Audit:      auditLogger,
+		Mailboxes:  []MailboxConfig{{Name: "bob", Address: "bob@example.com", Token: "bob-token"}},
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String(), db, pipeline
+}
+
+// testClient 按行读取服务端响应的 IMAP 客户端，字面量会拼接到所在行中
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	if greeting := c.readLine(); !strings.HasPrefix(greeting, "* OK [CAPABILITY IMAP4rev1") {
+		t.Fatalf("greeting = %q", greeting)
+	}
+	return c
+}
+
+func (c *testClient) send(line string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) readLine() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read: %v (partial %q)", err, line)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if open := strings.LastIndexByte(line, '{'); open >= 0 && strings.HasSuffix(line, "}") {
+		if n, err := strconv.Atoi(line[open+1 : len(line)-1]); err == nil {
+			literal := make([]byte, n)
+			if _, err := io.ReadFull(c.r, literal); err != nil {
+				c.t.Fatalf("read literal: %v", err)
+			}
+			return line + "\r\n" + string(literal) + c.readLine()
+		}
+	}
+	return line
+}
+
+// run 发送命令，返回未标记的响应和带标签的结果行
+func (c *testClient) run(tag, command string) (string, string) {
+	c.t.Helper()
+	c.send(tag + " " + command)
+	var untagged []string
+	for {
+		line := c.readLine()
+		if strings.HasPrefix(line, tag+" ") {
+			return strings.Join(untagged, "\n"), strings.TrimPrefix(line, tag+" ")
+		}
+		untagged = append(untagged, line)
+	}
+}
+
+// expect 发送命令并要求以 status 结束，返回未标记的响应
+func (c *testClient) expect(tag, command, status string) string {
+	c.t.Helper()
+	untagged, result := c.run(tag, command)
+	if !strings.HasPrefix(result, status+" ") {
+		c.t.Fatalf("%s %s = %q (untagged %q), want %s", tag, command, result, untagged, status)
+	}
+	return untagged
+}
+
+func isRead(t *testing.T, db *database.DB, id int) bool {
+	t.Helper()
+	email, err := db.GetEmailByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return email.IsRead
+}
+
+func TestSession(t *testing.T) {
+	addr, db, pipeline := newTestServer(t, nil)
+	var ids []int
+	for _, req := range []*models.EmailRequest{
+		testEmail("bob@example.com", "first", "hello bob"),
+		testEmail("alice@example.com", "private", "hello alice"),
+		testEmail("bob@example.com", "second", "meeting notes"),
+	} {
+		email, err := db.SaveEmail(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, email.ID)
+	}
+	first, second := strconv.Itoa(ids[0]), strconv.Itoa(ids[2])
+
+	c := dial(t, addr)
+	if caps := c.expect("a1", "CAPABILITY", "OK"); !strings.Contains(caps, "IDLE") || !strings.Contains(caps, "AUTH=PLAIN") {
+		t.Errorf("CAPABILITY = %q", caps)
+	}
+	c.expect("a2", "SELECT INBOX", "BAD")
+	c.expect("a3", "LOGIN bob wrong-token", "NO")
+
+	// 用户名以同步字面量发送
+	c.send("a4 LOGIN {3}")
+	if line := c.readLine(); !strings.HasPrefix(line, "+") {
+		t.Fatalf("continuation = %q", line)
+	}
+	c.send("bob bob-token")
+	if line := c.readLine(); !strings.HasPrefix(line, "a4 OK") {
+		t.Fatalf("LOGIN = %q", line)
+	}
+
+	// 邮箱用户只能看到自己的三个邮箱
+	if list := c.expect("a5", `LIST "" *`, "OK"); strings.Count(list, "* LIST") != 3 || strings.Contains(list, "alice") {
+		t.Errorf("LIST = %q", list)
+	}
+
+	selected := c.expect("a6", "SELECT INBOX", "OK")
+	for _, want := range []string{"* 2 EXISTS", "[UNSEEN 1]", "[UIDVALIDITY 1]", "[UIDNEXT " + strconv.Itoa(ids[2]+1) + "]"} {
+		if !strings.Contains(selected, want) {
+			t.Errorf("SELECT = %q, missing %q", selected, want)
+		}
+	}
+
+	// BODY.PEEK 不改变已读状态
+	fetched := c.expect("a7", "FETCH 1:* (UID FLAGS BODY.PEEK[HEADER.FIELDS (SUBJECT)])", "OK")
+	if want := "* 1 FETCH (UID " + first + " FLAGS () BODY[HEADER.FIELDS (SUBJECT)] {18}\r\nSubject: first\r\n\r\n)"; !strings.Contains(fetched, want) {
+		t.Errorf("FETCH = %q, want %q", fetched, want)
+	}
+	if !strings.Contains(fetched, "Subject: second") || isRead(t, db, ids[0]) {
+		t.Errorf("BODY.PEEK marked the message as read or missed a message: %q", fetched)
+	}
+
+	// BODY[TEXT] 把邮件标记为已读并写入数据库
+	if fetched := c.expect("a8", "FETCH 1 BODY[TEXT]", "OK"); fetched != "* 1 FETCH (BODY[TEXT] {11}\r\nhello bob\r\n FLAGS (\\Seen))" {
+		t.Errorf("FETCH BODY[TEXT] = %q", fetched)
+	}
+	if !isRead(t, db, ids[0]) {
+		t.Error("BODY[TEXT] did not persist \\Seen")
+	}
+
+	// UID 命令使用邮件 ID，不属于该邮箱的 UID 不会返回
+	if found := c.expect("a9", "UID SEARCH SUBJECT second", "OK"); found != "* SEARCH "+second {
+		t.Errorf("UID SEARCH = %q", found)
+	}
+	if found := c.expect("a10", "SEARCH UNSEEN", "OK"); found != "* SEARCH 2" {
+		t.Errorf("SEARCH UNSEEN = %q", found)
+	}
+	if found := c.expect("a11", "SEARCH OR BODY meeting SEEN", "OK"); found != "* SEARCH 1 2" {
+		t.Errorf("SEARCH OR = %q", found)
+	}
+	if fetched := c.expect("a12", "UID FETCH "+second+" FLAGS", "OK"); fetched != "* 2 FETCH (UID "+second+" FLAGS ())" {
+		t.Errorf("UID FETCH = %q", fetched)
+	}
+	if fetched := c.expect("a13", "UID FETCH "+strconv.Itoa(ids[1])+" FLAGS", "OK"); fetched != "" {
+		t.Errorf("UID FETCH of another mailbox's message = %q", fetched)
+	}
+	c.expect("a14", "FETCH 3 FLAGS", "BAD")
+
+	// STORE 只保存 \Seen
+	if stored := c.expect("a15", `STORE 1 -FLAGS (\Seen \Flagged)`, "OK"); stored != "* 1 FETCH (FLAGS ())" {
+		t.Errorf("STORE = %q", stored)
+	}
+	if stored := c.expect("a16", `UID STORE `+second+` +FLAGS.SILENT (\Seen)`, "OK"); stored != "" {
+		t.Errorf("STORE.SILENT = %q", stored)
+	}
+	if isRead(t, db, ids[0]) || !isRead(t, db, ids[2]) {
+		t.Error("STORE did not persist \\Seen")
+	}
+
+	// EXAMINE 只读：读取正文不会标记已读，STORE 被拒绝
+	if examined := c.expect("a17", "EXAMINE INBOX", "OK"); !strings.Contains(examined, "PERMANENTFLAGS ()") {
+		t.Errorf("EXAMINE = %q", examined)
+	}
+	if fetched := c.expect("a18", "FETCH 1 BODY[]", "OK"); strings.Contains(fetched, `\Seen`) || isRead(t, db, ids[0]) {
+		t.Errorf("FETCH in a read-only mailbox marked the message as read: %q", fetched)
+	}
+	c.expect("a19", `STORE 1 +FLAGS (\Seen)`, "NO")
+	c.expect("a20", "EXPUNGE", "NO")
+
+	// IDLE 中推送新邮件和其他客户端修改的已读状态
+	c.expect("a21", "SELECT INBOX", "OK")
+	c.send("a22 IDLE")
+	if line := c.readLine(); line != "+ idling" {
+		t.Fatalf("IDLE = %q", line)
+	}
+	if err := db.SetEmailsRead([]int{ids[0]}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pipeline.Ingest(context.Background(), testEmail("bob@example.com", "third", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if line := c.readLine(); line != `* 1 FETCH (FLAGS (\Seen))` {
+		t.Errorf("IDLE update = %q", line)
+	}
+	if line := c.readLine(); line != "* 3 EXISTS" {
+		t.Errorf("IDLE update = %q", line)
+	}
+	c.send("DONE")
+	if line := c.readLine(); line != "a22 OK IDLE terminated" {
+		t.Errorf("DONE = %q", line)
+	}
+	if found := c.expect("a23", "SEARCH SUBJECT third", "OK"); found != "* SEARCH 3" {
+		t.Errorf("SEARCH after IDLE = %q", found)
+	}
+
+	if bye := c.expect("a24", "LOGOUT", "OK"); !strings.HasPrefix(bye, "* BYE") {
+		t.Errorf("LOGOUT = %q", bye)
+	}
+}
+
+func TestSessionAuthenticatePlain(t *testing.T) {
+	addr, db, _ := newTestServer(t, nil)
+	if _, err := db.SaveEmail(testEmail("bob@example.com", "first", "hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := dial(t, addr)
+	c.send("a1 AUTHENTICATE PLAIN")
+	if line := c.readLine(); line != "+ " {
+		t.Fatalf("continuation = %q", line)
+	}
+	c.send(base64.StdEncoding.EncodeToString([]byte("\x00admin\x00admin-pw")))
+	if line := c.readLine(); !strings.HasPrefix(line, "a1 OK") {
+		t.Fatalf("AUTHENTICATE = %q", line)
+	}
+
+	// 管理员还能看到每个收件人邮箱
+	if list := c.expect("a2", `LIST "" %`, "OK"); !strings.Contains(list, `"/" "bob"`) {
+		t.Errorf("LIST = %q", list)
+	}
+	if status := c.expect("a3", "STATUS bob (MESSAGES UNSEEN UIDVALIDITY)", "OK"); status != `* STATUS "bob" (MESSAGES 1 UNSEEN 1 UIDVALIDITY 1)` {
+		t.Errorf("STATUS = %q", status)
+	}
+	c.expect("a4", "AUTHENTICATE PLAIN", "BAD")
+}
+
+func TestSessionLoginLockout(t *testing.T) {
+	loginLockout := lockout.New()
+	addr, db, _ := newTestServer(t, loginLockout)
+
+	// 之前的失败（例如管理后台登录）与 IMAP 登录共用计数，重新连接不会重置
+	for i := 0; i < 4; i++ {
+		loginLockout.Fail("127.0.0.1")
+	}
+	c := dial(t, addr)
+	c.expect("a1", "LOGIN bob wrong", "NO")
+	c = dial(t, addr)
+	c.expect("a1", "LOGIN bob bob-token", "NO")
+
+	entries, _, err := db.ListAuditEntries(models.AuditQuery{Action: "imap.login", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Actor+" "+entry.IP+" "+strconv.Itoa(entry.Status)+" "+strconv.FormatBool(entry.Success))
+	}
+	if want := "bob 127.0.0.1 429 false|bob 127.0.0.1 401 false"; strings.Join(got, "|") != want {
+		t.Errorf("audit entries = %q, want %q", got, want)
+	}
+}
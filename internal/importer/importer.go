@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"mailcat/internal/database"
+	"mailcat/internal/ingest"
+	"mailcat/internal/metrics"
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+)
+
+const (
+	// progressInterval 每处理多少封邮件报告一次进度
+	progressInterval = 100
+	// maxReportedErrors 报告中最多保留的错误条数
+	maxReportedErrors = 100
+)
+
+// Report 导入结果统计
+type Report struct {
+	Total         int         `json:"total"`
+	Imported      int         `json:"imported"`
+	Duplicates    int         `json:"duplicates"`
+	Failed        int         `json:"failed"`
+	Errors        []ItemError `json:"errors,omitempty"`
+	ErrorsDropped int         `json:"errors_dropped,omitempty"` // 超出上限未记录的错误数
+}
+
+// ItemError 单封邮件的导入错误
+type ItemError struct {
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+// Importer 将历史邮件通过与 Worker 推送相同的入库流程导入
+type Importer struct {
+	db     *database.DB
+	ingest *ingest.Pipeline
+
+	// Progress 每处理 progressInterval 封邮件以及结束时调用，可为 nil
+	Progress func(report Report)
+}
+
+// New 创建导入器
+func New(db *database.DB, ingestPipeline *ingest.Pipeline) *Importer {
+	return &Importer{db: db, ingest: ingestPipeline}
+}
+
+// Run 导入来源中的所有邮件。单封邮件的错误记录在报告中并继续；
+// 只有来源本身无法读取或 ctx 被取消时才返回错误
+func (i *Importer) Run(ctx context.Context, src Source) (*Report, error) {
+	report := &Report{}
+
+	err := src(func(name string, raw []byte, readErr error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		report.Total++
+		err := readErr
+		if err == nil {
+			err = i.importOne(ctx, raw, report)
+		} else {
+			metrics.IngestTotal.Inc(metrics.SourceImport, metrics.IngestRejected)
+		}
+		if err != nil {
+			report.fail(name, err)
+		}
+
+		if i.Progress != nil && report.Total%progressInterval == 0 {
+			i.Progress(*report)
+		}
+		return nil
+	})
+
+	if i.Progress != nil {
+		i.Progress(*report)
+	}
+	return report, err
+}
+
+func (i *Importer) importOne(ctx context.Context, raw []byte, report *Report) error {
+	req, err := RequestFromRaw(raw)
+	if err != nil {
+		metrics.IngestTotal.Inc(metrics.SourceImport, metrics.IngestParseFailed)
+		return err
+	}
+
+	exists, err := i.db.EmailExists(database.MessageIDFromHeaders(req.Headers), req.RawEmail)
+	if err != nil {
+		metrics.IngestTotal.Inc(metrics.SourceImport, metrics.IngestRejected)
+		return err
+	}
+	if exists {
+		metrics.IngestTotal.Inc(metrics.SourceImport, metrics.IngestDuplicate)
+		report.Duplicates++
+		return nil
+	}
+
+	if _, err := i.ingest.Ingest(ctx, req); err != nil {
+		metrics.IngestTotal.Inc(metrics.SourceImport, metrics.IngestRejected)
+		return err
+	}
+	metrics.IngestTotal.Inc(metrics.SourceImport, metrics.IngestAccepted)
+	report.Imported++
+	return nil
+}
+
+func (r *Report) fail(source string, err error) {
+	r.Failed++
+	if len(r.Errors) >= maxReportedErrors {
+		r.ErrorsDropped++
+		return
+	}
+	r.Errors = append(r.Errors, ItemError{Source: source, Error: err.Error()})
+}
+
+// RequestFromRaw 将原始邮件转换为入库请求：发件人、收件人和主题取自头部，
+// 接收时间取自 Date 头部（缺失时取最早的 Received 头部）
+func RequestFromRaw(raw []byte) (*models.EmailRequest, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+
+	headers := make(map[string]string, len(msg.Header))
+	for name, values := range msg.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, "\n")
+	}
+
+	from := firstHeader(msg.Header, "From", "Sender", "Return-Path")
+	to := firstHeader(msg.Header, "To", "Delivered-To", "X-Original-To", "Cc")
+	if from == "" {
+		return nil, errors.New("message has no From header")
+	}
+	if to == "" {
+		to = "undisclosed-recipients:;"
+	}
+
+	req := &models.EmailRequest{
+		From:       utils.DecodeHeader(from),
+		To:         utils.DecodeHeader(to),
+		Subject:    utils.DecodeHeader(msg.Header.Get("Subject")),
+		Headers:    headers,
+		RawEmail:   string(raw),
+		ReceivedAt: messageDate(msg.Header),
+	}
+
+	if content, err := utils.ParseEmailFromRaw(string(raw)); err == nil {
+		req.Body = content.TextBody
+		req.HTMLBody = content.HTMLBody
+	}
+	return req, nil
+}
+
+func firstHeader(header mail.Header, names ...string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(header.Get(name)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// messageDate 取 Date 头部，无法解析时取最早一条 Received 头部中的时间
+func messageDate(header mail.Header) time.Time {
+	if date, err := header.Date(); err == nil {
+		return date
+	}
+	received := header["Received"]
+	for i := len(received) - 1; i >= 0; i-- {
+		if semi := strings.LastIndex(received[i], ";"); semi >= 0 {
+			if date, err := mail.ParseDate(strings.TrimSpace(received[i][semi+1:])); err == nil {
+				return date
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mailcat/internal/database"
+	"mailcat/internal/ingest"
+)
+
+func TestRunDeduplicates(t *testing.T) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	imp := New(db, ingest.New(db, nil))
+
+	withID := "From: a@example.com\nTo: b@example.com\nSubject: with id\nMessage-ID: <1@example.com>\nDate: Mon, 02 Jan 2006 15:04:05 +0000\n\nhello\n"
+	withoutID := "From: a@example.com\nTo: b@example.com\nSubject: without id\n\nhello\n"
+	mbox := func(messages ...string) Source {
+		var b strings.Builder
+		for _, message := range messages {
+			b.WriteString("From a@example.com Mon Jan  2 15:04:05 2006\n" + message + "\n")
+		}
+		return MboxSource(strings.NewReader(b.String()))
+	}
+
+	report, err := imp.Run(context.Background(), mbox(withID, withoutID, "Subject: no sender\n\nx\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 3 || report.Imported != 2 || report.Duplicates != 0 || report.Failed != 1 || report.Errors[0].Source != "message #3" {
+		t.Errorf("first import = %+v", report)
+	}
+
+	// 相同 Message-ID 的邮件即使内容不同（例如经过不同的服务器）也视为重复；没有 Message-ID 时按原始内容判断
+	resent := strings.Replace(withID, "hello", "hello again", 1)
+	changed := strings.Replace(withoutID, "hello", "changed", 1)
+	report, err = imp.Run(context.Background(), mbox(resent, withoutID, changed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 3 || report.Imported != 1 || report.Duplicates != 2 || report.Failed != 0 {
+		t.Errorf("second import = %+v", report)
+	}
+}
+
+func TestRequestFromRaw(t *testing.T) {
+	raw := "Return-Path: <bounce@example.com>\r\n" +
+		"Received: from b by c; Tue, 03 Jan 2006 10:00:00 +0000\r\n" +
+		"Received: from a by b; Mon, 02 Jan 2006 09:00:00 +0000\r\n" +
+		"Delivered-To: qa@example.com\r\n" +
+		"Subject: =?UTF-8?B?5L2g5aW9?=\r\n" +
+		"\r\n" +
+		"body\r\n"
+	req, err := RequestFromRaw([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.From != "<bounce@example.com>" || req.To != "qa@example.com" || req.Subject != "你好" || req.Body != "body\r\n" {
+		t.Errorf("request = %+v", req)
+	}
+	if want := "2006-01-02T09:00:00Z"; req.ReceivedAt.UTC().Format("2006-01-02T15:04:05Z") != want {
+		t.Errorf("received at = %s, want the earliest Received header %s", req.ReceivedAt, want)
+	}
+}
@@ -0,0 +1,286 @@
+package importer
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 支持的导入格式
+const (
+	FormatMbox    = "mbox"
+	FormatMaildir = "maildir"
+	FormatEML     = "eml"
+)
+
+// maxMessageSize 单封邮件的最大字节数，防止压缩包中的超大文件耗尽内存（测试中可调小）
+var maxMessageSize = 50 << 20
+
+var ErrMessageTooLarge = errors.New("message exceeds size limit")
+
+// Source 依次产出待导入的原始邮件，name 用于在报告中定位出错的邮件。
+// 单封邮件读取失败时通过 readErr 报告并继续；yield 返回错误时应停止并返回该错误
+type Source func(yield YieldFunc) error
+
+// YieldFunc 接收一封原始邮件或该邮件的读取错误
+type YieldFunc func(name string, raw []byte, readErr error) error
+
+// ValidFormat 判断是否为支持的导入格式
+func ValidFormat(format string) bool {
+	return format == FormatMbox || format == FormatMaildir || format == FormatEML
+}
+
+// PathSource 根据格式从本地路径读取：mbox 文件、Maildir 目录，或 .eml 文件/目录
+func PathSource(format, p string) (Source, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatMbox:
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory, expected an mbox file", p)
+		}
+		return func(yield YieldFunc) error {
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return MboxSource(f)(yield)
+		}, nil
+	case FormatMaildir:
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", p)
+		}
+		return MaildirSource(p), nil
+	case FormatEML:
+		return EMLSource(p), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// MboxSource 读取 mbox 文件（兼容 mboxo 和 mboxrd）。邮件以位于文件开头或空行之后的
+// "From " 行分隔，正文中被 > 转义的 "From " 行会去掉一个 >
+func MboxSource(r io.Reader) Source {
+	return func(yield YieldFunc) error {
+		reader := bufio.NewReaderSize(r, 64<<10)
+		var current bytes.Buffer
+		index := 0
+		inMessage := false
+		tooLarge := false
+		prevBlank := true
+
+		flush := func() error {
+			if !inMessage {
+				return nil
+			}
+			name := fmt.Sprintf("message #%d", index)
+			if tooLarge {
+				current.Reset()
+				return yield(name, nil, ErrMessageTooLarge)
+			}
+			// 去掉分隔用的结尾空行
+			raw := bytes.TrimRight(current.Bytes(), "\r\n")
+			raw = append(append([]byte(nil), raw...), '\n')
+			current.Reset()
+			return yield(name, raw, nil)
+		}
+
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				switch {
+				case prevBlank && bytes.HasPrefix(line, []byte("From ")):
+					if err := flush(); err != nil {
+						return err
+					}
+					index++
+					inMessage = true
+					tooLarge = false
+				case inMessage && !tooLarge:
+					if current.Len()+len(line) > maxMessageSize {
+						// 丢弃该邮件余下的内容，继续读取下一封
+						tooLarge = true
+						current.Reset()
+						break
+					}
+					if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+						line = line[1:]
+					}
+					current.Write(line)
+				}
+				prevBlank = len(bytes.TrimRight(line, "\r\n")) == 0
+			}
+			if err == io.EOF {
+				return flush()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// MaildirSource 读取 Maildir 目录中 cur 和 new 下的邮件，包括 Maildir++ 的子文件夹（.Sent 等）
+func MaildirSource(dir string) Source {
+	return func(yield YieldFunc) error {
+		folders := []string{dir}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && strings.HasPrefix(entry.Name(), ".") {
+				folders = append(folders, filepath.Join(dir, entry.Name()))
+			}
+		}
+
+		found := false
+		for _, folder := range folders {
+			for _, sub := range []string{"cur", "new"} {
+				files, err := os.ReadDir(filepath.Join(folder, sub))
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				found = true
+				for _, file := range files {
+					if file.IsDir() {
+						continue
+					}
+					if err := yieldFile(filepath.Join(folder, sub, file.Name()), yield); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not a maildir (no cur or new directory)", dir)
+		}
+		return nil
+	}
+}
+
+// EMLSource 读取单个 .eml 文件，或递归读取目录中的所有 .eml 文件
+func EMLSource(p string) Source {
+	return func(yield YieldFunc) error {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return yieldFile(p, yield)
+		}
+
+		var files []string
+		err = filepath.WalkDir(p, func(file string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(file), ".eml") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			if err := yieldFile(file, yield); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ZipSource 读取上传的 zip 压缩包：eml 格式读取其中的 .eml 文件，maildir 格式读取
+// cur、new 目录下的文件，mbox 格式把每个文件当作一个 mbox
+func ZipSource(zr *zip.Reader, format string) Source {
+	return func(yield YieldFunc) error {
+		for _, file := range zr.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			name := file.Name
+			switch format {
+			case FormatEML:
+				if !strings.EqualFold(path.Ext(name), ".eml") {
+					continue
+				}
+			case FormatMaildir:
+				if parent := path.Base(path.Dir(name)); parent != "cur" && parent != "new" {
+					continue
+				}
+			}
+
+			rc, err := file.Open()
+			if err != nil {
+				if err := yield(name, nil, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if format == FormatMbox {
+				err = MboxSource(rc)(func(msgName string, raw []byte, readErr error) error {
+					return yield(name+": "+msgName, raw, readErr)
+				})
+				rc.Close()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			raw, err := readLimited(rc)
+			rc.Close()
+			if err := yield(name, raw, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SingleSource 只包含一封邮件的来源，用于上传单个 .eml 文件
+func SingleSource(name string, r io.Reader) Source {
+	return func(yield YieldFunc) error {
+		raw, err := readLimited(r)
+		return yield(name, raw, err)
+	}
+}
+
+func yieldFile(file string, yield YieldFunc) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return yield(file, nil, err)
+	}
+	raw, err := readLimited(f)
+	f.Close()
+	return yield(file, raw, err)
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, int64(maxMessageSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	return raw, nil
+}
@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// collected 来源产出的一封邮件或读取错误
+type collected struct {
+	name string
+	raw  string
+	err  error
+}
+
+func collect(t *testing.T, src Source) []collected {
+	t.Helper()
+	var items []collected
+	err := src(func(name string, raw []byte, readErr error) error {
+		items = append(items, collected{name, string(raw), readErr})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("source error: %v", err)
+	}
+	return items
+}
+
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMboxSource(t *testing.T) {
+	mbox := "From alice@example.com Mon Jan  2 15:04:05 2006\n" +
+		"Subject: first\n" +
+		"\n" +
+		">From the start\n" +
+		">>From quoted twice\n" +
+		"Not From a separator\n" +
+		"From inside a paragraph is not a separator\n" +
+		"\n" +
+		"From bob@example.com Mon Jan  2 15:04:05 2006\r\n" +
+		"Subject: second\r\n" +
+		"\r\n" +
+		"body\r\n" +
+		"\r\n"
+	items := collect(t, MboxSource(strings.NewReader(mbox)))
+	if len(items) != 2 {
+		t.Fatalf("got %d messages: %+v", len(items), items)
+	}
+	wantFirst := "Subject: first\n\nFrom the start\n>From quoted twice\nNot From a separator\n" +
+		"From inside a paragraph is not a separator\n"
+	if items[0].name != "message #1" || items[0].raw != wantFirst || items[0].err != nil {
+		t.Errorf("first message = %+v, want %q", items[0], wantFirst)
+	}
+	if items[1].name != "message #2" || items[1].raw != "Subject: second\r\n\r\nbody\n" {
+		t.Errorf("second message = %+v", items[1])
+	}
+
+	// 文件开头不是 From 行时，第一个分隔行之前的内容被忽略
+	if items := collect(t, MboxSource(strings.NewReader("garbage\n\nFrom x\nSubject: a\n\nb\n"))); len(items) != 1 || items[0].raw != "Subject: a\n\nb\n" {
+		t.Errorf("leading garbage: %+v", items)
+	}
+}
+
+func TestMboxSourceSizeLimit(t *testing.T) {
+	defer func(size int) { maxMessageSize = size }(maxMessageSize)
+	maxMessageSize = 64
+
+	mbox := "From a\nSubject: big\n\n" + strings.Repeat("x", 100) + "\n\nFrom b\nSubject: small\n\nok\n"
+	items := collect(t, MboxSource(strings.NewReader(mbox)))
+	if len(items) != 2 {
+		t.Fatalf("got %d messages: %+v", len(items), items)
+	}
+	if !errors.Is(items[0].err, ErrMessageTooLarge) || items[0].raw != "" {
+		t.Errorf("oversized message = %+v, want ErrMessageTooLarge", items[0])
+	}
+	if items[1].err != nil || items[1].raw != "Subject: small\n\nok\n" {
+		t.Errorf("message after oversized one = %+v", items[1])
+	}
+
+	if raw, err := readLimited(strings.NewReader(strings.Repeat("x", 65))); !errors.Is(err, ErrMessageTooLarge) || raw != nil {
+		t.Errorf("readLimited over the limit = %q, %v", raw, err)
+	}
+	if raw, err := readLimited(strings.NewReader(strings.Repeat("x", 64))); err != nil || len(raw) != 64 {
+		t.Errorf("readLimited at the limit = %d bytes, %v", len(raw), err)
+	}
+}
+
+func TestMaildirSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "cur", "1:2,S"), "Subject: cur\n\n")
+	writeFile(t, filepath.Join(dir, "new", "2"), "Subject: new\n\n")
+	writeFile(t, filepath.Join(dir, "tmp", "3"), "Subject: tmp\n\n")
+	writeFile(t, filepath.Join(dir, ".Sent", "cur", "4"), "Subject: sent\n\n")
+	writeFile(t, filepath.Join(dir, "Other", "cur", "5"), "Subject: not a Maildir++ folder\n\n")
+
+	var subjects []string
+	for _, item := range collect(t, MaildirSource(dir)) {
+		subjects = append(subjects, strings.TrimSpace(strings.TrimPrefix(item.raw, "Subject: ")))
+	}
+	if got := strings.Join(subjects, ","); got != "cur,new,sent" {
+		t.Errorf("maildir messages = %s, want cur,new,sent", got)
+	}
+
+	err := MaildirSource(t.TempDir())(func(string, []byte, error) error { return nil })
+	if err == nil {
+		t.Error("a directory without cur or new was accepted")
+	}
+}
+
+func TestEMLSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "b.eml"), "Subject: b\n\n")
+	writeFile(t, filepath.Join(dir, "sub", "a.EML"), "Subject: a\n\n")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not a message")
+
+	items := collect(t, EMLSource(dir))
+	if len(items) != 2 || items[0].raw != "Subject: b\n\n" || items[1].raw != "Subject: a\n\n" {
+		t.Errorf("eml directory = %+v", items)
+	}
+	if items := collect(t, EMLSource(filepath.Join(dir, "b.eml"))); len(items) != 1 || items[0].raw != "Subject: b\n\n" {
+		t.Errorf("single eml file = %+v", items)
+	}
+}
+
+func TestZipSource(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"export/a.eml":          "Subject: a\n\n",
+		"export/readme.txt":     "not a message",
+		"maildir/cur/1":         "Subject: cur\n\n",
+		"maildir/tmp/2":         "Subject: tmp\n\n",
+		"archive.mbox":          "From x\nSubject: m1\n\n>From body\n\nFrom y\nSubject: m2\n\n",
+		"export/folder/b.eml/":  "",
+		"export/folder/c.eml":   "Subject: c\n\n",
+		"maildir/.Sent/new/3:2": "Subject: sent\n\n",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(format string) map[string]string {
+		result := make(map[string]string)
+		for _, item := range collect(t, ZipSource(zr, format)) {
+			if item.err != nil {
+				t.Errorf("%s: %s: %v", format, item.name, item.err)
+			}
+			result[item.name] = item.raw
+		}
+		return result
+	}
+
+	if got := names(FormatEML); len(got) != 2 || got["export/a.eml"] != "Subject: a\n\n" || got["export/folder/c.eml"] != "Subject: c\n\n" {
+		t.Errorf("eml entries = %v", got)
+	}
+	if got := names(FormatMaildir); len(got) != 2 || got["maildir/cur/1"] != "Subject: cur\n\n" || got["maildir/.Sent/new/3:2"] != "Subject: sent\n\n" {
+		t.Errorf("maildir entries = %v", got)
+	}
+	got := names(FormatMbox)
+	if got["archive.mbox: message #1"] != "Subject: m1\n\nFrom body\n" || got["archive.mbox: message #2"] != "Subject: m2\n" {
+		t.Errorf("mbox entries = %v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"mailcat/internal/database"
+	"mailcat/internal/message"
+	"mailcat/internal/models"
+	"mailcat/internal/spam"
+)
+
+// Pipeline 邮件入库流程：垃圾邮件评分后写入数据库。
+// Worker 推送（ReceiveEmail）和批量导入共用同一流程
+type Pipeline struct {
+	db         *database.DB
+	spamFilter *spam.Pipeline // 为 nil 时不进行垃圾邮件评分
+
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+// New 创建入库流程
+func New(db *database.DB, spamFilter *spam.Pipeline) *Pipeline {
+	return &Pipeline{
+		db:          db,
+		spamFilter:  spamFilter,
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe 订阅新邮件入库通知（例如 IMAP IDLE）。连续多封邮件入库可能只产生一次信号，
+// 收到信号后应重新查询数据库；调用返回的函数取消订阅
+func (p *Pipeline) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	p.mu.Lock()
+	p.subscribers[ch] = struct{}{}
+	p.mu.Unlock()
+
+	return ch, func() {
+		p.mu.Lock()
+		delete(p.subscribers, ch)
+		p.mu.Unlock()
+	}
+}
+
+// Ingest 对邮件评分并保存，超过阈值的邮件放入垃圾邮件文件夹
+func (p *Pipeline) Ingest(ctx context.Context, req *models.EmailRequest) (*models.Email, error) {
+	if p.spamFilter != nil {
+		verdict := p.spamFilter.Score(ctx, spam.MessageFromRequest(req))
+		req.SpamScore = verdict.Score
+		if reasons, err := json.Marshal(verdict.Reasons); err == nil {
+			req.SpamReasons = string(reasons)
+		}
+		if verdict.IsSpam {
+			req.Folder = models.FolderSpam
+			log.Printf("Email from %s to %s classified as spam (score %.1f)", req.From, req.To, verdict.Score)
+		}
+	}
+
+	email, err := p.db.SaveEmail(req)
+	if err != nil {
+		return nil, err
+	}
+	// 摘要写入失败不影响入库，启动时的 BackfillSummaries 会补上
+	if err := p.saveSummary(email); err != nil {
+		log.Printf("Failed to save summary for email %d: %v", email.ID, err)
+	}
+	p.notify()
+	return email, nil
+}
+
+// BackfillSummaries 为升级前入库、尚未计算摘要的邮件补充列表摘要，返回处理的邮件数。
+// ctx 取消后在当前批次结束时返回
+func (p *Pipeline) BackfillSummaries(ctx context.Context) (int, error) {
+	count := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		emails, err := p.db.EmailsWithoutSummary(summaryBatchSize)
+		if err != nil {
+			return count, err
+		}
+		if len(emails) == 0 {
+			return count, nil
+		}
+		for _, email := range emails {
+			if err := p.saveSummary(email); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+}
+
+// summaryBatchSize 补充摘要时每批读取的邮件数
+const summaryBatchSize = 200
+
+func (p *Pipeline) saveSummary(email *models.Email) error {
+	summary := message.Summarize(email)
+	return p.db.SetEmailSummary(email.ID, summary.Snippet, summary.Size, summary.HasAttachments, summary.AttachmentSize)
+}
+
+func (p *Pipeline) notify() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ch := range p.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	maxAttempts  = 5                // 计数窗口内允许的失败次数
+	window       = 5 * time.Minute  // 计数窗口
+	lockDuration = 15 * time.Minute // 锁定时长
+)
+
+// Lockout 按来源 IP 统计登录失败次数，超过次数后锁定一段时间。
+// 管理后台登录、TOTP 验证和 IMAP/POP3 登录共用同一个实例，重新连接或换用其他协议不会重置计数
+type Lockout struct {
+	mu       sync.Mutex
+	attempts map[string]*attemptInfo
+}
+
+type attemptInfo struct {
+	count    int
+	firstAt  time.Time
+	lockedAt time.Time
+}
+
+// New 创建登录锁定
+func New() *Lockout {
+	return &Lockout{attempts: make(map[string]*attemptInfo)}
+}
+
+// Check 检查该 IP 是否允许登录。允许时返回剩余的尝试次数，锁定时返回距离解锁的秒数
+func (l *Lockout) Check(ip string) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, exists := l.attempts[ip]
+	if !exists {
+		l.attempts[ip] = &attemptInfo{count: 0, firstAt: time.Now()}
+		return true, maxAttempts
+	}
+
+	now := time.Now()
+
+	// 检查是否在锁定期间
+	if !info.lockedAt.IsZero() && now.Before(info.lockedAt.Add(lockDuration)) {
+		remaining := int(info.lockedAt.Add(lockDuration).Sub(now).Seconds())
+		return false, remaining
+	}
+
+	// 超出计数窗口则重置
+	if now.After(info.firstAt.Add(window)) {
+		info.count = 0
+		info.firstAt = now
+		info.lockedAt = time.Time{}
+	}
+
+	if info.count >= maxAttempts {
+		info.lockedAt = now
+		return false, int(lockDuration.Seconds())
+	}
+
+	return true, maxAttempts - info.count
+}
+
+// Fail 记录一次失败的登录尝试
+func (l *Lockout) Fail(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, exists := l.attempts[ip]
+	if !exists {
+		l.attempts[ip] = &attemptInfo{count: 1, firstAt: time.Now()}
+		return
+	}
+	info.count++
+}
+
+// Reset 登录成功后重置计数
+func (l *Lockout) Reset(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, ip)
+}
@@ -0,0 +1,29 @@
+package lockout
+
+import "testing"
+
+func TestLockout(t *testing.T) {
+	l := New()
+	for i := 0; i < maxAttempts; i++ {
+		if allowed, remaining := l.Check("192.0.2.1"); !allowed || remaining != maxAttempts-i {
+			t.Fatalf("attempt %d: allowed = %v, remaining = %d", i+1, allowed, remaining)
+		}
+		l.Fail("192.0.2.1")
+	}
+	if allowed, retryAfter := l.Check("192.0.2.1"); allowed || retryAfter != int(lockDuration.Seconds()) {
+		t.Errorf("after %d failures: allowed = %v, retry after %d", maxAttempts, allowed, retryAfter)
+	}
+	if allowed, _ := l.Check("192.0.2.1"); allowed {
+		t.Error("lock was lifted by checking again")
+	}
+	if allowed, _ := l.Check("192.0.2.2"); !allowed {
+		t.Error("another IP is locked")
+	}
+
+	// 成功登录后重新计数
+	l.Fail("192.0.2.3")
+	l.Reset("192.0.2.3")
+	if _, remaining := l.Check("192.0.2.3"); remaining != maxAttempts {
+		t.Errorf("remaining after reset = %d", remaining)
+	}
+}
@@ -0,0 +1,254 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+)
+
+// Raw 返回邮件的完整 RFC 5322 内容：优先使用 raw_email，
+// 其次是本身就是完整邮件的 body，否则根据存储的字段重建
+func Raw(email *models.Email) []byte {
+	if raw := email.RawEmail; raw != "" {
+		if IsBase64(raw) {
+			if decoded, err := base64.StdEncoding.DecodeString(raw); err == nil {
+				return decoded
+			}
+		}
+		return []byte(raw)
+	}
+
+	if isCompleteMessage(email.Body) {
+		return []byte(email.Body)
+	}
+
+	return utils.BuildMessage(rebuildFields(email))
+}
+
+// RawCRLF 返回 Raw 的内容并将单独的 LF 转换为 CRLF，供 IMAP、POP3 等要求 CRLF 换行的协议使用
+func RawCRLF(email *models.Email) []byte {
+	raw := Raw(email)
+	bareLF := bytes.Count(raw, []byte("\n")) - bytes.Count(raw, []byte("\r\n"))
+	if bareLF == 0 {
+		return raw
+	}
+	out := make([]byte, 0, len(raw)+bareLF)
+	for i, c := range raw {
+		if c == '\n' && (i == 0 || raw[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// isCompleteMessage 判断内容是否为带头部的完整邮件（RFC 5322 要求 From 和 Date）
+func isCompleteMessage(content string) bool {
+	if content == "" {
+		return false
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(content))
+	if err != nil {
+		return false
+	}
+	return msg.Header.Get("From") != "" && (msg.Header.Get("Date") != "" || msg.Header.Get("Message-Id") != "")
+}
+
+// rebuildFields 从存储的字段中收集重建邮件所需的信息
+func rebuildFields(email *models.Email) utils.MessageFields {
+	var headers map[string]string
+	json.Unmarshal([]byte(email.Headers), &headers)
+
+	fields := utils.MessageFields{
+		From:    email.From,
+		To:      email.To,
+		Subject: email.Subject,
+		Date:    email.ReceivedAt,
+		Headers: headers,
+	}
+	for name, value := range headers {
+		switch strings.ToLower(name) {
+		case "date":
+			if t, err := mail.ParseDate(value); err == nil {
+				fields.Date = t
+			}
+		case "message-id":
+			fields.MessageID = strings.TrimSpace(value)
+		}
+	}
+	if fields.MessageID == "" {
+		// 同一封邮件多次导出时保持 Message-ID 不变，便于客户端去重
+		fields.MessageID = fmt.Sprintf("<mailcat.%d.%d@mailcat.local>", email.ID, email.CreatedAt.Unix())
+	}
+
+	// Worker 提交的去掉头部的 multipart 正文原样保留，附件不会丢失
+	if contentType, encoding := headerValue(headers, "Content-Type"), headerValue(headers, "Content-Transfer-Encoding"); contentType != "" {
+		if mediaType, params, err := mime.ParseMediaType(contentType); err == nil &&
+			strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" &&
+			strings.Contains(email.Body, "--"+params["boundary"]) {
+			fields.Body = email.Body
+			fields.ContentType = contentType
+			fields.TransferEncoding = encoding
+			return fields
+		}
+	}
+
+	fields.TextBody, fields.HTMLBody = DecodeContent(email)
+	return fields
+}
+
+// headerValue 不区分大小写地读取头部
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// DecodeContent 从存储的字段中解析出纯文本和 HTML 正文：
+// 依次处理 Base64 编码的正文、MIME 格式的正文以及 raw_email
+func DecodeContent(email *models.Email) (string, string) {
+	body := email.Body
+	htmlBody := email.HTMLBody
+
+	// 首先检查是否是纯Base64编码的内容
+	if body != "" && IsBase64(body) {
+		if decoded, err := base64.StdEncoding.DecodeString(body); err == nil {
+			body = string(decoded)
+		}
+	}
+
+	// 优先尝试解析MIME格式内容（包含base64解码）
+	if body != "" && isMIMEContent(body) {
+		var headers map[string]string
+		json.Unmarshal([]byte(email.Headers), &headers)
+		if parsedContent, ok := parseMIMEBody(body, headers); ok {
+			if parsedContent.TextBody != "" {
+				body = parsedContent.TextBody
+			}
+			if parsedContent.HTMLBody != "" {
+				htmlBody = parsedContent.HTMLBody
+			}
+		}
+	} else if body != "" && (strings.Contains(body, "Content-Type:") || strings.Contains(body, "boundary=")) {
+		// 如果body包含multipart数据，尝试标准解析
+		if parsedContent, parseErr := utils.ParseEmailFromRaw(body); parseErr == nil {
+			if parsedContent.TextBody != "" {
+				body = parsedContent.TextBody
+			}
+			if parsedContent.HTMLBody != "" {
+				htmlBody = parsedContent.HTMLBody
+			}
+		}
+	}
+
+	// 如果还是空的，尝试从raw_email解析
+	if (body == "" || htmlBody == "") && email.RawEmail != "" {
+		rawEmail := email.RawEmail
+
+		// 检查raw_email是否是Base64编码
+		if IsBase64(rawEmail) {
+			if decoded, err := base64.StdEncoding.DecodeString(rawEmail); err == nil {
+				rawEmail = string(decoded)
+			}
+		}
+
+		if isMIMEContent(rawEmail) {
+			if parsedContent, ok := parseMIMEBody(rawEmail, nil); ok {
+				if body == "" && parsedContent.TextBody != "" {
+					body = parsedContent.TextBody
+				}
+				if htmlBody == "" && parsedContent.HTMLBody != "" {
+					htmlBody = parsedContent.HTMLBody
+				}
+			}
+		} else if parsedContent, parseErr := utils.ParseEmailFromRaw(rawEmail); parseErr == nil {
+			if body == "" && parsedContent.TextBody != "" {
+				body = parsedContent.TextBody
+			}
+			if htmlBody == "" && parsedContent.HTMLBody != "" {
+				htmlBody = parsedContent.HTMLBody
+			}
+		}
+	}
+
+	return body, htmlBody
+}
+
+// parseMIMEBody 解析 MIME 格式的内容：带头部的完整邮件按自身的头部解析，
+// Worker 提交的去掉头部的正文使用保存的 Content-Type。
+// 两者都没有时是早期版本保存的数据，才从边界线推断边界
+func parseMIMEBody(content string, headers map[string]string) (*utils.EmailContent, bool) {
+	if tree, err := utils.ParseMIMETree(content); err == nil && len(tree.Parts) > 0 {
+		return tree.Content(), true
+	}
+
+	if contentType := headerValue(headers, "Content-Type"); contentType != "" {
+		if mediaType, params, err := mime.ParseMediaType(contentType); err == nil &&
+			strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+			parsed, err := utils.ParseEmailContent(content, map[string]string{"content-type": contentType})
+			return parsed, err == nil
+		}
+	}
+	return utils.ParseLegacyMIMEBody(content)
+}
+
+// isMIMEContent 检查内容是否为MIME格式
+func isMIMEContent(content string) bool {
+	// 检查是否包含MIME边界标识符，同时支持 \n 和 \r\n 换行
+	lines := strings.FieldsFunc(content, func(r rune) bool {
+		return r == '\n'
+	})
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		// 查找以 -- 开头的边界线，且长度合理
+		if strings.HasPrefix(line, "--") && len(line) > 10 {
+			// 进一步验证是否包含Content-Type
+			if strings.Contains(content, "Content-Type:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsBase64 检查内容是否是Base64编码
+func IsBase64(content string) bool {
+	// 移除换行符和空格
+	cleanContent := strings.ReplaceAll(content, "\r\n", "")
+	cleanContent = strings.ReplaceAll(cleanContent, "\n", "")
+	cleanContent = strings.ReplaceAll(cleanContent, " ", "")
+
+	// Base64内容应该只包含Base64字符集
+	if len(cleanContent) == 0 {
+		return false
+	}
+
+	// 检查长度是否是4的倍数（Base64特征）
+	if len(cleanContent)%4 != 0 {
+		return false
+	}
+
+	// 检查是否只包含Base64字符
+	for _, char := range cleanContent {
+		if !((char >= 'A' && char <= 'Z') ||
+			(char >= 'a' && char <= 'z') ||
+			(char >= '0' && char <= '9') ||
+			char == '+' || char == '/' || char == '=') {
+			return false
+		}
+	}
+
+	// 尝试解码以验证是否是有效的Base64
+	_, err := base64.StdEncoding.DecodeString(cleanContent)
+	return err == nil
+}
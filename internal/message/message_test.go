@@ -0,0 +1,36 @@
+package message
+
+import (
+	"testing"
+
+	"mailcat/internal/models"
+)
+
+func TestDecodeContentMIMEBody(t *testing.T) {
+	body := "--=_Part_1_2.3\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--=_Part_1_2.3\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n--=_Part_1_2.3--\r\n"
+	full := "From: a@example.com\r\nContent-Type: multipart/alternative; boundary=\"=_Part_1_2.3\"\r\n\r\n" + body
+
+	tests := []struct {
+		name  string
+		email models.Email
+	}{
+		{"full message", models.Email{Body: full}},
+		{"stored content-type", models.Email{Body: body, Headers: `{"content-type":"multipart/alternative; boundary=\"=_Part_1_2.3\""}`}},
+		{"legacy body without headers", models.Email{Body: body, Headers: `{"subject":"hi"}`}},
+		{"raw email", models.Email{RawEmail: full}},
+	}
+	for _, tt := range tests {
+		text, html := DecodeContent(&tt.email)
+		if text != "plain" || html != "<p>html</p>" {
+			t.Errorf("%s: DecodeContent = %q, %q", tt.name, text, html)
+		}
+	}
+
+	// 保存的 Content-Type 优先于从正文推断的边界
+	email := models.Email{Body: "--other-boundary\r\nContent-Type: text/plain\r\n\r\nnot a part\r\n" + body,
+		Headers: `{"Content-Type":"multipart/alternative; boundary=\"=_Part_1_2.3\""}`}
+	if text, html := DecodeContent(&email); text != "plain" || html != "<p>html</p>" {
+		t.Errorf("stored content-type ignored: DecodeContent = %q, %q", text, html)
+	}
+}
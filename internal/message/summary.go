@@ -0,0 +1,64 @@
+package message
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"mailcat/internal/models"
+	"mailcat/internal/utils"
+)
+
+// snippetLength 摘要的最大长度（字符数）
+const snippetLength = 200
+
+var (
+	// htmlIgnoredElement 生成摘要时整体去掉的元素
+	htmlIgnoredElement = regexp.MustCompile(`(?is)<(script|style|head|title)\b.*?</(script|style|head|title)\s*>`)
+	htmlTag            = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// Summary 列表视图使用的摘要信息，在邮件入库时计算并保存
+type Summary struct {
+	Snippet        string
+	Size           int // 完整邮件（Raw）的字节数
+	HasAttachments bool
+	AttachmentSize int // 附件解码后的总字节数
+}
+
+// Summarize 计算邮件的摘要：正文开头的一段纯文本、邮件大小以及附件数据量
+func Summarize(email *models.Email) Summary {
+	raw := Raw(email)
+	summary := Summary{Size: len(raw)}
+
+	if tree, err := utils.ParseMIMETree(string(raw)); err == nil {
+		tree.Walk(func(part *utils.MIMEPart) bool {
+			if len(part.Parts) == 0 && part.Path != "" && part.IsAttachment() {
+				summary.HasAttachments = true
+				summary.AttachmentSize += part.Size
+			}
+			return true
+		})
+	}
+
+	text, htmlBody := DecodeContent(email)
+	if strings.TrimSpace(text) == "" && htmlBody != "" {
+		text = htmlBody
+		text = htmlIgnoredElement.ReplaceAllString(text, " ")
+		text = htmlTag.ReplaceAllString(text, " ")
+		text = html.UnescapeString(text)
+	}
+	summary.Snippet = snippet(text)
+	return summary
+}
+
+// snippet 合并空白并截取开头 snippetLength 个字符
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= snippetLength {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:snippetLength])) + "…"
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+)
+
+// Default 进程内的全局注册表，/metrics 输出其中的指标
+var Default = NewRegistry()
+
+// 入库来源
+const (
+	SourceAPI    = "api"    // Worker 推送（POST /api/v1/emails）
+	SourceImport = "import" // 历史邮件导入
+)
+
+// 入库结果
+const (
+	IngestAccepted    = "accepted"
+	IngestRejected    = "rejected"     // 请求无效或保存失败
+	IngestDuplicate   = "duplicate"    // 导入时已存在的邮件
+	IngestParseFailed = "parse_failed" // 导入时无法解析的原始邮件
+)
+
+var (
+	// IngestTotal 按来源和结果统计的入库邮件数
+	IngestTotal = Default.NewCounterVec("mailcat_ingest_emails_total",
+		"Emails submitted for ingestion, by source and result.", "source", "result")
+
+	// HTTPRequestDuration 按路由统计的 HTTP 请求耗时，未匹配任何路由的请求记为 route="unmatched"
+	HTTPRequestDuration = Default.NewHistogramVec("mailcat_http_request_duration_seconds",
+		"HTTP request latency by gin route.", nil, "method", "route", "status")
+
+	// DBQueryDuration 按语句类型统计的 SQLite 执行耗时，查询从开始执行到结果集关闭，包含逐行读取结果的时间
+	DBQueryDuration = Default.NewHistogramVec("mailcat_db_query_duration_seconds",
+		"SQLite statement latency by operation and statement kind.", nil, "operation", "statement")
+
+	// LoginFailures 按协议统计的登录失败次数
+	LoginFailures = Default.NewCounterVec("mailcat_login_failures_total",
+		"Failed logins by protocol (admin, admin_totp, admin_oidc, imap, pop3).", "protocol")
+
+	// RateLimited 按路由分组和限流维度（key、ip）统计的被限流请求数
+	RateLimited = Default.NewCounterVec("mailcat_rate_limited_requests_total",
+		"API requests rejected by rate limiting, by route group and limit dimension.", "group", "by")
+)
+
+// ObserveQuery 记录一条 SQL 语句的耗时，operation 为 query 或 exec
+func ObserveQuery(operation, query string, start time.Time) {
+	DBQueryDuration.Observe(time.Since(start).Seconds(), operation, statementKind(query))
+}
+
+// statementKind 取 SQL 语句的第一个关键字作为标签，未知关键字记为 other 以限制标签基数
+func statementKind(query string) string {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	end := strings.IndexAny(query, " \t\r\n(")
+	if end < 0 {
+		end = len(query)
+	}
+	switch kind := strings.ToLower(query[:end]); kind {
+	case "select", "insert", "update", "delete", "with", "create", "alter", "pragma", "begin", "commit", "rollback":
+		return kind
+	default:
+		return "other"
+	}
+}
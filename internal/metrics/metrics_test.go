@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestStatementKind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM emails", "select"},
+		{"  \n\tselect 1", "select"},
+		{"(SELECT 1) UNION (SELECT 2)", "select"},
+		{"INSERT INTO emails(id) VALUES (1)", "insert"},
+		{"update emails SET is_read = 1", "update"},
+		{"DELETE FROM emails", "delete"},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", "with"},
+		{"CREATE TABLE t (id INTEGER)", "create"},
+		{"ALTER TABLE t ADD COLUMN x", "alter"},
+		{"PRAGMA user_version", "pragma"},
+		{"BEGIN IMMEDIATE", "begin"},
+		{"COMMIT", "commit"},
+		{"ROLLBACK", "rollback"},
+		{"VACUUM", "other"},
+		{"REPLACE INTO t VALUES (1)", "other"},
+		{"", "other"},
+		{"select", "select"},
+	}
+	for _, tt := range tests {
+		if got := statementKind(tt.query); got != tt.want {
+			t.Errorf("statementKind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	n, err := r.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("WriteTo() = %d bytes, wrote %d", n, b.Len())
+	}
+	return b.String()
+}
+
+func TestHistogramExposition(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("test_duration_seconds", "Test latency.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "read")
+	h.Observe(0.1, "read") // 等于上界的观测值计入该分桶
+	h.Observe(0.5, "read")
+	h.Observe(3, "read")
+	h.Observe(2, "write")
+
+	want := `# HELP test_duration_seconds Test latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{op="read",le="0.1"} 2
+test_duration_seconds_bucket{op="read",le="1"} 3
+test_duration_seconds_bucket{op="read",le="+Inf"} 4
+test_duration_seconds_sum{op="read"} 3.65
+test_duration_seconds_count{op="read"} 4
+test_duration_seconds_bucket{op="write",le="0.1"} 0
+test_duration_seconds_bucket{op="write",le="1"} 0
+test_duration_seconds_bucket{op="write",le="+Inf"} 1
+test_duration_seconds_sum{op="write"} 2
+test_duration_seconds_count{op="write"} 1
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("test_seconds", "Test.", []float64{1})
+	h.Observe(0.5)
+
+	got := scrape(t, r)
+	for _, line := range []string{
+		`test_seconds_bucket{le="1"} 1`,
+		`test_seconds_bucket{le="+Inf"} 1`,
+		`test_seconds_sum 0.5`,
+		`test_seconds_count 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("exposition missing %q:\n%s", line, got)
+		}
+	}
+}
+
+func TestCounterExposition(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Help with \\ backslash\nand newline.", "path")
+	c.Inc(`/a"b`)
+	c.Add(2, "/line\nbreak")
+	c.Inc(`C:\dir`)
+	c.Inc(`C:\dir`)
+
+	want := `# HELP test_total Help with \\ backslash\nand newline.
+# TYPE test_total counter
+test_total{path="/a\"b"} 1
+test_total{path="/line\nbreak"} 2
+test_total{path="C:\\dir"} 2
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGaugeFuncExposition(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("test_gauge", "Test.", []string{"kind"}, func(set func(float64, ...string)) {
+		set(1.5, "a")
+		set(math.Inf(1), "b")
+	})
+	r.NewGaugeFunc("test_missing", "No data.", nil, func(set func(float64, ...string)) {})
+
+	want := `# HELP test_gauge Test.
+# TYPE test_gauge gauge
+test_gauge{kind="a"} 1.5
+test_gauge{kind="b"} +Inf
+# HELP test_missing No data.
+# TYPE test_missing gauge
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	expectPanic := func(name string, fn func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s did not panic", name)
+			}
+		}()
+		fn()
+	}
+
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test.", "a")
+	expectPanic("duplicate name", func() { r.NewCounterVec("test_total", "Test.") })
+	expectPanic("wrong label count", func() { c.Inc("x", "y") })
+	expectPanic("negative add", func() { c.Add(-1, "x") })
+}
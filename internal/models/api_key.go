@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// API 密钥的权限范围
+const (
+	ScopeEmailsWrite  = "emails:write"  // 推送邮件、修改已读/星标/标签状态
+	ScopeEmailsRead   = "emails:read"   // 读取邮件、标签和导出
+	ScopeEmailsDelete = "emails:delete" // 删除邮件（移入回收站）
+	ScopeAdmin        = "admin"         // 管理接口，同时包含以上所有权限
+)
+
+// Scopes 所有权限范围
+var Scopes = []string{ScopeEmailsWrite, ScopeEmailsRead, ScopeEmailsDelete, ScopeAdmin}
+
+// APIKey 命名的 API 密钥，数据库只保存密钥的哈希
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // 密钥开头的若干字符，用于辨认
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"` // IP 或 CIDR，为空时不限制
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// AllowQueryToken 允许通过 URL 参数 ?token= 传递，只能用于只有 emails:read 权限的密钥
+	AllowQueryToken bool `json:"allow_query_token"`
+}
+
+// HasScope 判断密钥是否具有指定权限，admin 包含所有权限
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest 创建 API 密钥的请求
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Scopes     []string   `json:"scopes" binding:"required"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	// AllowQueryToken 见 APIKey.AllowQueryToken
+	AllowQueryToken bool `json:"allow_query_token"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// AuditEntry 审计日志中的一条记录：谁在什么时间、从哪里对什么对象执行了什么操作
+type AuditEntry struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Actor     string    `json:"actor"`      // 用户名，API 密钥为 api_key:<名称>，未认证时为空或尝试登录的用户名
+	ActorType string    `json:"actor_type"` // user、api_key 或 anonymous
+	Action    string    `json:"action"`     // 例如 login、email.view、config.update
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`     // 路由模板，例如 /api/v1/emails/:id
+	TargetID  string    `json:"target_id"` // 操作对象的 ID，批量操作时以逗号分隔
+	IP        string    `json:"ip"`
+	Status    int       `json:"status"` // HTTP 状态码
+	Success   bool      `json:"success"`
+	Details   string    `json:"details,omitempty"`
+}
+
+// 审计日志中的操作者类型
+const (
+	ActorUser      = "user"
+	ActorAPIKey    = "api_key"
+	ActorAnonymous = "anonymous"
+)
+
+// AuditQuery 审计日志的筛选和分页条件，零值字段表示不筛选
+type AuditQuery struct {
+	Actor    string
+	Action   string
+	TargetID string
+	IP       string
+	Success  *bool
+	Since    time.Time // 包含
+	Until    time.Time // 不包含
+	Page     int
+	Limit    int
+}
+
+// AuditList 审计日志的一页，按时间倒序
+type AuditList struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	Limit   int          `json:"limit"`
+}
@@ -4,6 +4,14 @@ import (
 	"time"
 )
 
+// 邮件文件夹
+const (
+	FolderInbox = "inbox"
+	FolderSpam  = "spam"
+	FolderTrash = "trash" // 已删除的邮件，例如 POP3 DELE
+	FolderAll   = "all"   // 仅用于查询，表示不按文件夹过滤
+)
+
 type Email struct {
 	ID          int       `json:"id" db:"id"`
 	From        string    `json:"from" db:"from_address"`
@@ -13,6 +21,12 @@ type Email struct {
 	HTMLBody    string    `json:"html_body" db:"html_body"`
 	Headers     string    `json:"headers" db:"headers"`
 	RawEmail    string    `json:"raw_email" db:"raw_email"`
+	Folder      string    `json:"folder" db:"folder"`
+	SpamScore   float64   `json:"spam_score" db:"spam_score"`
+	SpamReasons string    `json:"spam_reasons" db:"spam_reasons"`
+	IsRead      bool      `json:"is_read" db:"is_read"`
+	IsStarred   bool      `json:"is_starred" db:"is_starred"`
+	Labels      []string  `json:"labels" db:"-"` // 来自 email_labels 表，只在列表和详情查询时填充
 	ReceivedAt  time.Time `json:"received_at" db:"received_at"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
@@ -25,11 +39,104 @@ type EmailRequest struct {
 	HTMLBody string            `json:"html_body"`
 	Headers  map[string]string `json:"headers"`
 	RawEmail string            `json:"raw_email"`
+
+	// 以下字段由服务端在接收时填充，不接受客户端传入
+	Folder      string    `json:"-"`
+	SpamScore   float64   `json:"-"`
+	SpamReasons string    `json:"-"`
+	ReceivedAt  time.Time `json:"-"` // 为零值时使用当前时间，导入历史邮件时取自 Date 头部
+}
+
+// EmailFilter 批量查询（如导出）时的过滤条件，零值字段表示不过滤
+type EmailFilter struct {
+	Folder  string     // 为空时只包含收件箱，为 FolderAll 时包含全部文件夹
+	From    string     // 发件人包含该字符串
+	To      string     // 收件人包含该字符串
+	Subject string     // 主题包含该字符串
+	Since   *time.Time // 接收时间不早于
+	Until   *time.Time // 接收时间早于
+	IDs     []int      // 只包含指定 ID
+	Limit   int        // 最多返回的数量，0 表示不限制
+
+	IsRead    *bool  // 已读状态
+	IsStarred *bool  // 星标状态
+	Label     string // 带有该标签（不区分大小写）
+
+	Mailboxes []string // 非 nil 时只包含收件人属于其中任一地址的邮件（按 MatchMailbox 精确匹配），空切片不匹配任何邮件
+}
+
+// EmailState 邮件的 ID 和已读状态，用于 IMAP 等只需要邮件列表状态的场景
+type EmailState struct {
+	ID     int
+	IsRead bool
+}
+
+// EmailStateUpdate 修改邮件的已读、星标和标签状态，nil 字段表示不修改
+type EmailStateUpdate struct {
+	IsRead       *bool    `json:"is_read"`
+	IsStarred    *bool    `json:"is_starred"`
+	Labels       []string `json:"labels"`        // 非 nil 时替换全部标签，空数组表示清空
+	AddLabels    []string `json:"add_labels"`    // 添加的标签，不存在时自动创建
+	RemoveLabels []string `json:"remove_labels"` // 移除的标签
 }
 
-type EmailListResponse struct {
-	Emails []Email `json:"emails"`
-	Total  int     `json:"total"`
-	Page   int     `json:"page"`
-	Limit  int     `json:"limit"`
-}
\ No newline at end of file
+// BulkEmailStateRequest 批量修改邮件状态
+type BulkEmailStateRequest struct {
+	IDs []int `json:"ids" binding:"required"`
+	EmailStateUpdate
+}
+
+// Label 标签及使用该标签的邮件数
+type Label struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EmailSummary 列表视图使用的邮件摘要，不包含正文和原始邮件
+type EmailSummary struct {
+	ID             int       `json:"id"`
+	From           string    `json:"from"`
+	To             string    `json:"to"`
+	Subject        string    `json:"subject"`
+	Snippet        string    `json:"snippet"`         // 正文开头的一段纯文本
+	Size           int       `json:"size"`            // 完整邮件的字节数
+	HasAttachments bool      `json:"has_attachments"`
+	Folder         string    `json:"folder"`
+	SpamScore      float64   `json:"spam_score"`
+	IsRead         bool      `json:"is_read"`
+	IsStarred      bool      `json:"is_starred"`
+	Labels         []string  `json:"labels"`
+	ReceivedAt     time.Time `json:"received_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// EmailStat 统计分析使用的邮件字段
+type EmailStat struct {
+	ReceivedAt     time.Time
+	From           string
+	To             string
+	Folder         string
+	Size           int
+	HasAttachments bool
+	AttachmentSize int
+}
+
+// EmailListQuery 列表分页参数：AfterID、BeforeID 都为 0 时按页码分页，否则按邮件 ID 游标分页
+type EmailListQuery struct {
+	Page     int
+	Limit    int
+	AfterID  int // 返回比该 ID 更早的邮件（下一页）
+	BeforeID int // 返回比该 ID 更新的邮件（上一页）
+}
+
+// EmailSummaryList 邮件列表，按 ID 降序（新邮件在前）
+type EmailSummaryList struct {
+	Emails     []EmailSummary `json:"emails"`
+	Total      *int           `json:"total,omitempty"` // 只在按页码分页时统计
+	Page       int            `json:"page,omitempty"`
+	Limit      int            `json:"limit"`
+	NextCursor *int           `json:"next_cursor"` // 传给 after_id 获取更早的邮件，没有更多时为 null
+	PrevCursor *int           `json:"prev_cursor"` // 传给 before_id 获取更新的邮件，没有更多时为 null
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// 管理后台用户的角色
+const (
+	RoleOwner  = "owner"  // 全部权限，包括管理用户
+	RoleAdmin  = "admin"  // 除管理用户外的全部权限
+	RoleViewer = "viewer" // 只读，只能查看 Mailboxes 中收件人的邮件
+)
+
+// Roles 所有角色
+var Roles = []string{RoleOwner, RoleAdmin, RoleViewer}
+
+// User 管理后台用户，数据库只保存密码的慢哈希
+type User struct {
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	Role         string     `json:"role"`
+	Mailboxes    []string   `json:"mailboxes"` // viewer 可见的收件人地址，例如 alice@example.com 或 @example.com
+	TOTPEnabled  bool       `json:"totp_enabled"`
+	TOTPRequired bool       `json:"totp_required"`          // 该用户必须启用 TOTP；也可以通过运行时设置 require_totp 对所有用户强制
+	OIDCSubject  string     `json:"oidc_subject,omitempty"` // 通过 OIDC 登录创建的用户在身份提供方的 sub，这类用户没有密码
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+}
+
+// HasRole 判断用户是否为指定角色之一
+func (u *User) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if u.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// MailboxFilter 返回用户可见的收件人地址，nil 表示不限制；用于 EmailFilter.Mailboxes
+func (u *User) MailboxFilter() []string {
+	if u.Role != RoleViewer {
+		return nil
+	}
+	return append([]string{}, u.Mailboxes...)
+}
+
+// CanAccess 判断用户能否查看收件人为 to 的邮件，与 EmailFilter.Mailboxes 的匹配规则相同，见 MatchMailbox
+func (u *User) CanAccess(to string) bool {
+	mailboxes := u.MailboxFilter()
+	if mailboxes == nil {
+		return true
+	}
+	for _, mailbox := range mailboxes {
+		if MatchMailbox(to, mailbox) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchMailbox 判断收件人列表 to 中是否有地址属于 mailbox，不区分大小写：
+// alice@example.com 只匹配完全相同的地址，@example.com 匹配域名恰好为 example.com 的地址。
+// to 无法解析为地址列表时整体作为一个地址比较
+func MatchMailbox(to, mailbox string) bool {
+	mailbox = strings.ToLower(strings.TrimSpace(mailbox))
+	if mailbox == "" {
+		return false
+	}
+	for _, address := range recipientAddresses(to) {
+		if strings.HasPrefix(mailbox, "@") {
+			at := strings.LastIndex(address, "@")
+			if at >= 0 && address[at:] == mailbox {
+				return true
+			}
+		} else if address == mailbox {
+			return true
+		}
+	}
+	return false
+}
+
+// recipientAddresses 解析收件人列表并转为小写，无法解析时使用原始值
+func recipientAddresses(to string) []string {
+	addresses, err := mail.ParseAddressList(to)
+	if err != nil {
+		to = strings.ToLower(strings.TrimSpace(to))
+		if to == "" {
+			return nil
+		}
+		return []string{to}
+	}
+	result := make([]string, len(addresses))
+	for i, addr := range addresses {
+		result[i] = strings.ToLower(addr.Address)
+	}
+	return result
+}
+
+// CreateUserRequest 创建用户的请求，Password 为明文密码
+type CreateUserRequest struct {
+	Username  string   `json:"username" binding:"required"`
+	Password  string   `json:"password" binding:"required"`
+	Role      string   `json:"role" binding:"required"`
+	Mailboxes []string `json:"mailboxes"`
+}
+
+// UpdateUserRequest 修改用户的请求，nil 字段表示不修改
+type UpdateUserRequest struct {
+	Password     *string  `json:"password"`
+	Role         *string  `json:"role"`
+	Mailboxes    []string `json:"mailboxes"` // 非 nil 时替换全部邮箱
+	TOTPRequired *bool    `json:"totp_required"`
+}
+
+// UserTOTP 用户的 TOTP 密钥和恢复码，不通过接口返回
+type UserTOTP struct {
+	Secret        string // Base32 编码的密钥，开始绑定后保存，验证通过后 Enabled 为 true
+	Enabled       bool
+	LastCounter   int64    // 最近一次验证通过的时间步，同一验证码不能重复使用
+	RecoveryCodes []string // 未使用的恢复码的 SHA-256 十六进制
+}
+
+// AdminSession 管理后台的登录 session，数据库只保存 token 的哈希
+type AdminSession struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	IP         string    `json:"ip"` // 最近一次请求的来源 IP
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // 是否为发起请求的 session
+}
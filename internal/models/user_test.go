@@ -0,0 +1,40 @@
+package models
+
+import "testing"
+
+func TestCanAccess(t *testing.T) {
+	viewer := &User{Role: RoleViewer, Mailboxes: []string{"Bob@Example.com", "@example.com"}}
+	bob := &User{Role: RoleViewer, Mailboxes: []string{"bob@example.com"}}
+	tests := []struct {
+		to        string
+		viewer    bool // 地址或 @example.com 可见
+		bobAccess bool // 只有 bob@example.com 可见
+	}{
+		{"bob@example.com", true, true},
+		{"Bob <BOB@example.com>", true, true},
+		{"carol@other.org, Bob <bob@example.com>", true, true},
+		{"alice@example.com", true, false},
+		{"jimbob@example.com", true, false},
+		{"bob@example.com.evil", false, false},
+		{"x@example.com.attacker", false, false},
+		{"x@sub.example.com", false, false},
+		{"\"bob@example.com\" <x@evil.org>", false, false},
+		{"bob@example.com;x@evil.org", false, false}, // 无法解析时整体比较
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if got := viewer.CanAccess(tt.to); got != tt.viewer {
+			t.Errorf("viewer.CanAccess(%q) = %v, want %v", tt.to, got, tt.viewer)
+		}
+		if got := bob.CanAccess(tt.to); got != tt.bobAccess {
+			t.Errorf("bob.CanAccess(%q) = %v, want %v", tt.to, got, tt.bobAccess)
+		}
+	}
+
+	if admin := (&User{Role: RoleAdmin, Mailboxes: []string{"bob@example.com"}}); !admin.CanAccess("x@evil.org") {
+		t.Error("admin mailboxes restricted access")
+	}
+	if none := (&User{Role: RoleViewer}); none.CanAccess("bob@example.com") {
+		t.Error("viewer without mailboxes can access mail")
+	}
+}
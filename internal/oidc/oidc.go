@@ -0,0 +1,484 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// discoveryTTL 发现文档的缓存时间
+	discoveryTTL = time.Hour
+	// keysMinRefresh 遇到未知 kid 时重新获取 JWKS 的最小间隔，防止被伪造的令牌用来放大请求
+	keysMinRefresh = time.Minute
+	// clockSkew 校验 exp 和 iat 时允许的时钟偏差
+	clockSkew = time.Minute
+	// maxResponseBytes 发现文档、JWKS 和令牌响应的大小上限
+	maxResponseBytes = 1 << 20
+)
+
+var (
+	ErrDiscovery    = errors.New("failed to load oidc provider configuration")
+	ErrExchange     = errors.New("failed to exchange authorization code")
+	ErrInvalidToken = errors.New("invalid id token")
+)
+
+// Config OIDC 客户端配置
+type Config struct {
+	Issuer       string // 发现文档位于 Issuer + /.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string   // 为空时作为公开客户端，只依靠 PKCE
+	RedirectURL  string   // 回调地址，需要在身份提供方登记
+	Scopes       []string // 为空时使用 openid profile email
+	Timeout      time.Duration
+}
+
+// Claims ID Token 中的声明
+type Claims map[string]interface{}
+
+// Provider OIDC 身份提供方，按需加载并缓存发现文档和签名公钥
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu         sync.Mutex
+	discovery  *discoveryDocument
+	fetchedAt  time.Time
+	keys       map[string]crypto.PublicKey // kid -> 公钥
+	keysLoaded time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// New 创建 Provider，不会立即访问身份提供方
+func New(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// NewVerifier 生成 PKCE code_verifier（43 个字符）
+func NewVerifier() (string, error) {
+	return randomString(32)
+}
+
+// NewState 生成 state 或 nonce
+func NewState() (string, error) {
+	return randomString(32)
+}
+
+// Challenge 计算 code_verifier 的 S256 code_challenge
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 返回授权地址，使用授权码模式和 S256 PKCE
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	doc, err := p.document(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange 用授权码换取令牌，校验 ID Token 的签名、签发者、受众、有效期和 nonce 后返回其中的声明
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	doc, err := p.document(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic，按 RFC 6749 2.3.1 先做表单编码
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.getJSON(req, &token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if status != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("%w: status %d %s %s", ErrExchange, status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: response does not contain an id_token", ErrExchange)
+	}
+	return p.verify(ctx, doc, token.IDToken, nonce)
+}
+
+// verify 校验 ID Token 并返回声明
+func (p *Provider) verify(ctx context.Context, doc *discoveryDocument, rawToken, nonce string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	key, err := p.key(ctx, doc, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	now := time.Now()
+	switch {
+	case claims.String("iss") != doc.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.String("iss"))
+	case !contains(claims.Strings("aud"), p.cfg.ClientID):
+		return nil, fmt.Errorf("%w: token was not issued for this client", ErrInvalidToken)
+	case len(claims.Strings("aud")) > 1 && claims.String("azp") != p.cfg.ClientID:
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidToken)
+	case claims.String("sub") == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	case subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	exp, ok := claims.time("exp")
+	if !ok || now.After(exp.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: token has expired", ErrInvalidToken)
+	}
+	if iat, ok := claims.time("iat"); ok && iat.After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: token was issued in the future", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// document 返回缓存的发现文档，过期后重新获取
+func (p *Provider) document(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil && time.Since(p.fetchedAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	endpoint := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	var doc discoveryDocument
+	status, err := p.getJSON(req, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	switch {
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("%w: %s returned status %d", ErrDiscovery, endpoint, status)
+	case doc.Issuer != p.cfg.Issuer:
+		return nil, fmt.Errorf("%w: issuer %q does not match the configured issuer %q", ErrDiscovery, doc.Issuer, p.cfg.Issuer)
+	case doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "":
+		return nil, fmt.Errorf("%w: missing authorization_endpoint, token_endpoint or jwks_uri", ErrDiscovery)
+	}
+	p.discovery = &doc
+	p.fetchedAt = time.Now()
+	return p.discovery, nil
+}
+
+// key 返回 kid 对应的公钥，缓存中没有时重新获取 JWKS（身份提供方轮换密钥）
+func (p *Provider) key(ctx context.Context, doc *discoveryDocument, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysLoaded) < keysMinRefresh {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, doc.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.getJSON(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned status %d", ErrDiscovery, doc.JWKSURI, status)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysLoaded = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+}
+
+// lookupKey 调用方持有 p.mu。令牌没有 kid 且 JWKS 中只有一个密钥时使用该密钥
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (p *Provider) getJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("invalid JSON response from %s: %v", req.URL, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// jsonWebKey JWKS 中的一个公钥，支持 RSA 和 P-256/P-384 EC 密钥
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid EC point")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature 校验 JWS 签名。只接受非对称算法，alg 必须与公钥类型一致
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") || rsa.VerifyPKCS1v15(key, hash, digest, signature) != nil {
+			return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key type", ErrInvalidToken)
+	}
+	return nil
+}
+
+// String 返回字符串声明，path 可以用 . 访问嵌套对象（例如 realm_access.roles）
+func (c Claims) String(path string) string {
+	if s, ok := c.lookup(path).(string); ok {
+		return s
+	}
+	return ""
+}
+
+// Strings 返回字符串或字符串数组声明，其他类型的元素被忽略
+func (c Claims) Strings(path string) []string {
+	switch v := c.lookup(path).(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func (c Claims) lookup(path string) interface{} {
+	var current interface{} = map[string]interface{}(c)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	if v, ok := c[name].(float64); ok {
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
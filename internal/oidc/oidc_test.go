@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mailcat/internal/oidc/oidctest"
+)
+
+// login 用 Provider 完成一次授权码登录
+func login(t *testing.T, m *oidctest.Provider, p *Provider) (Claims, error) {
+	ctx := context.Background()
+	state, _ := NewState()
+	nonce, _ := NewState()
+	verifier, _ := NewVerifier()
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Exchange(ctx, m.Authorize(t, authURL), verifier, nonce)
+}
+
+func newTestProvider(m *oidctest.Provider) *Provider {
+	return New(Config{Issuer: m.URL, ClientID: oidctest.ClientID, ClientSecret: oidctest.ClientSecret, RedirectURL: "http://localhost/admin/oidc/callback"})
+}
+
+func TestLogin(t *testing.T) {
+	m := oidctest.NewProvider(t)
+	m.Claims["groups"] = []string{"mailcat-admins", "staff"}
+	m.Claims["realm_access"] = map[string]interface{}{"roles": []string{"owner"}}
+
+	claims, err := login(t, m, newTestProvider(m))
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if claims.String("sub") != "user-1" {
+		t.Errorf("sub = %q, want user-1", claims.String("sub"))
+	}
+	if got := claims.Strings("groups"); len(got) != 2 || got[0] != "mailcat-admins" {
+		t.Errorf("groups = %v", got)
+	}
+	if got := claims.Strings("realm_access.roles"); len(got) != 1 || got[0] != "owner" {
+		t.Errorf("realm_access.roles = %v", got)
+	}
+}
+
+func TestLoginRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		{"wrong audience", map[string]interface{}{"aud": "other-client"}},
+		{"wrong issuer", map[string]interface{}{"iss": "https://attacker.example.com"}},
+		{"wrong nonce", map[string]interface{}{"nonce": "replayed"}},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{"unauthorized party", map[string]interface{}{"aud": []string{"mailcat", "other-client"}, "azp": "other-client"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := oidctest.NewProvider(t)
+			m.Claims = tt.claims
+			if _, err := login(t, m, newTestProvider(m)); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestLoginRejectsWrongVerifier(t *testing.T) {
+	m := oidctest.NewProvider(t)
+	p := newTestProvider(m)
+	ctx := context.Background()
+	verifier, _ := NewVerifier()
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewVerifier()
+	if _, err := p.Exchange(ctx, m.Authorize(t, authURL), other, "nonce"); !errors.Is(err, ErrExchange) {
+		t.Errorf("err = %v, want ErrExchange", err)
+	}
+}
+
+func TestLoginRejectsForgedSignature(t *testing.T) {
+	m := oidctest.NewProvider(t)
+	p := newTestProvider(m)
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Key = forger
+	// JWKS 仍然返回原来的公钥
+	if _, err := login(t, m, p); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("err = %v, want signature verification failure", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package oidctest 提供测试用的本地 OIDC 身份提供方
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	ClientID     = "mailcat"
+	ClientSecret = "s3cret"
+)
+
+// Provider 本地的 OIDC 身份提供方：授权请求直接签发授权码，令牌端点校验客户端凭据和 PKCE 后返回签名的 ID Token
+type Provider struct {
+	URL    string
+	Key    *rsa.PrivateKey        // 签名 ID Token 的私钥，JWKS 始终返回创建时的公钥
+	Claims map[string]interface{} // 写入 ID Token 的额外声明，可覆盖默认值（sub 默认为 user-1）
+
+	mu         sync.Mutex
+	challenges map[string]string // 授权码 -> code_challenge
+	nonces     map[string]string // 授权码 -> nonce
+}
+
+// NewProvider 启动身份提供方，测试结束时关闭
+func NewProvider(t testing.TB) *Provider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{Key: key, Claims: map[string]interface{}{}, challenges: map[string]string{}, nonces: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		code := r.PostForm.Get("code")
+		id, secret, _ := r.BasicAuth()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		p.mu.Lock()
+		challenge, nonce := p.challenges[code], p.nonces[code]
+		p.mu.Unlock()
+		if id != ClientID || secret != ClientSecret || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.Sign(t, nonce)})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	p.URL = server.URL
+	return p
+}
+
+// Authorize 模拟用户在身份提供方登录并同意授权，返回授权码
+func (p *Provider) Authorize(t testing.TB, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+	code := "code-" + query.Get("state")
+	p.mu.Lock()
+	p.challenges[code] = query.Get("code_challenge")
+	p.nonces[code] = query.Get("nonce")
+	p.mu.Unlock()
+	return code
+}
+
+// Sign 签发带有 nonce 和 Claims 的 ID Token
+func (p *Provider) Sign(t testing.TB, nonce string) string {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   p.URL,
+		"aud":   ClientID,
+		"sub":   "user-1",
+		"nonce": nonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+	}
+	p.mu.Lock()
+	for k, v := range p.Claims {
+		claims[k] = v
+	}
+	key := p.Key
+	p.mu.Unlock()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Error(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
@@ -0,0 +1,285 @@
+package pop3
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mailcat/internal/audit"
+	"mailcat/internal/database"
+	"mailcat/internal/lockout"
+	"mailcat/internal/metrics"
+	"mailcat/internal/models"
+)
+
+const (
+	// autologoutTimeout 空闲连接的超时时间（RFC 1939 要求不少于 10 分钟）
+	autologoutTimeout = 10 * time.Minute
+	// loginTimeout 登录前的空闲超时
+	loginTimeout = time.Minute
+	// maxLoginFailures 单个连接允许的登录失败次数
+	maxLoginFailures = 3
+	// addressSeparator 分隔管理员用户名和收件人地址，例如 alice+qa@example.com；用户名中不能包含该字符
+	addressSeparator = "+"
+)
+
+// Mailbox 按收件人划分的邮箱，收件人中有地址与 Address 匹配的邮件属于该邮箱（规则同 models.MatchMailbox）
+type Mailbox struct {
+	Name    string
+	Address string
+	Token   string // 以 Name 为用户名、Token 为密码登录，为空时不能以邮箱名登录
+}
+
+// Options POP3 服务配置
+type Options struct {
+	Address           string
+	TLSConfig         *tls.Config                          // 为 nil 时不支持 STLS
+	ImplicitTLS       bool                                 // 连接建立即进行 TLS 握手
+	AllowInsecureAuth bool                                 // 配置了 TLS 时仍允许在未加密连接上登录
+	CheckAdmin        func(username, password string) bool // 校验管理员的用户名和密码：以自己的用户名登录读取整个收件箱，以“用户名+收件人地址”登录读取该收件人的邮件
+	Lockout           *lockout.Lockout                     // 按来源 IP 的登录失败锁定，与管理后台共用；为 nil 时只限制单个连接的失败次数
+	Audit             *audit.Logger                        // 记录登录成功和失败，为 nil 时不记录
+	Mailboxes         []Mailbox
+}
+
+// maildrop 登录后可访问的邮件集合
+type maildrop struct {
+	name   string // 用于互斥锁定，同一邮箱同时只允许一个会话
+	filter models.EmailFilter
+}
+
+// Server POP3 服务，每次登录对应一个收件人邮箱，DELE 的邮件在 QUIT 时移入回收站
+type Server struct {
+	db   *database.DB
+	opts Options
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	locked   map[string]bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer 创建 POP3 服务
+func NewServer(db *database.DB, opts Options) *Server {
+	return &Server{
+		db:     db,
+		opts:   opts,
+		conns:  make(map[net.Conn]struct{}),
+		locked: make(map[string]bool),
+	}
+}
+
+// ListenAndServe 监听 Options.Address 并处理连接，直到 Close 被调用
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.opts.Address)
+	if err != nil {
+		return err
+	}
+	if s.opts.ImplicitTLS {
+		l = tls.NewListener(l, s.opts.TLSConfig)
+	}
+	return s.Serve(l)
+}
+
+// Serve 在指定的 listener 上处理连接，Close 之后返回 nil
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			newSession(s, conn).serve()
+		}()
+	}
+}
+
+// Close 停止监听并断开所有连接，未 QUIT 的会话不会删除邮件
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// Addr 返回正在监听的地址，尚未开始监听或已关闭时返回 nil
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil || s.closed {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// lock 锁定邮箱，已被其他会话锁定时返回 false
+func (s *Server) lock(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked[name] {
+		return false
+	}
+	s.locked[name] = true
+	return true
+}
+
+func (s *Server) unlock(name string) {
+	s.mu.Lock()
+	delete(s.locked, name)
+	s.mu.Unlock()
+}
+
+// authenticate 校验用户名和密码，ip 为客户端地址，被锁定时不校验密码；失败计入锁定，结果写入审计日志
+func (s *Server) authenticate(username, password, ip string) *maildrop {
+	if s.opts.Lockout != nil {
+		if allowed, _ := s.opts.Lockout.Check(ip); !allowed {
+			log.Printf("POP3 login for user %q from %s rejected: too many failed attempts", username, ip)
+			s.recordLogin(username, ip, http.StatusTooManyRequests, "too many failed login attempts")
+			return nil
+		}
+	}
+
+	drop := s.checkCredentials(username, password)
+	if drop == nil {
+		log.Printf("POP3 login failed for user %q", username)
+		metrics.LoginFailures.Inc("pop3")
+		if s.opts.Lockout != nil {
+			s.opts.Lockout.Fail(ip)
+		}
+		s.recordLogin(username, ip, http.StatusUnauthorized, "invalid credentials")
+		return nil
+	}
+	if s.opts.Lockout != nil {
+		s.opts.Lockout.Reset(ip)
+	}
+	s.recordLogin(username, ip, http.StatusOK, "")
+	return drop
+}
+
+// checkCredentials 校验用户名和密码，失败时返回 nil：
+// 配置的邮箱名使用该邮箱的令牌；owner 或 admin 用户以自己的用户名和密码读取整个收件箱，以“用户名+收件人地址”读取该收件人的邮件
+func (s *Server) checkCredentials(username, password string) *maildrop {
+	for _, mailbox := range s.opts.Mailboxes {
+		if mailbox.Token != "" && username == mailbox.Name && secureCompare(password, mailbox.Token) {
+			return &maildrop{
+				name:   "mailbox:" + mailbox.Name,
+				filter: models.EmailFilter{Folder: models.FolderInbox, Mailboxes: []string{mailbox.Address}},
+			}
+		}
+	}
+
+	if s.opts.CheckAdmin == nil {
+		return nil
+	}
+	if admin, address, scoped := strings.Cut(username, addressSeparator); scoped {
+		if admin == "" || !strings.Contains(address, "@") || !s.opts.CheckAdmin(admin, password) {
+			return nil
+		}
+		address = strings.ToLower(address)
+		return &maildrop{
+			name:   "address:" + address,
+			filter: models.EmailFilter{Folder: models.FolderInbox, Mailboxes: []string{address}},
+		}
+	}
+	if s.opts.CheckAdmin(username, password) {
+		return &maildrop{name: "admin", filter: models.EmailFilter{Folder: models.FolderInbox}}
+	}
+
+	return nil
+}
+
+// recordLogin 将登录结果写入审计日志，状态码与管理后台登录的 HTTP 状态一致
+func (s *Server) recordLogin(username, ip string, status int, details string) {
+	if s.opts.Audit == nil {
+		return
+	}
+	s.opts.Audit.Record(models.AuditEntry{
+		Actor:     username,
+		ActorType: models.ActorUser,
+		Action:    "pop3.login",
+		Method:    "POP3",
+		IP:        ip,
+		Status:    status,
+		Success:   status == http.StatusOK,
+		Details:   details,
+	})
+}
+
+// remoteIP 返回连接的客户端 IP，用于登录失败锁定
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// secureCompare 以固定时间比较两个字符串，先取哈希以免泄露长度
+func secureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
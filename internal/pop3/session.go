@@ -0,0 +1,532 @@
+package pop3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcat/internal/message"
+	"mailcat/internal/models"
+)
+
+// maxLineLength 命令行的最大长度（RFC 1939 为 255 字节，AUTH 的 base64 响应可能更长）
+const maxLineLength = 1024
+
+// loadBatchSize 登录时计算邮件大小每批读取的邮件数
+const loadBatchSize = 200
+
+var (
+	// errQuit 客户端已退出或连接需要关闭
+	errQuit = errors.New("quit")
+	// errLineTooLong 命令行超过 maxLineLength
+	errLineTooLong = errors.New("line too long")
+)
+
+// maildropMessage 登录时的邮件快照，消息编号 i+1 对应 messages[i]
+type maildropMessage struct {
+	id      int
+	size    int
+	deleted bool
+}
+
+// session 单个客户端连接的状态
+type session struct {
+	server *Server
+	conn   net.Conn
+	tls    bool
+	r      *bufio.Reader
+	w      *bufio.Writer
+
+	username string // USER 命令提交的用户名
+	failures int
+
+	drop     *maildrop
+	messages []maildropMessage
+}
+
+func newSession(server *Server, conn net.Conn) *session {
+	s := &session{server: server}
+	_, s.tls = conn.(*tls.Conn)
+	s.setConn(conn)
+	return s
+}
+
+func (s *session) setConn(conn net.Conn) {
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+	s.w = bufio.NewWriter(conn)
+}
+
+func (s *session) serve() {
+	defer func() {
+		if s.drop != nil {
+			s.server.unlock(s.drop.name)
+		}
+	}()
+
+	s.ok("MailCat POP3 server ready")
+	if s.w.Flush() != nil {
+		return
+	}
+
+	for {
+		timeout := autologoutTimeout
+		if s.drop == nil {
+			timeout = loginTimeout
+		}
+		s.conn.SetDeadline(time.Now().Add(timeout))
+
+		line, err := s.readLine()
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				s.err("Command line too long")
+				s.w.Flush()
+			}
+			return
+		}
+
+		name, arg, _ := strings.Cut(line, " ")
+		err = s.handle(strings.ToUpper(name), arg)
+		if flushErr := s.w.Flush(); flushErr != nil {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, errQuit) {
+				log.Printf("POP3 session error: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// readLine 读取一行命令，去掉结尾的 CRLF
+func (s *session) readLine() (string, error) {
+	line, err := s.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || len(line) > maxLineLength {
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// handle 执行一条命令，返回错误时关闭连接
+func (s *session) handle(name, arg string) error {
+	switch name {
+	case "CAPA":
+		s.ok("Capability list follows")
+		for _, capability := range s.capabilities() {
+			s.w.WriteString(capability + "\r\n")
+		}
+		s.w.WriteString(".\r\n")
+		return nil
+	case "QUIT":
+		return s.handleQuit()
+	}
+
+	if s.drop == nil {
+		switch name {
+		case "STLS":
+			return s.handleSTLS()
+		case "USER":
+			return s.handleUser(arg)
+		case "PASS":
+			return s.handlePass(arg)
+		case "AUTH":
+			return s.handleAuth(arg)
+		}
+		s.err("Unknown command or not authenticated")
+		return nil
+	}
+
+	switch name {
+	case "STAT":
+		count, size := 0, 0
+		for _, msg := range s.messages {
+			if !msg.deleted {
+				count++
+				size += msg.size
+			}
+		}
+		s.ok(fmt.Sprintf("%d %d", count, size))
+		return nil
+	case "LIST", "UIDL":
+		return s.handleList(name, arg)
+	case "RETR":
+		return s.handleRetr(arg)
+	case "TOP":
+		return s.handleTop(arg)
+	case "DELE":
+		n, msg := s.message(arg)
+		if msg == nil {
+			return nil
+		}
+		msg.deleted = true
+		s.ok(fmt.Sprintf("Message %d deleted", n))
+		return nil
+	case "RSET":
+		for i := range s.messages {
+			s.messages[i].deleted = false
+		}
+		s.ok(fmt.Sprintf("Maildrop has %d messages", len(s.messages)))
+		return nil
+	case "NOOP":
+		s.ok("")
+		return nil
+	}
+
+	s.err("Unknown command")
+	return nil
+}
+
+func (s *session) capabilities() []string {
+	caps := []string{"TOP", "UIDL", "RESP-CODES", "AUTH-RESP-CODE", "PIPELINING"}
+	if s.drop == nil {
+		if s.server.opts.TLSConfig != nil && !s.tls {
+			caps = append(caps, "STLS")
+		}
+		if s.canLogin() {
+			caps = append(caps, "USER", "SASL PLAIN")
+		}
+	}
+	return append(caps, "IMPLEMENTATION MailCat")
+}
+
+// canLogin 配置了 TLS 时只允许在加密连接上登录，除非显式允许明文登录
+func (s *session) canLogin() bool {
+	return s.tls || s.server.opts.TLSConfig == nil || s.server.opts.AllowInsecureAuth
+}
+
+func (s *session) ok(text string) {
+	if text == "" {
+		s.w.WriteString("+OK\r\n")
+		return
+	}
+	s.w.WriteString("+OK " + text + "\r\n")
+}
+
+func (s *session) err(text string) {
+	s.w.WriteString("-ERR " + text + "\r\n")
+}
+
+func (s *session) handleSTLS() error {
+	if s.server.opts.TLSConfig == nil || s.tls {
+		s.err("STLS not available")
+		return nil
+	}
+	// STLS 之后不能处理握手前已缓冲的明文数据，防止命令注入
+	if s.r.Buffered() > 0 {
+		s.err("Unexpected data after STLS")
+		return errQuit
+	}
+
+	s.ok("Begin TLS negotiation")
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	tlsConn := tls.Server(s.conn, s.server.opts.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	s.tls = true
+	s.username = ""
+	s.setConn(tlsConn)
+	return nil
+}
+
+func (s *session) handleUser(arg string) error {
+	if !s.canLogin() {
+		s.err("[AUTH] Use STLS before logging in")
+		return nil
+	}
+	if arg == "" {
+		s.err("USER expects a username")
+		return nil
+	}
+	s.username = arg
+	s.ok("Send password")
+	return nil
+}
+
+func (s *session) handlePass(arg string) error {
+	if s.username == "" {
+		s.err("USER required first")
+		return nil
+	}
+	username := s.username
+	s.username = ""
+	return s.login(username, arg)
+}
+
+// handleAuth 支持 AUTH PLAIN（RFC 5034），初始响应可以在命令中给出或在继续请求后发送
+func (s *session) handleAuth(arg string) error {
+	mechanism, response, hasResponse := strings.Cut(arg, " ")
+	if !strings.EqualFold(mechanism, "PLAIN") {
+		s.err("Unsupported authentication mechanism")
+		return nil
+	}
+	if !s.canLogin() {
+		s.err("[AUTH] Use STLS before logging in")
+		return nil
+	}
+
+	if !hasResponse {
+		s.w.WriteString("+ \r\n")
+		if err := s.w.Flush(); err != nil {
+			return err
+		}
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		response = line
+	}
+	if response == "*" {
+		s.err("Authentication cancelled")
+		return nil
+	}
+	if response == "=" {
+		response = ""
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		s.err("Invalid base64 response")
+		return nil
+	}
+	parts := bytes.Split(decoded, []byte{0})
+	if len(parts) != 3 || (len(parts[0]) > 0 && !bytes.Equal(parts[0], parts[1])) {
+		s.err("[AUTH] Invalid PLAIN response")
+		return nil
+	}
+	return s.login(string(parts[1]), string(parts[2]))
+}
+
+func (s *session) login(username, password string) error {
+	drop := s.server.authenticate(username, password, remoteIP(s.conn))
+	if drop == nil {
+		s.failures++
+		// 延迟响应以减缓暴力破解
+		time.Sleep(time.Second)
+		s.err("[AUTH] Invalid credentials")
+		if s.failures >= maxLoginFailures {
+			return errQuit
+		}
+		return nil
+	}
+
+	if !s.server.lock(drop.name) {
+		s.err("[IN-USE] Maildrop is already in use")
+		return nil
+	}
+	messages, err := s.loadMaildrop(drop.filter)
+	if err != nil {
+		s.server.unlock(drop.name)
+		s.err("[SYS/TEMP] Failed to open maildrop")
+		return err
+	}
+
+	s.drop = drop
+	s.messages = messages
+	s.ok(fmt.Sprintf("Maildrop has %d messages", len(messages)))
+	return nil
+}
+
+// loadMaildrop 读取邮箱快照并计算每封邮件的大小（按 RETR 返回的内容计算，不含点填充）
+func (s *session) loadMaildrop(filter models.EmailFilter) ([]maildropMessage, error) {
+	states, err := s.server.db.ListEmailStates(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]maildropMessage, len(states))
+	index := make(map[int]int, len(states))
+	for i, state := range states {
+		messages[i].id = state.ID
+		index[state.ID] = i
+	}
+
+	for start := 0; start < len(states); start += loadBatchSize {
+		end := start + loadBatchSize
+		if end > len(states) {
+			end = len(states)
+		}
+		ids := make([]int, 0, end-start)
+		for _, state := range states[start:end] {
+			ids = append(ids, state.ID)
+		}
+		err := s.server.db.ForEachEmail(models.EmailFilter{Folder: models.FolderAll, IDs: ids}, func(email *models.Email) error {
+			messages[index[email.ID]].size = len(messageContent(email))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// message 解析消息编号，编号无效或邮件已标记删除时输出错误并返回 nil
+func (s *session) message(arg string) (int, *maildropMessage) {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil || n < 1 || n > len(s.messages) {
+		s.err("No such message")
+		return 0, nil
+	}
+	msg := &s.messages[n-1]
+	if msg.deleted {
+		s.err(fmt.Sprintf("Message %d already deleted", n))
+		return 0, nil
+	}
+	return n, msg
+}
+
+// handleList 处理 LIST 和 UIDL，UIDL 使用邮件 ID 作为唯一标识
+func (s *session) handleList(name, arg string) error {
+	value := func(msg *maildropMessage) string {
+		if name == "UIDL" {
+			return strconv.Itoa(msg.id)
+		}
+		return strconv.Itoa(msg.size)
+	}
+
+	if arg != "" {
+		n, msg := s.message(arg)
+		if msg != nil {
+			s.ok(fmt.Sprintf("%d %s", n, value(msg)))
+		}
+		return nil
+	}
+
+	s.ok("Listing follows")
+	for i := range s.messages {
+		if !s.messages[i].deleted {
+			s.w.WriteString(fmt.Sprintf("%d %s\r\n", i+1, value(&s.messages[i])))
+		}
+	}
+	s.w.WriteString(".\r\n")
+	return nil
+}
+
+func (s *session) handleRetr(arg string) error {
+	_, msg := s.message(arg)
+	if msg == nil {
+		return nil
+	}
+	email, ok := s.loadMessage(msg)
+	if !ok {
+		return nil
+	}
+
+	content := messageContent(email)
+	s.ok(fmt.Sprintf("%d octets", len(content)))
+	writeMultiline(s.w, content)
+
+	// 与 IMAP 的 \Seen 一致，取回的邮件标记为已读
+	if !email.IsRead {
+		if err := s.server.db.SetEmailsRead([]int{email.ID}, true); err != nil {
+			log.Printf("POP3 failed to mark email %d as read: %v", email.ID, err)
+		}
+	}
+	return nil
+}
+
+// handleTop 返回邮件头部和正文的前 n 行
+func (s *session) handleTop(arg string) error {
+	msgArg, linesArg, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	lines, err := strconv.Atoi(strings.TrimSpace(linesArg))
+	if err != nil || lines < 0 {
+		s.err("TOP expects a message number and a line count")
+		return nil
+	}
+	_, msg := s.message(msgArg)
+	if msg == nil {
+		return nil
+	}
+	email, ok := s.loadMessage(msg)
+	if !ok {
+		return nil
+	}
+
+	content := messageContent(email)
+	cut := len(content)
+	if i := bytes.Index(content, []byte("\r\n\r\n")); i >= 0 {
+		cut = i + 4
+		for n := 0; n < lines && cut < len(content); n++ {
+			cut += bytes.Index(content[cut:], []byte("\r\n")) + 2
+		}
+	}
+
+	s.ok("Top of message follows")
+	writeMultiline(s.w, content[:cut])
+	return nil
+}
+
+// loadMessage 读取快照中的邮件，邮件已被其他途径删除时输出错误
+func (s *session) loadMessage(msg *maildropMessage) (*models.Email, bool) {
+	email, err := s.server.db.GetEmailByID(msg.id)
+	if err != nil {
+		s.err("Message no longer available")
+		return nil, false
+	}
+	return email, true
+}
+
+// handleQuit 在 TRANSACTION 状态下将标记删除的邮件移入回收站（RFC 1939 UPDATE 状态）
+func (s *session) handleQuit() error {
+	if s.drop == nil {
+		s.ok("MailCat POP3 server signing off")
+		return errQuit
+	}
+
+	var ids []int
+	for _, msg := range s.messages {
+		if msg.deleted {
+			ids = append(ids, msg.id)
+		}
+	}
+	if err := s.server.db.MoveEmails(ids, models.FolderTrash); err != nil {
+		log.Printf("POP3 failed to delete messages: %v", err)
+		s.err("[SYS/TEMP] Some deleted messages not removed")
+		return errQuit
+	}
+
+	remaining := len(s.messages) - len(ids)
+	s.ok(fmt.Sprintf("MailCat POP3 server signing off (%d messages left)", remaining))
+	return errQuit
+}
+
+// messageContent 返回 RETR 使用的邮件内容，以 CRLF 结尾
+func messageContent(email *models.Email) []byte {
+	content := message.RawCRLF(email)
+	if !bytes.HasSuffix(content, []byte("\r\n")) {
+		content = append(content, '\r', '\n')
+	}
+	return content
+}
+
+// writeMultiline 写出多行响应：以 . 开头的行进行点填充，最后以单独的 . 结束
+func writeMultiline(w *bufio.Writer, content []byte) {
+	for len(content) > 0 {
+		end := bytes.Index(content, []byte("\r\n"))
+		line := content
+		if end >= 0 {
+			line = content[:end+2]
+		}
+		if line[0] == '.' {
+			w.WriteByte('.')
+		}
+		w.Write(line)
+		content = content[len(line):]
+	}
+	w.WriteString(".\r\n")
+}
@@ -0,0 +1,385 @@
+package pop3
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mailcat/internal/audit"
+	"mailcat/internal/database"
+	"mailcat/internal/lockout"
+	"mailcat/internal/models"
+)
+
+// testTLSConfig 生成 localhost 的自签名证书，返回服务端配置和信任该证书的客户端配置
+func testTLSConfig(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: roots, ServerName: "localhost"}
+}
+
+// newTestServer 在本地端口上启动 POP3 服务，配置 serverTLS 时要求 STLS 后登录，bob 以邮箱令牌登录；
+// alice 是管理员，密码为 alice-pw；登录结果写入审计日志，loginLockout 为 nil 时不跨连接锁定
+func newTestServer(t *testing.T, serverTLS *tls.Config, loginLockout *lockout.Lockout) (string, *database.DB) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	auditLogger, err := audit.New(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(db, Options{
+		TLSConfig:  serverTLS,
+		CheckAdmin: func(username, password string) bool { return username == "alice" && password == "alice-pw" },
+		Lockout:    loginLockout,
+		Audit:      auditLogger,
+		Mailboxes:  []Mailbox{{Name: "bob", Address: "bob@example.com", Token: "bob-token"}},
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String(), db
+}
+
+// testClient 逐行读取响应的 POP3 客户端
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	if greeting := c.readLine(); !strings.HasPrefix(greeting, "+OK") {
+		t.Fatalf("greeting = %q", greeting)
+	}
+	return c
+}
+
+func (c *testClient) readLine() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read: %v (partial %q)", err, line)
+	}
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// cmd 发送命令并返回单行响应
+func (c *testClient) cmd(command string) string {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(command + "\r\n")); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.readLine()
+}
+
+// expect 发送命令，要求响应以 prefix 开头
+func (c *testClient) expect(command, prefix string) string {
+	c.t.Helper()
+	line := c.cmd(command)
+	if !strings.HasPrefix(line, prefix) {
+		c.t.Fatalf("%s = %q, want %s", command, line, prefix)
+	}
+	return line
+}
+
+// multiline 读取多行响应的内容，保留线路上的点填充，不含结尾的 "."
+func (c *testClient) multiline() string {
+	c.t.Helper()
+	var b strings.Builder
+	for {
+		line := c.readLine()
+		if line == "." {
+			return b.String()
+		}
+		b.WriteString(line + "\r\n")
+	}
+}
+
+// waitClosed 等待服务端关闭连接，此时会话已释放邮箱锁
+func (c *testClient) waitClosed() {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.r.ReadString('\n'); err != io.EOF {
+		c.t.Fatalf("connection not closed: %v", err)
+	}
+}
+
+func (c *testClient) login() {
+	c.t.Helper()
+	c.expect("USER bob", "+OK")
+	c.expect("PASS bob-token", "+OK")
+}
+
+func saveEmails(t *testing.T, db *database.DB, requests ...*models.EmailRequest) []int {
+	var ids []int
+	for _, req := range requests {
+		email, err := db.SaveEmail(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, email.ID)
+	}
+	return ids
+}
+
+func rawEmail(to, subject, body string) *models.EmailRequest {
+	return &models.EmailRequest{
+		From:    "sender@example.com",
+		To:      to,
+		Subject: subject,
+		RawEmail: "From: sender@example.com\r\nTo: " + to + "\r\nSubject: " + subject +
+			"\r\nDate: Mon, 02 Jan 2006 15:04:05 +0000\r\n\r\n" + body,
+	}
+}
+
+func folder(t *testing.T, db *database.DB, id int) string {
+	t.Helper()
+	email, err := db.GetEmailByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return email.Folder
+}
+
+func TestSession(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfig(t)
+	addr, db := newTestServer(t, serverTLS, nil)
+	ids := saveEmails(t, db,
+		rawEmail("bob@example.com", "first", "hello\r\n"),
+		rawEmail("alice@example.com", "private", "not for bob\r\n"),
+		rawEmail("bob@example.com", "dots", ".leading dot\r\n.\r\n..two dots\r\nlast line without CRLF"),
+		rawEmail("jimbob@example.com", "similar", "not for bob either\r\n"),
+	)
+	first, dots := strconv.Itoa(ids[0]), strconv.Itoa(ids[2])
+
+	c := dial(t, addr)
+	c.cmd("CAPA")
+	if capa := c.multiline(); !strings.Contains(capa, "STLS\r\n") || strings.Contains(capa, "USER") {
+		t.Errorf("CAPA before STLS = %q", capa)
+	}
+	c.expect("USER bob", "-ERR [AUTH]")
+
+	// STLS 之后在同一连接上握手，会话重新开始
+	c.expect("STLS", "+OK")
+	tlsConn := tls.Client(c.conn, clientTLS)
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("TLS handshake: %v", err)
+	}
+	c.conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	c.cmd("CAPA")
+	if capa := c.multiline(); strings.Contains(capa, "STLS") || !strings.Contains(capa, "USER\r\n") {
+		t.Errorf("CAPA after STLS = %q", capa)
+	}
+	c.expect("STLS", "-ERR")
+	c.expect("PASS bob-token", "-ERR USER required first")
+	c.login()
+
+	// UIDL 使用邮件 ID，不包含其他收件人（包括地址中含有 bob@example.com 的）的邮件
+	c.expect("UIDL", "+OK")
+	if uidl := c.multiline(); uidl != "1 "+first+"\r\n2 "+dots+"\r\n" {
+		t.Errorf("UIDL = %q", uidl)
+	}
+	if line := c.cmd("UIDL 2"); line != "+OK 2 "+dots {
+		t.Errorf("UIDL 2 = %q", line)
+	}
+	c.expect("LIST 3", "-ERR No such message")
+
+	// RETR 对以 . 开头的行进行点填充，大小按填充前的内容计算，取回后标记为已读
+	line := c.expect("RETR 2", "+OK")
+	body := c.multiline()
+	wantBody := "\r\n..leading dot\r\n..\r\n...two dots\r\nlast line without CRLF\r\n"
+	if !strings.HasSuffix(body, wantBody) || !strings.HasPrefix(body, "From: sender@example.com\r\n") {
+		t.Errorf("RETR 2 = %q, want a body ending in %q", body, wantBody)
+	}
+	unstuffed := strings.ReplaceAll("\r\n"+body, "\r\n.", "\r\n")[2:]
+	if line != "+OK "+strconv.Itoa(len(unstuffed))+" octets" {
+		t.Errorf("RETR 2 = %q, content has %d octets", line, len(unstuffed))
+	}
+	if email, _ := db.GetEmailByID(ids[2]); !email.IsRead {
+		t.Error("RETR did not mark the message as read")
+	}
+	if line := c.cmd("LIST 2"); line != "+OK 2 "+strconv.Itoa(len(unstuffed)) {
+		t.Errorf("LIST 2 = %q, want the RETR size", line)
+	}
+
+	c.expect("TOP 1 0", "+OK")
+	if top := c.multiline(); !strings.HasSuffix(top, "Subject: first\r\nDate: Mon, 02 Jan 2006 15:04:05 +0000\r\n\r\n") {
+		t.Errorf("TOP 1 0 = %q", top)
+	}
+
+	// RSET 撤销 DELE
+	c.expect("DELE 1", "+OK")
+	c.expect("DELE 1", "-ERR Message 1 already deleted")
+	c.expect("RETR 1", "-ERR")
+	if line := c.cmd("STAT"); !strings.HasPrefix(line, "+OK 1 ") {
+		t.Errorf("STAT after DELE = %q", line)
+	}
+	c.expect("RSET", "+OK Maildrop has 2 messages")
+	if line := c.cmd("STAT"); !strings.HasPrefix(line, "+OK 2 ") {
+		t.Errorf("STAT after RSET = %q", line)
+	}
+
+	// QUIT 时标记删除的邮件移入回收站
+	c.expect("DELE 1", "+OK")
+	if line := c.cmd("QUIT"); line != "+OK MailCat POP3 server signing off (1 messages left)" {
+		t.Errorf("QUIT = %q", line)
+	}
+	if got := folder(t, db, ids[0]); got != models.FolderTrash {
+		t.Errorf("deleted message is in %q, want trash", got)
+	}
+	if got := folder(t, db, ids[2]); got != models.FolderInbox {
+		t.Errorf("kept message is in %q, want inbox", got)
+	}
+
+	// 重新登录后消息编号变化，UIDL 不变；未 QUIT 就断开时不删除邮件
+	c = dial(t, addr)
+	c.expect("STLS", "+OK")
+	tlsConn = tls.Client(c.conn, clientTLS)
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("TLS handshake: %v", err)
+	}
+	c.conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	c.login()
+	if line := c.cmd("UIDL 1"); line != "+OK 1 "+dots {
+		t.Errorf("UIDL 1 after deletion = %q", line)
+	}
+	c.expect("DELE 1", "+OK")
+	c.conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	if got := folder(t, db, ids[2]); got != models.FolderInbox {
+		t.Errorf("message deleted without QUIT is in %q", got)
+	}
+}
+
+func TestSessionRejectsDataAfterSTLS(t *testing.T) {
+	serverTLS, _ := testTLSConfig(t)
+	addr, _ := newTestServer(t, serverTLS, nil)
+
+	// STLS 后面紧跟的明文命令不能在握手后执行
+	c := dial(t, addr)
+	if line := c.cmd("STLS\r\nUSER bob"); line != "-ERR Unexpected data after STLS" {
+		t.Errorf("STLS with pipelined data = %q", line)
+	}
+}
+
+func TestSessionMaildropLock(t *testing.T) {
+	addr, db := newTestServer(t, nil, nil)
+	saveEmails(t, db, rawEmail("bob@example.com", "first", "hello\r\n"))
+
+	c := dial(t, addr)
+	c.login()
+	other := dial(t, addr)
+	other.expect("USER bob", "+OK")
+	other.expect("PASS bob-token", "-ERR [IN-USE]")
+
+	c.expect("QUIT", "+OK")
+	c.waitClosed()
+	other.expect("USER bob", "+OK")
+	other.expect("PASS bob-token", "+OK Maildrop has 1 messages")
+}
+
+func TestSessionLoginLockout(t *testing.T) {
+	loginLockout := lockout.New()
+	addr, db := newTestServer(t, nil, loginLockout)
+
+	// 之前的失败（例如管理后台登录）与 POP3 登录共用计数，重新连接不会重置
+	for i := 0; i < 4; i++ {
+		loginLockout.Fail("127.0.0.1")
+	}
+	c := dial(t, addr)
+	c.expect("USER bob", "+OK")
+	c.expect("PASS wrong", "-ERR [AUTH]")
+	c = dial(t, addr)
+	c.expect("USER bob", "+OK")
+	c.expect("PASS bob-token", "-ERR [AUTH]")
+
+	entries, _, err := db.ListAuditEntries(models.AuditQuery{Action: "pop3.login", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Actor+" "+entry.IP+" "+strconv.Itoa(entry.Status)+" "+strconv.FormatBool(entry.Success))
+	}
+	if want := "bob 127.0.0.1 429 false|bob 127.0.0.1 401 false"; strings.Join(got, "|") != want {
+		t.Errorf("audit entries = %q, want %q", got, want)
+	}
+}
+
+func TestSessionAdminLogin(t *testing.T) {
+	addr, db := newTestServer(t, nil, nil)
+	saveEmails(t, db,
+		rawEmail("bob@example.com", "first", "hello\r\n"),
+		rawEmail("qa+tag@example.com", "tagged", "hello\r\n"),
+		rawEmail("carol@example.com", "other", "hello\r\n"),
+	)
+
+	tests := []struct {
+		username string
+		response string
+	}{
+		{"alice", "+OK Maildrop has 3 messages"},
+		{"alice+bob@example.com", "+OK Maildrop has 1 messages"},
+		{"alice+QA+tag@example.com", "+OK Maildrop has 1 messages"}, // 以第一个 + 分隔，地址不区分大小写
+		{"bob@example.com", "-ERR [AUTH]"},                          // 不再以固定的 admin 账户校验收件人地址
+		{"admin+bob@example.com", "-ERR [AUTH]"},
+		{"+bob@example.com", "-ERR [AUTH]"},
+		{"alice+bob", "-ERR [AUTH]"},
+	}
+	for _, tt := range tests {
+		c := dial(t, addr)
+		c.expect("USER "+tt.username, "+OK")
+		if line := c.cmd("PASS alice-pw"); !strings.HasPrefix(line, tt.response) {
+			t.Errorf("login as %q = %q, want %s", tt.username, line, tt.response)
+		}
+		c.conn.Close()
+	}
+}
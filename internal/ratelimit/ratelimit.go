@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// 路由分组
+const (
+	GroupIngest = "ingest" // 推送邮件（POST /api/v1/emails）
+	GroupRead   = "read"   // 查询、导出
+	GroupWrite  = "write"  // 修改状态、删除
+)
+
+// 限流维度
+const (
+	ByKey = "key" // 按 API 密钥
+	ByIP  = "ip"  // 按客户端 IP
+)
+
+// errorLogInterval 存储后端出错时两次日志之间的最短间隔，避免后端不可用时刷屏
+const errorLogInterval = time.Minute
+
+// Rule 令牌桶规则：每分钟补充 RequestsPerMinute 个令牌，桶容量为 Burst
+type Rule struct {
+	RequestsPerMinute int
+	Burst             int
+}
+
+// Enabled 规则是否限流，RequestsPerMinute 不大于 0 时不限制
+func (r Rule) Enabled() bool {
+	return r.RequestsPerMinute > 0 && r.Burst > 0
+}
+
+// perSecond 每秒补充的令牌数
+func (r Rule) perSecond() float64 {
+	return float64(r.RequestsPerMinute) / 60
+}
+
+// Result 一次取令牌的结果
+type Result struct {
+	Allowed    bool
+	Limit      int           // 桶容量
+	Remaining  int           // 剩余令牌数（向下取整）
+	RetryAfter time.Duration // 被拒绝时，下一个令牌可用前需要等待的时间
+	Reset      time.Duration // 令牌桶补满需要的时间
+}
+
+// newResult 根据取令牌后的剩余令牌数计算结果
+func newResult(rule Rule, tokens float64, allowed bool) Result {
+	rate := rule.perSecond()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     rule.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(rule.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// Store 保存令牌桶状态。实现必须保证同一个 key 的取令牌操作是原子的
+type Store interface {
+	// Take 从 key 对应的令牌桶中取一个令牌，桶不存在时视为满桶
+	Take(ctx context.Context, key string, rule Rule) (Result, error)
+	Close() error
+}
+
+// Limiter 按路由分组和维度应用令牌桶规则
+type Limiter struct {
+	store Store
+	rules map[string]map[string]Rule // 分组 -> 维度 -> 规则
+
+	mu           sync.Mutex
+	lastErrorLog time.Time
+}
+
+// New 创建限流器，rules 中未配置或未启用的分组和维度不限流
+func New(store Store, rules map[string]map[string]Rule) *Limiter {
+	return &Limiter{store: store, rules: rules}
+}
+
+// Take 为 group 分组中 by 维度上标识为 id 的客户端取一个令牌，未配置规则时返回 false。
+// 存储后端出错时放行请求（限流不应导致 API 不可用），并记录日志
+func (l *Limiter) Take(ctx context.Context, group, by, id string) (Result, bool) {
+	rule, ok := l.rules[group][by]
+	if !ok || !rule.Enabled() {
+		return Result{}, false
+	}
+	result, err := l.store.Take(ctx, group+":"+by+":"+id, rule)
+	if err != nil {
+		l.logError(err)
+		return Result{}, false
+	}
+	return result, true
+}
+
+func (l *Limiter) logError(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastErrorLog) < errorLogInterval {
+		return
+	}
+	l.lastErrorLog = time.Now()
+	log.Printf("Rate limit store error, allowing requests: %v", err)
+}
+
+// Close 关闭存储后端
+func (l *Limiter) Close() error {
+	return l.store.Close()
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	rule := Rule{RequestsPerMinute: 60, Burst: 3}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		result, _ := store.Take(ctx, "k", rule)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("Take = %+v, want allowed with %d remaining", result, i)
+		}
+	}
+	result, _ := store.Take(ctx, "k", rule)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf("Take on an empty bucket = %+v, want rejected, retry after 1s, reset in 3s", result)
+	}
+	if other, _ := store.Take(ctx, "other", rule); !other.Allowed {
+		t.Error("Take rejected a different key")
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	if result, _ := store.Take(ctx, "k", rule); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Take after 1.5s = %+v, want allowed with 0 remaining", result)
+	}
+
+	now = now.Add(time.Hour)
+	store.Take(ctx, "k", rule)
+	if _, ok := store.buckets["other"]; ok {
+		t.Error("sweep kept a bucket that was already full")
+	}
+}
+
+func TestLimiterSkipsUnconfiguredRules(t *testing.T) {
+	limiter := New(NewMemoryStore(), map[string]map[string]Rule{
+		GroupRead: {ByKey: {RequestsPerMinute: 60, Burst: 1}, ByIP: {}},
+	})
+	ctx := context.Background()
+	if _, ok := limiter.Take(ctx, GroupRead, ByIP, "127.0.0.1"); ok {
+		t.Error("Take applied a disabled rule")
+	}
+	if _, ok := limiter.Take(ctx, GroupWrite, ByKey, "1"); ok {
+		t.Error("Take applied a rule for an unconfigured group")
+	}
+	if result, ok := limiter.Take(ctx, GroupRead, ByKey, "1"); !ok || !result.Allowed {
+		t.Errorf("Take = %+v, %v, want allowed", result, ok)
+	}
+	if result, _ := limiter.Take(ctx, GroupRead, ByKey, "1"); result.Allowed {
+		t.Error("Take allowed a request beyond the burst")
+	}
+}
+
+// fakeRedis 只实现限流用到的命令：EVALSHA 总是返回 NOSCRIPT，EVAL 按调用次数递减令牌
+func fakeRedis(t *testing.T) (string, *[]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var commands []string
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		tokens := 2
+		for {
+			reply, err := readReply(r)
+			if err != nil {
+				return
+			}
+			args := reply.([]interface{})
+			name := string(args[0].([]byte))
+			commands = append(commands, name)
+			switch name {
+			case "AUTH", "SELECT":
+				conn.Write([]byte("+OK\r\n"))
+			case "EVALSHA":
+				conn.Write([]byte("-NOSCRIPT No matching script. Please use EVAL.\r\n"))
+			case "EVAL":
+				allowed := 0
+				if tokens >= 1 {
+					tokens--
+					allowed = 1
+				}
+				count := strconv.Itoa(tokens) + ".5"
+				conn.Write([]byte("*2\r\n:" + strconv.Itoa(allowed) + "\r\n$" + strconv.Itoa(len(count)) + "\r\n" + count + "\r\n"))
+			default:
+				conn.Write([]byte("-ERR unknown command\r\n"))
+			}
+		}
+	}()
+	return listener.Addr().String(), &commands
+}
+
+func TestRedisStoreProtocol(t *testing.T) {
+	addr, commands := fakeRedis(t)
+	store := NewRedisStore(RedisOptions{Address: addr, Password: "secret", DB: 2})
+	defer store.Close()
+	rule := Rule{RequestsPerMinute: 60, Burst: 3}
+
+	result, err := store.Take(context.Background(), "read:key:1", rule)
+	if err != nil {
+		t.Fatalf("Take error: %v", err)
+	}
+	if !result.Allowed || result.Remaining != 1 || result.Reset != 1500*time.Millisecond {
+		t.Errorf("Take = %+v, want allowed with 1 remaining, reset in 1.5s", result)
+	}
+	if got, want := strings.Join(*commands, " "), "AUTH SELECT EVALSHA EVAL"; got != want {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+// TestRedisStore 在真实的 Redis 上运行令牌桶脚本，设置 MAILCAT_TEST_REDIS_ADDR（如 127.0.0.1:6379）时执行
+func TestRedisStore(t *testing.T) {
+	addr := os.Getenv("MAILCAT_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("MAILCAT_TEST_REDIS_ADDR is not set")
+	}
+	store := NewRedisStore(RedisOptions{Address: addr, KeyPrefix: "mailcat:test:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"})
+	defer store.Close()
+	ctx := context.Background()
+	if err := store.Ping(ctx); err != nil {
+		t.Fatalf("Ping error: %v", err)
+	}
+
+	rule := Rule{RequestsPerMinute: 1, Burst: 2}
+	for i := 1; i >= 0; i-- {
+		result, err := store.Take(ctx, "k", rule)
+		if err != nil {
+			t.Fatalf("Take error: %v", err)
+		}
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("Take = %+v, want allowed with %d remaining", result, i)
+		}
+	}
+	result, err := store.Take(ctx, "k", rule)
+	if err != nil {
+		t.Fatalf("Take error: %v", err)
+	}
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > time.Minute {
+		t.Errorf("Take on an empty bucket = %+v, want rejected with retry after up to 1m", result)
+	}
+}
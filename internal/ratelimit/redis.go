@@ -0,0 +1,284 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenBucketScript 在 Redis 中原子地补充并取出令牌。时间取自 Redis 的 TIME，
+// 多个实例共享状态时不受各自时钟偏差影响（需要 Redis 5+，或 3.2+ 的脚本效果复制）。
+// 令牌数以字符串返回，Lua 数值转换为整数回复时会丢失小数部分
+const tokenBucketScript = `
+redis.replicate_commands()
+local rate = tonumber(ARGV[1]) / 60000
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil or updated == nil then
+  tokens = burst
+  updated = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens))
+redis.call('HSET', KEYS[1], 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+// redisError Redis 返回的错误回复（-ERR ...），连接仍然可用
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// RedisOptions Redis 连接配置
+type RedisOptions struct {
+	Address   string // 形如 127.0.0.1:6379
+	Password  string
+	DB        int
+	KeyPrefix string
+	Timeout   time.Duration // 连接和单次命令的超时
+	PoolSize  int           // 保留的空闲连接数
+}
+
+// RedisStore 将令牌桶保存在 Redis 中，多个实例共享限流状态。
+// 使用 RESP 协议直接通信，不依赖第三方客户端
+type RedisStore struct {
+	opts      RedisOptions
+	scriptSHA string
+	idle      chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NewRedisStore 创建 Redis 存储，连接在第一次使用时建立
+func NewRedisStore(opts RedisOptions) *RedisStore {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 8
+	}
+	sum := sha1.Sum([]byte(tokenBucketScript))
+	return &RedisStore{
+		opts:      opts,
+		scriptSHA: hex.EncodeToString(sum[:]),
+		idle:      make(chan *redisConn, opts.PoolSize),
+	}
+}
+
+// Take 实现 Store。优先使用 EVALSHA，脚本未缓存时（NOSCRIPT）改用 EVAL 并由 Redis 缓存
+func (s *RedisStore) Take(ctx context.Context, key string, rule Rule) (Result, error) {
+	key = s.opts.KeyPrefix + key
+	rpm := strconv.Itoa(rule.RequestsPerMinute)
+	burst := strconv.Itoa(rule.Burst)
+
+	reply, err := s.do(ctx, "EVALSHA", s.scriptSHA, "1", key, rpm, burst)
+	var replyErr redisError
+	if errors.As(err, &replyErr) && strings.HasPrefix(string(replyErr), "NOSCRIPT") {
+		reply, err = s.do(ctx, "EVAL", tokenBucketScript, "1", key, rpm, burst)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("redis: unexpected script reply %v", reply)
+	}
+	allowed, ok := values[0].(int64)
+	if !ok {
+		return Result{}, fmt.Errorf("redis: unexpected script reply %v", reply)
+	}
+	tokensReply, ok := values[1].([]byte)
+	if !ok {
+		return Result{}, fmt.Errorf("redis: unexpected script reply %v", reply)
+	}
+	tokens, err := strconv.ParseFloat(string(tokensReply), 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("redis: invalid token count %q", tokensReply)
+	}
+	return newResult(rule, tokens, allowed == 1), nil
+}
+
+// Ping 检查 Redis 是否可用，用于就绪检查
+func (s *RedisStore) Ping(ctx context.Context) error {
+	_, err := s.do(ctx, "PING")
+	return err
+}
+
+// Close 关闭空闲连接
+func (s *RedisStore) Close() error {
+	for {
+		select {
+		case conn := <-s.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do 执行一条命令。网络或协议错误时丢弃连接，错误回复不影响连接复用
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(s.deadline(ctx), args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+	s.put(conn)
+	return reply, err
+}
+
+func (s *RedisStore) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(s.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return deadline
+}
+
+// get 取一个空闲连接，没有时新建连接并完成认证和选库
+func (s *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: s.opts.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", s.opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn)}
+	if s.opts.Password != "" {
+		if _, err := conn.do(s.deadline(ctx), "AUTH", s.opts.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis AUTH failed: %w", err)
+		}
+	}
+	if s.opts.DB != 0 {
+		if _, err := conn.do(s.deadline(ctx), "SELECT", strconv.Itoa(s.opts.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis SELECT failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// put 归还连接，空闲连接已满时关闭
+func (s *RedisStore) put(conn *redisConn) {
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// do 发送一条命令（RESP 数组）并读取回复
+func (c *redisConn) do(deadline time.Time, args ...string) (interface{}, error) {
+	c.SetDeadline(deadline)
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, fmt.Errorf("failed to send redis command: %w", err)
+	}
+	return readReply(c.r)
+}
+
+// readReply 读取一条 RESP 回复：简单字符串返回 string，整数返回 int64，
+// 批量字符串返回 []byte（空值为 nil），数组返回 []interface{}，错误回复返回 redisError。
+// 数组中的错误回复作为元素返回
+func readReply(r *bufio.Reader) (interface{}, error) {
+	reply, err := readValue(r)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(redisError); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+func readValue(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redis reply: %w", err)
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return redisError(payload), nil
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed integer %q", payload)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("failed to read redis reply: %w", err)
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
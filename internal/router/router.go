@@ -1,13 +1,34 @@
 package router
 
 import (
+	"mailcat/internal/apikeys"
+	"mailcat/internal/audit"
+	"mailcat/internal/config"
 	"mailcat/internal/database"
 	"mailcat/internal/handlers"
+	"mailcat/internal/health"
+	"mailcat/internal/imageproxy"
+	"mailcat/internal/importer"
+	"mailcat/internal/ingest"
+	"mailcat/internal/lockout"
+	"mailcat/internal/models"
+	"mailcat/internal/oidc"
+	"mailcat/internal/ratelimit"
+	"mailcat/internal/sessions"
+	"mailcat/internal/settings"
+	"mailcat/internal/users"
+	"mailcat/internal/utils"
 	"github.com/gin-gonic/gin"
+	"context"
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 )
 
-func SetupRouter(db *database.DB, authToken string, adminPassword string) *gin.Engine {
+// SetupRouter 创建路由；处理器的后台任务（如清理过期 session）在 ctx 取消后停止，
+// 这些任务计入 background，关闭数据库前需要等待其退出
+func SetupRouter(ctx context.Context, background *sync.WaitGroup, db *database.DB, cfg *config.Config, ingestPipeline *ingest.Pipeline, checker *health.Checker, store *settings.Store, userManager *users.Manager, auditLogger *audit.Logger, loginLockout *lockout.Lockout, limiter *ratelimit.Limiter) (*gin.Engine, error) {
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 	
@@ -33,8 +54,19 @@ func SetupRouter(db *database.DB, authToken string, adminPassword string) *gin.E
 	
 	// 同源部署，不启用 CORS（浏览器默认阻止跨域请求）
 
+	// 请求耗时指标
+	r.Use(handlers.MetricsMiddleware())
+
+	// 审计日志：登录、配置修改、API 密钥使用、邮件查看、导出和删除等操作
+	r.Use(handlers.AuditMiddleware(auditLogger))
+
 	// 请求体大小限制中间件
 	r.Use(func(c *gin.Context) {
+		// 邮件导入上传由处理器按 import.max_upload_mb 单独限制
+		if c.FullPath() == "/admin/api/import" {
+			c.Next()
+			return
+		}
 		if c.Request.ContentLength > 10*1024*1024 { // 10MB
 			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
 				"error": "Request body too large",
@@ -45,13 +77,44 @@ func SetupRouter(db *database.DB, authToken string, adminPassword string) *gin.E
 	})
 	
 	// 创建邮件处理器
-	emailHandler := handlers.NewEmailHandler(db, authToken)
+	keys := apikeys.NewManager(db, store)
+	inlineURLSecret, err := handlers.LoadInlineURLSecret(db, cfg.API.InlineURLSecret)
+	if err != nil {
+		return nil, err
+	}
+	emailHandler := handlers.NewEmailHandler(db, store, keys, ingestPipeline, utils.SanitizeOptions{
+		RemoteImages:  cfg.Sanitizer.RemoteImages,
+		ImageProxyURL: cfg.Sanitizer.ImageProxyURL,
+	}, inlineURLSecret)
 	
-	// 创建管理员处理器
-	adminHandler := handlers.NewAdminHandler(db, authToken, adminPassword)
+	// 历史邮件导入处理器
+	importHandler := handlers.NewImportHandler(importer.New(db, ingestPipeline), store)
+
+	// 创建管理员处理器，统计按配置的时区计算日期
+	location, err := time.LoadLocation(cfg.Server.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", cfg.Server.Timezone, err)
+	}
+	adminHandler := handlers.NewAdminHandler(db, store, keys, userManager, sessions.NewManager(db), loginLockout, location)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		adminHandler.CleanExpiredSessions(ctx)
+	}()
 	
 	// 公开端点
 	r.GET("/health", emailHandler.HealthCheck)
+
+	// 存活与就绪检查，就绪检查失败时返回 503
+	healthHandler := handlers.NewHealthHandler(checker)
+	r.GET("/health/live", healthHandler.Live)
+	r.GET("/health/ready", healthHandler.Ready)
+
+	// Prometheus 指标端点，可单独配置令牌
+	if cfg.Metrics.Enabled {
+		metricsHandler := handlers.NewMetricsHandler(db, cfg.Metrics.Token, adminHandler.ActiveSessions)
+		r.GET("/metrics", metricsHandler.Metrics)
+	}
 	
 	// 根路径重定向到管理员登录页面
 	r.GET("/", func(c *gin.Context) {
@@ -59,14 +122,38 @@ func SetupRouter(db *database.DB, authToken string, adminPassword string) *gin.E
 	})
 	
 	// API路由组
+	// 每个端点依次经过：按 IP 限流、API 密钥认证、按密钥限流
+	rateLimiter := handlers.NewRateLimiter(limiter)
+	apiAuth := func(group, scope string, next ...gin.HandlerFunc) []gin.HandlerFunc {
+		chain := []gin.HandlerFunc{rateLimiter.ByIP(group), emailHandler.AuthMiddleware(scope), rateLimiter.ByKey(group)}
+		return append(chain, next...)
+	}
 	api := r.Group("/api/v1")
 	{
-		// 邮件接收端点（需要认证）
-		api.POST("/emails", emailHandler.AuthMiddleware(), emailHandler.ReceiveEmail)
+		// 邮件接收端点（需要认证），配置了签名密钥时还需要 X-MailCat-Signature 签名
+		var receive []gin.HandlerFunc
+		if cfg.API.IngestSigningSecret != "" {
+			receive = append(receive, handlers.RequireSignature(cfg.API.IngestSigningSecret))
+		}
+		api.POST("/emails", apiAuth(ratelimit.GroupIngest, models.ScopeEmailsWrite, append(receive, emailHandler.ReceiveEmail)...)...)
 		
 		// 邮件读取端点（需要认证）
-		api.GET("/emails", emailHandler.AuthMiddleware(), emailHandler.GetEmails)
-		api.GET("/emails/:id", emailHandler.AuthMiddleware(), emailHandler.GetEmailByID)
+		api.GET("/emails", apiAuth(ratelimit.GroupRead, models.ScopeEmailsRead, emailHandler.GetEmails)...)
+		api.GET("/emails/:id", apiAuth(ratelimit.GroupRead, models.ScopeEmailsRead, emailHandler.GetEmailByID)...)
+		api.GET("/emails/:id/structure", apiAuth(ratelimit.GroupRead, models.ScopeEmailsRead, emailHandler.GetEmailStructure)...)
+		api.GET("/emails/:id/raw", apiAuth(ratelimit.GroupRead, models.ScopeEmailsRead, emailHandler.GetRawEmail)...)
+
+		// 已读、星标和标签状态
+		api.PATCH("/emails", apiAuth(ratelimit.GroupWrite, models.ScopeEmailsWrite, emailHandler.BulkUpdateEmailState)...)
+		api.PATCH("/emails/:id", apiAuth(ratelimit.GroupWrite, models.ScopeEmailsWrite, emailHandler.UpdateEmailState)...)
+		api.DELETE("/emails/:id", apiAuth(ratelimit.GroupWrite, models.ScopeEmailsDelete, emailHandler.DeleteEmail)...)
+		api.GET("/labels", apiAuth(ratelimit.GroupRead, models.ScopeEmailsRead, emailHandler.GetLabels)...)
+
+		// 批量导出（mbox 或 .eml 文件的 zip 压缩包）
+		api.GET("/export", apiAuth(ratelimit.GroupRead, models.ScopeEmailsRead, emailHandler.ExportEmails)...)
+
+		// 内嵌图片（cid:）端点，支持签名地址或 API 令牌
+		api.GET("/emails/:id/inline", rateLimiter.ByIP(ratelimit.GroupRead), emailHandler.InlineAuthMiddleware(), rateLimiter.ByKey(ratelimit.GroupRead), emailHandler.GetInlinePart)
 	}
 	
 	// 管理员路由组
@@ -82,20 +169,93 @@ func SetupRouter(db *database.DB, authToken string, adminPassword string) *gin.E
 		
 		// API 路由
 		admin.POST("/login", adminHandler.Login)
+		admin.POST("/login/totp", adminHandler.LoginTOTP)
 		admin.POST("/logout", adminHandler.Logout)
+		admin.GET("/login/methods", handlers.LoginMethods(cfg.OIDC.Enabled))
+
+		// OIDC 单点登录（授权码模式 + PKCE）
+		if cfg.OIDC.Enabled {
+			oidcHandler := handlers.NewOIDCHandler(oidc.New(oidc.Config{
+				Issuer:       cfg.OIDC.Issuer,
+				ClientID:     cfg.OIDC.ClientID,
+				ClientSecret: cfg.OIDC.ClientSecret,
+				RedirectURL:  cfg.OIDC.RedirectURL,
+				Scopes:       cfg.OIDC.Scopes,
+			}), userManager, adminHandler, cfg.OIDC)
+			background.Add(1)
+			go func() {
+				defer background.Done()
+				oidcHandler.CleanExpiredLogins(ctx)
+			}()
+			admin.GET("/oidc/login", oidcHandler.Login)
+			admin.GET("/oidc/callback", oidcHandler.Callback)
+		}
 		
 		// 管理员API路由
 		adminAPI := admin.Group("/api")
 		adminAPI.Use(adminHandler.AdminAuthMiddleware())
 		{
-			adminAPI.GET("/stats", adminHandler.GetStats)
+			// viewer 只能读取其邮箱中的邮件，admin 和 owner 可以修改，只有 owner 可以管理用户
+			manage := handlers.RequireRole(models.RoleOwner, models.RoleAdmin)
+			ownerOnly := handlers.RequireRole(models.RoleOwner)
+
+			adminAPI.GET("/me", adminHandler.CurrentUser)
+			adminAPI.GET("/stats", manage, adminHandler.GetStats)
 			adminAPI.GET("/emails", adminHandler.GetAdminEmails)
-			adminAPI.GET("/emails/:id", emailHandler.GetEmailByID)
-			adminAPI.GET("/config", adminHandler.GetConfig)
-			adminAPI.POST("/config", adminHandler.SaveConfig)
+			adminAPI.GET("/emails/:id", emailHandler.GetAdminEmailByID)
+			adminAPI.PATCH("/emails", manage, emailHandler.BulkUpdateEmailState)
+			adminAPI.PATCH("/emails/:id", manage, emailHandler.UpdateEmailState)
+			adminAPI.GET("/labels", emailHandler.GetLabels)
+			adminAPI.GET("/emails/:id/structure", emailHandler.GetEmailStructure)
+			adminAPI.GET("/emails/:id/raw", emailHandler.GetRawEmail)
+			adminAPI.GET("/export", emailHandler.ExportEmails)
+			adminAPI.POST("/import", manage, importHandler.ImportEmails)
+			adminAPI.GET("/config", manage, adminHandler.GetConfig)
+			adminAPI.POST("/config", manage, adminHandler.SaveConfig)
+
+			// API 密钥管理
+			apiKeyHandler := handlers.NewAPIKeyHandler(keys)
+			adminAPI.GET("/keys", manage, apiKeyHandler.ListAPIKeys)
+			adminAPI.POST("/keys", manage, apiKeyHandler.CreateAPIKey)
+			adminAPI.DELETE("/keys/:id", manage, apiKeyHandler.RevokeAPIKey)
+
+			// 用户管理
+			adminAPI.GET("/users", ownerOnly, adminHandler.ListUsers)
+			adminAPI.POST("/users", ownerOnly, adminHandler.CreateUser)
+			adminAPI.PATCH("/users/:id", ownerOnly, adminHandler.UpdateUser)
+			adminAPI.DELETE("/users/:id", ownerOnly, adminHandler.DeleteUser)
+			adminAPI.DELETE("/users/:id/totp", ownerOnly, adminHandler.ResetUserTOTP)
+
+			// 登录 session：查看、吊销、退出其他设备
+			adminAPI.GET("/sessions", adminHandler.ListSessions)
+			adminAPI.DELETE("/sessions/:id", adminHandler.RevokeSession)
+			adminAPI.POST("/sessions/revoke-others", adminHandler.RevokeOtherSessions)
+
+			// 审计日志查询
+			auditHandler := handlers.NewAuditHandler(auditLogger, location)
+			adminAPI.GET("/audit", ownerOnly, auditHandler.ListAuditLog)
+
+			// 当前用户的 TOTP 绑定
+			adminAPI.GET("/totp", adminHandler.GetTOTPStatus)
+			adminAPI.POST("/totp/setup", adminHandler.SetupTOTP)
+			adminAPI.POST("/totp/enable", adminHandler.EnableTOTP)
+			adminAPI.POST("/totp/disable", adminHandler.DisableTOTP)
+			adminAPI.POST("/totp/recovery-codes", adminHandler.RegenerateRecoveryCodes)
+
+			// 可选的远程图片代理
+			if cfg.ImageProxy.Enabled {
+				imageProxyHandler := handlers.NewImageProxyHandler(imageproxy.New(imageproxy.Options{
+					MaxBytes:             cfg.ImageProxy.MaxBytes,
+					Timeout:              time.Duration(cfg.ImageProxy.TimeoutSeconds) * time.Second,
+					CacheEntries:         cfg.ImageProxy.CacheEntries,
+					CacheTTL:             time.Duration(cfg.ImageProxy.CacheTTLSeconds) * time.Second,
+					AllowPrivateNetworks: cfg.ImageProxy.AllowPrivateNetworks,
+				}))
+				adminAPI.GET("/proxy/image", imageProxyHandler.ProxyImage)
+			}
 		}
 		
 	}
 	
-	return r
+	return r, nil
 }
\ No newline at end of file
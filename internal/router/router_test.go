@@ -0,0 +1,68 @@
+package router
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"mailcat/internal/audit"
+	"mailcat/internal/config"
+	"mailcat/internal/database"
+	"mailcat/internal/health"
+	"mailcat/internal/ingest"
+	"mailcat/internal/lockout"
+	"mailcat/internal/settings"
+	"mailcat/internal/users"
+)
+
+func TestSetupRouterStopsCleaners(t *testing.T) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{}
+	cfg.OIDC.Enabled = true
+	cfg.OIDC.Issuer = "https://idp.example.com"
+	store, err := settings.Load(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userManager, err := users.NewManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLogger, err := audit.New(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var background sync.WaitGroup
+	if _, err := SetupRouter(ctx, &background, db, cfg, ingest.New(db, nil), health.New(time.Second), store, userManager, auditLogger, lockout.New(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	// session 和 OIDC 登录的清理任务计入 background，ctx 取消前不会退出
+	select {
+	case <-done:
+		t.Fatal("background cleaners are not tracked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("background cleaners did not stop after ctx was cancelled")
+	}
+}
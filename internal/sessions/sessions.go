@@ -0,0 +1,140 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+)
+
+const (
+	// IdleTimeout 没有活动超过该时间的 session 失效，每次请求顺延
+	IdleTimeout = 24 * time.Hour
+	// MaxAge 无论是否活动，session 自创建起的最长有效期
+	MaxAge = 30 * 24 * time.Hour
+	// touchInterval 最近活动时间和有效期的最小写入间隔
+	touchInterval = time.Minute
+	// maxUserAgentLength 保存的 User-Agent 的最大长度（字符数）
+	maxUserAgentLength = 256
+)
+
+// Manager 管理后台的 session 保存在数据库中，重启后仍然有效，多个实例可以共享。
+// 数据库只保存 token 的 SHA-256 哈希
+type Manager struct {
+	db  *database.DB
+	now func() time.Time
+}
+
+// NewManager 创建 session 管理器
+func NewManager(db *database.DB) *Manager {
+	return &Manager{db: db, now: time.Now}
+}
+
+// Create 为用户创建 session，返回 token（只在此时可见）和 session
+func (m *Manager) Create(userID int, ip, userAgent string) (string, *models.AdminSession, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	now := m.now().UTC()
+	session := &models.AdminSession{
+		UserID:     userID,
+		IP:         ip,
+		UserAgent:  truncate(userAgent, maxUserAgentLength),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  expiry(now, now),
+	}
+	if err := m.db.CreateSession(session, hashToken(token)); err != nil {
+		return "", nil, err
+	}
+	return token, session, nil
+}
+
+// Validate 校验 token，返回未过期的 session，无效时返回 nil。
+// 有效的 session 会顺延有效期（滑动过期），同时记录最近活动时间和 IP
+func (m *Manager) Validate(token, ip string) (*models.AdminSession, error) {
+	if token == "" {
+		return nil, nil
+	}
+	session, err := m.db.GetSessionByHash(hashToken(token))
+	if err != nil || session == nil {
+		return nil, err
+	}
+	now := m.now().UTC()
+	if !now.Before(session.ExpiresAt) {
+		return nil, nil
+	}
+
+	if now.Sub(session.LastSeenAt) >= touchInterval || session.IP != ip {
+		session.LastSeenAt = now
+		session.ExpiresAt = expiry(session.CreatedAt, now)
+		session.IP = ip
+		if err := m.db.TouchSession(session.ID, ip, session.LastSeenAt, session.ExpiresAt); err != nil {
+			log.Printf("Failed to record session activity: %v", err)
+		}
+	}
+	return session, nil
+}
+
+// List 返回未过期的 session，userID 为 0 时返回所有用户的 session
+func (m *Manager) List(userID int) ([]models.AdminSession, error) {
+	return m.db.ListSessions(userID, m.now())
+}
+
+// Revoke 吊销 session，userID 非 0 时只能吊销该用户的 session；不存在时返回 false
+func (m *Manager) Revoke(id, userID int) (bool, error) {
+	return m.db.DeleteSession(id, userID)
+}
+
+// RevokeToken 吊销 token 对应的 session（登出）
+func (m *Manager) RevokeToken(token string) error {
+	if token == "" {
+		return nil
+	}
+	return m.db.DeleteSessionByHash(hashToken(token))
+}
+
+// RevokeUser 吊销用户的所有 session，exceptID 非 0 时保留该 session，返回吊销的数量
+func (m *Manager) RevokeUser(userID, exceptID int) (int64, error) {
+	return m.db.DeleteUserSessions(userID, exceptID)
+}
+
+// DeleteExpired 删除已过期的 session
+func (m *Manager) DeleteExpired() (int64, error) {
+	return m.db.DeleteExpiredSessions(m.now())
+}
+
+// Count 返回未过期的 session 数
+func (m *Manager) Count() (int, error) {
+	return m.db.CountSessions(m.now())
+}
+
+// expiry 计算滑动过期时间，不超过创建后 MaxAge
+func expiry(created, now time.Time) time.Time {
+	expires := now.Add(IdleTimeout)
+	if limit := created.Add(MaxAge); expires.After(limit) {
+		return limit
+	}
+	return expires
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,257 @@
+package sessions
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+	"mailcat/internal/users"
+)
+
+// newTestManager 创建使用临时数据库的管理器，返回的时钟指针可以在测试中推进
+func newTestManager(t *testing.T) (*Manager, *users.Manager, *time.Time) {
+	t.Helper()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	userManager, err := users.NewManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewManager(db)
+	m.now = func() time.Time { return now }
+	return m, userManager, &now
+}
+
+func createUser(t *testing.T, userManager *users.Manager, username string) *models.User {
+	t.Helper()
+	user, err := userManager.Create(models.CreateUserRequest{Username: username, Password: "password-" + username, Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestValidateSlidingExpiry(t *testing.T) {
+	m, userManager, now := newTestManager(t)
+	user := createUser(t, userManager, "alice")
+	token, session, err := m.Create(user.ID, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(IdleTimeout); !session.ExpiresAt.Equal(want) {
+		t.Fatalf("ExpiresAt = %v, want %v", session.ExpiresAt, want)
+	}
+
+	// 在空闲超时之前活动，有效期顺延
+	*now = now.Add(IdleTimeout - time.Hour)
+	got, err := m.Validate(token, "192.0.2.1")
+	if err != nil || got == nil {
+		t.Fatalf("Validate() = %v, %v", got, err)
+	}
+	if want := now.Add(IdleTimeout); !got.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt after activity = %v, want %v", got.ExpiresAt, want)
+	}
+
+	// touchInterval 内的同一 IP 不写入数据库，有效期不变
+	*now = now.Add(touchInterval / 2)
+	got, err = m.Validate(token, "192.0.2.1")
+	if err != nil || got == nil {
+		t.Fatalf("Validate() = %v, %v", got, err)
+	}
+	if want := now.Add(-touchInterval / 2).Add(IdleTimeout); !got.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt within touch interval = %v, want %v", got.ExpiresAt, want)
+	}
+
+	// IP 变化立即记录
+	got, err = m.Validate(token, "192.0.2.2")
+	if err != nil || got == nil {
+		t.Fatalf("Validate() = %v, %v", got, err)
+	}
+	if got.IP != "192.0.2.2" || !got.ExpiresAt.Equal(now.Add(IdleTimeout)) {
+		t.Errorf("session after IP change = %s %v", got.IP, got.ExpiresAt)
+	}
+
+	// 空闲超过 IdleTimeout 后失效
+	*now = now.Add(IdleTimeout)
+	if got, err := m.Validate(token, "192.0.2.2"); err != nil || got != nil {
+		t.Errorf("Validate() after idle timeout = %v, %v, want nil", got, err)
+	}
+}
+
+func TestValidateMaxAge(t *testing.T) {
+	m, userManager, now := newTestManager(t)
+	user := createUser(t, userManager, "alice")
+	created := *now
+	token, _, err := m.Create(user.ID, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 持续活动也不能超过 MaxAge
+	limit := created.Add(MaxAge)
+	for now.Before(limit.Add(-IdleTimeout / 2)) {
+		*now = now.Add(IdleTimeout / 2)
+		got, err := m.Validate(token, "192.0.2.1")
+		if err != nil || got == nil {
+			t.Fatalf("Validate() at %v = %v, %v", now, got, err)
+		}
+		if got.ExpiresAt.After(limit) {
+			t.Fatalf("ExpiresAt = %v, exceeds MaxAge limit %v", got.ExpiresAt, limit)
+		}
+	}
+	got, err := m.Validate(token, "192.0.2.1")
+	if err != nil || got == nil {
+		t.Fatalf("Validate() = %v, %v", got, err)
+	}
+	if !got.ExpiresAt.Equal(limit) {
+		t.Errorf("ExpiresAt near MaxAge = %v, want %v", got.ExpiresAt, limit)
+	}
+
+	*now = limit
+	if got, err := m.Validate(token, "192.0.2.1"); err != nil || got != nil {
+		t.Errorf("Validate() at MaxAge = %v, %v, want nil", got, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"new session", created, created.Add(IdleTimeout)},
+		{"sliding", created.Add(48 * time.Hour), created.Add(72 * time.Hour)},
+		{"capped", created.Add(MaxAge - time.Hour), created.Add(MaxAge)},
+		{"past max age", created.Add(MaxAge + time.Hour), created.Add(MaxAge)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiry(created, tt.now); !got.Equal(tt.want) {
+				t.Errorf("expiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeScopedToUser(t *testing.T) {
+	m, userManager, _ := newTestManager(t)
+	alice := createUser(t, userManager, "alice")
+	bob := createUser(t, userManager, "bob")
+
+	aliceToken, aliceSession, err := m.Create(alice.ID, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobToken, bobSession, err := m.Create(bob.ID, "192.0.2.2", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不能以 alice 的身份吊销 bob 的 session
+	if revoked, err := m.Revoke(bobSession.ID, alice.ID); err != nil || revoked {
+		t.Fatalf("Revoke(bob, alice) = %v, %v, want false", revoked, err)
+	}
+	if got, _ := m.Validate(bobToken, "192.0.2.2"); got == nil {
+		t.Fatal("bob's session was revoked by another user")
+	}
+
+	list, err := m.List(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != aliceSession.ID {
+		t.Errorf("List(alice) = %+v, want only alice's session", list)
+	}
+	if all, err := m.List(0); err != nil || len(all) != 2 {
+		t.Errorf("List(0) = %d sessions, %v, want 2", len(all), err)
+	}
+
+	if revoked, err := m.Revoke(aliceSession.ID, alice.ID); err != nil || !revoked {
+		t.Fatalf("Revoke(alice, alice) = %v, %v, want true", revoked, err)
+	}
+	if got, _ := m.Validate(aliceToken, "192.0.2.1"); got != nil {
+		t.Error("revoked session still validates")
+	}
+	// userID 为 0 时不限制用户
+	if revoked, err := m.Revoke(bobSession.ID, 0); err != nil || !revoked {
+		t.Errorf("Revoke(bob, 0) = %v, %v, want true", revoked, err)
+	}
+}
+
+func TestRevokeUserExcept(t *testing.T) {
+	m, userManager, _ := newTestManager(t)
+	alice := createUser(t, userManager, "alice")
+	bob := createUser(t, userManager, "bob")
+
+	keepToken, keep, err := m.Create(alice.ID, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var others []string
+	for i := 0; i < 2; i++ {
+		token, _, err := m.Create(alice.ID, "192.0.2.1", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		others = append(others, token)
+	}
+	bobToken, _, err := m.Create(bob.ID, "192.0.2.2", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := m.RevokeUser(alice.ID, keep.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 2 {
+		t.Errorf("RevokeUser() = %d, want 2", revoked)
+	}
+	if got, _ := m.Validate(keepToken, "192.0.2.1"); got == nil {
+		t.Error("excepted session was revoked")
+	}
+	for _, token := range others {
+		if got, _ := m.Validate(token, "192.0.2.1"); got != nil {
+			t.Error("other session of the user still validates")
+		}
+	}
+	if got, _ := m.Validate(bobToken, "192.0.2.2"); got == nil {
+		t.Error("another user's session was revoked")
+	}
+
+	// exceptID 为 0 时吊销全部
+	if revoked, err := m.RevokeUser(alice.ID, 0); err != nil || revoked != 1 {
+		t.Errorf("RevokeUser(alice, 0) = %d, %v, want 1", revoked, err)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	m, userManager, now := newTestManager(t)
+	user := createUser(t, userManager, "alice")
+	if _, _, err := m.Create(user.ID, "192.0.2.1", "test"); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(IdleTimeout - time.Minute)
+	if _, _, err := m.Create(user.ID, "192.0.2.1", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(time.Hour)
+	if count, err := m.Count(); err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v, want 1", count, err)
+	}
+	if deleted, err := m.DeleteExpired(); err != nil || deleted != 1 {
+		t.Errorf("DeleteExpired() = %d, %v, want 1", deleted, err)
+	}
+	if list, err := m.List(0); err != nil || len(list) != 1 {
+		t.Errorf("List(0) = %d sessions, %v, want 1", len(list), err)
+	}
+}
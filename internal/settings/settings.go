@@ -0,0 +1,254 @@
+package settings
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"mailcat/internal/config"
+	"mailcat/internal/database"
+)
+
+// 可在运行时修改的设置项
+const (
+	KeyAPIToken           = "api_token"
+	KeyAdminPassword      = "admin_password" // 数据库中保存 SHA-256 哈希；只用于创建初始 owner 账户，不能再通过接口修改
+	KeySpamThreshold      = "spam_threshold"
+	KeyRemoteImages       = "remote_images"
+	KeyImportMaxUploadMB  = "import_max_upload_mb"
+	KeyRequireTOTP        = "require_totp"
+	KeyAuditRetentionDays = "audit_retention_days"
+)
+
+// Keys 可通过接口修改的设置项，按名称排序
+var Keys = []string{KeyAPIToken, KeyAuditRetentionDays, KeyImportMaxUploadMB, KeyRemoteImages, KeyRequireTOTP, KeySpamThreshold}
+
+const (
+	// minAPITokenLength 运行时设置的 API 令牌的最短长度
+	minAPITokenLength = 16
+)
+
+// Settings 当前生效的设置
+type Settings struct {
+	APIToken           string
+	AdminPasswordHash  string // 管理员密码的 SHA-256 十六进制，数据库中没有用户时用于创建 owner 账户
+	SpamThreshold      float64
+	RemoteImages       string
+	ImportMaxUploadMB  int64
+	RequireTOTP        bool // 所有管理后台用户都必须启用 TOTP
+	AuditRetentionDays int  // 审计日志保留天数
+}
+
+// Store 运行时设置：以 config.yaml（及环境变量）为基础，数据库中保存的值优先。
+// 修改后立即生效，并通知 OnChange 注册的回调
+type Store struct {
+	db   *database.DB
+	base Settings
+
+	mu        sync.RWMutex
+	overrides map[string]string // 数据库中保存的值
+	current   Settings
+	listeners []func(old, updated Settings)
+}
+
+// Load 读取配置和数据库中保存的设置。数据库中无效或未知的设置项会被忽略并记录日志
+func Load(db *database.DB, cfg *config.Config) (*Store, error) {
+	s := &Store{
+		db: db,
+		base: Settings{
+			APIToken:           cfg.API.AuthToken,
+			AdminPasswordHash:  HashPassword(cfg.Admin.Password),
+			SpamThreshold:      cfg.Spam.Threshold,
+			RemoteImages:       cfg.Sanitizer.RemoteImages,
+			ImportMaxUploadMB:  cfg.Import.MaxUploadMB,
+			RequireTOTP:        cfg.Admin.RequireTOTP,
+			AuditRetentionDays: cfg.Audit.RetentionDays,
+		},
+		overrides: make(map[string]string),
+	}
+
+	stored, err := db.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	s.current = s.base
+	for key, value := range stored {
+		if err := apply(&s.current, key, value); err != nil {
+			log.Printf("Ignoring stored setting %s: %v", key, err)
+			continue
+		}
+		s.overrides[key] = value
+	}
+	return s, nil
+}
+
+// Get 返回当前设置的副本
+func (s *Store) Get() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Overrides 返回保存在数据库中、覆盖了配置文件的设置项名称
+func (s *Store) Overrides() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.overrides))
+	for key := range s.overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// OnChange 注册设置修改后的回调，回调在 Update 返回前同步执行
+func (s *Store) OnChange(fn func(old, updated Settings)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Update 校验并保存设置：set 中的值写入数据库，
+// reset 中的设置项从数据库删除，恢复为配置文件中的值。保存成功后新设置立即生效
+func (s *Store) Update(set map[string]string, reset []string) (Settings, error) {
+	stored := make(map[string]string, len(set))
+	for key, value := range set {
+		value, err := validate(key, value)
+		if err != nil {
+			return Settings{}, err
+		}
+		stored[key] = value
+	}
+	for _, key := range reset {
+		if !isKey(key) {
+			return Settings{}, fmt.Errorf("unknown setting %q", key)
+		}
+		if _, ok := stored[key]; ok {
+			return Settings{}, fmt.Errorf("setting %q cannot be both set and reset", key)
+		}
+	}
+
+	s.mu.Lock()
+	old := s.current
+	overrides := make(map[string]string, len(s.overrides)+len(stored))
+	for key, value := range s.overrides {
+		overrides[key] = value
+	}
+	for key, value := range stored {
+		overrides[key] = value
+	}
+	for _, key := range reset {
+		delete(overrides, key)
+	}
+
+	updated := s.base
+	for key, value := range overrides {
+		if err := apply(&updated, key, value); err != nil {
+			s.mu.Unlock()
+			return Settings{}, err
+		}
+	}
+	if err := s.db.SaveSettings(stored, reset); err != nil {
+		s.mu.Unlock()
+		return Settings{}, err
+	}
+	s.overrides = overrides
+	s.current = updated
+	listeners := append([]func(old, updated Settings){}, s.listeners...)
+	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(old, updated)
+	}
+	return updated, nil
+}
+
+// HashPassword 计算密码的 SHA-256 十六进制（与前端登录时提交的值一致），空密码返回空字符串
+func HashPassword(password string) string {
+	if password == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// validate 校验用户提交的设置值，返回写入数据库的值
+func validate(key, value string) (string, error) {
+	switch key {
+	case KeyAPIToken:
+		if utf8.RuneCountInString(value) < minAPITokenLength {
+			return "", fmt.Errorf("api_token must be at least %d characters", minAPITokenLength)
+		}
+	case KeyAdminPassword:
+		return "", fmt.Errorf("admin_password is managed per user, use /admin/api/users")
+	}
+	var probe Settings
+	if err := apply(&probe, key, value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// apply 将数据库中保存的值写入 settings
+func apply(settings *Settings, key, value string) error {
+	switch key {
+	case KeyAPIToken:
+		if value == "" {
+			return fmt.Errorf("api_token must not be empty")
+		}
+		settings.APIToken = value
+	case KeyAdminPassword:
+		if len(value) != sha256.Size*2 {
+			return fmt.Errorf("admin_password hash is invalid")
+		}
+		settings.AdminPasswordHash = value
+	case KeySpamThreshold:
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 {
+			return fmt.Errorf("spam_threshold must be a positive number")
+		}
+		settings.SpamThreshold = threshold
+	case KeyRemoteImages:
+		switch value {
+		case "allow", "block", "proxy":
+		default:
+			return fmt.Errorf("remote_images must be one of allow, block, proxy")
+		}
+		settings.RemoteImages = value
+	case KeyImportMaxUploadMB:
+		mb, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || mb <= 0 {
+			return fmt.Errorf("import_max_upload_mb must be a positive integer")
+		}
+		settings.ImportMaxUploadMB = mb
+	case KeyRequireTOTP:
+		required, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("require_totp must be true or false")
+		}
+		settings.RequireTOTP = required
+	case KeyAuditRetentionDays:
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			return fmt.Errorf("audit_retention_days must be a positive integer")
+		}
+		settings.AuditRetentionDays = days
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+func isKey(key string) bool {
+	for _, k := range Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package settings
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"mailcat/internal/config"
+	"mailcat/internal/database"
+	"mailcat/internal/spam"
+)
+
+func testConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.API.AuthToken = "config-token"
+	cfg.Admin.Password = "password"
+	cfg.Spam.Threshold = 5
+	cfg.Sanitizer.RemoteImages = "proxy"
+	cfg.Import.MaxUploadMB = 100
+	cfg.Audit.RetentionDays = 90
+	return cfg
+}
+
+func newTestStore(t *testing.T) (*Store, *database.DB) {
+	t.Helper()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := Load(db, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, db
+}
+
+func TestStoredValuesOverrideConfig(t *testing.T) {
+	store, db := newTestStore(t)
+	base := store.Get()
+	if base.APIToken != "config-token" || base.RemoteImages != "proxy" || base.SpamThreshold != 5 {
+		t.Fatalf("settings without overrides = %+v", base)
+	}
+
+	updated, err := store.Update(map[string]string{
+		KeyAPIToken:     "stored-token-0123456789",
+		KeyRemoteImages: "block",
+		KeyRequireTOTP:  "true",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.APIToken != "stored-token-0123456789" || updated.RemoteImages != "block" || !updated.RequireTOTP {
+		t.Errorf("Update() = %+v", updated)
+	}
+	if updated.SpamThreshold != 5 || updated.AuditRetentionDays != 90 {
+		t.Errorf("settings that were not changed = %+v, want config values", updated)
+	}
+	if got := store.Get(); got != updated {
+		t.Errorf("Get() = %+v, want %+v", got, updated)
+	}
+	if got, want := store.Overrides(), []string{KeyAPIToken, KeyRemoteImages, KeyRequireTOTP}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Overrides() = %v, want %v", got, want)
+	}
+
+	// 重启后数据库中的值仍然优先
+	reloaded, err := Load(db, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Get(); got != updated {
+		t.Errorf("reloaded settings = %+v, want %+v", got, updated)
+	}
+
+	// reset 恢复为配置文件中的值，其余覆盖保留
+	updated, err = store.Update(nil, []string{KeyAPIToken, KeyRemoteImages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.APIToken != "config-token" || updated.RemoteImages != "proxy" || !updated.RequireTOTP {
+		t.Errorf("settings after reset = %+v", updated)
+	}
+	if got, want := store.Overrides(), []string{KeyRequireTOTP}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Overrides() after reset = %v, want %v", got, want)
+	}
+	reloaded, err = Load(db, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Get(); got != updated {
+		t.Errorf("reloaded settings after reset = %+v, want %+v", got, updated)
+	}
+}
+
+func TestLoadIgnoresInvalidStoredValues(t *testing.T) {
+	_, db := newTestStore(t)
+	if err := db.SaveSettings(map[string]string{KeySpamThreshold: "-1", "unknown": "x", KeyImportMaxUploadMB: "20"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	store, err := Load(db, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Get(); got.SpamThreshold != 5 || got.ImportMaxUploadMB != 20 {
+		t.Errorf("Get() = %+v, want config threshold and stored upload limit", got)
+	}
+	if got, want := store.Overrides(), []string{KeyImportMaxUploadMB}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Overrides() = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateValidation(t *testing.T) {
+	store, db := newTestStore(t)
+	if _, err := store.Update(map[string]string{KeyRemoteImages: "block"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	before := store.Get()
+	calls := 0
+	store.OnChange(func(old, updated Settings) { calls++ })
+
+	tests := []struct {
+		name  string
+		set   map[string]string
+		reset []string
+	}{
+		{"short api token", map[string]string{KeyAPIToken: "short"}, nil},
+		{"admin password", map[string]string{KeyAdminPassword: "new-password"}, nil},
+		{"negative spam threshold", map[string]string{KeySpamThreshold: "-1"}, nil},
+		{"non-numeric spam threshold", map[string]string{KeySpamThreshold: "high"}, nil},
+		{"unknown remote images mode", map[string]string{KeyRemoteImages: "maybe"}, nil},
+		{"zero upload limit", map[string]string{KeyImportMaxUploadMB: "0"}, nil},
+		{"invalid bool", map[string]string{KeyRequireTOTP: "yes please"}, nil},
+		{"zero retention", map[string]string{KeyAuditRetentionDays: "0"}, nil},
+		{"unknown key", map[string]string{"theme": "dark"}, nil},
+		{"reset unknown key", nil, []string{"theme"}},
+		{"set and reset", map[string]string{KeyRemoteImages: "allow"}, []string{KeyRemoteImages}},
+		// 一个无效值使整个请求失败，有效的部分也不保存
+		{"partially valid", map[string]string{KeySpamThreshold: "8", KeyRemoteImages: "maybe"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Update(tt.set, tt.reset); err == nil {
+				t.Fatal("Update() succeeded, want error")
+			}
+			if got := store.Get(); got != before {
+				t.Errorf("Get() = %+v, want unchanged %+v", got, before)
+			}
+			if got, want := store.Overrides(), []string{KeyRemoteImages}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Overrides() = %v, want %v", got, want)
+			}
+			stored, err := db.GetSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{KeyRemoteImages: "block"}; !reflect.DeepEqual(stored, want) {
+				t.Errorf("stored settings = %v, want %v", stored, want)
+			}
+		})
+	}
+	if calls != 0 {
+		t.Errorf("OnChange called %d times for rejected updates", calls)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	// 与 main.go 相同：垃圾邮件阈值和远程图片策略跟随设置修改
+	filter := spam.NewPipeline(store.Get().SpamThreshold, time.Second)
+	store.OnChange(func(old, updated Settings) {
+		filter.SetThreshold(updated.SpamThreshold)
+	})
+	var changes [][2]string
+	store.OnChange(func(old, updated Settings) {
+		if old.RemoteImages != updated.RemoteImages {
+			changes = append(changes, [2]string{old.RemoteImages, updated.RemoteImages})
+		}
+	})
+
+	if _, err := store.Update(map[string]string{KeySpamThreshold: "7.5", KeyRemoteImages: "allow"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := filter.Threshold(); got != 7.5 {
+		t.Errorf("threshold after update = %v, want 7.5", got)
+	}
+	if _, err := store.Update(nil, []string{KeySpamThreshold, KeyRemoteImages}); err != nil {
+		t.Fatal(err)
+	}
+	if got := filter.Threshold(); got != 5 {
+		t.Errorf("threshold after reset = %v, want 5", got)
+	}
+	if want := [][2]string{{"proxy", "allow"}, {"allow", "proxy"}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("remote image changes = %v, want %v", changes, want)
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	store, _ := newTestStore(t)
+	tokens := map[string]bool{"config-token": true, "rotated-token-aaaaaaaa": true, "rotated-token-bbbbbbbb": true}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// 读到的总是某一次完整更新后的设置
+				got := store.Get()
+				if !tokens[got.APIToken] {
+					t.Errorf("Get() returned unexpected token %q", got.APIToken)
+					return
+				}
+				_ = store.Overrides()
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		token := "rotated-token-aaaaaaaa"
+		if i%2 == 1 {
+			token = "rotated-token-bbbbbbbb"
+		}
+		if _, err := store.Update(map[string]string{KeyAPIToken: token}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
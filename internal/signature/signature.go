@@ -0,0 +1,128 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Header 请求签名所在的请求头，格式为 t=<Unix 时间戳>,v1=<HMAC-SHA256 十六进制>
+	Header = "X-MailCat-Signature"
+	// Version 当前的签名版本，签名内容为 "<时间戳>.<请求体>"
+	Version = "v1"
+)
+
+// 校验失败的原因
+var (
+	ErrMissing   = errors.New("signature is missing")
+	ErrMalformed = errors.New("signature header is malformed")
+	ErrExpired   = errors.New("signature timestamp is outside the allowed window")
+	ErrMismatch  = errors.New("signature does not match")
+	ErrReplayed  = errors.New("signature has already been used")
+)
+
+// Sign 计算请求体在指定时间的签名，返回请求头的值
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + "," + Version + "=" + hex.EncodeToString(mac([]byte(secret), timestamp, body))
+}
+
+// Verifier 校验请求签名：时间戳与当前时间相差不超过 window，同一签名在 window 内只能使用一次
+type Verifier struct {
+	secret []byte
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time // 已使用的签名 -> 可以忘记的时间
+}
+
+// NewVerifier 创建签名校验器
+func NewVerifier(secret string, window time.Duration) *Verifier {
+	return &Verifier{
+		secret: []byte(secret),
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// Verify 校验请求头中的签名。签名正确的请求才会被记录为已使用，伪造的请求不会占用缓存
+func (v *Verifier) Verify(header string, body []byte, now time.Time) error {
+	if header == "" {
+		return ErrMissing
+	}
+	timestamp, signatures, err := parse(header)
+	if err != nil {
+		return err
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+	signedAt := time.Unix(unix, 0)
+	if diff := now.Sub(signedAt); diff > v.window || diff < -v.window {
+		return ErrExpired
+	}
+
+	expected := mac(v.secret, timestamp, body)
+	var matched string
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			matched = hex.EncodeToString(decoded)
+			break
+		}
+	}
+	if matched == "" {
+		return ErrMismatch
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for signature, forget := range v.seen {
+		if now.After(forget) {
+			delete(v.seen, signature)
+		}
+	}
+	if _, used := v.seen[matched]; used {
+		return ErrReplayed
+	}
+	// 时间戳超出窗口后签名本身就会被拒绝，此时可以从缓存中删除
+	v.seen[matched] = signedAt.Add(v.window)
+	return nil
+}
+
+// parse 解析请求头，返回时间戳和当前版本的签名（轮换密钥时可以同时携带多个）
+func parse(header string) (string, []string, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return "", nil, ErrMalformed
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case Version:
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return "", nil, ErrMalformed
+	}
+	return timestamp, signatures, nil
+}
+
+func mac(secret []byte, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
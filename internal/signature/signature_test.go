@@ -0,0 +1,64 @@
+package signature
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const secret = "test-signing-secret"
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"from":"a@example.com","to":"b@example.com"}`)
+	header := Sign(secret, now, body)
+
+	v := NewVerifier(secret, 5*time.Minute)
+	if err := v.Verify(header, body, now.Add(time.Minute)); err != nil {
+		t.Fatalf("Verify rejected a valid signature: %v", err)
+	}
+	if err := v.Verify(header, body, now.Add(2*time.Minute)); err != ErrReplayed {
+		t.Errorf("Verify of a reused signature = %v, want ErrReplayed", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"subject":"hello"}`)
+	valid := Sign(secret, now, body)
+
+	tests := []struct {
+		name   string
+		header string
+		body   []byte
+		now    time.Time
+		want   error
+	}{
+		{"missing", "", body, now, ErrMissing},
+		{"malformed", "garbage", body, now, ErrMalformed},
+		{"no signature", "t=1700000000", body, now, ErrMalformed},
+		{"expired", valid, body, now.Add(6 * time.Minute), ErrExpired},
+		{"future", valid, body, now.Add(-6 * time.Minute), ErrExpired},
+		{"tampered body", valid, []byte(`{"subject":"hacked"}`), now, ErrMismatch},
+		{"wrong secret", Sign("another-secret", now, body), body, now, ErrMismatch},
+		{"changed timestamp", strings.Replace(valid, "t=1700000000", "t=1700000060", 1), body, now, ErrMismatch},
+	}
+	for _, tt := range tests {
+		v := NewVerifier(secret, 5*time.Minute)
+		if err := v.Verify(tt.header, tt.body, tt.now); err != tt.want {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyAcceptsAnyOfSeveralSignatures(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("{}")
+	old := Sign("old-secret", now, body)
+	current := Sign(secret, now, body)
+	header := old + "," + current[strings.Index(current, Version+"="):]
+
+	if err := NewVerifier(secret, 5*time.Minute).Verify(header, body, now); err != nil {
+		t.Errorf("Verify rejected a header carrying the current signature: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package spam
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HeaderAnomalyChecker 检查缺失或异常的头部
+type HeaderAnomalyChecker struct{}
+
+func (c *HeaderAnomalyChecker) Name() string { return "header_anomaly" }
+
+func (c *HeaderAnomalyChecker) Check(ctx context.Context, msg *Message) ([]Reason, error) {
+	var reasons []Reason
+
+	if msg.Header("message-id") == "" {
+		reasons = append(reasons, Reason{Rule: "missing_message_id", Score: 1.5, Detail: "Message-ID header is missing"})
+	}
+
+	if date := msg.Header("date"); date == "" {
+		reasons = append(reasons, Reason{Rule: "missing_date", Score: 1.0, Detail: "Date header is missing"})
+	} else if t, err := mail.ParseDate(date); err != nil {
+		reasons = append(reasons, Reason{Rule: "invalid_date", Score: 1.0, Detail: fmt.Sprintf("unparseable Date header %q", date)})
+	} else if t.After(time.Now().Add(24 * time.Hour)) {
+		reasons = append(reasons, Reason{Rule: "future_date", Score: 1.5, Detail: "Date header is more than a day in the future"})
+	}
+
+	if from := msg.Header("from"); from == "" {
+		reasons = append(reasons, Reason{Rule: "missing_from", Score: 2.0, Detail: "From header is missing"})
+	} else if _, err := mail.ParseAddress(from); err != nil {
+		reasons = append(reasons, Reason{Rule: "invalid_from", Score: 1.0, Detail: fmt.Sprintf("malformed From header %q", from)})
+	}
+
+	subject := msg.Subject
+	if subject == "" {
+		subject = msg.Header("subject")
+	}
+	if strings.IndexFunc(subject, isLetter) >= 0 && len(subject) > 10 && subject == strings.ToUpper(subject) {
+		reasons = append(reasons, Reason{Rule: "subject_all_caps", Score: 0.5, Detail: "Subject is written in all caps"})
+	}
+
+	return reasons, nil
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// SenderMismatchChecker 检查信封发件人、From、Reply-To 之间的不一致
+type SenderMismatchChecker struct{}
+
+func (c *SenderMismatchChecker) Name() string { return "sender_mismatch" }
+
+func (c *SenderMismatchChecker) Check(ctx context.Context, msg *Message) ([]Reason, error) {
+	var reasons []Reason
+
+	from, err := mail.ParseAddress(msg.Header("from"))
+	if err != nil {
+		return nil, nil
+	}
+	fromDomain := addressDomain(from.Address)
+
+	// 显示名称中伪装成另一个邮箱地址是典型的钓鱼手法
+	if m := emailInTextRegex.FindString(from.Name); m != "" && !strings.EqualFold(m, from.Address) {
+		reasons = append(reasons, Reason{
+			Rule:   "display_name_spoof",
+			Score:  3.0,
+			Detail: fmt.Sprintf("display name contains %s but address is %s", m, from.Address),
+		})
+	}
+
+	if envelopeDomain := addressDomain(msg.EnvelopeFrom); envelopeDomain != "" && fromDomain != "" &&
+		!sameOrganization(envelopeDomain, fromDomain) {
+		reasons = append(reasons, Reason{
+			Rule:   "envelope_from_mismatch",
+			Score:  1.0,
+			Detail: fmt.Sprintf("envelope sender domain %s differs from From domain %s", envelopeDomain, fromDomain),
+		})
+	}
+
+	if replyTo, err := mail.ParseAddress(msg.Header("reply-to")); err == nil {
+		if replyDomain := addressDomain(replyTo.Address); replyDomain != "" && fromDomain != "" &&
+			!sameOrganization(replyDomain, fromDomain) {
+			reasons = append(reasons, Reason{
+				Rule:   "reply_to_mismatch",
+				Score:  1.5,
+				Detail: fmt.Sprintf("Reply-To domain %s differs from From domain %s", replyDomain, fromDomain),
+			})
+		}
+	}
+
+	return reasons, nil
+}
+
+var emailInTextRegex = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+
+// addressDomain 提取邮件地址的域名部分（小写）
+func addressDomain(address string) string {
+	if addr, err := mail.ParseAddress(address); err == nil {
+		address = addr.Address
+	}
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.Trim(address[at+1:], "> "))
+}
+
+// sameOrganization 判断两个域名是否属于同一注册域（按最后两级比较）
+func sameOrganization(a, b string) bool {
+	return registeredDomain(a) == registeredDomain(b)
+}
+
+func registeredDomain(domain string) string {
+	labels := strings.Split(strings.TrimSuffix(domain, "."), ".")
+	if len(labels) <= 2 {
+		return domain
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// defaultSuspiciousExtensions 常见的可执行或宏附件类型
+var defaultSuspiciousExtensions = []string{
+	".exe", ".scr", ".bat", ".cmd", ".com", ".pif", ".cpl", ".msi", ".dll",
+	".js", ".jse", ".vbs", ".vbe", ".wsf", ".wsh", ".hta", ".ps1", ".jar",
+	".lnk", ".iso", ".img", ".vhd", ".docm", ".xlsm", ".pptm",
+}
+
+// AttachmentChecker 检查可疑的附件类型
+type AttachmentChecker struct {
+	extensions map[string]bool
+}
+
+// NewAttachmentChecker 创建附件检查器，extensions 为空时使用内置列表
+func NewAttachmentChecker(extensions []string) *AttachmentChecker {
+	if len(extensions) == 0 {
+		extensions = defaultSuspiciousExtensions
+	}
+	set := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		set[ext] = true
+	}
+	return &AttachmentChecker{extensions: set}
+}
+
+func (c *AttachmentChecker) Name() string { return "attachment" }
+
+// attachmentNameRegex 匹配 Content-Type 的 name 参数和 Content-Disposition 的 filename 参数
+var attachmentNameRegex = regexp.MustCompile(`(?i)\b(?:file)?name\*?=\s*(?:"([^"\r\n]+)"|([^;\s\r\n]+))`)
+
+func (c *AttachmentChecker) Check(ctx context.Context, msg *Message) ([]Reason, error) {
+	if msg.Raw == "" {
+		return nil, nil
+	}
+
+	var reasons []Reason
+	seen := make(map[string]bool)
+	for _, m := range attachmentNameRegex.FindAllStringSubmatch(msg.Raw, -1) {
+		name := m[1]
+		if name == "" {
+			name = m[2]
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		ext := path.Ext(name)
+		if !c.extensions[ext] {
+			continue
+		}
+
+		reason := Reason{Rule: "suspicious_attachment", Score: 3.0, Detail: fmt.Sprintf("attachment %q has type %s", name, ext)}
+		// 双扩展名（如 invoice.pdf.exe）用于伪装文件类型
+		if inner := path.Ext(strings.TrimSuffix(name, ext)); inner != "" && len(inner) <= 5 {
+			reason.Rule = "double_extension_attachment"
+			reason.Score = 5.0
+		}
+		reasons = append(reasons, reason)
+	}
+
+	return reasons, nil
+}
+
+// URLBlocklistChecker 检查正文中的链接是否命中黑名单
+type URLBlocklistChecker struct {
+	domains map[string]bool
+}
+
+// LoadURLBlocklist 从文件加载黑名单，每行一个域名或 URL，# 开头为注释
+func LoadURLBlocklist(files ...string) (*URLBlocklistChecker, error) {
+	checker := &URLBlocklistChecker{domains: make(map[string]bool)}
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open url blocklist %s: %w", file, err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if host := hostOf(line); host != "" {
+				checker.domains[host] = true
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read url blocklist %s: %w", file, err)
+		}
+	}
+
+	return checker, nil
+}
+
+func (c *URLBlocklistChecker) Name() string { return "url_blocklist" }
+
+var urlRegex = regexp.MustCompile(`(?i)https?://[^\s<>"'()]+`)
+
+func (c *URLBlocklistChecker) Check(ctx context.Context, msg *Message) ([]Reason, error) {
+	var reasons []Reason
+	seen := make(map[string]bool)
+
+	for _, content := range []string{msg.TextBody, msg.HTMLBody} {
+		for _, link := range urlRegex.FindAllString(content, -1) {
+			host := hostOf(link)
+			if host == "" || seen[host] {
+				continue
+			}
+			seen[host] = true
+			if blocked := c.match(host); blocked != "" {
+				reasons = append(reasons, Reason{
+					Rule:   "blocklisted_url",
+					Score:  5.0,
+					Detail: fmt.Sprintf("link to %s matches blocklist entry %s", host, blocked),
+				})
+			}
+		}
+	}
+
+	return reasons, nil
+}
+
+// match 检查主机名及其上级域名是否在黑名单中
+func (c *URLBlocklistChecker) match(host string) string {
+	for {
+		if c.domains[host] {
+			return host
+		}
+		dot := strings.Index(host, ".")
+		if dot < 0 {
+			return ""
+		}
+		host = host[dot+1:]
+	}
+}
+
+// hostOf 从 URL 或裸域名中提取小写主机名
+func hostOf(s string) string {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
@@ -0,0 +1,148 @@
+package spam
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// validHeaders 不触发任何头部规则的基础头部
+func validHeaders() map[string]string {
+	return map[string]string{
+		"message-id": "<1@example.com>",
+		"date":       "Mon, 02 Jan 2006 15:04:05 +0000",
+		"from":       "Alice <alice@example.com>",
+	}
+}
+
+// rules 返回原因的规则名和分数，便于比较
+func rules(reasons []Reason) map[string]float64 {
+	got := make(map[string]float64, len(reasons))
+	for _, r := range reasons {
+		got[r.Rule] = r.Score
+	}
+	return got
+}
+
+func equalRules(got, want map[string]float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for rule, score := range want {
+		if s, ok := got[rule]; !ok || s != score {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHeaderAnomalyChecker(t *testing.T) {
+	future := time.Now().Add(72 * time.Hour).Format(time.RFC1123Z)
+	tests := []struct {
+		name    string
+		modify  func(h map[string]string)
+		subject string
+		want    map[string]float64
+	}{
+		{"clean", nil, "Hello", map[string]float64{}},
+		{"missing message-id", func(h map[string]string) { delete(h, "message-id") }, "", map[string]float64{"missing_message_id": 1.5}},
+		{"missing date", func(h map[string]string) { delete(h, "date") }, "", map[string]float64{"missing_date": 1.0}},
+		{"invalid date", func(h map[string]string) { h["date"] = "yesterday" }, "", map[string]float64{"invalid_date": 1.0}},
+		{"future date", func(h map[string]string) { h["date"] = future }, "", map[string]float64{"future_date": 1.5}},
+		{"missing from", func(h map[string]string) { delete(h, "from") }, "", map[string]float64{"missing_from": 2.0}},
+		{"invalid from", func(h map[string]string) { h["from"] = "not an address" }, "", map[string]float64{"invalid_from": 1.0}},
+		{"all caps subject", nil, "FREE MONEY NOW", map[string]float64{"subject_all_caps": 0.5}},
+		{"short caps subject", nil, "HI THERE", map[string]float64{}},
+		{"caps without letters", nil, "12345678901", map[string]float64{}},
+	}
+	for _, tt := range tests {
+		headers := validHeaders()
+		if tt.modify != nil {
+			tt.modify(headers)
+		}
+		reasons, _ := (&HeaderAnomalyChecker{}).Check(context.Background(), &Message{Headers: headers, Subject: tt.subject})
+		if got := rules(reasons); !equalRules(got, tt.want) {
+			t.Errorf("%s: rules = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSenderMismatchChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		envelope string
+		replyTo  string
+		want     map[string]float64
+	}{
+		{"aligned", "alice@example.com", "bounce@mail.example.com", "help@example.com", map[string]float64{}},
+		{"display name spoof", `"ceo@bank.com" <x@evil.net>`, "", "", map[string]float64{"display_name_spoof": 3.0}},
+		{"display name is own address", `"x@evil.net" <x@evil.net>`, "", "", map[string]float64{}},
+		{"envelope mismatch", "alice@example.com", "bulk@mailer.net", "", map[string]float64{"envelope_from_mismatch": 1.0}},
+		{"reply-to mismatch", "alice@example.com", "", "collect@other.org", map[string]float64{"reply_to_mismatch": 1.5}},
+		{"unparseable from", "garbage", "bulk@mailer.net", "", map[string]float64{}},
+	}
+	for _, tt := range tests {
+		msg := &Message{EnvelopeFrom: tt.envelope, Headers: map[string]string{"from": tt.from}}
+		if tt.replyTo != "" {
+			msg.Headers["reply-to"] = tt.replyTo
+		}
+		reasons, _ := (&SenderMismatchChecker{}).Check(context.Background(), msg)
+		if got := rules(reasons); !equalRules(got, tt.want) {
+			t.Errorf("%s: rules = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAttachmentChecker(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions []string
+		raw        string
+		want       map[string]float64
+	}{
+		{"no attachments", nil, "Subject: hi\r\n\r\nbody", map[string]float64{}},
+		{"pdf", nil, "Content-Disposition: attachment; filename=\"report.pdf\"\r\n", map[string]float64{}},
+		{"executable", nil, "Content-Type: application/octet-stream; name=setup.EXE\r\n", map[string]float64{"suspicious_attachment": 3.0}},
+		{"double extension", nil, "Content-Disposition: attachment; filename=\"invoice.pdf.exe\"\r\n", map[string]float64{"double_extension_attachment": 5.0}},
+		{"custom list", []string{"pdf"}, "Content-Disposition: attachment; filename=\"report.pdf\"\r\n", map[string]float64{"suspicious_attachment": 3.0}},
+	}
+	for _, tt := range tests {
+		reasons, _ := NewAttachmentChecker(tt.extensions).Check(context.Background(), &Message{Raw: tt.raw})
+		if got := rules(reasons); !equalRules(got, tt.want) {
+			t.Errorf("%s: rules = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestURLBlocklistChecker(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(file, []byte("# phishing\nevil.example\nhttps://tracker.test/path\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	checker, err := LoadURLBlocklist(file)
+	if err != nil {
+		t.Fatalf("LoadURLBlocklist error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		msg  Message
+		want int
+	}{
+		{"clean", Message{TextBody: "see https://example.com/"}, 0},
+		{"exact host", Message{TextBody: "click http://evil.example/login"}, 1},
+		{"subdomain", Message{HTMLBody: `<a href="https://login.EVIL.example/">`}, 1},
+		{"lookalike", Message{TextBody: "https://notevil.example/"}, 0},
+		{"listed as url", Message{TextBody: "https://tracker.test/other"}, 1},
+		{"repeated host", Message{TextBody: "http://evil.example/a http://evil.example/b"}, 1},
+	}
+	for _, tt := range tests {
+		reasons, _ := checker.Check(context.Background(), &tt.msg)
+		if len(reasons) != tt.want {
+			t.Errorf("%s: got %d reasons %v, want %d", tt.name, len(reasons), reasons, tt.want)
+		}
+	}
+}
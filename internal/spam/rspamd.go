@@ -0,0 +1,95 @@
+package spam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RspamdChecker 通过 rspamd 的 HTTP /checkv2 接口评分
+type RspamdChecker struct {
+	baseURL  string
+	password string
+	client   *http.Client
+}
+
+// NewRspamdChecker 创建 rspamd 客户端，baseURL 形如 http://127.0.0.1:11333
+func NewRspamdChecker(baseURL, password string, timeout time.Duration) *RspamdChecker {
+	return &RspamdChecker{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		password: password,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *RspamdChecker) Name() string { return "rspamd" }
+
+type rspamdResponse struct {
+	Score         float64 `json:"score"`
+	RequiredScore float64 `json:"required_score"`
+	Action        string  `json:"action"`
+	Symbols       map[string]struct {
+		Name        string  `json:"name"`
+		Score       float64 `json:"score"`
+		Description string  `json:"description"`
+	} `json:"symbols"`
+}
+
+func (c *RspamdChecker) Check(ctx context.Context, msg *Message) ([]Reason, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/checkv2", strings.NewReader(msg.rfc822()))
+	if err != nil {
+		return nil, err
+	}
+	if c.password != "" {
+		req.Header.Set("Password", c.password)
+	}
+	if msg.EnvelopeFrom != "" {
+		req.Header.Set("From", msg.EnvelopeFrom)
+	}
+	if msg.EnvelopeTo != "" {
+		req.Header.Set("Rcpt", msg.EnvelopeTo)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rspamd request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("rspamd returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result rspamdResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode rspamd response: %w", err)
+	}
+
+	// 只保留计分的符号作为原因，总分以 rspamd 返回的 score 为准
+	names := make([]string, 0, len(result.Symbols))
+	for name, sym := range result.Symbols {
+		if sym.Score != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	reasons := make([]Reason, 0, len(names)+1)
+	var symbolTotal float64
+	for _, name := range names {
+		sym := result.Symbols[name]
+		symbolTotal += sym.Score
+		reasons = append(reasons, Reason{Rule: "rspamd:" + name, Score: sym.Score, Detail: sym.Description})
+	}
+	if diff := result.Score - symbolTotal; diff > 0.001 || diff < -0.001 {
+		reasons = append(reasons, Reason{Rule: "rspamd", Score: diff, Detail: "action: " + result.Action})
+	}
+
+	return reasons, nil
+}
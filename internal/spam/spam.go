@@ -0,0 +1,210 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mailcat/internal/config"
+	"mailcat/internal/models"
+)
+
+// Message 评分时使用的邮件视图
+type Message struct {
+	EnvelopeFrom string // Worker 提交的 from（SMTP 信封发件人）
+	EnvelopeTo   string // Worker 提交的 to（SMTP 信封收件人）
+	Subject      string
+	Headers      map[string]string // 头部名称统一为小写
+	TextBody     string
+	HTMLBody     string
+	Raw          string // 原始邮件，可能为空
+}
+
+// Header 获取头部值（大小写不敏感）
+func (m *Message) Header(name string) string {
+	return m.Headers[strings.ToLower(name)]
+}
+
+// Reason 单条评分原因
+type Reason struct {
+	Rule   string  `json:"rule"`
+	Score  float64 `json:"score"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// Verdict 评分结果
+type Verdict struct {
+	Score   float64  `json:"score"`
+	Reasons []Reason `json:"reasons"`
+	IsSpam  bool     `json:"is_spam"`
+}
+
+// Checker 评分规则接口，内置启发式规则与外部扫描器都实现该接口
+type Checker interface {
+	Name() string
+	Check(ctx context.Context, msg *Message) ([]Reason, error)
+}
+
+// Pipeline 按顺序执行所有 Checker 并汇总分数
+type Pipeline struct {
+	checkers []Checker
+	timeout  time.Duration
+
+	mu        sync.RWMutex
+	threshold float64 // 可在运行时通过 SetThreshold 修改
+}
+
+// NewPipeline 创建评分管道
+func NewPipeline(threshold float64, timeout time.Duration, checkers ...Checker) *Pipeline {
+	return &Pipeline{
+		checkers:  checkers,
+		threshold: threshold,
+		timeout:   timeout,
+	}
+}
+
+// NewPipelineFromConfig 根据配置创建评分管道，未启用时返回 nil
+func NewPipelineFromConfig(cfg config.SpamConfig) (*Pipeline, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	checkers := []Checker{
+		&HeaderAnomalyChecker{},
+		&SenderMismatchChecker{},
+		NewAttachmentChecker(cfg.SuspiciousExtensions),
+	}
+
+	if len(cfg.URLBlocklistFiles) > 0 {
+		blocklist, err := LoadURLBlocklist(cfg.URLBlocklistFiles...)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, blocklist)
+	}
+	if cfg.Rspamd.URL != "" {
+		checkers = append(checkers, NewRspamdChecker(cfg.Rspamd.URL, cfg.Rspamd.Password, timeout))
+	}
+	if cfg.SpamAssassin.Address != "" {
+		checkers = append(checkers, NewSpamAssassinChecker(cfg.SpamAssassin.Address, timeout))
+	}
+
+	return NewPipeline(cfg.Threshold, timeout, checkers...), nil
+}
+
+// Threshold 返回判定为垃圾邮件的分数阈值
+func (p *Pipeline) Threshold() float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.threshold
+}
+
+// SetThreshold 修改分数阈值，对之后评分的邮件生效
+func (p *Pipeline) SetThreshold(threshold float64) {
+	p.mu.Lock()
+	p.threshold = threshold
+	p.mu.Unlock()
+}
+
+// Score 对邮件评分。单个 Checker 失败只记录日志，不影响邮件接收
+func (p *Pipeline) Score(ctx context.Context, msg *Message) *Verdict {
+	verdict := &Verdict{Reasons: []Reason{}}
+
+	for _, checker := range p.checkers {
+		checkCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		reasons, err := checker.Check(checkCtx, msg)
+		cancel()
+		if err != nil {
+			log.Printf("spam checker %s failed: %v", checker.Name(), err)
+			continue
+		}
+		for _, r := range reasons {
+			verdict.Score += r.Score
+			verdict.Reasons = append(verdict.Reasons, r)
+		}
+	}
+
+	sort.SliceStable(verdict.Reasons, func(i, j int) bool {
+		return verdict.Reasons[i].Score > verdict.Reasons[j].Score
+	})
+	verdict.IsSpam = verdict.Score >= p.Threshold()
+	return verdict
+}
+
+// MessageFromRequest 将 Worker 提交的请求转换为评分视图
+func MessageFromRequest(req *models.EmailRequest) *Message {
+	headers := make(map[string]string, len(req.Headers))
+	for k, v := range req.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+
+	raw := req.RawEmail
+	// Worker 在解析失败时会把原始邮件放进 body
+	if raw == "" && looksLikeRawMessage(req.Body) {
+		raw = req.Body
+	}
+
+	return &Message{
+		EnvelopeFrom: req.From,
+		EnvelopeTo:   req.To,
+		Subject:      req.Subject,
+		Headers:      headers,
+		TextBody:     req.Body,
+		HTMLBody:     req.HTMLBody,
+		Raw:          raw,
+	}
+}
+
+// looksLikeRawMessage 粗略判断内容是否包含 RFC 5322 头部
+func looksLikeRawMessage(content string) bool {
+	end := strings.Index(content, "\n\n")
+	if end < 0 {
+		end = strings.Index(content, "\r\n\r\n")
+	}
+	if end <= 0 {
+		return false
+	}
+	_, err := mail.ReadMessage(strings.NewReader(content))
+	return err == nil && strings.Contains(strings.ToLower(content[:end]), "from:")
+}
+
+// rfc822 返回可交给外部扫描器的完整邮件，没有原始邮件时由头部和正文拼装
+func (m *Message) rfc822() string {
+	if m.Raw != "" {
+		return m.Raw
+	}
+
+	var b strings.Builder
+	keys := make([]string, 0, len(m.Headers))
+	for k := range m.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// 正文已被解码，原有的编码相关头部不再适用
+		if k == "content-type" || k == "content-transfer-encoding" || k == "mime-version" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", k, m.Headers[k])
+	}
+	if m.Header("from") == "" {
+		fmt.Fprintf(&b, "from: %s\r\n", m.EnvelopeFrom)
+	}
+	if m.Header("subject") == "" && m.Subject != "" {
+		fmt.Fprintf(&b, "subject: %s\r\n", m.Subject)
+	}
+	if m.TextBody != "" {
+		b.WriteString("content-type: text/plain; charset=utf-8\r\n\r\n")
+		b.WriteString(m.TextBody)
+	} else {
+		b.WriteString("content-type: text/html; charset=utf-8\r\n\r\n")
+		b.WriteString(m.HTMLBody)
+	}
+	return b.String()
+}
@@ -0,0 +1,192 @@
+package spam
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRspamdChecker(t *testing.T) {
+	var gotPassword, gotRcpt, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/checkv2" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		gotPassword, gotRcpt, gotBody = r.Header.Get("Password"), r.Header.Get("Rcpt"), string(body)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"score":  7.5,
+			"action": "add header",
+			"symbols": map[string]interface{}{
+				"BAYES_SPAM": map[string]interface{}{"score": 5.0, "description": "bayes"},
+				"R_DKIM_NA":  map[string]interface{}{"score": 0.0},
+				"MISSING_TO": map[string]interface{}{"score": 2.0},
+			},
+		})
+	}))
+	defer server.Close()
+
+	checker := NewRspamdChecker(server.URL+"/", "secret", time.Second)
+	msg := &Message{EnvelopeTo: "bob@example.com", Raw: "From: a@example.com\r\n\r\nhi"}
+	reasons, err := checker.Check(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if gotPassword != "secret" || gotRcpt != "bob@example.com" || gotBody != msg.Raw {
+		t.Errorf("request password=%q rcpt=%q body=%q", gotPassword, gotRcpt, gotBody)
+	}
+	want := map[string]float64{"rspamd:BAYES_SPAM": 5.0, "rspamd:MISSING_TO": 2.0, "rspamd": 0.5}
+	if got := rules(reasons); !equalRules(got, want) {
+		t.Errorf("rules = %v, want %v", got, want)
+	}
+}
+
+func TestRspamdCheckerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Password") == "" {
+			http.Error(w, "unauthorized", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	if _, err := NewRspamdChecker(server.URL, "", time.Second).Check(context.Background(), &Message{}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Check with a rejected password = %v, want a 403 error", err)
+	}
+	if _, err := NewRspamdChecker(server.URL, "pw", time.Second).Check(context.Background(), &Message{}); err == nil {
+		t.Error("Check accepted an invalid JSON response")
+	}
+}
+
+// fakeSpamd 在本地端口上模拟 spamd：读取请求后由 respond 写回响应，返回地址和收到的请求
+func fakeSpamd(t *testing.T, respond func(conn net.Conn)) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	requests := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		request, _ := io.ReadAll(conn) // 客户端半关闭写方向后读到 EOF
+		requests <- string(request)
+		respond(conn)
+	}()
+	return listener.Addr().String(), requests
+}
+
+func TestSpamAssassinChecker(t *testing.T) {
+	addr, requests := fakeSpamd(t, func(conn net.Conn) {
+		io.WriteString(conn, "SPAMD/1.1 0 EX_OK\r\nContent-length: 27\r\nSpam: True ; 15.3 / 5.0\r\n\r\nBAYES_99,URIBL_BLACK\r\n")
+	})
+
+	checker := NewSpamAssassinChecker(addr, time.Second)
+	reasons, err := checker.Check(context.Background(), &Message{EnvelopeTo: "bob@example.com", Raw: "Subject: hi\r\n\r\nbody"})
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if len(reasons) != 1 || reasons[0].Score != 15.3 || reasons[0].Detail != "BAYES_99,URIBL_BLACK" {
+		t.Errorf("reasons = %+v", reasons)
+	}
+	request := <-requests
+	if !strings.HasPrefix(request, "SYMBOLS SPAMC/1.5\r\nContent-length: 21\r\nUser: bob@example.com\r\n\r\n") {
+		t.Errorf("request = %q", request)
+	}
+}
+
+func TestSpamAssassinCheckerTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	addr, _ := fakeSpamd(t, func(conn net.Conn) { <-block })
+
+	start := time.Now()
+	if _, err := NewSpamAssassinChecker(addr, 200*time.Millisecond).Check(context.Background(), &Message{Raw: "x\r\n"}); err == nil {
+		t.Fatal("Check returned no error when spamd did not respond")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Check took %s, want it to give up after the timeout", elapsed)
+	}
+}
+
+func TestParseSpamdResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		score    float64
+		symbols  string
+		wantErr  bool
+	}{
+		{"ham", "SPAMD/1.1 0 EX_OK\r\nSpam: False ; 1.2 / 5.0\r\n\r\n", 1.2, "", false},
+		{"negative score", "SPAMD/1.5 0 EX_OK\nSpam: no ; -0.5 / 5.0\n\nALL_TRUSTED\n", -0.5, "ALL_TRUSTED", false},
+		{"lowercase header", "SPAMD/1.1 0 EX_OK\r\nspam: True ; 6 / 5\r\n\r\nA, B ,\r\n", 6, "A,B", false},
+		{"error status", "SPAMD/1.0 76 Bad header line\r\n\r\n", 0, "", true},
+		{"not spamd", "HTTP/1.1 200 OK\r\n\r\n", 0, "", true},
+		{"missing spam header", "SPAMD/1.1 0 EX_OK\r\nContent-length: 0\r\n\r\n", 0, "", true},
+		{"invalid score", "SPAMD/1.1 0 EX_OK\r\nSpam: True ; lots / 5.0\r\n\r\n", 0, "", true},
+		{"truncated", "SPAMD/1.1 0 EX_OK\r\nSpam: True ; 1 / 5", 0, "", true},
+		{"empty", "", 0, "", true},
+	}
+	for _, tt := range tests {
+		score, symbols, err := parseSpamdResponse(bufio.NewReader(strings.NewReader(tt.response)))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (score != tt.score || strings.Join(symbols, ",") != tt.symbols) {
+			t.Errorf("%s: got %v %v, want %v %q", tt.name, score, symbols, tt.score, tt.symbols)
+		}
+	}
+}
+
+type stubChecker struct {
+	reasons []Reason
+	err     error
+}
+
+func (c stubChecker) Name() string { return "stub" }
+
+func (c stubChecker) Check(ctx context.Context, msg *Message) ([]Reason, error) {
+	return c.reasons, c.err
+}
+
+// slowChecker 直到 ctx 超时才返回，模拟没有响应的外部扫描器
+type slowChecker struct{}
+
+func (slowChecker) Name() string { return "slow" }
+
+func (slowChecker) Check(ctx context.Context, msg *Message) ([]Reason, error) {
+	<-ctx.Done()
+	return []Reason{{Rule: "late", Score: 100}}, ctx.Err()
+}
+
+func TestPipelineFailsOpen(t *testing.T) {
+	pipeline := NewPipeline(5, 50*time.Millisecond,
+		stubChecker{reasons: []Reason{{Rule: "a", Score: 2}}},
+		stubChecker{err: errors.New("scanner unavailable")},
+		slowChecker{},
+		stubChecker{reasons: []Reason{{Rule: "b", Score: 4}}},
+	)
+	verdict := pipeline.Score(context.Background(), &Message{})
+	if verdict.Score != 6 || !verdict.IsSpam || len(verdict.Reasons) != 2 || verdict.Reasons[0].Rule != "b" {
+		t.Errorf("verdict = %+v, want score 6 from the two working checkers, sorted by score", verdict)
+	}
+
+	pipeline.SetThreshold(10)
+	if verdict := pipeline.Score(context.Background(), &Message{}); verdict.IsSpam {
+		t.Error("Score ignored the updated threshold")
+	}
+}
@@ -0,0 +1,129 @@
+package spam
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SpamAssassinChecker 通过 spamd 的 SPAMC/1.5 协议评分
+type SpamAssassinChecker struct {
+	address string
+	timeout time.Duration
+}
+
+// NewSpamAssassinChecker 创建 spamd 客户端，address 形如 127.0.0.1:783
+func NewSpamAssassinChecker(address string, timeout time.Duration) *SpamAssassinChecker {
+	return &SpamAssassinChecker{address: address, timeout: timeout}
+}
+
+func (c *SpamAssassinChecker) Name() string { return "spamassassin" }
+
+func (c *SpamAssassinChecker) Check(ctx context.Context, msg *Message) ([]Reason, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to spamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	body := msg.rfc822()
+	if !strings.HasSuffix(body, "\n") {
+		body += "\r\n"
+	}
+	request := fmt.Sprintf("SYMBOLS SPAMC/1.5\r\nContent-length: %d\r\n", len(body))
+	if msg.EnvelopeTo != "" {
+		request += "User: " + msg.EnvelopeTo + "\r\n"
+	}
+	request += "\r\n" + body
+	if _, err := io.WriteString(conn, request); err != nil {
+		return nil, fmt.Errorf("failed to send message to spamd: %w", err)
+	}
+	// 半关闭写方向，告知 spamd 请求已结束
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+
+	score, symbols, err := parseSpamdResponse(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+
+	return []Reason{{
+		Rule:   "spamassassin",
+		Score:  score,
+		Detail: strings.Join(symbols, ","),
+	}}, nil
+}
+
+// parseSpamdResponse 解析 spamd 响应：
+//
+//	SPAMD/1.1 0 EX_OK
+//	Spam: True ; 15.3 / 5.0
+//
+//	SYMBOL_A,SYMBOL_B
+func parseSpamdResponse(r *bufio.Reader) (float64, []string, error) {
+	status, err := r.ReadString('\n')
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read spamd status: %w", err)
+	}
+	fields := strings.Fields(status)
+	if len(fields) < 3 || !strings.HasPrefix(fields[0], "SPAMD/") {
+		return 0, nil, fmt.Errorf("unexpected spamd status line %q", strings.TrimSpace(status))
+	}
+	if fields[1] != "0" {
+		return 0, nil, fmt.Errorf("spamd error: %s", strings.TrimSpace(status))
+	}
+
+	var score float64
+	scoreFound := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && line == "" {
+			return 0, nil, fmt.Errorf("failed to read spamd headers: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Spam") {
+			continue
+		}
+		// value 形如 " True ; 15.3 / 5.0"
+		_, scores, ok := strings.Cut(value, ";")
+		if !ok {
+			continue
+		}
+		got, _, _ := strings.Cut(scores, "/")
+		score, err = strconv.ParseFloat(strings.TrimSpace(got), 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid spamd score %q", value)
+		}
+		scoreFound = true
+	}
+	if !scoreFound {
+		return 0, nil, fmt.Errorf("spamd response missing Spam header")
+	}
+
+	rest, _ := io.ReadAll(r)
+	var symbols []string
+	for _, s := range strings.Split(strings.TrimSpace(string(rest)), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			symbols = append(symbols, s)
+		}
+	}
+
+	return score, symbols, nil
+}
@@ -0,0 +1,98 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period 时间步长（秒）
+	Period = 30
+	// Digits 验证码位数
+	Digits = 6
+	// secretSize 密钥长度（字节），RFC 4226 建议至少 160 位
+	secretSize = 20
+	// skew 允许的时间偏差（前后各若干个时间步），用于容忍客户端时钟误差
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret 生成随机密钥，返回 Base32 编码（无填充），可直接输入认证器应用
+func GenerateSecret() (string, error) {
+	buf := make([]byte, secretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	return encoding.EncodeToString(buf), nil
+}
+
+// ProvisioningURI 返回 otpauth:// 地址，认证器应用扫描由其生成的二维码即可添加账户
+func ProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(Period))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Counter 返回时间 t 对应的时间步
+func Counter(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code 计算密钥在指定时间步的验证码（RFC 6238，HMAC-SHA1）
+func Code(secret string, counter int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret: %w", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断（RFC 4226 第 5.3 节）
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Validate 校验验证码，允许前后 skew 个时间步的偏差。只接受大于 after 的时间步，
+// 调用方保存返回的时间步作为下一次的 after，防止同一验证码被重复使用
+func Validate(secret, code string, t time.Time, after int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Counter(t)
+	for counter := current - skew; counter <= current+skew; counter++ {
+		if counter <= after {
+			continue
+		}
+		expected, err := Code(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
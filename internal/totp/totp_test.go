@@ -0,0 +1,45 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA-1 测试向量（取后 6 位），密钥为 ASCII "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d) error: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRejectsReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	counter, ok := Validate(rfcSecret, "005924", now, 0)
+	if !ok {
+		t.Fatal("Validate rejected a valid code")
+	}
+	if _, ok := Validate(rfcSecret, "005924", now, counter); ok {
+		t.Error("Validate accepted a code that was already used")
+	}
+	if _, ok := Validate(rfcSecret, "000000", now, 0); ok {
+		t.Error("Validate accepted a wrong code")
+	}
+}
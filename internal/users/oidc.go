@@ -0,0 +1,65 @@
+package users
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"mailcat/internal/models"
+)
+
+// ErrLocalAccount OIDC 登录的用户名已被本地账户使用，不会自动关联，避免身份提供方中的同名用户接管本地账户
+var ErrLocalAccount = errors.New("username belongs to a local account")
+
+// ProvisionOIDC 通过 OIDC 登录时按 sub 查找用户：不存在时以 username 创建，存在时按身份提供方的声明更新角色和邮箱。
+// 创建的用户没有密码，只能通过 OIDC 登录
+func (m *Manager) ProvisionOIDC(subject, username, role string, mailboxes []string) (*models.User, error) {
+	role, mailboxes, err := normalizeRole(role, mailboxes)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.db.GetUserByOIDCSubject(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		username = strings.TrimSpace(username)
+		if err := validateUsername(username); err != nil {
+			return nil, err
+		}
+		existing, _, err := m.db.GetUserByUsername(username)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, ErrLocalAccount
+		}
+		user = &models.User{Username: username, Role: role, Mailboxes: mailboxes, OIDCSubject: subject}
+		if err := m.db.CreateUser(user, ""); err != nil {
+			return nil, err
+		}
+	} else if user.Role != role || strings.Join(user.Mailboxes, ",") != strings.Join(mailboxes, ",") {
+		if user.Role == models.RoleOwner && role != models.RoleOwner {
+			if err := m.checkNotLastOwner(); err != nil {
+				return nil, err
+			}
+		}
+		user.Role = role
+		user.Mailboxes = mailboxes
+		if err := m.db.UpdateUser(user, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	if err := m.db.TouchUserLogin(user.ID, now); err != nil {
+		log.Printf("Failed to record user login: %v", err)
+	}
+	user.LastLoginAt = &now
+	return user, nil
+}
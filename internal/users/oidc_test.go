@@ -0,0 +1,136 @@
+package users
+
+import (
+	"path/filepath"
+	"testing"
+
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+	"mailcat/internal/settings"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := NewManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestProvisionOIDC(t *testing.T) {
+	m := newTestManager(t)
+
+	user, err := m.ProvisionOIDC("sub-1", " alice@example.com ", models.RoleViewer, []string{"Alice@Example.com", "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice@example.com" || user.Role != models.RoleViewer || user.OIDCSubject != "sub-1" || user.LastLoginAt == nil {
+		t.Errorf("created user = %+v", user)
+	}
+	if len(user.Mailboxes) != 1 || user.Mailboxes[0] != "alice@example.com" {
+		t.Errorf("mailboxes = %v, want normalized [alice@example.com]", user.Mailboxes)
+	}
+	// 自动创建的用户没有密码
+	if _, err := m.AuthenticatePassword("alice@example.com", "", false); err != ErrInvalidCredentials {
+		t.Errorf("password login for OIDC user: %v, want ErrInvalidCredentials", err)
+	}
+
+	// 再次登录按 sub 找到同一用户：按声明更新角色，用户名不随声明改变
+	again, err := m.ProvisionOIDC("sub-1", "renamed", models.RoleAdmin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID || again.Username != "alice@example.com" || again.Role != models.RoleAdmin || len(again.Mailboxes) != 0 {
+		t.Errorf("updated user = %+v", again)
+	}
+	if stored, err := m.Get(user.ID); err != nil || stored.Role != models.RoleAdmin {
+		t.Errorf("stored user = %+v, %v", stored, err)
+	}
+	if users, _ := m.List(); len(users) != 1 {
+		t.Errorf("%d users after repeated login, want 1", len(users))
+	}
+
+	for _, tt := range []struct {
+		name, subject, username, role string
+		mailboxes                     []string
+	}{
+		{"unknown role", "sub-2", "bob", "superuser", nil},
+		{"viewer without mailboxes", "sub-2", "bob", models.RoleViewer, nil},
+		{"invalid username", "sub-2", "bob smith", models.RoleAdmin, nil},
+		{"empty username", "sub-2", " ", models.RoleAdmin, nil},
+		{"invalid role for existing user", "sub-1", "", models.RoleViewer, []string{"not-a-mailbox"}},
+	} {
+		if _, err := m.ProvisionOIDC(tt.subject, tt.username, tt.role, tt.mailboxes); err == nil {
+			t.Errorf("%s: ProvisionOIDC succeeded", tt.name)
+		}
+	}
+}
+
+func TestProvisionOIDCRefusesLocalAccount(t *testing.T) {
+	m := newTestManager(t)
+	local, err := m.Create(models.CreateUserRequest{Username: "alice", Password: "correct horse", Role: models.RoleViewer, Mailboxes: []string{"alice@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 身份提供方中的同名用户不能接管本地账户，本地账户的角色和邮箱保持不变
+	if _, err := m.ProvisionOIDC("sub-1", "alice", models.RoleOwner, nil); err != ErrLocalAccount {
+		t.Fatalf("err = %v, want ErrLocalAccount", err)
+	}
+	stored, err := m.Get(local.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Role != models.RoleViewer || stored.OIDCSubject != "" || len(stored.Mailboxes) != 1 {
+		t.Errorf("local account was modified: %+v", stored)
+	}
+	if _, err := m.Authenticate("alice", settings.HashPassword("correct horse")); err != nil {
+		t.Errorf("local password login: %v", err)
+	}
+
+	// 已由另一个 sub 创建的用户同样不会被关联
+	if _, err := m.ProvisionOIDC("sub-2", "bob", models.RoleAdmin, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ProvisionOIDC("sub-3", "bob", models.RoleAdmin, nil); err != ErrLocalAccount {
+		t.Errorf("err = %v, want ErrLocalAccount for a user created by another subject", err)
+	}
+}
+
+func TestProvisionOIDCLastOwner(t *testing.T) {
+	m := newTestManager(t)
+	owner, err := m.ProvisionOIDC("sub-1", "owner", models.RoleOwner, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 声明变化会让唯一的 owner 降级时拒绝登录，保留原角色
+	if _, err := m.ProvisionOIDC("sub-1", "owner", models.RoleAdmin, nil); err != ErrLastOwner {
+		t.Fatalf("err = %v, want ErrLastOwner", err)
+	}
+	if stored, _ := m.Get(owner.ID); stored.Role != models.RoleOwner {
+		t.Errorf("role = %q after refused demotion, want owner", stored.Role)
+	}
+	// 角色不变的登录不受影响
+	if _, err := m.ProvisionOIDC("sub-1", "owner", models.RoleOwner, nil); err != nil {
+		t.Errorf("login without role change: %v", err)
+	}
+
+	// 还有其他 owner 时可以降级
+	if _, err := m.Create(models.CreateUserRequest{Username: "second", Password: "correct horse", Role: models.RoleOwner}); err != nil {
+		t.Fatal(err)
+	}
+	demoted, err := m.ProvisionOIDC("sub-1", "owner", models.RoleViewer, []string{"@example.com"})
+	if err != nil {
+		t.Fatalf("demotion with another owner: %v", err)
+	}
+	if demoted.Role != models.RoleViewer || len(demoted.Mailboxes) != 1 || demoted.Mailboxes[0] != "@example.com" {
+		t.Errorf("demoted user = %+v", demoted)
+	}
+}
@@ -0,0 +1,181 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mailcat/internal/models"
+	"mailcat/internal/totp"
+)
+
+const (
+	// totpIssuer 认证器应用中显示的发行方
+	totpIssuer = "MailCat"
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// recoveryCodeLength 恢复码的字符数（不含分隔符），每个字符 5 位
+	recoveryCodeLength = 12
+)
+
+var (
+	ErrTOTPEnabled    = errors.New("totp is already enabled")
+	ErrTOTPNotEnabled = errors.New("totp is not enabled")
+	ErrTOTPNotStarted = errors.New("totp setup has not been started")
+	ErrInvalidCode    = errors.New("invalid verification code")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// BeginTOTP 为用户生成新的 TOTP 密钥，验证通过（EnableTOTP）之前不会启用；
+// 返回密钥和用于生成二维码的 otpauth:// 地址
+func (m *Manager) BeginTOTP(user *models.User) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, err := m.db.GetUserTOTP(user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if state == nil {
+		return "", "", fmt.Errorf("user %d not found", user.ID)
+	}
+	if state.Enabled {
+		return "", "", ErrTOTPEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	state.Secret = secret
+	state.LastCounter = 0
+	if err := m.db.SaveUserTOTP(user.ID, state); err != nil {
+		return "", "", err
+	}
+	return secret, totp.ProvisioningURI(totpIssuer, user.Username, secret), nil
+}
+
+// EnableTOTP 使用认证器应用生成的验证码确认绑定并启用 TOTP，返回恢复码（只在此时可见）
+func (m *Manager) EnableTOTP(userID int, code string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, err := m.db.GetUserTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || state.Secret == "" {
+		return nil, ErrTOTPNotStarted
+	}
+	if state.Enabled {
+		return nil, ErrTOTPEnabled
+	}
+	counter, ok := totp.Validate(state.Secret, code, time.Now(), state.LastCounter)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	state.Enabled = true
+	state.LastCounter = counter
+	state.RecoveryCodes = hashes
+	if err := m.db.SaveUserTOTP(userID, state); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor 校验 TOTP 验证码或恢复码，恢复码使用后失效；返回是否使用了恢复码
+func (m *Manager) VerifySecondFactor(userID int, code string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, err := m.db.GetUserTOTP(userID)
+	if err != nil {
+		return false, err
+	}
+	if state == nil || !state.Enabled {
+		return false, ErrTOTPNotEnabled
+	}
+
+	if counter, ok := totp.Validate(state.Secret, code, time.Now(), state.LastCounter); ok {
+		state.LastCounter = counter
+		return false, m.db.SaveUserTOTP(userID, state)
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, stored := range state.RecoveryCodes {
+		if stored == hash {
+			state.RecoveryCodes = append(state.RecoveryCodes[:i:i], state.RecoveryCodes[i+1:]...)
+			return true, m.db.SaveUserTOTP(userID, state)
+		}
+	}
+	return false, ErrInvalidCode
+}
+
+// RegenerateRecoveryCodes 生成新的恢复码，旧的恢复码全部失效
+func (m *Manager) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, err := m.db.GetUserTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || !state.Enabled {
+		return nil, ErrTOTPNotEnabled
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	state.RecoveryCodes = hashes
+	if err := m.db.SaveUserTOTP(userID, state); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RecoveryCodesRemaining 返回未使用的恢复码数量
+func (m *Manager) RecoveryCodesRemaining(userID int) (int, error) {
+	state, err := m.db.GetUserTOTP(userID)
+	if err != nil || state == nil {
+		return 0, err
+	}
+	return len(state.RecoveryCodes), nil
+}
+
+// DisableTOTP 关闭 TOTP 并清除密钥和恢复码
+func (m *Manager) DisableTOTP(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.db.SaveUserTOTP(userID, &models.UserTOTP{RecoveryCodes: []string{}})
+}
+
+// generateRecoveryCodes 生成恢复码，返回明文（xxxx-xxxx-xxxx）和保存到数据库的哈希
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	buf := make([]byte, recoveryCodeLength*5/8)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12]
+		hashes[i] = hashRecoveryCode(raw)
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 忽略大小写、空格和连字符后计算恢复码的 SHA-256；恢复码为 60 位随机数，无需慢哈希
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
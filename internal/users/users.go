@@ -0,0 +1,302 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+	"mailcat/internal/settings"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// BootstrapUsername 数据库中没有用户时，使用配置的管理员密码创建的 owner 账户
+	BootstrapUsername = "admin"
+	// minPasswordLength 用户密码的最短长度
+	minPasswordLength = 8
+	// maxUsernameLength 用户名的最大长度（字符数）
+	maxUsernameLength = 64
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUsernameTaken      = errors.New("username is already taken")
+	ErrLastOwner          = errors.New("at least one owner is required")
+	ErrTOTPRequired       = errors.New("password login is not allowed for users with TOTP")
+)
+
+// Manager 管理后台用户。密码在客户端先做 SHA-256，服务端对该摘要再做 bcrypt 后保存，
+// 因此数据库泄露时无法直接用其中的值登录
+type Manager struct {
+	db *database.DB
+
+	mu        sync.Mutex // 串行化修改，保证用户名不重复且至少保留一个 owner
+	dummyHash []byte     // 用户不存在时也执行一次 bcrypt 比较，避免通过响应时间判断用户名是否存在
+}
+
+// NewManager 创建用户管理器
+func NewManager(db *database.DB) (*Manager, error) {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("mailcat"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return &Manager{db: db, dummyHash: dummyHash}, nil
+}
+
+// Bootstrap 数据库中没有任何用户时，创建名为 admin 的 owner 账户，密码为配置（或运行时设置中保存）的管理员密码。
+// passwordDigest 为密码的 SHA-256 十六进制，返回是否创建了账户
+func (m *Manager) Bootstrap(passwordDigest string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count, err := m.db.CountUsers("")
+	if err != nil || count > 0 {
+		return false, err
+	}
+	if passwordDigest == "" {
+		return false, fmt.Errorf("admin password is required to create the initial owner account")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(passwordDigest), bcrypt.DefaultCost)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash password: %w", err)
+	}
+	user := &models.User{Username: BootstrapUsername, Role: models.RoleOwner, Mailboxes: []string{}}
+	if err := m.db.CreateUser(user, string(hash)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Authenticate 校验用户名和密码的 SHA-256 十六进制（Web 登录时前端提交的值），成功后记录登录时间
+func (m *Manager) Authenticate(username, passwordDigest string) (*models.User, error) {
+	user, err := m.checkPassword(username, passwordDigest)
+	if err != nil {
+		return nil, err
+	}
+	m.touchLogin(user)
+	return user, nil
+}
+
+// AuthenticatePassword 校验用户名和明文密码（IMAP/POP3 登录使用）。这些协议无法提交 TOTP 验证码，
+// 已启用或被要求启用 TOTP 的用户（requireTOTP 为运行时设置 require_totp）在密码正确时返回 ErrTOTPRequired
+func (m *Manager) AuthenticatePassword(username, password string, requireTOTP bool) (*models.User, error) {
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	user, err := m.checkPassword(username, settings.HashPassword(password))
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled || user.TOTPRequired || requireTOTP {
+		return nil, ErrTOTPRequired
+	}
+	m.touchLogin(user)
+	return user, nil
+}
+
+// checkPassword 校验用户名和密码摘要
+func (m *Manager) checkPassword(username, passwordDigest string) (*models.User, error) {
+	user, hash, err := m.db.GetUserByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		bcrypt.CompareHashAndPassword(m.dummyHash, []byte(passwordDigest))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(passwordDigest)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// touchLogin 记录用户的登录时间
+func (m *Manager) touchLogin(user *models.User) {
+	now := time.Now()
+	if err := m.db.TouchUserLogin(user.ID, now); err != nil {
+		log.Printf("Failed to record user login: %v", err)
+	}
+	user.LastLoginAt = &now
+}
+
+// Get 按 ID 返回用户，不存在时返回 nil
+func (m *Manager) Get(id int) (*models.User, error) {
+	return m.db.GetUserByID(id)
+}
+
+// List 返回所有用户
+func (m *Manager) List() ([]models.User, error) {
+	return m.db.ListUsers()
+}
+
+// Create 校验请求并创建用户
+func (m *Manager) Create(req models.CreateUserRequest) (*models.User, error) {
+	username := strings.TrimSpace(req.Username)
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	role, mailboxes, err := normalizeRole(req.Role, req.Mailboxes)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, _, err := m.db.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrUsernameTaken
+	}
+	user := &models.User{Username: username, Role: role, Mailboxes: mailboxes}
+	if err := m.db.CreateUser(user, hash); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Update 修改用户的密码、角色、邮箱或是否强制 TOTP，返回修改后的用户和密码是否被修改；用户不存在时返回 nil
+func (m *Manager) Update(id int, req models.UpdateUserRequest) (*models.User, bool, error) {
+	var hash string
+	if req.Password != nil {
+		var err error
+		if hash, err = hashPassword(*req.Password); err != nil {
+			return nil, false, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.db.GetUserByID(id)
+	if err != nil || user == nil {
+		return nil, false, err
+	}
+
+	role := user.Role
+	if req.Role != nil {
+		role = *req.Role
+	}
+	mailboxes := user.Mailboxes
+	if req.Mailboxes != nil {
+		mailboxes = req.Mailboxes
+	}
+	role, mailboxes, err = normalizeRole(role, mailboxes)
+	if err != nil {
+		return nil, false, err
+	}
+	if user.Role == models.RoleOwner && role != models.RoleOwner {
+		if err := m.checkNotLastOwner(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	user.Role = role
+	user.Mailboxes = mailboxes
+	if req.TOTPRequired != nil {
+		user.TOTPRequired = *req.TOTPRequired
+	}
+	if err := m.db.UpdateUser(user, hash); err != nil {
+		return nil, false, err
+	}
+	return user, hash != "", nil
+}
+
+// Delete 删除用户，不能删除最后一个 owner；用户不存在时返回 false
+func (m *Manager) Delete(id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.db.GetUserByID(id)
+	if err != nil || user == nil {
+		return false, err
+	}
+	if user.Role == models.RoleOwner {
+		if err := m.checkNotLastOwner(); err != nil {
+			return false, err
+		}
+	}
+	return m.db.DeleteUser(id)
+}
+
+// checkNotLastOwner 调用方持有 m.mu
+func (m *Manager) checkNotLastOwner() error {
+	owners, err := m.db.CountUsers(models.RoleOwner)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// hashPassword 校验明文密码的长度，返回其 SHA-256 十六进制的 bcrypt 哈希
+func hashPassword(password string) (string, error) {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(settings.HashPassword(password)), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// validateUsername 用户名只能包含字母、数字和 . _ - @
+func validateUsername(username string) error {
+	if username == "" || utf8.RuneCountInString(username) > maxUsernameLength {
+		return fmt.Errorf("username must be between 1 and %d characters", maxUsernameLength)
+	}
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-', r == '@':
+		default:
+			return fmt.Errorf("username may only contain letters, digits and . _ - @")
+		}
+	}
+	return nil
+}
+
+// normalizeRole 校验角色和邮箱：viewer 至少需要一个邮箱，其他角色的邮箱被清空
+func normalizeRole(role string, mailboxes []string) (string, []string, error) {
+	valid := false
+	for _, r := range models.Roles {
+		if role == r {
+			valid = true
+		}
+	}
+	if !valid {
+		return "", nil, fmt.Errorf("unknown role %q, expected one of %s", role, strings.Join(models.Roles, ", "))
+	}
+	if role != models.RoleViewer {
+		return role, []string{}, nil
+	}
+
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, mailbox := range mailboxes {
+		mailbox = strings.ToLower(strings.TrimSpace(mailbox))
+		if !strings.Contains(mailbox, "@") || strings.ContainsAny(mailbox, ", ") {
+			return "", nil, fmt.Errorf("invalid mailbox %q, expected an address or @domain", mailbox)
+		}
+		if !seen[mailbox] {
+			seen[mailbox] = true
+			result = append(result, mailbox)
+		}
+	}
+	if len(result) == 0 {
+		return "", nil, fmt.Errorf("viewer requires at least one mailbox")
+	}
+	return role, result, nil
+}
@@ -0,0 +1,65 @@
+package users
+
+import (
+	"path/filepath"
+	"testing"
+
+	"mailcat/internal/database"
+	"mailcat/internal/models"
+	"mailcat/internal/settings"
+)
+
+func TestAuthenticatePasswordRefusesTOTPUsers(t *testing.T) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := NewManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(username string) *models.User {
+		user, err := m.Create(models.CreateUserRequest{Username: username, Password: "correct horse", Role: models.RoleAdmin})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	create("plain")
+	enabled := create("enabled")
+	if err := db.SaveUserTOTP(enabled.ID, &models.UserTOTP{Secret: "JBSWY3DPEHPK3PXP", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	required := create("required")
+	requireTOTP := true
+	if _, _, err := m.Update(required.ID, models.UpdateUserRequest{TOTPRequired: &requireTOTP}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username, password string
+		requireTOTP        bool
+		want               error
+	}{
+		{"plain", "correct horse", false, nil},
+		{"plain", "wrong", false, ErrInvalidCredentials},
+		{"plain", "correct horse", true, ErrTOTPRequired},
+		{"enabled", "correct horse", false, ErrTOTPRequired},
+		{"enabled", "wrong", false, ErrInvalidCredentials}, // 密码错误时不透露是否启用了 TOTP
+		{"required", "correct horse", false, ErrTOTPRequired},
+		{"missing", "correct horse", false, ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		user, err := m.AuthenticatePassword(tt.username, tt.password, tt.requireTOTP)
+		if err != tt.want || (err == nil) != (user != nil) {
+			t.Errorf("AuthenticatePassword(%q, %q, %v) = %v, %v, want %v", tt.username, tt.password, tt.requireTOTP, user, err, tt.want)
+		}
+	}
+
+	// Web 登录仍然先校验密码，再要求 TOTP 验证码
+	if _, err := m.Authenticate("enabled", settings.HashPassword("correct horse")); err != nil {
+		t.Errorf("Authenticate with TOTP enabled: %v", err)
+	}
+}
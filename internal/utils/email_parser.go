@@ -1,14 +1,12 @@
 package utils
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime"
-	"mime/multipart"
 	"mime/quotedprintable"
-	"net/mail"
+	"net/textproto"
 	"strings"
 )
 
@@ -21,260 +19,32 @@ type EmailContent struct {
 	To       string `json:"to"`
 }
 
-// ParseEmailContent 解析邮件内容
+// ParseEmailContent 解析邮件内容，headers 为小写键名的邮件头部，rawEmail 为邮件正文
 func ParseEmailContent(rawEmail string, headers map[string]string) (*EmailContent, error) {
-	content := &EmailContent{
-		Subject: headers["subject"],
-		From:    headers["from"],
-		To:      headers["to"],
-	}
-
-	// 检查Content-Type
-	contentType := headers["content-type"]
-	if contentType == "" {
-		// 如果没有Content-Type，尝试直接使用原始内容
-		content.TextBody = rawEmail
-		return content, nil
-	}
-
-	// 解析Content-Type
-	mediaType, params, err := mime.ParseMediaType(contentType)
-	if err != nil {
-		// 如果解析失败，尝试直接使用原始内容
-		content.TextBody = rawEmail
-		return content, nil
-	}
-
-	switch {
-	case strings.HasPrefix(mediaType, "multipart/"):
-		return parseMultipartEmail(rawEmail, mediaType, params)
-	case mediaType == "text/plain":
-		decoded, err := decodeContent(rawEmail, headers)
-		if err != nil {
-			content.TextBody = rawEmail
-		} else {
-			content.TextBody = decoded
-		}
-		return content, nil
-	case mediaType == "text/html":
-		decoded, err := decodeContent(rawEmail, headers)
-		if err != nil {
-			content.HTMLBody = rawEmail
-		} else {
-			content.HTMLBody = decoded
-		}
-		return content, nil
-	default:
-		content.TextBody = rawEmail
-		return content, nil
-	}
-}
-
-// parseMultipartEmail 解析multipart邮件
-func parseMultipartEmail(rawEmail, mediaType string, params map[string]string) (*EmailContent, error) {
-	content := &EmailContent{}
-	
-	boundary := params["boundary"]
-	if boundary == "" {
-		return content, fmt.Errorf("multipart email missing boundary")
-	}
-
-	// 创建multipart reader
-	reader := multipart.NewReader(strings.NewReader(rawEmail), boundary)
-	
-	for {
-		part, err := reader.NextPart()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			continue
-		}
-
-		// 读取part内容
-		partContent, err := io.ReadAll(part)
-		if err != nil {
-			part.Close()
-			continue
-		}
-		part.Close()
-
-		// 获取part的Content-Type
-		partContentType := part.Header.Get("Content-Type")
-		partMediaType, _, _ := mime.ParseMediaType(partContentType)
-
-		// 解码内容
-		decodedContent := string(partContent)
-		
-		// 检查Content-Transfer-Encoding
-		encoding := part.Header.Get("Content-Transfer-Encoding")
-		if encoding != "" {
-			decoded, err := decodeByEncoding(string(partContent), encoding)
-			if err == nil {
-				decodedContent = decoded
-			}
-		}
-
-		// 根据Content-Type分配内容
-		switch partMediaType {
-		case "text/plain":
-			if content.TextBody == "" {
-				content.TextBody = decodedContent
-			}
-		case "text/html":
-			if content.HTMLBody == "" {
-				content.HTMLBody = decodedContent
-			}
-		}
+	header := make(textproto.MIMEHeader, len(headers))
+	for name, value := range headers {
+		header.Set(name, value)
 	}
 
+	content := ParseMIMETreeWithHeader(header, rawEmail).Content()
+	content.Subject = headers["subject"]
+	content.From = headers["from"]
+	content.To = headers["to"]
 	return content, nil
 }
 
-// decodeContent 根据编码解码内容
-func decodeContent(content string, headers map[string]string) (string, error) {
-	encoding := headers["content-transfer-encoding"]
-	if encoding == "" {
-		return content, nil
-	}
-
-	return decodeByEncoding(content, encoding)
-}
-
-// decodeByEncoding 根据指定编码解码内容
-func decodeByEncoding(content, encoding string) (string, error) {
-	encoding = strings.ToLower(strings.TrimSpace(encoding))
-	
-	switch encoding {
-	case "base64":
-		decoded, err := base64.StdEncoding.DecodeString(content)
-		if err != nil {
-			return content, err
-		}
-		return string(decoded), nil
-		
-	case "quoted-printable":
-		reader := quotedprintable.NewReader(strings.NewReader(content))
-		decoded, err := io.ReadAll(reader)
-		if err != nil {
-			return content, err
-		}
-		return string(decoded), nil
-		
-	case "7bit", "8bit", "binary":
-		return content, nil
-		
-	default:
-		return content, nil
-	}
-}
-
 // ParseEmailFromRaw 从原始邮件数据解析
 func ParseEmailFromRaw(rawEmail string) (*EmailContent, error) {
-	// 尝试解析为标准邮件格式
-	msg, err := mail.ReadMessage(strings.NewReader(rawEmail))
+	tree, err := ParseMIMETree(rawEmail)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse email: %w", err)
-	}
-
-	content := &EmailContent{
-		Subject: msg.Header.Get("Subject"),
-		From:    msg.Header.Get("From"),
-		To:      msg.Header.Get("To"),
-	}
-
-	// 读取邮件体
-	body, err := io.ReadAll(msg.Body)
-	if err != nil {
-		return content, err
-	}
-
-	// 获取Content-Type
-	contentType := msg.Header.Get("Content-Type")
-	mediaType, params, err := mime.ParseMediaType(contentType)
-	if err != nil {
-		content.TextBody = string(body)
-		return content, nil
-	}
-
-	switch {
-	case strings.HasPrefix(mediaType, "multipart/"):
-		return parseMultipartFromBody(string(body), mediaType, params)
-	case mediaType == "text/plain":
-		encoding := msg.Header.Get("Content-Transfer-Encoding")
-		decoded, err := decodeByEncoding(string(body), encoding)
-		if err != nil {
-			content.TextBody = string(body)
-		} else {
-			content.TextBody = decoded
-		}
-		return content, nil
-	case mediaType == "text/html":
-		encoding := msg.Header.Get("Content-Transfer-Encoding")
-		decoded, err := decodeByEncoding(string(body), encoding)
-		if err != nil {
-			content.HTMLBody = string(body)
-		} else {
-			content.HTMLBody = decoded
-		}
-		return content, nil
-	default:
-		content.TextBody = string(body)
-		return content, nil
-	}
-}
-
-// parseMultipartFromBody 从邮件体解析multipart内容
-func parseMultipartFromBody(body, mediaType string, params map[string]string) (*EmailContent, error) {
-	content := &EmailContent{}
-	
-	boundary := params["boundary"]
-	if boundary == "" {
-		return content, fmt.Errorf("multipart email missing boundary")
-	}
-
-	reader := multipart.NewReader(strings.NewReader(body), boundary)
-	
-	for {
-		part, err := reader.NextPart()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			continue
-		}
-
-		partContent, err := io.ReadAll(part)
-		if err != nil {
-			part.Close()
-			continue
-		}
-		part.Close()
-
-		partContentType := part.Header.Get("Content-Type")
-		partMediaType, _, _ := mime.ParseMediaType(partContentType)
-
-		decodedContent := string(partContent)
-		encoding := part.Header.Get("Content-Transfer-Encoding")
-		if encoding != "" {
-			decoded, err := decodeByEncoding(string(partContent), encoding)
-			if err == nil {
-				decodedContent = decoded
-			}
-		}
-
-		switch partMediaType {
-		case "text/plain":
-			if content.TextBody == "" {
-				content.TextBody = decodedContent
-			}
-		case "text/html":
-			if content.HTMLBody == "" {
-				content.HTMLBody = decodedContent
-			}
-		}
+		return nil, err
 	}
 
+	content := tree.Content()
+	header := textproto.MIMEHeader(tree.Headers)
+	content.Subject = DecodeHeader(header.Get("Subject"))
+	content.From = DecodeHeader(header.Get("From"))
+	content.To = DecodeHeader(header.Get("To"))
 	return content, nil
 }
 
@@ -316,89 +86,32 @@ func TryParseEmailContent(rawBody, htmlBody string, headersJSON string) (string,
 	return rawBody, htmlBody, fmt.Errorf("multipart email requires raw email data for parsing")
 }
 
-// ParseMIMEContent 解析MIME格式的邮件内容，包含base64解码
+// ParseMIMEContent 解析带头部的完整 MIME 邮件，包含 base64 等传输编码的解码。
+// 没有 multipart 头部的内容（包括去掉了头部的 multipart 正文）原样作为文本正文返回：
+// 这类正文应使用 ParseEmailContent 并传入保存的头部，旧数据见 ParseLegacyMIMEBody
 func ParseMIMEContent(content string) (*EmailContent, error) {
-	result := &EmailContent{}
-	
 	// 规范化换行符
 	content = normalizeLineEndings(content)
-	
-	// 检测MIME边界
+
+	if tree, err := ParseMIMETree(content); err == nil && len(tree.Parts) > 0 {
+		return tree.Content(), nil
+	}
+	return &EmailContent{TextBody: content}, nil
+}
+
+// ParseLegacyMIMEBody 兼容早期版本保存的数据：Worker 提交的 multipart 正文去掉了头部，
+// 且没有提交 Content-Type，只能从第一条边界线推断边界。
+// 只应在没有可用的 Content-Type 时调用；推断不出边界时返回 false
+func ParseLegacyMIMEBody(content string) (*EmailContent, bool) {
+	content = normalizeLineEndings(content)
 	boundary := detectMIMEBoundary(content)
 	if boundary == "" {
-		// 不是multipart格式，直接返回原内容
-		result.TextBody = content
-		return result, nil
+		return nil, false
 	}
-	
-	// 按行分割内容
-	lines := strings.Split(content, "\r\n")
-	
-	var currentPart strings.Builder
-	var currentEncoding string
-	var currentContentType string
-	var inHeaders bool = false
-	var inContent bool = false
-	
-	for _, line := range lines {
-		// 检查是否是边界线
-		if strings.HasPrefix(line, "--"+boundary) {
-			// 处理之前的部分
-			if inContent && currentPart.Len() > 0 {
-				partContent := strings.TrimSpace(currentPart.String())
-				decodedContent, err := decodePartContent(partContent, currentEncoding)
-				if err == nil {
-					assignContentByType(result, decodedContent, currentContentType)
-				}
-			}
-			
-			// 检查是否是结束边界
-			if strings.HasSuffix(line, "--") {
-				break
-			}
-			
-			// 重置状态，开始新的部分
-			currentPart.Reset()
-			currentEncoding = ""
-			currentContentType = ""
-			inHeaders = true
-			inContent = false
-			continue
-		}
-		
-		if inHeaders {
-			if line == "" {
-				// 空行表示头部结束，内容开始
-				inHeaders = false
-				inContent = true
-				continue
-			}
-			
-			// 解析头部信息
-			if strings.HasPrefix(line, "Content-Type:") {
-				currentContentType = strings.TrimSpace(strings.TrimPrefix(line, "Content-Type:"))
-			} else if strings.HasPrefix(line, "Content-Transfer-Encoding:") {
-				currentEncoding = strings.TrimSpace(strings.TrimPrefix(line, "Content-Transfer-Encoding:"))
-			}
-		} else if inContent {
-			// 添加内容行
-			if currentPart.Len() > 0 {
-				currentPart.WriteString("\r\n")
-			}
-			currentPart.WriteString(line)
-		}
-	}
-	
-	// 处理最后一个部分
-	if inContent && currentPart.Len() > 0 {
-		partContent := strings.TrimSpace(currentPart.String())
-		decodedContent, err := decodePartContent(partContent, currentEncoding)
-		if err == nil {
-			assignContentByType(result, decodedContent, currentContentType)
-		}
-	}
-	
-	return result, nil
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": boundary}))
+	return ParseMIMETreeWithHeader(header, content).Content(), true
 }
 
 // detectMIMEBoundary 检测MIME边界标识符
@@ -425,61 +138,25 @@ func detectMIMEBoundary(content string) string {
 	return ""
 }
 
-// isValidBoundary 验证边界标识符是否有效
+// isValidBoundary 验证推断出的边界标识符是否有效，只用于 ParseLegacyMIMEBody。
+// 接受 RFC 2046 的全部 bchars（空格除外），长度为 6-70 个字符。
+// 早期版本只接受字母、数字和 "_-=."，且不限制最大长度：
+// 含 "+"、"/"、":" 等字符的边界（如 "4Sx1y2Z3abz.1704798333/mx.example.com"）推断不出来，
+// 这类旧邮件的正文会被当作纯文本显示；而超过 70 个字符的横线分隔线反而会被误认为边界
 func isValidBoundary(boundary string) bool {
-	// 边界应该只包含字母、数字和一些特殊字符
+	// 要求长度大于 5 且不含空格，避免把签名分隔线（"-- "）等正文内容误认为边界
+	if len(boundary) <= 5 || len(boundary) > 70 {
+		return false
+	}
 	for _, char := range boundary {
 		if !((char >= 'a' && char <= 'z') ||
-			 (char >= 'A' && char <= 'Z') ||
-			 (char >= '0' && char <= '9') ||
-			 char == '_' || char == '-' || char == '=' || char == '.') {
+			(char >= 'A' && char <= 'Z') ||
+			(char >= '0' && char <= '9') ||
+			strings.ContainsRune("'()+_,-./:=?", char)) {
 			return false
 		}
 	}
-	return len(boundary) > 5 // 边界应该有一定长度
-}
-
-// decodePartContent 根据编码类型解码内容
-func decodePartContent(content, encoding string) (string, error) {
-	encoding = strings.ToLower(strings.TrimSpace(encoding))
-	
-	switch encoding {
-	case "base64":
-		// 清理base64字符串（移除换行符和空格）
-		cleanContent := strings.ReplaceAll(content, "\r\n", "")
-		cleanContent = strings.ReplaceAll(cleanContent, "\n", "")
-		cleanContent = strings.ReplaceAll(cleanContent, " ", "")
-		
-		decoded, err := base64.StdEncoding.DecodeString(cleanContent)
-		if err != nil {
-			return content, err
-		}
-		return string(decoded), nil
-	case "quoted-printable":
-		reader := quotedprintable.NewReader(strings.NewReader(content))
-		decoded, err := io.ReadAll(reader)
-		if err != nil {
-			return content, err
-		}
-		return string(decoded), nil
-	default:
-		return content, nil
-	}
-}
-
-// assignContentByType 根据内容类型分配解码后的内容
-func assignContentByType(result *EmailContent, content, contentType string) {
-	contentType = strings.ToLower(strings.TrimSpace(contentType))
-	
-	if strings.Contains(contentType, "text/plain") {
-		if result.TextBody == "" {
-			result.TextBody = content
-		}
-	} else if strings.Contains(contentType, "text/html") {
-		if result.HTMLBody == "" {
-			result.HTMLBody = content
-		}
-	}
+	return true
 }
 
 // normalizeLineEndings 统一将换行符规范化为 \r\n
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// 模糊测试种子：样例邮件以及若干边界情况。运行方式：
+//
+//	go test ./internal/utils -run '^$' -fuzz FuzzParseMIMEContent -fuzztime 30s
+var fuzzSeeds = []string{
+	"",
+	"plain text only",
+	"--\r\n",
+	"--boundary42\r\n\r\n--boundary42--",
+	"--boundary42\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n!!!!\r\n--boundary42--",
+	"Content-Type: multipart/mixed; boundary=x\r\n\r\n--x\r\nContent-Type: multipart/mixed; boundary=x\r\n\r\n--x--",
+	"Content-Type: message/rfc822\r\n\r\nContent-Type: message/rfc822\r\n\r\n",
+	"Subject: =?gb18030?B?!!?=\r\n\r\nbody",
+}
+
+func addFuzzSeeds(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	for _, raw := range loadFixtures(f) {
+		f.Add(raw)
+	}
+}
+
+func FuzzParseMIMEContent(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, content string) {
+		result, err := ParseMIMEContent(content)
+		if err != nil {
+			return
+		}
+		if result == nil {
+			t.Fatal("nil result without error")
+		}
+		// 非 multipart 内容原样（仅规范化换行）作为文本正文返回
+		normalized := normalizeLineEndings(content)
+		if tree, err := ParseMIMETree(normalized); err == nil && len(tree.Parts) > 0 {
+			return
+		}
+		if result.TextBody != normalized || result.HTMLBody != "" {
+			t.Fatalf("non-multipart content altered: %q", content)
+		}
+	})
+}
+
+func FuzzParseLegacyMIMEBody(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, content string) {
+		result, ok := ParseLegacyMIMEBody(content)
+		if ok != (detectMIMEBoundary(normalizeLineEndings(content)) != "") || ok && result == nil {
+			t.Fatalf("ParseLegacyMIMEBody(%q) = %v, %v", content, result, ok)
+		}
+	})
+}
+
+func FuzzParseEmailFromRaw(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, raw string) {
+		content, err := ParseEmailFromRaw(raw)
+		if err != nil {
+			return
+		}
+		if content == nil {
+			t.Fatal("nil content without error")
+		}
+		// 解析结果与 MIME 树保持一致
+		tree, err := ParseMIMETree(raw)
+		if err != nil {
+			t.Fatalf("ParseMIMETree failed after ParseEmailFromRaw succeeded: %v", err)
+		}
+		if got := tree.Content(); got.TextBody != content.TextBody || got.HTMLBody != content.HTMLBody {
+			t.Fatal("ParseEmailFromRaw differs from ParseMIMETree().Content()")
+		}
+	})
+}
+
+func FuzzDecodeQuotedPrintable(f *testing.F) {
+	for _, seed := range []string{"", "hello=\nworld", "caf=C3=A9", "=3D=3d", "bad =ZZ", "trailing =", "line\r\nbreak"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, content string) {
+		decoded, err := DecodeQuotedPrintable(content)
+		if err != nil {
+			if decoded != content {
+				t.Fatalf("error %v but content was modified", err)
+			}
+			return
+		}
+
+		// 编码后再解码应得到换行规范化后的原文
+		if !utf8.ValidString(content) || strings.ContainsRune(content, '\r') {
+			return
+		}
+		var buf bytes.Buffer
+		w := quotedprintable.NewWriter(&buf)
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		roundTrip, err := DecodeQuotedPrintable(buf.String())
+		if err != nil {
+			t.Fatalf("decode of encoded content failed: %v", err)
+		}
+		if want := normalizeLineEndings(content); roundTrip != want {
+			t.Fatalf("round trip mismatch\nwant %q\ngot  %q", want, roundTrip)
+		}
+	})
+}
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 使用 go test ./internal/utils -run TestGolden -update 重新生成期望输出
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/golden")
+
+// goldenPart MIME 树中一个节点的摘要
+type goldenPart struct {
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	Disposition string `json:"disposition,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// goldenResult 一封样例邮件的期望解析结果
+type goldenResult struct {
+	Subject  string       `json:"subject"`
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	TextBody string       `json:"text_body"`
+	HTMLBody string       `json:"html_body"`
+	Parts    []goldenPart `json:"parts"`
+}
+
+func loadFixtures(t testing.TB) map[string]string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", "eml", "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fixtures found in testdata/eml")
+	}
+
+	fixtures := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixtures[strings.TrimSuffix(filepath.Base(file), ".eml")] = string(data)
+	}
+	return fixtures
+}
+
+func TestGoldenCorpus(t *testing.T) {
+	for name, raw := range loadFixtures(t) {
+		name, raw := name, raw
+		t.Run(name, func(t *testing.T) {
+			content, err := ParseEmailFromRaw(raw)
+			if err != nil {
+				t.Fatalf("ParseEmailFromRaw: %v", err)
+			}
+			tree, err := ParseMIMETree(raw)
+			if err != nil {
+				t.Fatalf("ParseMIMETree: %v", err)
+			}
+
+			got := goldenResult{
+				Subject:  content.Subject,
+				From:     content.From,
+				To:       content.To,
+				TextBody: content.TextBody,
+				HTMLBody: content.HTMLBody,
+			}
+			tree.Walk(func(part *MIMEPart) bool {
+				got.Parts = append(got.Parts, goldenPart{
+					Path:        part.Path,
+					ContentType: part.ContentType,
+					Disposition: part.Disposition,
+					Filename:    part.Filename,
+					ContentID:   part.ContentID,
+					Size:        part.Size,
+				})
+				return true
+			})
+
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			encoder.SetEscapeHTML(false)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(got); err != nil {
+				t.Fatal(err)
+			}
+			gotJSON := buf.Bytes()
+
+			goldenFile := filepath.Join("testdata", "golden", name+".json")
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(goldenFile), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(goldenFile, gotJSON, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("read golden file (run with -update to create it): %v", err)
+			}
+			if string(want) != string(gotJSON) {
+				t.Errorf("parse result differs from %s\n--- want\n%s\n--- got\n%s", goldenFile, want, gotJSON)
+			}
+		})
+	}
+}
+
+// TestParseBodyOnly Worker 提交的正文去掉了头部：使用保存的 Content-Type 解析，
+// 以及旧数据仅凭边界推断，都应得到与完整邮件相同的正文
+func TestParseBodyOnly(t *testing.T) {
+	for name, raw := range loadFixtures(t) {
+		name, raw := name, raw
+		t.Run(name, func(t *testing.T) {
+			full, err := ParseEmailFromRaw(raw)
+			if err != nil {
+				t.Fatalf("ParseEmailFromRaw: %v", err)
+			}
+			tree, err := ParseMIMETree(raw)
+			if err != nil {
+				t.Fatalf("ParseMIMETree: %v", err)
+			}
+
+			normalized := normalizeLineEndings(raw)
+			sep := strings.Index(normalized, "\r\n\r\n")
+			if sep < 0 {
+				t.Fatal("fixture has no header/body separator")
+			}
+			body := normalized[sep+4:]
+
+			withHeaders, err := ParseEmailContent(body, map[string]string{"content-type": textproto.MIMEHeader(tree.Headers).Get("Content-Type")})
+			if err != nil {
+				t.Fatalf("ParseEmailContent: %v", err)
+			}
+			results := map[string]*EmailContent{"stored content-type": withHeaders}
+			if len(tree.Parts) > 0 {
+				legacy, ok := ParseLegacyMIMEBody(body)
+				if !ok {
+					t.Fatal("ParseLegacyMIMEBody found no boundary in a multipart body")
+				}
+				results["legacy"] = legacy
+			}
+
+			// 解码前统一了换行，只比较内容本身
+			for path, content := range results {
+				if want, got := normalizeLineEndings(full.HTMLBody), normalizeLineEndings(content.HTMLBody); got != want {
+					t.Errorf("%s: html body mismatch\nwant %q\ngot  %q", path, want, got)
+				}
+				if want, got := normalizeLineEndings(full.TextBody), normalizeLineEndings(content.TextBody); got != want {
+					t.Errorf("%s: text body mismatch\nwant %q\ngot  %q", path, want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestParseMIMEContentDoesNotGuess 没有头部的内容不再推断边界，原样作为文本正文返回
+func TestParseMIMEContentDoesNotGuess(t *testing.T) {
+	body := "--boundary42\r\nContent-Type: text/html\r\n\r\n<p>hi</p>\r\n--boundary42--\r\n"
+	content, err := ParseMIMEContent(body)
+	if err != nil {
+		t.Fatalf("ParseMIMEContent: %v", err)
+	}
+	if content.TextBody != body || content.HTMLBody != "" {
+		t.Errorf("ParseMIMEContent = %+v, want the body unchanged", content)
+	}
+
+	legacy, ok := ParseLegacyMIMEBody(body)
+	if !ok || legacy.HTMLBody != "<p>hi</p>" {
+		t.Errorf("ParseLegacyMIMEBody = %+v, %v", legacy, ok)
+	}
+	if _, ok := ParseLegacyMIMEBody("Thanks\n-- \nLi Lei"); ok {
+		t.Error("ParseLegacyMIMEBody found a boundary in plain text")
+	}
+}
+
+func TestParseMIMEContentFullMessage(t *testing.T) {
+	for name, raw := range loadFixtures(t) {
+		full, err := ParseEmailFromRaw(raw)
+		if err != nil {
+			t.Fatalf("%s: ParseEmailFromRaw: %v", name, err)
+		}
+		content, err := ParseMIMEContent(raw)
+		if err != nil {
+			t.Fatalf("%s: ParseMIMEContent: %v", name, err)
+		}
+		if normalizeLineEndings(content.TextBody) != normalizeLineEndings(full.TextBody) ||
+			normalizeLineEndings(content.HTMLBody) != normalizeLineEndings(full.HTMLBody) {
+			t.Errorf("%s: ParseMIMEContent differs from ParseEmailFromRaw", name)
+		}
+	}
+}
+
+func TestIsValidBoundary(t *testing.T) {
+	tests := []struct {
+		boundary string
+		want     bool
+	}{
+		{"0000000000008f2a3b0612d1c4e5", true},
+		{"----=_NextPart_65F1A2B3_0C4D5E6F_1A2B3C4D", true},
+		{"Apple-Mail=_2E7C3A1B-5D4F-4A6E-8B9C-0D1E2F3A4B5C", true},
+		{"4Sx1y2Z3abz.1704798333/mx.example.com", true},
+		{"a+b/c:d?e'f(g)h,i", true}, // 早期版本不接受的 bchars
+		{strings.Repeat("a", 70), true},
+		{"=_alternative 0035A1B2C1258A7B_=", false}, // 含空格，按正文处理
+		{"short", false},
+		{"abc;def", false},
+		{strings.Repeat("-", 71), false}, // 横线分隔线
+		{"", false},
+		{" signature", false},
+		{"abc<def>ghi", false},
+		{strings.Repeat("a", 71), false},
+	}
+	for _, tt := range tests {
+		if got := isValidBoundary(tt.boundary); got != tt.want {
+			t.Errorf("isValidBoundary(%q) = %v, want %v", tt.boundary, got, tt.want)
+		}
+	}
+}
+
+func TestDetectMIMEBoundary(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain text", "Hello\nWorld", ""},
+		{"signature separator", "Thanks\n-- \nLi Lei", ""},
+		{"dash rule", "Title\n--\nBody", ""},
+		{"closing delimiter", "--boundary42--", "boundary42"},
+		{"preamble", "This is a multi-part message.\n\n--=_Part_1_2.3\nContent-Type: text/plain\n\nhi", "=_Part_1_2.3"},
+	}
+	for _, tt := range tests {
+		if got := detectMIMEBoundary(tt.content); got != tt.want {
+			t.Errorf("%s: detectMIMEBoundary = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsQuotedPrintable(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"plain ascii", "Hello world", false},
+		{"single pattern", "a=3Db", false},
+		{"html attributes", `<a href=3D"x">=E2=80=93</a>`, true},
+		// 只统计固定的几种模式，纯拉丁字母重音字符不会被识别
+		{"latin accents only", "caf=C3=A9 cr=C3=A8me", false},
+		{"lowercase hex", `<p style=3d"x">=e2=80=93</p>`, true},
+		{"base64 padding", "SGVsbG8gd29ybGQ=", false},
+	}
+	for _, tt := range tests {
+		if got := IsQuotedPrintable(tt.content); got != tt.want {
+			t.Errorf("%s: IsQuotedPrintable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeQuotedPrintable(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"soft line break", "hello=\nworld", "helloworld"},
+		{"utf-8 bytes", "caf=C3=A9", "café"},
+		{"lf normalized", "a=3Db\nc", "a=b\r\nc"},
+		{"no encoding", "plain text", "plain text"},
+		{"invalid escape kept", "bad =ZZ escape", "bad =ZZ escape"},
+	}
+	for _, tt := range tests {
+		got, err := DecodeQuotedPrintable(tt.content)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: DecodeQuotedPrintable = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// 远程图片处理策略
+const (
+	RemoteImagesAllow = "allow" // 保留原始地址
+	RemoteImagesBlock = "block" // 移除远程图片地址，防止追踪像素
+	RemoteImagesProxy = "proxy" // 改写为图片代理地址
+)
+
+// SanitizeOptions HTML 清理选项
+type SanitizeOptions struct {
+	RemoteImages  string // allow / block / proxy，为空时等同于 allow
+	ImageProxyURL string // proxy 模式下的代理地址前缀，原始 URL 会以 url 参数附加
+}
+
+// SanitizeReport 记录清理过程中移除或改写的内容
+type SanitizeReport struct {
+	Modified bool           `json:"modified"`
+	Removed  map[string]int `json:"removed"`
+}
+
+func (r *SanitizeReport) add(kind string) {
+	r.Modified = true
+	r.Removed[kind]++
+}
+
+// sanitizerDropWithContent 连同内容一起删除的元素
+var sanitizerDropWithContent = map[string]string{
+	"script":   "scripts",
+	"noscript": "scripts",
+	"template": "scripts",
+	"iframe":   "embeds",
+	"frame":    "embeds",
+	"frameset": "embeds",
+	"object":   "embeds",
+	"embed":    "embeds",
+	"applet":   "embeds",
+	"svg":      "embeds",
+	"math":     "embeds",
+	"select":   "forms",
+	"textarea": "forms",
+	"button":   "forms",
+	"title":    "tags",
+}
+
+// sanitizerVoidDrop 直接删除的空元素
+var sanitizerVoidDrop = map[string]string{
+	"input":  "forms",
+	"base":   "tags",
+	"meta":   "tags",
+	"link":   "tags",
+	"param":  "embeds",
+	"source": "embeds",
+	"track":  "embeds",
+}
+
+// sanitizerAllowedTags 允许保留的元素及其专有属性
+var sanitizerAllowedTags = map[string][]string{
+	"a": {"href", "name", "target"}, "abbr": nil, "address": nil, "article": nil, "aside": nil,
+	"b": nil, "bdi": nil, "bdo": nil, "big": nil, "blockquote": {"cite"}, "body": {"bgcolor", "background", "text", "link", "vlink", "alink"},
+	"br": nil, "caption": nil, "center": nil, "cite": nil, "code": nil, "col": {"span", "width"}, "colgroup": {"span", "width"},
+	"dd": nil, "del": nil, "details": nil, "dfn": nil, "div": nil, "dl": nil, "dt": nil, "em": nil,
+	"figcaption": nil, "figure": nil, "font": {"color", "face", "size"}, "footer": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil, "head": nil, "header": nil, "hr": {"size", "noshade"}, "html": nil,
+	"i": nil, "img": {"src", "alt", "width", "height", "border", "hspace", "vspace"}, "ins": nil, "kbd": nil,
+	"li": {"value", "type"}, "main": nil, "mark": nil, "nav": nil, "ol": {"start", "type", "reversed"}, "p": nil, "pre": nil,
+	"q": {"cite"}, "s": nil, "samp": nil, "section": nil, "small": nil, "span": nil, "strike": nil, "strong": nil, "style": nil,
+	"sub": nil, "summary": nil, "sup": nil, "table": {"border", "cellpadding", "cellspacing", "bgcolor", "background", "summary", "frame", "rules"},
+	"tbody": nil, "td": {"colspan", "rowspan", "bgcolor", "background", "nowrap", "headers", "scope"}, "tfoot": nil,
+	"th": {"colspan", "rowspan", "bgcolor", "background", "nowrap", "headers", "scope"}, "thead": nil, "time": {"datetime"},
+	"tr": {"bgcolor", "background"}, "tt": nil, "u": nil, "ul": {"type"}, "var": nil, "wbr": nil,
+}
+
+// sanitizerGlobalAttrs 所有元素都允许的属性
+var sanitizerGlobalAttrs = map[string]bool{
+	"align": true, "valign": true, "class": true, "dir": true, "height": true, "id": true,
+	"lang": true, "style": true, "title": true, "width": true, "role": true,
+}
+
+// sanitizerURLAttrs 值为 URL 的属性，需要检查协议
+var sanitizerURLAttrs = map[string]bool{
+	"href": true, "src": true, "background": true, "cite": true,
+}
+
+var (
+	cssAtRuleRegex      = regexp.MustCompile(`(?i)@(import|charset|namespace)[^;{}]*;?`)
+	cssDangerousRegex   = regexp.MustCompile(`(?i)(expression\s*\(|javascript\s*:|vbscript\s*:|behavior\s*:|-moz-binding)`)
+	cssImageSetRegex    = regexp.MustCompile(`(?i)image-set\s*\(`)
+	cssDeclarationRegex = regexp.MustCompile(`[^;{}]*`)
+	cssURLRegex         = regexp.MustCompile(`(?i)url\(\s*(['"]?)([^'")]*)(['"]?)\s*\)`)
+	cssCommentRegex     = regexp.MustCompile(`/\*[\s\S]*?\*/`)
+)
+
+// SanitizeHTML 按白名单策略清理邮件 HTML：移除脚本、事件处理器、表单和危险 CSS，
+// 并按选项处理远程图片。返回清理后的 HTML 和移除内容的统计
+func SanitizeHTML(input string, opts SanitizeOptions) (string, *SanitizeReport) {
+	s := &htmlSanitizer{
+		opts:   opts,
+		report: &SanitizeReport{Removed: make(map[string]int)},
+	}
+	return s.run(input), s.report
+}
+
+type htmlSanitizer struct {
+	opts   SanitizeOptions
+	report *SanitizeReport
+	out    strings.Builder
+}
+
+func (s *htmlSanitizer) run(input string) string {
+	z := html.NewTokenizer(strings.NewReader(input))
+
+	skipTag := ""  // 正在跳过内容的元素
+	skipDepth := 0 // 同名元素嵌套深度
+	inStyle := false
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				s.report.add("malformed")
+			}
+			break
+		}
+		token := z.Token()
+
+		if skipTag != "" {
+			switch {
+			case tt == html.StartTagToken && token.Data == skipTag:
+				skipDepth++
+			case tt == html.EndTagToken && token.Data == skipTag:
+				skipDepth--
+				if skipDepth == 0 {
+					skipTag = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.CommentToken, html.DoctypeToken:
+			// 注释可能包含 Outlook 条件注释，直接丢弃
+			continue
+
+		case html.TextToken:
+			if inStyle {
+				s.out.WriteString(s.sanitizeCSS(token.Data, true))
+			} else {
+				s.out.WriteString(html.EscapeString(token.Data))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if kind, ok := sanitizerDropWithContent[token.Data]; ok {
+				s.report.add(kind)
+				if tt == html.StartTagToken {
+					skipTag = token.Data
+					skipDepth = 1
+				}
+				continue
+			}
+			if kind, ok := sanitizerVoidDrop[token.Data]; ok {
+				s.report.add(kind)
+				continue
+			}
+			if token.Data == "form" {
+				// 保留表单内的文本，只移除表单本身
+				s.report.add("forms")
+				continue
+			}
+			allowed, ok := sanitizerAllowedTags[token.Data]
+			if !ok {
+				s.report.add("tags")
+				continue
+			}
+			token.Attr = s.sanitizeAttrs(token.Data, token.Attr, allowed)
+			if token.Data == "style" && tt == html.StartTagToken {
+				inStyle = true
+			}
+			s.out.WriteString(token.String())
+
+		case html.EndTagToken:
+			if token.Data == "style" {
+				inStyle = false
+			}
+			if _, ok := sanitizerAllowedTags[token.Data]; !ok {
+				continue
+			}
+			s.out.WriteString(token.String())
+		}
+	}
+
+	return s.out.String()
+}
+
+// sanitizeAttrs 过滤元素属性
+func (s *htmlSanitizer) sanitizeAttrs(tag string, attrs []html.Attribute, allowed []string) []html.Attribute {
+	result := make([]html.Attribute, 0, len(attrs))
+
+	for _, attr := range attrs {
+		key := strings.ToLower(attr.Key)
+		if strings.HasPrefix(key, "on") {
+			s.report.add("event_handlers")
+			continue
+		}
+		if attr.Namespace != "" || (!sanitizerGlobalAttrs[key] && !containsString(allowed, key)) {
+			s.report.add("attributes")
+			continue
+		}
+
+		switch {
+		case key == "style":
+			attr.Val = s.sanitizeCSS(attr.Val, false)
+			if strings.TrimSpace(attr.Val) == "" {
+				continue
+			}
+		case sanitizerURLAttrs[key]:
+			val, ok := s.sanitizeURL(tag, key, attr.Val)
+			if !ok {
+				continue
+			}
+			attr.Val = val
+		case key == "target":
+			attr.Val = "_blank"
+		}
+		result = append(result, attr)
+	}
+
+	// 链接统一在新窗口打开，且不泄露来源页面
+	if tag == "a" {
+		result = append(result, html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+		if !hasAttr(result, "target") {
+			result = append(result, html.Attribute{Key: "target", Val: "_blank"})
+		}
+	}
+
+	return result
+}
+
+// sanitizeURL 检查 URL 协议，并按策略处理远程图片
+func (s *htmlSanitizer) sanitizeURL(tag, key, raw string) (string, bool) {
+	val := strings.TrimSpace(raw)
+	scheme := urlScheme(val)
+
+	isImage := key == "background" || (tag == "img" && key == "src")
+	switch scheme {
+	case "http", "https":
+		if isImage {
+			return s.remoteImage(val)
+		}
+		return val, true
+	case "":
+		// 相对地址在邮件中没有意义，但也不危险
+		return val, true
+	case "mailto", "tel":
+		if key == "href" {
+			return val, true
+		}
+	case "cid":
+		if isImage {
+			return val, true
+		}
+	case "data":
+		if isImage && strings.HasPrefix(strings.ToLower(val), "data:image/") &&
+			!strings.HasPrefix(strings.ToLower(val), "data:image/svg") {
+			return val, true
+		}
+	}
+
+	s.report.add("urls")
+	return "", false
+}
+
+// remoteImage 按策略处理远程图片地址
+func (s *htmlSanitizer) remoteImage(src string) (string, bool) {
+	switch s.opts.RemoteImages {
+	case RemoteImagesBlock:
+		s.report.add("remote_images")
+		return "", false
+	case RemoteImagesProxy:
+		if s.opts.ImageProxyURL == "" {
+			s.report.add("remote_images")
+			return "", false
+		}
+		s.report.add("proxied_images")
+		sep := "?"
+		if strings.Contains(s.opts.ImageProxyURL, "?") {
+			sep = "&"
+		}
+		return s.opts.ImageProxyURL + sep + "url=" + url.QueryEscape(src), true
+	default:
+		return src, true
+	}
+}
+
+// sanitizeCSS 清理 style 属性或 <style> 元素中的 CSS：移除外部引用的 @ 规则和
+// 包含脚本的声明，并按策略处理 url() 中的远程资源。
+// 先去掉注释并解码转义序列，u\72l( 之类的写法会按 url( 检查
+func (s *htmlSanitizer) sanitizeCSS(css string, block bool) string {
+	css = cssCommentRegex.ReplaceAllString(css, "")
+	css = decodeCSSEscapes(css)
+
+	css = cssAtRuleRegex.ReplaceAllStringFunc(css, func(string) string {
+		s.report.add("css")
+		return ""
+	})
+	css = cssDeclarationRegex.ReplaceAllStringFunc(css, func(decl string) string {
+		if cssDangerousRegex.MatchString(decl) {
+			s.report.add("css")
+			return ""
+		}
+		// image-set() 中的字符串也是图片地址，无法逐个改写，不允许远程图片时整条删除
+		if s.opts.RemoteImages != RemoteImagesAllow && s.opts.RemoteImages != "" && cssImageSetRegex.MatchString(decl) {
+			s.report.add("remote_images")
+			return ""
+		}
+		return decl
+	})
+
+	css = cssURLRegex.ReplaceAllStringFunc(css, func(m string) string {
+		parts := cssURLRegex.FindStringSubmatch(m)
+		val, ok := s.sanitizeURL("img", "src", parts[2])
+		if !ok {
+			return "none"
+		}
+		return "url(" + parts[1] + val + parts[3] + ")"
+	})
+
+	if block {
+		// 防止 CSS 内容提前闭合 <style>
+		css = strings.ReplaceAll(css, "</", `<\/`)
+	} else {
+		css = strings.ReplaceAll(css, "<", "")
+	}
+	return css
+}
+
+// decodeCSSEscapes 解码 CSS 转义序列（\ 后跟 1 到 6 位十六进制数和可选的一个空白，或 \ 后跟任意字符），
+// 使关键字只能以明文出现。引号、反斜杠和控制字符重新编码为十六进制转义，保持字符串的边界不变
+func decodeCSSEscapes(css string) string {
+	if !strings.Contains(css, "\\") {
+		return css
+	}
+	var b strings.Builder
+	for i := 0; i < len(css); {
+		if css[i] != '\\' {
+			b.WriteByte(css[i])
+			i++
+			continue
+		}
+		i++
+		if i == len(css) {
+			break
+		}
+		var r rune
+		switch c := css[i]; {
+		case isHexDigit(c):
+			end := i
+			for end < len(css) && end-i < 6 && isHexDigit(css[end]) {
+				end++
+			}
+			n, _ := strconv.ParseUint(css[i:end], 16, 32)
+			r = rune(n)
+			if r == 0 || r > unicode.MaxRune || (r >= 0xd800 && r <= 0xdfff) {
+				r = unicode.ReplacementChar
+			}
+			i = end
+			// 转义序列后的一个空白（\r\n 视为一个）属于转义本身
+			if strings.HasPrefix(css[i:], "\r\n") {
+				i += 2
+			} else if i < len(css) && strings.IndexByte(" \t\n\r\f", css[i]) >= 0 {
+				i++
+			}
+		case c == '\n' || c == '\r' || c == '\f':
+			// 字符串中的续行
+			i++
+			if c == '\r' && i < len(css) && css[i] == '\n' {
+				i++
+			}
+			continue
+		default:
+			var size int
+			r, size = utf8.DecodeRuneInString(css[i:])
+			i += size
+		}
+		if r == '"' || r == '\'' || r == '\\' || unicode.IsControl(r) {
+			fmt.Fprintf(&b, "\\%x ", r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// urlScheme 提取 URL 协议（小写），忽略用于混淆的控制字符和空白
+func urlScheme(raw string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+	colon := strings.Index(cleaned, ":")
+	if colon <= 0 {
+		return ""
+	}
+	// 冒号出现在路径、查询或片段之后时是相对地址
+	if strings.ContainsAny(cleaned[:colon], "/?#") {
+		return ""
+	}
+	return strings.ToLower(cleaned[:colon])
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttr(attrs []html.Attribute, key string) bool {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string // 输出中必须包含的片段
+		notWant []string // 输出中（不区分大小写）不得包含的片段
+	}{
+		{
+			name:    "script with content",
+			input:   `<p>hi</p><script>alert(1)</script><SCRIPT src="x.js"></SCRIPT>`,
+			want:    []string{"<p>hi</p>"},
+			notWant: []string{"script", "alert"},
+		},
+		{
+			name:    "nested script inside dropped element",
+			input:   `<noscript><p><script>alert(1)</script></p></noscript>ok`,
+			want:    []string{"ok"},
+			notWant: []string{"alert"},
+		},
+		{
+			name:    "event handlers",
+			input:   `<img src="cid:a" onerror="alert(1)"><div OnMouseOver='x()' onclick=y>t</div>`,
+			want:    []string{`<img src="cid:a">`, "<div>t</div>"},
+			notWant: []string{"onerror", "onmouseover", "onclick", "alert"},
+		},
+		{
+			name:    "javascript url",
+			input:   `<a href="javascript:alert(1)">a</a>`,
+			want:    []string{`<a rel="noopener noreferrer" target="_blank">a</a>`},
+			notWant: []string{"javascript"},
+		},
+		{
+			name:    "javascript url with entities",
+			input:   `<a href="jav&#x61;script&colon;alert(1)">a</a><a href="&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;:x">b</a>`,
+			notWant: []string{"javascript", "href"},
+		},
+		{
+			name:    "javascript url with whitespace and case",
+			input:   "<a href=\" \tJaVa\nScRiPt\t:alert(1)\">a</a><a href=\"java\x00script:x\">b</a>",
+			notWant: []string{"script", "href"},
+		},
+		{
+			name:    "vbscript and data urls",
+			input:   `<a href="vbscript:msgbox">a</a><a href="data:text/html,<script>">b</a><img src="data:image/svg+xml,<svg onload=x>">`,
+			notWant: []string{"vbscript", "data:", "svg"},
+		},
+		{
+			name:  "safe urls",
+			input: `<a href="https://example.com/?a=1&amp;b=2">a</a><a href="mailto:x@example.com">m</a><img src="data:image/png;base64,AAAA">`,
+			want:  []string{`href="https://example.com/?a=1&amp;b=2"`, `href="mailto:x@example.com"`, `src="data:image/png;base64,AAAA"`},
+		},
+		{
+			name:    "svg and math",
+			input:   `<svg><script>alert(1)</script><a xlink:href="javascript:x"/></svg><math><mi xlink:href="javascript:y">z</mi></math>after`,
+			want:    []string{"after"},
+			notWant: []string{"svg", "math", "javascript", "alert"},
+		},
+		{
+			name:    "forms and embeds",
+			input:   `<form action="https://evil"><input name=p><button>go</button>text</form><iframe src="https://x"></iframe><object data=x></object>`,
+			want:    []string{"text"},
+			notWant: []string{"form", "input", "button", "iframe", "object", "action"},
+		},
+		{
+			name:    "unknown tags and attributes",
+			input:   `<blink>b</blink><div data-x="1" xmlns:foo="y" formaction="z">d</div>`,
+			want:    []string{"b<div>d</div>"},
+			notWant: []string{"blink", "data-x", "formaction", "xmlns"},
+		},
+		{
+			name:    "style block cannot close early",
+			input:   `<style>p{color:red}</style><script>alert(1)</script>`,
+			want:    []string{"<style>p{color:red}</style>"},
+			notWant: []string{"alert"},
+		},
+		{
+			name:    "style attribute cannot break out",
+			input:   `<div style="color:red;&quot;&gt;&lt;script&gt;">x</div>`,
+			notWant: []string{"<script", `"><`},
+		},
+		{
+			name:    "css expression and behaviours",
+			input:   `<div style="width:expression(alert(1));color:red">a</div><p style="behavior:url(x.htc);-moz-binding:url(y)">b</p>`,
+			want:    []string{`style=";color:red"`},
+			notWant: []string{"expression", "behavior", "binding"},
+		},
+		{
+			name:    "css javascript url",
+			input:   `<div style="background:url(javascript:alert(1))">a</div>`,
+			notWant: []string{"javascript"},
+		},
+		{
+			name:    "css import",
+			input:   `<style>@import url(https://evil/x.css); p{color:red}</style>`,
+			want:    []string{"p{color:red}"},
+			notWant: []string{"import", "evil"},
+		},
+		{
+			name:    "css escapes in expression",
+			input:   `<div style="width:e\78pression(alert(1))">a</div><div style="width:\65 xpression(alert(1))">b</div>`,
+			notWant: []string{"xpression", "alert"},
+		},
+		{
+			name:    "css escapes in javascript url",
+			input:   `<div style="background:url(java\73 cript:alert(1))">a</div><div style="background:url(&quot;j\61vascript:x&quot;)">b</div>`,
+			notWant: []string{"script", "j\\61"},
+		},
+		{
+			name:    "css comments inside keywords",
+			input:   `<div style="width:expr/**/ession(alert(1))">a</div>`,
+			notWant: []string{"ession", "alert"},
+		},
+		{
+			name:  "css escapes for text are kept",
+			input: `<style>li:before{content:"\2022"} q:after{content:"\""}</style>`,
+			want:  []string{`content:"•"`, `content:"\22 "`},
+		},
+	}
+	for _, tt := range tests {
+		got, _ := SanitizeHTML(tt.input, SanitizeOptions{})
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: output %q does not contain %q", tt.name, got, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(strings.ToLower(got), strings.ToLower(notWant)) {
+				t.Errorf("%s: output %q contains %q", tt.name, got, notWant)
+			}
+		}
+	}
+}
+
+func TestSanitizeHTMLRemoteImages(t *testing.T) {
+	input := `<img src="https://tracker.example/p.gif">` +
+		`<table background="http://x.example/bg.png"><tr><td>t</td></tr></table>` +
+		`<div style="background:url('https://x.example/a.png')">a</div>` +
+		`<div style="background:u\72l(https://x.example/b.png)">b</div>` +
+		`<div style="background:\75rl(&quot;https://x.example/c.png&quot;)">c</div>` +
+		`<div style="background-image:image-set(&quot;https://x.example/d.png&quot; 1x)">d</div>` +
+		`<img src="cid:logo@example.com">`
+
+	tests := []struct {
+		name    string
+		opts    SanitizeOptions
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "allow",
+			opts: SanitizeOptions{RemoteImages: RemoteImagesAllow},
+			want: []string{`src="https://tracker.example/p.gif"`, `background="http://x.example/bg.png"`, "url(&#39;https://x.example/a.png&#39;)", "url(https://x.example/b.png)", "image-set("},
+		},
+		{
+			name:    "block",
+			opts:    SanitizeOptions{RemoteImages: RemoteImagesBlock},
+			want:    []string{`src="cid:logo@example.com"`, "background:none"},
+			notWant: []string{"x.example", "tracker.example", "image-set"},
+		},
+		{
+			name:    "proxy",
+			opts:    SanitizeOptions{RemoteImages: RemoteImagesProxy, ImageProxyURL: "/admin/api/proxy/image"},
+			want:    []string{`src="/admin/api/proxy/image?url=https%3A%2F%2Ftracker.example%2Fp.gif"`, "url(&#39;/admin/api/proxy/image?url=https%3A%2F%2Fx.example%2Fa.png&#39;)", "url(/admin/api/proxy/image?url=https%3A%2F%2Fx.example%2Fb.png)", "url(&#34;/admin/api/proxy/image?url=https%3A%2F%2Fx.example%2Fc.png&#34;)"},
+			notWant: []string{`"https://`, "(https://", "image-set"},
+		},
+		{
+			name:    "proxy without url",
+			opts:    SanitizeOptions{RemoteImages: RemoteImagesProxy},
+			notWant: []string{"x.example", "tracker.example"},
+		},
+	}
+	for _, tt := range tests {
+		got, report := SanitizeHTML(input, tt.opts)
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: output %q does not contain %q", tt.name, got, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(got, notWant) {
+				t.Errorf("%s: output %q contains %q", tt.name, got, notWant)
+			}
+		}
+		if tt.opts.RemoteImages == RemoteImagesBlock && report.Removed["remote_images"] == 0 {
+			t.Errorf("%s: report %+v does not count removed remote images", tt.name, report)
+		}
+	}
+}
+
+func TestDecodeCSSEscapes(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`color:red`, `color:red`},
+		{`u\72l(`, `url(`},
+		{`\75 rl(`, `url(`},
+		{`\000075rl(`, `url(`},
+		{"\\75\r\nrl(", `url(`},
+		{`\x\y\z`, `xyz`},
+		{`\e`, `\e `},
+		{`"a\"b"`, `"a\22 b"`},
+		{`'\27'`, `'\27 '`},
+		{`\\`, `\5c `},
+		{`\0`, "\ufffd"},
+		{`\110000`, "\ufffd"},
+		{"a\\\nb", `ab`},
+		{`trailing\`, `trailing`},
+	}
+	for _, tt := range tests {
+		if got := decodeCSSEscapes(tt.in); got != tt.want {
+			t.Errorf("decodeCSSEscapes(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrPartNotFound 邮件中没有匹配的 MIME 部分
+var ErrPartNotFound = errors.New("mime part not found")
+
+// InlinePart 通过 Content-ID 引用的内嵌部分（通常是 HTML 中的图片）
+type InlinePart struct {
+	ContentID   string
+	ContentType string
+	Filename    string
+	Data        []byte
+}
+
+// FindInlinePart 在原始邮件中查找 Content-ID 为 cid 的部分并解码其内容
+func FindInlinePart(rawEmail, cid string) (*InlinePart, error) {
+	tree, err := ParseMIMETree(rawEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	part := tree.FindByContentID(cid)
+	if part == nil {
+		return nil, ErrPartNotFound
+	}
+
+	contentType := part.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &InlinePart{
+		ContentID:   part.ContentID,
+		ContentType: contentType,
+		Filename:    part.Filename,
+		Data:        part.Body,
+	}, nil
+}
+
+// normalizeContentID 去掉 Content-ID 两侧的尖括号和 cid: 前缀，便于比较
+func normalizeContentID(cid string) string {
+	cid = strings.TrimSpace(cid)
+	if len(cid) >= 4 && strings.EqualFold(cid[:4], "cid:") {
+		cid = cid[4:]
+	}
+	return strings.Trim(cid, "<> ")
+}
+
+var cidURLRegex = regexp.MustCompile(`(?i)cid:([^"'\s)>]+)`)
+
+// RewriteCIDReferences 将 HTML 中的 cid: 引用替换为 resolve 返回的地址，
+// resolve 返回空字符串时保留原引用
+func RewriteCIDReferences(htmlBody string, resolve func(cid string) string) string {
+	return cidURLRegex.ReplaceAllStringFunc(htmlBody, func(m string) string {
+		// cid: URL 中的字符可能经过百分号转义（RFC 2392）
+		cid := normalizeContentID(m)
+		if decoded, err := url.PathUnescape(cid); err == nil {
+			cid = decoded
+		}
+		if resolved := resolve(cid); resolved != "" {
+			return resolved
+		}
+		return m
+	})
+}
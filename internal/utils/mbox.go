@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/mail"
+	"time"
+)
+
+// mboxDateLayout mbox "From " 分隔行中使用的 asctime 时间格式
+const mboxDateLayout = "Mon Jan _2 15:04:05 2006"
+
+// MboxWriter 以 mboxrd 格式写入多封邮件：正文中以 "From " 开头（包括已被 > 转义）的行
+// 会再加一个 >，读取时去掉一个即可无损还原
+type MboxWriter struct {
+	w *bufio.Writer
+}
+
+// NewMboxWriter 创建 mbox 写入器，写完后需要调用 Flush
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{w: bufio.NewWriter(w)}
+}
+
+// WriteMessage 写入一封完整邮件，sender 为信封发件人
+func (m *MboxWriter) WriteMessage(sender string, date time.Time, message []byte) error {
+	envelope := "MAILER-DAEMON"
+	if addr, err := mail.ParseAddress(sender); err == nil && addr.Address != "" {
+		envelope = addr.Address
+	}
+	if _, err := m.w.WriteString("From " + envelope + " " + date.UTC().Format(mboxDateLayout) + "\n"); err != nil {
+		return err
+	}
+
+	// mbox 使用 LF 换行
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	endsWithNewline := bytes.HasSuffix(message, []byte("\n"))
+	for len(message) > 0 {
+		line := message
+		if i := bytes.IndexByte(message, '\n'); i >= 0 {
+			line, message = message[:i+1], message[i+1:]
+		} else {
+			message = nil
+		}
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+			if err := m.w.WriteByte('>'); err != nil {
+				return err
+			}
+		}
+		if _, err := m.w.Write(line); err != nil {
+			return err
+		}
+	}
+
+	// 每封邮件以空行结束；邮件本身没有以换行结尾时先补上
+	trailer := "\n"
+	if !endsWithNewline {
+		trailer = "\n\n"
+	}
+	_, err := m.w.WriteString(trailer)
+	return err
+}
+
+// Flush 将缓冲的内容写入底层 Writer
+func (m *MboxWriter) Flush() error {
+	return m.w.Flush()
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMboxWriter(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMboxWriter(&buf)
+	date := time.Date(2024, 3, 1, 9, 5, 7, 0, time.FixedZone("CST", 8*3600))
+
+	messages := []struct {
+		sender  string
+		message string
+	}{
+		{"Alice <alice@example.com>", "Subject: one\r\n\r\nFrom here on\r\n>From quoted\r\n>>From twice\r\n From indented\r\nFromage\r\n"},
+		{"not an address", "Subject: two\n\nno trailing newline"},
+	}
+	for _, msg := range messages {
+		if err := m.WriteMessage(msg.sender, date, []byte(msg.message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "From alice@example.com Fri Mar  1 01:05:07 2024\n" +
+		"Subject: one\n" +
+		"\n" +
+		">From here on\n" +
+		">>From quoted\n" +
+		">>>From twice\n" +
+		" From indented\n" +
+		"Fromage\n" +
+		"\n" +
+		"From MAILER-DAEMON Fri Mar  1 01:05:07 2024\n" +
+		"Subject: two\n" +
+		"\n" +
+		"no trailing newline\n" +
+		"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("mbox =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestMboxWriterRoundTrip(t *testing.T) {
+	// mboxrd：每个以 >*From 开头的行读取时去掉一个 >，即可还原原文
+	original := "Subject: x\n\nFrom a\n>From b\n>>>From c\nplain\n"
+	var buf bytes.Buffer
+	m := NewMboxWriter(&buf)
+	if err := m.WriteMessage("a@example.com", time.Unix(0, 0), []byte(original)); err != nil {
+		t.Fatal(err)
+	}
+	m.Flush()
+
+	lines := bytes.SplitAfter(buf.Bytes(), []byte("\n"))
+	var restored bytes.Buffer
+	for _, line := range lines[1 : len(lines)-2] { // 去掉分隔行和结尾的空行
+		if trimmed := bytes.TrimLeft(line, ">"); len(trimmed) < len(line) && bytes.HasPrefix(trimmed, []byte("From ")) {
+			line = line[1:]
+		}
+		restored.Write(line)
+	}
+	if restored.String() != original {
+		t.Errorf("restored = %q, want %q", restored.String(), original)
+	}
+}
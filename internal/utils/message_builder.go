@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageFields 重建 RFC 5322 邮件所需的字段
+type MessageFields struct {
+	From      string
+	To        string
+	Subject   string
+	Date      time.Time
+	MessageID string
+	Headers   map[string]string // 额外保留的原始头部，键名不区分大小写
+
+	TextBody string
+	HTMLBody string
+
+	// Body 非空时表示已经是 MIME 编码的正文（例如 Worker 提交的去掉头部的 multipart 正文），
+	// 原样写入，ContentType 和 TransferEncoding 为其对应的头部
+	Body             string
+	ContentType      string
+	TransferEncoding string
+}
+
+// 重建时由 BuildMessage 自行生成的头部，不从 Headers 中复制
+var generatedHeaders = map[string]bool{
+	"From":                      true,
+	"To":                        true,
+	"Subject":                   true,
+	"Date":                      true,
+	"Message-Id":                true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+}
+
+// BuildMessage 根据字段构造符合 RFC 5322 的完整邮件，使用 CRLF 换行
+func BuildMessage(fields MessageFields) []byte {
+	var buf bytes.Buffer
+
+	date := fields.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := fields.MessageID
+	if messageID == "" {
+		messageID = generateMessageID(fields.From)
+	}
+
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "From", encodeAddressHeader(fields.From))
+	writeHeader(&buf, "To", encodeAddressHeader(fields.To))
+	writeHeader(&buf, "Subject", encodeHeaderValue(fields.Subject))
+	writeHeader(&buf, "Message-ID", messageID)
+
+	// 按名称排序，保证同一封邮件每次导出的结果一致
+	names := make([]string, 0, len(fields.Headers))
+	extra := make(map[string]string, len(fields.Headers))
+	for name, value := range fields.Headers {
+		canonical := textproto.CanonicalMIMEHeaderKey(name)
+		if generatedHeaders[canonical] || strings.TrimSpace(value) == "" {
+			continue
+		}
+		names = append(names, canonical)
+		extra[canonical] = value
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHeader(&buf, name, encodeHeaderValue(extra[name]))
+	}
+
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	switch {
+	case fields.Body != "":
+		contentType := fields.ContentType
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+		writeHeader(&buf, "Content-Type", contentType)
+		if fields.TransferEncoding != "" {
+			writeHeader(&buf, "Content-Transfer-Encoding", fields.TransferEncoding)
+		}
+		buf.WriteString("\r\n")
+		buf.WriteString(normalizeLineEndings(fields.Body))
+
+	case fields.TextBody != "" && fields.HTMLBody != "":
+		boundary := contentBoundary(fields.TextBody, fields.HTMLBody)
+		writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": boundary}))
+		buf.WriteString("\r\n")
+		writeTextPart(&buf, boundary, "text/plain", fields.TextBody)
+		writeTextPart(&buf, boundary, "text/html", fields.HTMLBody)
+		buf.WriteString("--" + boundary + "--\r\n")
+
+	case fields.HTMLBody != "":
+		writeHeader(&buf, "Content-Type", "text/html; charset=utf-8")
+		writeHeader(&buf, "Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		writeQuotedPrintable(&buf, fields.HTMLBody)
+
+	default:
+		writeHeader(&buf, "Content-Type", "text/plain; charset=utf-8")
+		writeHeader(&buf, "Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		writeQuotedPrintable(&buf, fields.TextBody)
+	}
+
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\r\n")) {
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+// writeHeader 写入一行头部，去掉值中的换行防止头部注入
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	value = strings.Join(strings.Fields(strings.NewReplacer("\r", " ", "\n", " ").Replace(value)), " ")
+	buf.WriteString(name + ": " + value + "\r\n")
+}
+
+// writeTextPart 写入 multipart/alternative 中的一个文本部分
+func writeTextPart(buf *bytes.Buffer, boundary, mediaType, content string) {
+	buf.WriteString("--" + boundary + "\r\n")
+	writeHeader(buf, "Content-Type", mediaType+"; charset=utf-8")
+	writeHeader(buf, "Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+	writeQuotedPrintable(buf, content)
+}
+
+// writeQuotedPrintable 以 quoted-printable 编码写入文本，并以 CRLF 结尾
+func writeQuotedPrintable(buf *bytes.Buffer, content string) {
+	w := quotedprintable.NewWriter(buf)
+	w.Write([]byte(normalizeLineEndings(content)))
+	w.Close()
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\r\n")) {
+		buf.WriteString("\r\n")
+	}
+}
+
+// encodeAddressHeader 编码地址类头部，显示名中的非 ASCII 字符按 RFC 2047 编码
+func encodeAddressHeader(value string) string {
+	if isASCII(value) {
+		return value
+	}
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		return encodeHeaderValue(value)
+	}
+	encoded := make([]string, len(addresses))
+	for i, addr := range addresses {
+		encoded[i] = addr.String()
+	}
+	return strings.Join(encoded, ", ")
+}
+
+// encodeHeaderValue 对包含非 ASCII 字符的头部值进行 RFC 2047 编码
+func encodeHeaderValue(value string) string {
+	if isASCII(value) {
+		return value
+	}
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, "�")
+	}
+	return mime.BEncoding.Encode("utf-8", value)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// generateMessageID 生成 Message-ID，域名取自发件人地址
+func generateMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 && at < len(addr.Address)-1 {
+			domain = addr.Address[at+1:]
+		}
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), randomHex(8), domain)
+}
+
+// contentBoundary 根据正文内容生成分隔符，同一封邮件每次重建的结果完全相同，
+// 便于 IMAP 客户端分段读取
+func contentBoundary(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return "mailcat-" + hex.EncodeToString(h.Sum(nil)[:12])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseBuilt(t *testing.T, raw []byte) *mail.Message {
+	t.Helper()
+	if bytes.Contains(bytes.ReplaceAll(raw, []byte("\r\n"), nil), []byte("\n")) {
+		t.Fatalf("message contains bare LF:\n%q", raw)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v\n%s", err, raw)
+	}
+	return msg
+}
+
+func TestBuildMessageHeaders(t *testing.T) {
+	date := time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("CST", 8*3600))
+	raw := BuildMessage(MessageFields{
+		From:      "张三 <zhang@example.com>",
+		To:        "b@example.com, c@example.com",
+		Subject:   "你好 world",
+		Date:      date,
+		MessageID: "<id-1@example.com>",
+		Headers: map[string]string{
+			"x-mailer":     "Worker",
+			"Reply-To":     "reply@example.com",
+			"subject":      "duplicate subject",
+			"content-type": "text/html",
+			"X-Empty":      " ",
+		},
+		TextBody: "hello\nworld",
+	})
+	msg := parseBuilt(t, raw)
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "你好 world" {
+		t.Errorf("Subject = %q (%v)", subject, err)
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil || from.Name != "张三" || from.Address != "zhang@example.com" {
+		t.Errorf("From = %q (%v)", msg.Header.Get("From"), err)
+	}
+	if got, err := msg.Header.Date(); err != nil || !got.Equal(date) {
+		t.Errorf("Date = %v (%v), want %v", got, err, date)
+	}
+	for name, want := range map[string]string{
+		"To":           "b@example.com, c@example.com",
+		"Message-Id":   "<id-1@example.com>",
+		"X-Mailer":     "Worker",
+		"Reply-To":     "reply@example.com",
+		"Mime-Version": "1.0",
+		"Content-Type": "text/plain; charset=utf-8",
+	} {
+		if got := msg.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	// 生成的头部不会被 Headers 中的同名头部重复，空值被跳过
+	if n := len(msg.Header["Subject"]); n != 1 {
+		t.Errorf("Subject appears %d times", n)
+	}
+	if n := len(msg.Header["Content-Type"]); n != 1 {
+		t.Errorf("Content-Type appears %d times", n)
+	}
+	if _, ok := msg.Header["X-Empty"]; ok {
+		t.Error("empty header was written")
+	}
+	// 额外头部按名称排序
+	if i, j := bytes.Index(raw, []byte("Reply-To:")), bytes.Index(raw, []byte("X-Mailer:")); i < 0 || j < 0 || i > j {
+		t.Errorf("extra headers are not sorted:\n%s", raw)
+	}
+
+	body, _ := io.ReadAll(msg.Body)
+	if string(body) != "hello\r\nworld\r\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestBuildMessageHeaderInjection(t *testing.T) {
+	raw := BuildMessage(MessageFields{
+		From:      "a@example.com\r\nBcc: victim@example.com",
+		To:        "b@example.com\nX-Injected: 1",
+		Subject:   "hi\r\n\r\n<html>body</html>",
+		MessageID: "<id@example.com>\rX-Other: 1",
+		Headers:   map[string]string{"X-Custom": "value\r\nX-Injected: 2"},
+		TextBody:  "text",
+	})
+	msg := parseBuilt(t, raw)
+	for _, name := range []string{"Bcc", "X-Injected", "X-Other"} {
+		if _, ok := msg.Header[name]; ok {
+			t.Errorf("injected header %s was written:\n%s", name, raw)
+		}
+	}
+	if got := msg.Header.Get("Subject"); got != "hi <html>body</html>" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got := msg.Header.Get("X-Custom"); got != "value X-Injected: 2" {
+		t.Errorf("X-Custom = %q", got)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if string(body) != "text\r\n" {
+		t.Errorf("body = %q, header content leaked into the body", body)
+	}
+}
+
+func TestBuildMessageAlternative(t *testing.T) {
+	fields := MessageFields{
+		From:     "a@example.com",
+		To:       "b@example.com",
+		Subject:  "both",
+		TextBody: "plain ünïcode",
+		HTMLBody: "<p>html</p>",
+	}
+	raw := BuildMessage(fields)
+	msg := parseBuilt(t, raw)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+	// 同样的正文生成同样的分隔符
+	if again := BuildMessage(fields); !bytes.Contains(again, []byte(params["boundary"])) {
+		t.Error("boundary is not stable across rebuilds")
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	want := []struct{ mediaType, content string }{
+		{"text/plain", "plain ünïcode"},
+		{"text/html", "<p>html</p>"},
+	}
+	for _, w := range want {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		if got, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); got != w.mediaType {
+			t.Errorf("part type = %q, want %q", got, w.mediaType)
+		}
+		// multipart.Reader 会自动解码 quoted-printable
+		content, _ := io.ReadAll(part)
+		if strings.TrimRight(string(content), "\r\n") != w.content {
+			t.Errorf("%s content = %q, want %q", w.mediaType, content, w.content)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("extra part after alternatives: %v", err)
+	}
+}
+
+func TestBuildMessagePreservesMIMEBody(t *testing.T) {
+	body := "--b1\nContent-Type: text/plain\n\nhi\n--b1--\n"
+	raw := BuildMessage(MessageFields{
+		From:             "a@example.com",
+		To:               "b@example.com",
+		Body:             body,
+		ContentType:      `multipart/mixed; boundary="b1"`,
+		TransferEncoding: "7bit",
+	})
+	msg := parseBuilt(t, raw)
+	if got := msg.Header.Get("Content-Type"); got != `multipart/mixed; boundary="b1"` {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := msg.Header.Get("Content-Transfer-Encoding"); got != "7bit" {
+		t.Errorf("Content-Transfer-Encoding = %q", got)
+	}
+	got, _ := io.ReadAll(msg.Body)
+	if want := strings.ReplaceAll(body, "\n", "\r\n"); string(got) != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestBuildMessageGeneratesMessageID(t *testing.T) {
+	msg := parseBuilt(t, BuildMessage(MessageFields{From: "Alice <alice@example.org>", To: "b@example.com", HTMLBody: "<b>x</b>"}))
+	id := msg.Header.Get("Message-Id")
+	if !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.org>") {
+		t.Errorf("Message-ID = %q, want a generated id at the sender's domain", id)
+	}
+	if msg.Header.Get("Date") == "" {
+		t.Error("Date header is missing")
+	}
+	if got := msg.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// MIMEPart MIME 树中的一个节点。multipart 节点包含子部分，叶子节点保存解码后的内容
+type MIMEPart struct {
+	Path        string              `json:"path"` // IMAP 风格的部分编号，根节点为空，子部分为 1、1.2 等
+	ContentType string              `json:"content_type"`
+	Params      map[string]string   `json:"params,omitempty"`
+	Headers     map[string][]string `json:"headers"`
+	Disposition string              `json:"disposition,omitempty"`
+	Filename    string              `json:"filename,omitempty"`
+	ContentID   string              `json:"content_id,omitempty"`
+	Encoding    string              `json:"encoding,omitempty"`
+	Size        int                 `json:"size"` // 叶子为解码后的字节数，multipart 为原始正文字节数
+	Parts       []*MIMEPart         `json:"parts,omitempty"`
+
+	Body []byte `json:"-"` // 叶子节点按 Content-Transfer-Encoding 解码后的内容
+}
+
+// maxMIMEDepth 递归解析 multipart 的最大深度，防止恶意构造的邮件耗尽资源
+const maxMIMEDepth = 16
+
+var headerWordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// ParseMIMETree 将完整的原始邮件（头部 + 正文）解析为 MIME 树
+func ParseMIMETree(rawEmail string) (*MIMEPart, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(rawEmail))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email: %w", err)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email body: %w", err)
+	}
+	return parseMIMEPart(textproto.MIMEHeader(msg.Header), body, "", 0), nil
+}
+
+// ParseMIMETreeWithHeader 使用单独给出的头部解析邮件正文
+func ParseMIMETreeWithHeader(header textproto.MIMEHeader, body string) *MIMEPart {
+	return parseMIMEPart(header, []byte(body), "", 0)
+}
+
+// parseMIMEPart 递归解析一个 MIME 部分
+func parseMIMEPart(header textproto.MIMEHeader, body []byte, path string, depth int) *MIMEPart {
+	part := &MIMEPart{
+		Path:     path,
+		Headers:  map[string][]string(header),
+		Encoding: strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))),
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType == "" {
+		// RFC 2045：缺失或无法解析的 Content-Type 按 text/plain 处理
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+	part.ContentType = mediaType
+	if len(params) > 0 {
+		part.Params = params
+	}
+
+	if disposition, dispParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		part.Disposition = disposition
+		part.Filename = DecodeHeader(dispParams["filename"])
+	}
+	if part.Filename == "" {
+		part.Filename = DecodeHeader(params["name"])
+	}
+	part.ContentID = normalizeContentID(header.Get("Content-Id"))
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" && depth < maxMIMEDepth:
+		part.Size = len(body)
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for i := 1; ; i++ {
+			child, err := reader.NextRawPart()
+			if err != nil {
+				break
+			}
+			// 截断的邮件读取出错时保留已读取的内容
+			childBody, _ := io.ReadAll(child)
+			part.Parts = append(part.Parts, parseMIMEPart(child.Header, childBody, childPath(path, i), depth+1))
+		}
+
+	case mediaType == "message/rfc822" && depth < maxMIMEDepth:
+		// 退信等场景中内嵌的完整邮件，解码后作为子树解析
+		decoded := decodeTransferEncoding(body, part.Encoding)
+		part.Body = decoded
+		part.Size = len(decoded)
+		if inner, err := mail.ReadMessage(bytes.NewReader(decoded)); err == nil {
+			innerBody, _ := io.ReadAll(inner.Body)
+			part.Parts = []*MIMEPart{parseMIMEPart(textproto.MIMEHeader(inner.Header), innerBody, childPath(path, 1), depth+1)}
+		}
+
+	default:
+		part.Body = decodeTransferEncoding(body, part.Encoding)
+		part.Size = len(part.Body)
+	}
+
+	return part
+}
+
+// childPath 计算子部分的编号
+func childPath(parent string, index int) string {
+	if parent == "" {
+		return strconv.Itoa(index)
+	}
+	return parent + "." + strconv.Itoa(index)
+}
+
+// IsAttachment 判断叶子部分是否为附件（而不是正文）
+func (p *MIMEPart) IsAttachment() bool {
+	if strings.EqualFold(p.Disposition, "attachment") {
+		return true
+	}
+	return p.Filename != "" && !strings.HasPrefix(p.ContentType, "text/")
+}
+
+// Text 返回转换为 UTF-8 的文本内容
+func (p *MIMEPart) Text() string {
+	charset := strings.ToLower(p.Params["charset"])
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return string(p.Body)
+	}
+	if reader, err := charsetReader(charset, bytes.NewReader(p.Body)); err == nil {
+		if decoded, err := io.ReadAll(reader); err == nil {
+			return string(decoded)
+		}
+	}
+	return string(p.Body)
+}
+
+// Walk 深度优先遍历 MIME 树，fn 返回 false 时不再进入该节点的子部分
+func (p *MIMEPart) Walk(fn func(part *MIMEPart) bool) {
+	if !fn(p) {
+		return
+	}
+	for _, child := range p.Parts {
+		child.Walk(fn)
+	}
+}
+
+// FindByContentID 查找 Content-ID 匹配的叶子部分
+func (p *MIMEPart) FindByContentID(cid string) *MIMEPart {
+	want := normalizeContentID(cid)
+	var found *MIMEPart
+	p.Walk(func(part *MIMEPart) bool {
+		if found != nil {
+			return false
+		}
+		if len(part.Parts) == 0 && part.ContentID != "" && part.ContentID == want {
+			found = part
+		}
+		return true
+	})
+	return found
+}
+
+// Content 从 MIME 树中提取正文：取第一个非附件的 text/plain 和 text/html，
+// 不进入内嵌的 message/rfc822 邮件
+func (p *MIMEPart) Content() *EmailContent {
+	content := &EmailContent{}
+	p.Walk(func(part *MIMEPart) bool {
+		if part.ContentType == "message/rfc822" && part.Path != "" {
+			return false
+		}
+		if len(part.Parts) > 0 || part.IsAttachment() {
+			return true
+		}
+		switch part.ContentType {
+		case "text/plain":
+			if content.TextBody == "" {
+				content.TextBody = part.Text()
+			}
+		case "text/html":
+			if content.HTMLBody == "" {
+				content.HTMLBody = part.Text()
+			}
+		}
+		return true
+	})
+	return content
+}
+
+// decodeTransferEncoding 按 Content-Transfer-Encoding 解码内容，解码失败时返回原内容
+func decodeTransferEncoding(data []byte, encoding string) []byte {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// base64 解码器会忽略换行，但不会忽略空格和制表符
+		cleaned := bytes.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, data)
+		decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(cleaned)))
+		if err != nil && len(decoded) == 0 {
+			return data
+		}
+		return decoded
+	case "quoted-printable":
+		decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+		if err != nil && len(decoded) == 0 {
+			return data
+		}
+		return decoded
+	default:
+		return data
+	}
+}
+
+// charsetReader 将指定字符集的内容转换为 UTF-8，支持 GBK、GB2312、Big5 等常见字符集
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// DecodeHeader 解码 RFC 2047 编码的头部值（如主题、附件文件名），支持 GBK 等字符集
+func DecodeHeader(s string) string {
+	if s == "" || !strings.Contains(s, "=?") {
+		return s
+	}
+	if decoded, err := headerWordDecoder.DecodeHeader(s); err == nil {
+		return decoded
+	}
+	return s
+}
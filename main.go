@@ -1,17 +1,40 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
+	"mailcat/internal/audit"
 	"mailcat/internal/config"
 	"mailcat/internal/database"
+	"mailcat/internal/health"
+	"mailcat/internal/imap"
+	"mailcat/internal/ingest"
+	"mailcat/internal/lockout"
+	"mailcat/internal/models"
+	"mailcat/internal/pop3"
+	"mailcat/internal/ratelimit"
 	"mailcat/internal/router"
+	"mailcat/internal/settings"
+	"mailcat/internal/spam"
+	"mailcat/internal/users"
 )
 
 func main() {
+	// 子命令：mailcat import --format mbox|maildir|eml <path>
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+
 	// 加载配置
 	configPath := "config/config.yaml"
 	if len(os.Args) > 1 {
@@ -23,36 +46,351 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// 确保数据库目录存在
-	dbDir := filepath.Dir(cfg.Database.Path)
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		log.Fatalf("Failed to create database directory: %v", err)
+	// 初始化数据库，所有服务停止后才关闭
+	db, err := openDatabase(cfg)
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
 
-	// 初始化数据库
-	db, err := database.NewDB(cfg.Database.Path)
+	// 运行时设置：数据库中保存的值优先于配置文件，修改后立即生效
+	store, err := settings.Load(db, cfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		log.Fatalf("Failed to load settings: %v", err)
 	}
-	defer db.Close()
+
+	// 管理后台用户：首次启动时使用配置的管理员密码创建 owner 账户 admin
+	userManager, err := users.NewManager(db)
+	if err != nil {
+		log.Fatalf("Failed to setup users: %v", err)
+	}
+	created, err := userManager.Bootstrap(store.Get().AdminPasswordHash)
+	if err != nil {
+		log.Fatalf("Failed to create owner account: %v", err)
+	}
+	if created {
+		log.Printf("Created owner account %q with the configured admin password", users.BootstrapUsername)
+	}
+
+	// 垃圾邮件评分管道，阈值跟随运行时设置
+	spamFilter, err := spam.NewPipelineFromConfig(cfg.Spam)
+	if err != nil {
+		log.Fatalf("Failed to setup spam filter: %v", err)
+	}
+	if spamFilter != nil {
+		spamFilter.SetThreshold(store.Get().SpamThreshold)
+		store.OnChange(func(old, updated settings.Settings) {
+			spamFilter.SetThreshold(updated.SpamThreshold)
+		})
+	}
+
+	// 收到 SIGINT/SIGTERM 时取消 ctx，后台任务随之停止
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Worker 推送、批量导入共用的入库流程，IMAP IDLE 通过它接收新邮件通知
+	ingestPipeline := ingest.New(db, spamFilter)
+
+	// 为升级前入库的邮件补充列表摘要，在后台进行以免延迟启动
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		count, err := ingestPipeline.BackfillSummaries(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to backfill email summaries: %v", err)
+		} else if count > 0 {
+			log.Printf("Backfilled summaries for %d emails", count)
+		}
+	}()
+
+	// 就绪检查，IMAP/POP3 启用后再加入监听状态检查
+	checker := newHealthChecker(db, cfg)
+
+	// 审计日志，过期记录按运行时设置的保留天数定期删除
+	auditLogger, err := audit.New(db, cfg.Audit.File)
+	if err != nil {
+		log.Fatalf("Failed to setup audit log: %v", err)
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		auditLogger.Prune(ctx, func() int { return store.Get().AuditRetentionDays })
+	}()
+
+	// 公开 API 限流，未启用时为 nil
+	limiter := newRateLimiter(cfg)
+
+	// 登录失败锁定，管理后台和 IMAP/POP3 共用，换用其他协议或重新连接不会重置计数
+	loginLockout := lockout.New()
 
 	// 设置路由
-	r := router.SetupRouter(db, cfg.API.AuthToken, cfg.Admin.Password)
+	r, err := router.SetupRouter(ctx, &background, db, cfg, ingestPipeline, checker, store, userManager, auditLogger, loginLockout, limiter)
+	if err != nil {
+		log.Fatalf("Failed to setup router: %v", err)
+	}
+
+	// 任一服务异常退出时同样进入关闭流程
+	serveErr := make(chan error, 3)
+
+	// 可选的只读 IMAP 服务
+	var imapServer *imap.Server
+	if cfg.IMAP.Enabled {
+		imapServer, err = newIMAPServer(db, ingestPipeline, userManager, store, loginLockout, auditLogger, cfg)
+		if err != nil {
+			log.Fatalf("Failed to setup IMAP server: %v", err)
+		}
+		go func() {
+			if err := imapServer.ListenAndServe(); err != nil {
+				serveErr <- fmt.Errorf("IMAP server: %w", err)
+			}
+		}()
+		checker.Register("imap", health.Listening(imapServer.Addr))
+		log.Printf("IMAP server listening on %s", cfg.IMAP.Address)
+	}
+
+	// 可选的 POP3 服务
+	var pop3Server *pop3.Server
+	if cfg.POP3.Enabled {
+		pop3Server, err = newPOP3Server(db, userManager, store, loginLockout, auditLogger, cfg)
+		if err != nil {
+			log.Fatalf("Failed to setup POP3 server: %v", err)
+		}
+		go func() {
+			if err := pop3Server.ListenAndServe(); err != nil {
+				serveErr <- fmt.Errorf("POP3 server: %w", err)
+			}
+		}()
+		checker.Register("pop3", health.Listening(pop3Server.Addr))
+		log.Printf("POP3 server listening on %s", cfg.POP3.Address)
+	}
 
 	// 启动服务器
 	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeoutSeconds) * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serveErr <- fmt.Errorf("HTTP server: %w", err)
+		}
+	}()
+
 	log.Printf("Starting MailCat server on %s", addr)
-	log.Printf("Health check: http://%s/health", addr)
+	log.Printf("Health check: http://%s/health/ready", addr)
 	log.Printf("Admin panel: http://%s/admin/login", addr)
 	log.Printf("API endpoints:")
 	log.Printf("  POST /api/v1/emails - Receive email")
 	log.Printf("  GET  /api/v1/emails - List emails")
 	log.Printf("  GET  /api/v1/emails/:id - Get email by ID")
+	log.Printf("  DELETE /api/v1/emails/:id - Move email to trash")
 	log.Printf("Admin endpoints:")
 	log.Printf("  GET  /admin/login - Admin login page")
 	log.Printf("  GET  /admin/dashboard - Admin dashboard")
-	
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	log.Printf("  POST /admin/api/import - Import mbox/maildir/eml upload")
+	log.Printf("  GET  /admin/api/keys - Manage API keys")
+	log.Printf("  GET  /admin/api/audit - Audit log")
+	if cfg.OIDC.Enabled {
+		log.Printf("  GET  /admin/oidc/login - Single sign-on via %s", cfg.OIDC.Issuer)
+	}
+
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down, waiting up to %ds for in-flight requests", cfg.Server.ShutdownTimeoutSeconds)
+	case err := <-serveErr:
+		log.Printf("Failed to run server: %v", err)
+		exitCode = 1
+	}
+	// 停止后台任务；再次收到信号时按默认行为立即退出
+	stop()
+	// 就绪检查立即返回 503，keep-alive 连接上的探测不会再把流量导向正在关闭的实例
+	checker.SetDraining()
+
+	// 先停止接收新请求并等待进行中的请求（例如正在保存的邮件）完成，超时后强制断开
+	drainCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
+	if err := srv.Shutdown(drainCtx); err != nil {
+		log.Printf("HTTP server did not drain in time: %v", err)
+		srv.Close()
+	}
+	cancel()
+	if imapServer != nil {
+		imapServer.Close()
+	}
+	if pop3Server != nil {
+		pop3Server.Close()
+	}
+	background.Wait()
+	if err := auditLogger.Close(); err != nil {
+		log.Printf("Failed to close audit log: %v", err)
+	}
+	if limiter != nil {
+		limiter.Close()
+	}
+
+	// 所有使用数据库的任务都已停止
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	log.Printf("MailCat stopped")
+	os.Exit(exitCode)
+}
+
+// newHealthChecker 创建就绪检查：数据库可写、迁移已完成、磁盘空间充足、前端资源存在
+func newHealthChecker(db *database.DB, cfg *config.Config) *health.Checker {
+	checker := health.New(2 * time.Second)
+	checker.Register("database", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, db.ProbeWrite(ctx)
+	})
+	checker.Register("migrations", func(ctx context.Context) (map[string]interface{}, error) {
+		status, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]interface{}{
+			"version":  status.Version,
+			"expected": status.Expected,
+		}
+		if len(status.MissingColumns) > 0 {
+			details["missing_columns"] = status.MissingColumns
+		}
+		if !status.Current() {
+			return details, fmt.Errorf("database schema is not current")
+		}
+		return details, nil
+	})
+	checker.Register("disk", health.DiskSpace(filepath.Dir(cfg.Database.Path), uint64(cfg.Health.MinFreeDiskMB)<<20))
+	checker.Register("frontend", health.FileExists("./web/dist/index.html"))
+	return checker
+}
+
+// newRateLimiter 根据配置创建公开 API 的限流器，未启用时返回 nil。
+// Redis 不可用时限流器放行请求，不影响就绪检查
+func newRateLimiter(cfg *config.Config) *ratelimit.Limiter {
+	if !cfg.RateLimit.Enabled {
+		return nil
+	}
+	var store ratelimit.Store
+	if cfg.RateLimit.Backend == "redis" {
+		store = ratelimit.NewRedisStore(ratelimit.RedisOptions{
+			Address:   cfg.RateLimit.Redis.Address,
+			Password:  cfg.RateLimit.Redis.Password,
+			DB:        cfg.RateLimit.Redis.DB,
+			KeyPrefix: cfg.RateLimit.Redis.KeyPrefix,
+		})
+	} else {
+		store = ratelimit.NewMemoryStore()
+	}
+	log.Printf("API rate limiting enabled (%s backend)", cfg.RateLimit.Backend)
+
+	rules := make(map[string]map[string]ratelimit.Rule)
+	for group, limits := range map[string]config.RateLimitGroup{
+		ratelimit.GroupIngest: cfg.RateLimit.Ingest,
+		ratelimit.GroupRead:   cfg.RateLimit.Read,
+		ratelimit.GroupWrite:  cfg.RateLimit.Write,
+	} {
+		rules[group] = map[string]ratelimit.Rule{
+			ratelimit.ByKey: {RequestsPerMinute: limits.PerKey.RequestsPerMinute, Burst: limits.PerKey.Burst},
+			ratelimit.ByIP:  {RequestsPerMinute: limits.PerIP.RequestsPerMinute, Burst: limits.PerIP.Burst},
+		}
+	}
+	return ratelimit.New(store, rules)
+}
+
+// newIMAPServer 根据配置创建 IMAP 服务
+func newIMAPServer(db *database.DB, ingestPipeline *ingest.Pipeline, userManager *users.Manager, store *settings.Store, loginLockout *lockout.Lockout, auditLogger *audit.Logger, cfg *config.Config) (*imap.Server, error) {
+	opts := imap.Options{
+		Address:           cfg.IMAP.Address,
+		ImplicitTLS:       cfg.IMAP.ImplicitTLS,
+		AllowInsecureAuth: cfg.IMAP.AllowInsecureAuth,
+		CheckAdmin:        adminChecker(userManager, store),
+		Lockout:           loginLockout,
+		Audit:             auditLogger,
+	}
+	tlsConfig, err := loadTLSConfig(cfg.IMAP.TLSCertFile, cfg.IMAP.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load IMAP TLS certificate: %w", err)
+	}
+	opts.TLSConfig = tlsConfig
+	for _, mailbox := range cfg.IMAP.Mailboxes {
+		opts.Mailboxes = append(opts.Mailboxes, imap.MailboxConfig{
+			Name:    mailbox.Name,
+			Address: mailbox.Address,
+			Token:   mailbox.Token,
+		})
+	}
+	return imap.NewServer(db, ingestPipeline, opts), nil
+}
+
+// newPOP3Server 根据配置创建 POP3 服务，邮箱账户与 IMAP 共用
+func newPOP3Server(db *database.DB, userManager *users.Manager, store *settings.Store, loginLockout *lockout.Lockout, auditLogger *audit.Logger, cfg *config.Config) (*pop3.Server, error) {
+	opts := pop3.Options{
+		Address:           cfg.POP3.Address,
+		ImplicitTLS:       cfg.POP3.ImplicitTLS,
+		AllowInsecureAuth: cfg.POP3.AllowInsecureAuth,
+		CheckAdmin:        adminChecker(userManager, store),
+		Lockout:           loginLockout,
+		Audit:             auditLogger,
+	}
+	tlsConfig, err := loadTLSConfig(cfg.POP3.TLSCertFile, cfg.POP3.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load POP3 TLS certificate: %w", err)
+	}
+	opts.TLSConfig = tlsConfig
+	for _, mailbox := range cfg.IMAP.Mailboxes {
+		opts.Mailboxes = append(opts.Mailboxes, pop3.Mailbox{
+			Name:    mailbox.Name,
+			Address: mailbox.Address,
+			Token:   mailbox.Token,
+		})
+	}
+	return pop3.NewServer(db, opts), nil
+}
+
+// adminChecker IMAP/POP3 的管理员登录：owner 或 admin 用户的用户名和密码。
+// 协议登录无法提交 TOTP 验证码，因此启用或被要求启用 TOTP 的用户（包括运行时设置 require_totp）不能登录
+func adminChecker(userManager *users.Manager, store *settings.Store) func(username, password string) bool {
+	return func(username, password string) bool {
+		user, err := userManager.AuthenticatePassword(username, password, store.Get().RequireTOTP)
+		switch {
+		case err == users.ErrTOTPRequired:
+			log.Printf("Refused IMAP/POP3 login for user %q: TOTP is enabled or required", username)
+		case err != nil && err != users.ErrInvalidCredentials:
+			log.Printf("Failed to authenticate user %q: %v", username, err)
+		}
+		return err == nil && user.HasRole(models.RoleOwner, models.RoleAdmin)
+	}
+}
+
+// loadTLSConfig 加载证书，未配置证书时返回 nil
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// openDatabase 确保数据库目录存在并打开数据库
+func openDatabase(cfg *config.Config) (*database.DB, error) {
+	dbDir := filepath.Dir(cfg.Database.Path)
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create database directory: %w", err)
+	}
+
+	db, err := database.NewDB(cfg.Database.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize database: %w", err)
 	}
-}
\ No newline at end of file
+	return db, nil
+}
@@ -29,7 +29,8 @@ api.interceptors.response.use(
     return response
   },
   (error) => {
-    if (error.response?.status === 401) {
+    // 登录接口的 401 由登录页自行处理，避免刷新页面丢失 TOTP 验证步骤
+    if (error.response?.status === 401 && !error.config?.url?.startsWith('/admin/login')) {
       localStorage.removeItem('admin_session')
       window.location.href = '/admin/login'
     }
@@ -40,8 +41,18 @@ api.interceptors.response.use(
 // API 方法
 export const authAPI = {
   // 登录
-  login: (password) => {
-    return api.post('/admin/login', { password })
+  login: (username, password) => {
+    return api.post('/admin/login', { username, password })
+  },
+
+  // 可用的登录方式（是否启用 OIDC 单点登录）
+  loginMethods: () => {
+    return api.get('/admin/login/methods')
+  },
+
+  // 登录第二步：提交 TOTP 验证码或恢复码
+  loginTOTP: (challenge, code) => {
+    return api.post('/admin/login/totp', { challenge, code })
   },
   
   // 登出